@@ -99,12 +99,16 @@ func (api *API) SetAppConfig(config *service.AppConfig) error {
 	if err := api.appConf.SetAppConfig(config); err != nil {
 		return err
 	}
+	// 缓存参数修改后立即生效
+	service.GetPathCache().Configure(api.appConf)
+	service.GetPrefetcher().Configure(api.appConf)
 	return nil
 }
 
+// GetUserData 获取用户数据, ApiKey 只返回脱敏后的值
 func (api *API) GetUserData() (*service.UData, error) {
 	if api.userData != nil {
-		return api.userData, nil
+		return api.userData.Masked(), nil
 	}
 	return nil, fmt.Errorf("user data is nil")
 }
@@ -117,6 +121,7 @@ func (api *API) SetUserData(userData *service.UData) error {
 	if err := api.userData.StoreUserData(); err != nil {
 		return err
 	}
+	service.GetVectorStore().SetEnabled(api.userData.EmbeddingModel != "")
 	return nil
 }
 
@@ -129,6 +134,32 @@ func (api *API) TestLLM() (string, error) {
 	})
 }
 
+// ExportPromptTemplates 将内置提示词模板导出到配置目录供用户修改, 返回模板所在目录
+func (api *API) ExportPromptTemplates() (string, error) {
+	return service.ExportPromptTemplates()
+}
+
+// GetDailyLLMUsage 获取最近 days 天每天的大模型用量
+func (api *API) GetDailyLLMUsage(days int) ([]*service.UsageTotals, error) {
+	if days <= 0 {
+		return nil, fmt.Errorf("days must be positive")
+	}
+	return service.GetUsageTracker().Daily(days), nil
+}
+
+// GetMonthlyLLMUsage 获取最近 months 个月每月的大模型用量
+func (api *API) GetMonthlyLLMUsage(months int) ([]*service.UsageTotals, error) {
+	if months <= 0 {
+		return nil, fmt.Errorf("months must be positive")
+	}
+	return service.GetUsageTracker().Monthly(months), nil
+}
+
+// GetLLMQuota 获取当前服务商本月的用量与限额
+func (api *API) GetLLMQuota() (*service.QuotaStatus, error) {
+	return service.GetUsageTracker().Quota(api.userData), nil
+}
+
 // ============ 绑定SystemInfo api ============
 
 func (api *API) GetSystemInfo() (*service.SystemInfo, error) {
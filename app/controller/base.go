@@ -2,8 +2,12 @@ package controller
 
 import (
 	"context"
+	"errors"
 )
 
+// ErrNoContext 应用尚未启动(例如在测试中), 无法向前端推送事件
+var ErrNoContext = errors.New("wails context is not ready")
+
 // Base 控制器基类
 type Base struct {
 	ctx context.Context
@@ -13,3 +17,11 @@ type Base struct {
 func (b *Base) setCtx(ctx context.Context) {
 	b.ctx = ctx
 }
+
+// getCtx 获取上下文对象, 应用未启动时(例如测试中)返回空的上下文
+func (b *Base) getCtx() context.Context {
+	if b.ctx == nil {
+		return context.Background()
+	}
+	return b.ctx
+}
@@ -4,13 +4,16 @@ import (
 	"GoSearch/app/dto"
 	"GoSearch/app/service"
 	"GoSearch/app/utils"
+	"context"
 	"errors"
 	"fmt"
 	"github.com/shirou/gopsutil/v3/disk"
 	"github.com/wailsapp/wails/v2/pkg/runtime"
 	"log"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -19,6 +22,9 @@ type DirController struct {
 	pathCache        *service.PathCache
 	isIndexing       bool
 	totalFileIndexed int
+	sessionLock      sync.Mutex
+	sessionCancel    context.CancelFunc // 取消当前检索会话中尚未完成的大模型请求
+	sessionID        uint64             // 当前检索会话的编号, 会话结束时只清理自己的 sessionCancel
 }
 
 type SearchResponse struct {
@@ -27,9 +33,11 @@ type SearchResponse struct {
 }
 
 func NewDirController() *DirController {
-	return &DirController{
+	d := &DirController{
 		pathCache: service.GetPathCache(),
 	}
+	service.GetTransferManager().SetListener(d.onTransfer)
+	return d
 }
 
 // OpenDirectory 打开目录选择器
@@ -106,6 +114,7 @@ func (d *DirController) IndexDir(dirPath string, useCache bool) (*service.DirCon
 		// Cache命中
 		if dirCnt, ok = d.pathCache.Get(dirPath); ok {
 			log.Printf("cache命中")
+			service.GetPrefetcher().Visit(dirCnt)
 			return dirCnt, err
 		}
 	}
@@ -118,10 +127,55 @@ func (d *DirController) IndexDir(dirPath string, useCache bool) (*service.DirCon
 		log.Printf("Cache put error: %v", err)
 		return nil, err
 	}
+	// 增量更新语义检索的向量库
+	service.GetVectorStore().Enqueue(dirCnt)
+	// 后台预取接下来可能打开的文件夹
+	service.GetPrefetcher().Visit(dirCnt)
 
 	return dirCnt, nil
 }
 
+// GetCacheStats 获取文件夹缓存的命中率、淘汰次数与容量等统计信息
+func (d *DirController) GetCacheStats() (*service.CacheStats, error) {
+	return d.pathCache.Stats(), nil
+}
+
+// ResetCacheStats 清空文件夹缓存的统计计数
+func (d *DirController) ResetCacheStats() error {
+	d.pathCache.ResetStats()
+	return nil
+}
+
+// PinDir 将文件夹(收藏或常用)固定在缓存中, 不会被一次性的大量访问挤出
+func (d *DirController) PinDir(dirPath string) error {
+	if dirPath == "" {
+		return fmt.Errorf("path is null")
+	}
+	d.pathCache.Pin(dirPath)
+	return d.storePinnedDirs()
+}
+
+// UnpinDir 取消固定文件夹
+func (d *DirController) UnpinDir(dirPath string) error {
+	d.pathCache.Unpin(dirPath)
+	return d.storePinnedDirs()
+}
+
+// GetPinnedDirs 获取固定在缓存中的文件夹
+func (d *DirController) GetPinnedDirs() ([]string, error) {
+	return d.pathCache.PinnedDirs(), nil
+}
+
+// storePinnedDirs 将固定的文件夹写入配置, 下次启动时生效
+func (d *DirController) storePinnedDirs() error {
+	_, appConf, err := service.EnsureConfigInitialized()
+	if err != nil || appConf == nil {
+		return fmt.Errorf("app config is nil")
+	}
+	appConf.SetPinnedDirs(d.pathCache.PinnedDirs())
+	return appConf.StoreAppConfig()
+}
+
 // IndexFile 查找指定文件
 func (d *DirController) IndexFile(filePath string) (*service.FileSystemEntry, error) {
 	var (
@@ -142,7 +196,7 @@ func (d *DirController) IndexFile(filePath string) (*service.FileSystemEntry, er
 	return &service.FileSystemEntry{
 		Name:    fileInfo.Name(),
 		Path:    filePath,
-		IsDir:   false,
+		IsDir:   fileInfo.IsDir(),
 		Size:    fileInfo.Size(),
 		ModTime: fileInfo.ModTime(),
 		Mode:    fileInfo.Mode(),
@@ -196,6 +250,10 @@ func (d *DirController) SearchItemFromInputInStream(searchParams *dto.SearchPara
 	if searchParams.CurrentPath == "" {
 		return fmt.Errorf("search base directory cannot be empty for this implementation")
 	}
+	// 结果通过事件推送, 没有上下文时 runtime 会直接退出进程
+	if d.ctx == nil {
+		return ErrNoContext
+	}
 
 	if params, err = service.ParseParams(searchParams); err != nil {
 		return err
@@ -228,10 +286,10 @@ func (d *DirController) SearchItemFromLLM(searchParams *dto.SearchParams) (*Sear
 		return nil, fmt.Errorf("search base directory cannot be empty for this implementation")
 	}
 
-	if params, err = service.ParseParamsFromLLM(searchParams.Query); err != nil {
+	// 结合当前窗口的历史对话解析检索条件, 支持"只要PDF"这类追问
+	if params, err = d.interpret(searchParams); err != nil {
 		return nil, err
 	}
-	params.BaseDir = searchParams.CurrentPath
 	start := time.Now()
 	if items, err = service.SearchItems(params); err != nil {
 		return nil, err
@@ -249,10 +307,13 @@ func (d *DirController) SearchItemFromLLMInStream(searchParams *dto.SearchParams
 	if searchParams.CurrentPath == "" {
 		return fmt.Errorf("search base directory cannot be empty for this implementation")
 	}
-	if params, err = service.ParseParamsFromLLM(searchParams.Query); err != nil {
+	// 结果通过事件推送, 没有上下文时 runtime 会直接退出进程
+	if d.ctx == nil {
+		return ErrNoContext
+	}
+	if params, err = d.interpret(searchParams); err != nil {
 		return err
 	}
-	params.BaseDir = searchParams.CurrentPath
 
 	if stream, err = service.SearchItemsInStream(params); err != nil {
 		return err
@@ -268,6 +329,134 @@ func (d *DirController) SearchItemFromLLMInStream(searchParams *dto.SearchParams
 	return nil
 }
 
+// InterpretQuery 仅解析自然语言检索条件而不执行检索, 返回解析出的过滤条件供用户确认或编辑
+func (d *DirController) InterpretQuery(searchParams *dto.SearchParams) (*dto.SearchParams, error) {
+	params, err := d.interpret(searchParams)
+	if err != nil {
+		return nil, err
+	}
+	return params.ToDTO(), nil
+}
+
+// ConfirmSearchParams 使用用户确认(或编辑)后的过滤条件执行检索, 并作为后续追问的基础
+func (d *DirController) ConfirmSearchParams(searchParams *dto.SearchParams) (*SearchResponse, error) {
+	var (
+		params *service.SearchParams
+		items  []*service.FileSystemEntry
+		err    error
+	)
+	if searchParams.CurrentPath == "" {
+		return nil, fmt.Errorf("search base directory cannot be empty for this implementation")
+	}
+	if params, err = service.ParseParams(searchParams); err != nil {
+		return nil, err
+	}
+	params.BaseDir = searchParams.CurrentPath
+	if err = service.GetConversation(searchParams.WindowID).SetParams(params); err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	if items, err = service.SearchItems(params); err != nil {
+		return nil, err
+	}
+	return &SearchResponse{Items: items, DurationNs: time.Since(start)}, nil
+}
+
+// ResetConversation 清空窗口的大模型检索会话, 下一次检索将重新开始
+func (d *DirController) ResetConversation(windowID string) error {
+	service.GetConversation(windowID).Reset()
+	return nil
+}
+
+// RerankSearchResults 使用大模型对检索结果按原始问题重排, 解释内容通过 llm_rerank_stream 事件流式输出
+func (d *DirController) RerankSearchResults(question string, items []*service.FileSystemEntry) (*service.RerankResult, error) {
+	ctx, end := d.newSession()
+	defer end()
+	result, err := service.RerankResults(ctx, question, items, func(chunk string) {
+		if d.ctx != nil {
+			runtime.EventsEmit(d.ctx, "llm_rerank_stream", chunk)
+		}
+	})
+	if d.ctx != nil {
+		// 标记结束
+		runtime.EventsEmit(d.ctx, "llm_rerank_stream", nil)
+	}
+	return result, err
+}
+
+// CancelSearch 取消当前检索会话中尚未完成的大模型请求
+func (d *DirController) CancelSearch() error {
+	d.sessionLock.Lock()
+	defer d.sessionLock.Unlock()
+	if d.sessionCancel != nil {
+		d.sessionCancel()
+		d.sessionCancel = nil
+	}
+	return nil
+}
+
+// newSession 开始新的检索会话, 同时取消上一次尚未完成的请求; 请求结束后需调用返回的 end 释放会话
+func (d *DirController) newSession() (ctx context.Context, end func()) {
+	d.sessionLock.Lock()
+	defer d.sessionLock.Unlock()
+	if d.sessionCancel != nil {
+		d.sessionCancel()
+	}
+	ctx, cancel := context.WithCancel(d.getCtx())
+	d.sessionID++
+	id := d.sessionID
+	d.sessionCancel = cancel
+	return ctx, func() {
+		d.sessionLock.Lock()
+		if d.sessionID == id {
+			d.sessionCancel = nil
+		}
+		d.sessionLock.Unlock()
+		cancel()
+	}
+}
+
+// interpret 结合会话历史解析检索条件, 并通过事件将解析结果展示给用户
+func (d *DirController) interpret(searchParams *dto.SearchParams) (*service.SearchParams, error) {
+	ctx, end := d.newSession()
+	defer end()
+	params, err := service.GetConversation(searchParams.WindowID).Refine(ctx, searchParams.Query)
+	if err != nil {
+		return nil, err
+	}
+	params.BaseDir = searchParams.CurrentPath
+	if d.ctx != nil {
+		runtime.EventsEmit(d.ctx, "llm_interpreted", params.ToDTO())
+	}
+	return params, nil
+}
+
+// SearchItemSemantic 语义检索: 合并关键字检索与向量检索的结果
+func (d *DirController) SearchItemSemantic(searchParams *dto.SearchParams) (*SearchResponse, error) {
+	var (
+		params *service.SearchParams
+		items  []*service.FileSystemEntry
+		err    error
+	)
+	if searchParams.CurrentPath == "" {
+		return nil, fmt.Errorf("search base directory cannot be empty for this implementation")
+	}
+
+	start := time.Now()
+	if params, err = service.ParseParams(searchParams); err != nil {
+		return nil, err
+	}
+	if params.BaseDir == "" {
+		params.BaseDir = searchParams.CurrentPath
+	}
+	if items, err = service.HybridSearch(d.getCtx(), params, searchParams.Query); err != nil {
+		return nil, err
+	}
+
+	return &SearchResponse{Items: items, DurationNs: time.Since(start)}, nil
+}
+
 // GetRetrieveDes 文件检索说明
 func (d *DirController) GetRetrieveDes() (string, error) {
 	return runtime.MessageDialog(d.ctx, runtime.MessageDialogOptions{
@@ -285,49 +474,370 @@ func (d *DirController) GetRetrieveDes() (string, error) {
 	})
 }
 
-// CreateItem TODO: 创建文件夹/文件
-func (d *DirController) CreateItem(dirPath string, dirName string) error {
+// CreateItem 新建文件或文件夹, 名称可以包含多级路径, 已存在同名项目时自动重命名, 返回实际创建的路径
+func (d *DirController) CreateItem(params *dto.CreateItemParams) (string, error) {
+	if params == nil {
+		return "", fmt.Errorf("params is null")
+	}
+	result, err := service.CreateItem(params.DirPath, params.Name, service.CreateOptions{
+		IsDir:    params.IsDir,
+		Template: params.Template,
+	})
+	if err != nil {
+		log.Printf("CreateItem error: %v", err)
+		return "", err
+	}
+	// 新建了中间文件夹时记录最上层的文件夹, 撤销时连同其中新建的项目一起移到回收站
+	service.GetJournal().Record(service.JournalCreate, "", result.Created, "")
+	// 父文件夹(以及多级路径中已存在的中间文件夹)的内容发生了变化
+	d.pathCache.Remove(params.DirPath)
+	for dir := filepath.Dir(result.Path); len(dir) > len(filepath.Clean(params.DirPath)); dir = filepath.Dir(dir) {
+		d.pathCache.Remove(dir)
+	}
+	return result.Path, nil
+}
+
+// CreateFolder 新建文件夹, 已存在同名项目时返回错误
+func (d *DirController) CreateFolder(dirPath string, dirName string) error {
+	result, err := d.createFolder(dirPath, dirName)
+	if err != nil {
+		return err
+	}
+	service.GetJournal().Record(service.JournalCreate, "", result.Created, "")
 	return nil
 }
 
-// RenameItem 重命名文件夹/文件
+func (d *DirController) createFolder(dirPath string, dirName string) (*service.CreateResult, error) {
+	result, err := service.CreateItem(dirPath, dirName, service.CreateOptions{IsDir: true, KeepName: true})
+	if err != nil {
+		log.Printf("CreateFolder error: %v", err)
+		return nil, err
+	}
+	d.pathCache.Remove(dirPath)
+	return result, nil
+}
+
+// GetFileTemplates 获取新建文件时可用的模板
+func (d *DirController) GetFileTemplates() ([]*service.FileTemplate, error) {
+	return service.FileTemplates()
+}
+
+// RenameItem 重命名文件夹/文件, 已存在同名项目时返回错误, 由用户确认后调用 RenameItemReplace
 func (d *DirController) RenameItem(path string, newName string) error {
-	if path == "" {
-		return fmt.Errorf("path is null")
+	return d.renameJournaled(path, newName, false)
+}
+
+// RenameItemReplace 重命名并替换已存在的同名文件, 被替换的文件移到回收站
+func (d *DirController) RenameItemReplace(path string, newName string) error {
+	return d.renameJournaled(path, newName, true)
+}
+
+func (d *DirController) renameJournaled(path string, newName string, overwrite bool) error {
+	result, err := d.rename(path, newName, overwrite)
+	if err != nil || result.Path == result.NewPath {
+		return err
 	}
-	var (
-		sysInfo *service.SystemInfo
-		dirPath string
-		dirCnt  *service.DirContent
-		err     error
-	)
-	sysInfo = service.GetSysInfoInstance()
-	dirPath, _ = utils.GetParentPath(sysInfo.OS, path)
+	service.GetJournal().RecordRename(result)
+	return nil
+}
 
-	// 为了防止数据不一致性, 直接从cache中删除父文件夹条目
-	dirCnt = d.pathCache.Remove(dirPath)
-	if err = dirCnt.RenameItem(path, dirPath, newName); err != nil {
+func (d *DirController) rename(path string, newName string, overwrite bool) (*service.RenameResult, error) {
+	result, err := service.RenameItem(path, newName, overwrite)
+	if err != nil {
 		log.Printf("RenameItem error: %v", err)
+		return nil, err
+	}
+	if result.Path == result.NewPath {
+		return result, nil
+	}
+
+	// 就地更新父文件夹的缓存条目, 不再整个丢弃
+	dirPath, _ := utils.GetParentPath(service.GetSysInfoInstance().OS, result.Path)
+	if dirPath == "" {
+		dirPath = filepath.Dir(result.Path)
+	}
+	d.pathCache.UpdateRenamed(dirPath, result)
+	return result, nil
+}
+
+// PreviewBatchRename 预览批量重命名的结果, 冲突的项目会标出原因
+func (d *DirController) PreviewBatchRename(params *dto.BatchRenameParams) ([]*service.RenamePreview, error) {
+	return service.PreviewBatchRename(params)
+}
+
+// BatchRename 批量重命名, 有冲突时不做任何修改并返回预览; 整个批量作为一个操作撤销
+func (d *DirController) BatchRename(params *dto.BatchRenameParams) ([]*service.RenamePreview, error) {
+	previews, err := service.BatchRename(params)
+	if err != nil {
+		log.Printf("BatchRename error: %v", err)
+		return previews, err
+	}
+	for _, preview := range previews {
+		if preview.Changed {
+			d.pathCache.Remove(filepath.Dir(preview.Path))
+			d.pathCache.Remove(preview.Path)
+		}
+	}
+	service.GetJournal().RecordBatch(previews)
+	return previews, nil
+}
+
+// MoveItem 将文件夹/文件移动到目标文件夹下, 目标位置已存在同名项目时返回错误, 可以跨分区移动
+func (d *DirController) MoveItem(path string, targetDir string) error {
+	target, err := d.moveItem(path, targetDir)
+	if err != nil {
 		return err
 	}
+	service.GetJournal().Record(service.JournalMove, path, target, "")
 	return nil
 }
 
-// DeleteItem 删除文件夹/文件
-func (d *DirController) DeleteItem(path string) error {
-	if path == "" {
-		return fmt.Errorf("path is null")
+func (d *DirController) moveItem(path string, targetDir string) (string, error) {
+	if path == "" || targetDir == "" {
+		return "", fmt.Errorf("path is null")
 	}
 	var (
 		sysInfo = service.GetSysInfoInstance()
 		dirPath string
-		dirCnt  *service.DirContent
-		err     error
+		name    string
+		target  string
 	)
-	dirPath, _ = utils.GetParentPath(sysInfo.OS, path)
-	dirCnt = d.pathCache.Remove(dirPath)
-	if err = dirCnt.DeleteItem(path); err != nil {
+	dirPath, name = utils.GetParentPath(sysInfo.OS, path)
+	target = filepath.Join(targetDir, name)
+	// 源文件夹与目标文件夹的内容都发生了变化
+	d.pathCache.Remove(dirPath)
+	d.pathCache.Remove(targetDir)
+	// 不在同一分区时先复制再删除
+	if err := service.MovePath(path, target); err != nil {
+		log.Printf("MoveItem error: %v", err)
+		return "", err
+	}
+	return target, nil
+}
+
+// DeleteItem 将文件夹/文件移到回收站, 可以通过 RestoreTrashItem 恢复
+func (d *DirController) DeleteItem(path string) (*service.TrashItem, error) {
+	item, err := d.deleteItem(path)
+	if err != nil {
+		return nil, err
+	}
+	service.GetJournal().Record(service.JournalTrash, filepath.Clean(path), "", item.ID)
+	return item, nil
+}
+
+func (d *DirController) deleteItem(path string) (*service.TrashItem, error) {
+	item, err := service.MoveToTrash(path)
+	if err != nil {
+		log.Printf("DeleteItem error: %v", err)
+		return nil, err
+	}
+	d.pathCache.Remove(filepath.Dir(filepath.Clean(path)))
+	d.pathCache.Remove(path)
+	return item, nil
+}
+
+// DeletePermanently 不经过回收站直接删除, recursive 为 true 时删除文件夹及其中的所有内容
+func (d *DirController) DeletePermanently(path string, recursive bool) error {
+	if err := service.DeletePermanently(path, recursive); err != nil {
+		log.Printf("DeletePermanently error: %v", err)
 		return err
 	}
+	d.pathCache.Remove(filepath.Dir(filepath.Clean(path)))
+	d.pathCache.Remove(path)
 	return nil
 }
+
+// ListTrash 列出回收站中的项目
+func (d *DirController) ListTrash() ([]*service.TrashItem, error) {
+	return service.ListTrash()
+}
+
+// RestoreTrashItem 将回收站中的项目恢复到原来的位置, 返回恢复后的路径
+func (d *DirController) RestoreTrashItem(id string) (string, error) {
+	path, err := service.RestoreTrashItem(id)
+	if err != nil {
+		log.Printf("RestoreTrashItem error: %v", err)
+		return "", err
+	}
+	d.pathCache.Remove(filepath.Dir(path))
+	return path, nil
+}
+
+// DeleteTrashItem 从回收站中彻底删除一个项目
+func (d *DirController) DeleteTrashItem(id string) error {
+	return service.DeleteTrashItem(id)
+}
+
+// EmptyTrash 清空回收站
+func (d *DirController) EmptyTrash() error {
+	return service.EmptyTrash()
+}
+
+// CopyItems 在后台将文件/文件夹复制到目标文件夹, 进度通过 transfer_progress 事件推送
+func (d *DirController) CopyItems(params *dto.TransferParams) (*service.TransferJob, error) {
+	if params == nil {
+		return nil, fmt.Errorf("params is null")
+	}
+	return service.GetTransferManager().Submit(service.TransferCopy, params.Sources, params.TargetDir, params.Policy)
+}
+
+// MoveItems 在后台将文件/文件夹移动到目标文件夹, 跨分区时先复制再删除
+func (d *DirController) MoveItems(params *dto.TransferParams) (*service.TransferJob, error) {
+	if params == nil {
+		return nil, fmt.Errorf("params is null")
+	}
+	return service.GetTransferManager().Submit(service.TransferMove, params.Sources, params.TargetDir, params.Policy)
+}
+
+// GetTransfers 获取复制/移动任务队列
+func (d *DirController) GetTransfers() ([]*service.TransferJob, error) {
+	return service.GetTransferManager().Jobs(), nil
+}
+
+// PauseTransfer 暂停复制/移动任务
+func (d *DirController) PauseTransfer(id string) error {
+	return service.GetTransferManager().Pause(id)
+}
+
+// ResumeTransfer 继续暂停的任务
+func (d *DirController) ResumeTransfer(id string) error {
+	return service.GetTransferManager().Resume(id)
+}
+
+// CancelTransfer 取消任务, 已完成的文件保留
+func (d *DirController) CancelTransfer(id string) error {
+	return service.GetTransferManager().Cancel(id)
+}
+
+// ResolveTransferConflict 处理任务中等待用户选择的冲突: skip, overwrite 或 keep_both
+func (d *DirController) ResolveTransferConflict(id string, policy string, applyToAll bool) error {
+	return service.GetTransferManager().ResolveConflict(id, policy, applyToAll)
+}
+
+// ClearTransfers 从队列中移除已结束的任务
+func (d *DirController) ClearTransfers() error {
+	service.GetTransferManager().Clear()
+	return nil
+}
+
+// onTransfer 推送任务进度, 任务结束后使源文件夹与目标文件夹的缓存失效
+func (d *DirController) onTransfer(job *service.TransferJob) {
+	if job.Finished() {
+		d.pathCache.Remove(job.TargetDir)
+		for _, path := range job.Results {
+			d.pathCache.Remove(path)
+		}
+		if job.Op == service.TransferMove {
+			for _, path := range job.Sources {
+				d.pathCache.Remove(path)
+				d.pathCache.Remove(filepath.Dir(path))
+			}
+		}
+	}
+	if d.ctx != nil {
+		runtime.EventsEmit(d.ctx, "transfer_progress", job)
+	}
+}
+
+// Undo 撤销最近一次重命名、移动、新建或删除操作, 项目在操作之后被改动过时返回错误且不做修改
+func (d *DirController) Undo() (*service.JournalEntry, error) {
+	entry, err := service.GetJournal().Undo()
+	if err != nil {
+		log.Printf("Undo error: %v", err)
+		return entry, err
+	}
+	d.invalidate(entry)
+	return entry, nil
+}
+
+// Redo 重做最近一次撤销的操作
+func (d *DirController) Redo() (*service.JournalEntry, error) {
+	entry, err := service.GetJournal().Redo()
+	if err != nil {
+		log.Printf("Redo error: %v", err)
+		return entry, err
+	}
+	d.invalidate(entry)
+	return entry, nil
+}
+
+// History 获取可撤销的操作日志, 最新的在前, 已撤销的操作可以重做
+func (d *DirController) History() ([]*service.JournalEntry, error) {
+	return service.GetJournal().History(), nil
+}
+
+// invalidate 使操作涉及的路径及其父文件夹的缓存失效
+func (d *DirController) invalidate(entry *service.JournalEntry) {
+	for _, path := range []string{entry.Source, entry.Target} {
+		if path != "" {
+			d.pathCache.Remove(path)
+			d.pathCache.Remove(filepath.Dir(path))
+		}
+	}
+	for _, item := range entry.Items {
+		d.invalidate(item)
+	}
+}
+
+// PlanFileOperations 根据自然语言指令生成文件操作计划, 计划只列出受影响的路径, 需要用户确认后才会执行
+func (d *DirController) PlanFileOperations(instruction string, currentPath string) (*service.AgentPlan, error) {
+	if currentPath == "" {
+		return nil, fmt.Errorf("current path cannot be empty")
+	}
+	ctx, end := d.newSession()
+	defer end()
+	return service.GetFileAgent().Plan(ctx, instruction, currentPath)
+}
+
+// ApproveFileOperations 执行用户确认后的计划
+func (d *DirController) ApproveFileOperations(planID string) (*service.AgentPlan, error) {
+	return service.GetFileAgent().Execute(planID, agentOperator{d})
+}
+
+// RejectFileOperations 放弃用户未确认的计划
+func (d *DirController) RejectFileOperations(planID string) error {
+	return service.GetFileAgent().Reject(planID)
+}
+
+// UndoFileOperations 撤销已执行的计划
+func (d *DirController) UndoFileOperations(planID string) (*service.AgentPlan, error) {
+	return service.GetFileAgent().Undo(planID, agentOperator{d})
+}
+
+// GetFileOperationLog 获取已执行计划的操作日志
+func (d *DirController) GetFileOperationLog() ([]*service.AgentPlan, error) {
+	return service.GetFileAgent().History(), nil
+}
+
+// agentOperator 执行文件操作助手的步骤, 与界面上的操作使用相同的逻辑但不写入操作日志;
+// 计划由 FileAgent 自己记录并整体撤销, 避免同一操作可以被撤销两次
+type agentOperator struct {
+	d *DirController
+}
+
+func (o agentOperator) RenameItem(path string, newName string) error {
+	_, err := o.d.rename(path, newName, false)
+	return err
+}
+
+func (o agentOperator) MoveItem(path string, targetDir string) error {
+	_, err := o.d.moveItem(path, targetDir)
+	return err
+}
+
+func (o agentOperator) CreateFolder(dirPath string, dirName string) error {
+	_, err := o.d.createFolder(dirPath, dirName)
+	return err
+}
+
+func (o agentOperator) DeleteItem(path string) (*service.TrashItem, error) {
+	return o.d.deleteItem(path)
+}
+
+func (o agentOperator) DeletePermanently(path string, recursive bool) error {
+	return o.d.DeletePermanently(path, recursive)
+}
+
+func (o agentOperator) RestoreTrashItem(id string) (string, error) {
+	return o.d.RestoreTrashItem(id)
+}
@@ -2,13 +2,9 @@ package controller
 
 import (
 	"GoSearch/app/service"
-	"GoSearch/app/utils"
 	"errors"
-	"fmt"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
 	"os"
-	"os/exec"
-	"strings"
-	"syscall"
 )
 
 type FileController struct {
@@ -17,53 +13,102 @@ type FileController struct {
 }
 
 func NewFileController() *FileController {
-	return &FileController{
+	f := &FileController{
 		sysInfo: service.GetSysInfoInstance(),
 	}
+	service.GetThumbnailService().SetListener(f.onThumbnail)
+	service.SetOpenerListener(f.onOpenFailed)
+	return f
 }
 
+// OpenFile 使用系统默认的应用打开文件或文件夹
 func (f *FileController) OpenFile(filePath string) error {
-	var (
-		cmd *exec.Cmd
-		err error
-	)
-	// 1.检查文件是否存在
-	if _, err = os.Stat(filePath); err != nil {
+	if err := checkPath(filePath); err != nil {
+		return err
+	}
+	return service.OpenPath(filePath)
+}
+
+// ListApplications 列出可以打开该文件的应用, 默认应用在最前
+func (f *FileController) ListApplications(filePath string) ([]*service.Application, error) {
+	if err := checkPath(filePath); err != nil {
+		return nil, err
+	}
+	return service.ListApplications(filePath)
+}
+
+// OpenFileWith 使用指定的应用打开文件, appID 为 ListApplications 返回的 ID
+func (f *FileController) OpenFileWith(filePath, appID string) error {
+	if err := checkPath(filePath); err != nil {
+		return err
+	}
+	return service.OpenWith(filePath, appID)
+}
+
+// RevealFile 在系统的文件管理器中显示并选中文件
+func (f *FileController) RevealFile(filePath string) error {
+	if err := checkPath(filePath); err != nil {
+		return err
+	}
+	return service.RevealPath(filePath)
+}
+
+// OpenTerminal 在文件夹(或文件所在的文件夹)中打开终端
+func (f *FileController) OpenTerminal(filePath string) error {
+	if err := checkPath(filePath); err != nil {
+		return err
+	}
+	return service.OpenTerminal(filePath)
+}
+
+// PreviewFile 预览文件内容, 返回预览描述, 内容通过其中的 URL 从资源服务器获取
+func (f *FileController) PreviewFile(filePath string) (*service.Preview, error) {
+	return service.GetPreview(f.getCtx(), filePath)
+}
+
+// GetProperties 获取文件或文件夹的完整属性, 包括图片、音频与文档的元数据
+func (f *FileController) GetProperties(filePath string) (*service.FileProperties, error) {
+	return service.GetProperties(filePath)
+}
+
+// GetFileHashes 计算文件的哈希值, algorithms 可选 md5、sha1、sha256, 为空时全部计算
+func (f *FileController) GetFileHashes(filePath string, algorithms []string) (map[string]string, error) {
+	return service.ComputeHashes(f.getCtx(), filePath, algorithms)
+}
+
+// GetThumbnails 获取一组文件的缩略图, size 为 normal、large、x-large 或 xx-large;
+// 已缓存的直接返回地址, 其余的在后台生成, 完成后通过 thumbnail_ready 事件通知. 应只传入当前可见的文件
+func (f *FileController) GetThumbnails(paths []string, size string) ([]*service.Thumbnail, error) {
+	return service.GetThumbnailService().Request(paths, size)
+}
+
+// CancelThumbnails 取消尚未生成的缩略图, 在文件滚动出可见区域时调用
+func (f *FileController) CancelThumbnails(paths []string, size string) {
+	service.GetThumbnailService().Cancel(paths, size)
+}
+
+// checkPath 检查文件是否存在, 转换为前端可以直接显示的错误
+func checkPath(filePath string) error {
+	if _, err := os.Stat(filePath); err != nil {
 		if os.IsNotExist(err) {
 			return errors.New("file is not Exist")
 		} else if os.IsPermission(err) {
 			return errors.New("permission is denied")
-		} else {
-			return err
 		}
+		return err
 	}
+	return nil
+}
 
-	// 2.使用特点操作系统打开文件
-	switch f.sysInfo.OS {
-	case utils.WINDOWS:
-		cmd = exec.Command("cmd", "/c", "start", filePath)
-		//cmd = exec.Command("powershell", "Start-Process", filePath)
-		cmd.SysProcAttr = &syscall.SysProcAttr{HideWindow: true} // 隐藏命令行窗口
-	case utils.LINUX:
-		cmd = exec.Command("xdg-open", filePath)
-	case utils.MAC:
-		cmd = exec.Command("open", filePath)
-	default:
-		return fmt.Errorf("不支持的操作系统: %s", f.sysInfo.OS)
+func (f *FileController) onThumbnail(thumb *service.Thumbnail) {
+	if f.ctx != nil {
+		runtime.EventsEmit(f.ctx, "thumbnail_ready", thumb)
 	}
+}
 
-	// 3.命令执行时清理环境变量
-	var newEnv []string
-	for _, env := range cmd.Env {
-		if !strings.Contains(env, "WEBVIEW2_") {
-			newEnv = append(newEnv, env)
-		}
+// onOpenFailed 打开文件的程序启动后很快失败退出时通知界面
+func (f *FileController) onOpenFailed(failure *service.OpenFailure) {
+	if f.ctx != nil {
+		runtime.EventsEmit(f.ctx, "open_failed", failure)
 	}
-	cmd.Env = newEnv
-	return cmd.Start()
 }
-
-// PreviewFile 预览文件内容
-//func (f *FileController) PreviewFile(filePath string) ([]byte, error) {
-//
-//}
@@ -1,6 +1,7 @@
 package controller
 
 import (
+	"GoSearch/app/service"
 	"context"
 	"embed"
 	"fmt"
@@ -10,6 +11,8 @@ import (
 	"github.com/wailsapp/wails/v2/pkg/options/linux"
 	"github.com/wailsapp/wails/v2/pkg/options/mac"
 	"github.com/wailsapp/wails/v2/pkg/options/windows"
+	"log"
+	"net/http"
 )
 
 func GoSearchRun(assets embed.FS, port int, icon []byte) {
@@ -20,6 +23,10 @@ func GoSearchRun(assets embed.FS, port int, icon []byte) {
 	api := NewAPI()
 	dirController := NewDirController()
 	fileController := NewFileController()
+	// 资源服务器中 Assets 以外的请求: 文件预览内容与缩略图
+	assetHandler := http.NewServeMux()
+	assetHandler.Handle(service.PreviewURLPrefix, service.GetPreviewStore())
+	assetHandler.Handle(service.ThumbnailURLPrefix, service.GetThumbnailService())
 
 	app := application.NewWithOptions(&options.App{
 		Title: "GoSearch",
@@ -31,17 +38,30 @@ func GoSearchRun(assets embed.FS, port int, icon []byte) {
 		Height:    800,  // 可选：最大高度
 		Frameless: true, // <--- 关键：设置为 true 实现无边框
 		AssetServer: &assetserver.Options{
-			Assets: assets,
+			Assets:  assets,
+			Handler: assetHandler,
 		},
 		BackgroundColour: &options.RGBA{R: 27, G: 38, B: 54, A: 1},
 		OnStartup: func(ctx context.Context) {
 			api.setCtx(ctx)
 			dirController.setCtx(ctx)
-			//fileController.setCtx(ctx)
+			fileController.setCtx(ctx)
 		},
 		OnShutdown: func(ctx context.Context) {
 			api.CloseResource()
+			service.GetPrefetcher().Stop()
+			service.GetTransferManager().Stop()
+			service.GetThumbnailService().Stop()
 			dirController.pathCache.StopJanitor()
+			if err := dirController.pathCache.SaveSnapshot(); err != nil {
+				log.Printf("save cache snapshot error: %v", err)
+			}
+			if err := service.GetVectorStore().Close(); err != nil {
+				log.Printf("save vector store error: %v", err)
+			}
+			if err := service.GetMetaIndex().Save(); err != nil {
+				log.Printf("save metadata index error: %v", err)
+			}
 		},
 		Bind: []interface{}{
 			api,
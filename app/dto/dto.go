@@ -1,11 +1,60 @@
 package dto
 
 type SearchParams struct {
-	Query          string   `json:"query"`
-	CurrentPath    string   `json:"current_path"`
-	FileType       []string `json:"file_type"`
-	MinSize        uint64   `json:"min_size"`
-	MaxSize        uint64   `json:"max_size"`
-	ModifiedAfter  string   `json:"modified_after"`
-	ModifiedBefore string   `json:"modified_before"`
+	Query          string       `json:"query"`
+	CurrentPath    string       `json:"current_path"`
+	FileType       []string     `json:"file_type"`
+	MinSize        uint64       `json:"min_size"`
+	MaxSize        uint64       `json:"max_size"`
+	ModifiedAfter  string       `json:"modified_after"`
+	ModifiedBefore string       `json:"modified_before"`
+	Metadata       []MetaFilter `json:"metadata"`  // 元数据过滤条件, 也可以在 Query 中写作 camera:Canon、pages:>20
+	WindowID       string       `json:"window_id"` // 大模型多轮检索的会话标识, 为空时使用默认会话
+}
+
+// MetaFilter 按图片 EXIF、音频标签或文档属性过滤的条件
+type MetaFilter struct {
+	Field string `json:"field"` // camera, taken, width, height, artist, album, title, genre, author, pages, duration
+	Op    string `json:"op"`    // 文本字段为空时表示包含, "=" 表示完全相同; 数值与时间字段为 =, >, >=, <, <=
+	Value string `json:"value"` // 时间为 YYYY、YYYY-MM 或 YYYY-MM-DD; 范围写作 "2020..2022"
+}
+
+// CreateItemParams 新建文件/文件夹的参数
+type CreateItemParams struct {
+	DirPath  string `json:"dir_path"` // 父文件夹
+	Name     string `json:"name"`     // 名称, 可以包含多级路径, 例如 "a/b/c"
+	IsDir    bool   `json:"is_dir"`
+	Template string `json:"template"` // 文件模板, 为空时按扩展名选择
+}
+
+// TransferParams 复制/移动的参数
+type TransferParams struct {
+	Sources   []string `json:"sources"`
+	TargetDir string   `json:"target_dir"`
+	Policy    string   `json:"policy"` // 冲突处理方式: skip, overwrite, keep_both, ask(默认)
+}
+
+// RenameRule 批量重命名的一条规则, 按 Type 使用不同的字段, 规则按顺序作用于不含扩展名的名称
+type RenameRule struct {
+	Type       string `json:"type"`        // replace, sequence, case, date, extension
+	Find       string `json:"find"`        // replace: 查找的内容
+	Replace    string `json:"replace"`     // replace: 替换为, 正则表达式时可以使用 $1
+	Regex      bool   `json:"regex"`       // replace: Find 是否为正则表达式
+	IgnoreCase bool   `json:"ignore_case"` // replace: 忽略大小写
+	IncludeExt bool   `json:"include_ext"` // replace: 同时作用于扩展名
+	Start      int    `json:"start"`       // sequence: 起始序号
+	Step       int    `json:"step"`        // sequence: 步长, 为0时为1
+	Padding    int    `json:"padding"`     // sequence: 补零后的位数
+	Position   string `json:"position"`    // sequence/date: prefix, suffix(默认), replace(替换整个名称)
+	Separator  string `json:"separator"`   // sequence/date: 与原名称之间的分隔符
+	Case       string `json:"case"`        // case/extension: lower, upper, title
+	DateSource string `json:"date_source"` // date: mtime(默认), exif(没有 EXIF 时使用修改时间)
+	Format     string `json:"format"`      // date: 日期格式, 例如 YYYY-MM-DD_hhmmss
+	Extension  string `json:"extension"`   // extension: 新的扩展名, 不带点, 为空且 Case 为空时去掉扩展名
+}
+
+// BatchRenameParams 批量重命名的参数, 序号按 Paths 的顺序分配
+type BatchRenameParams struct {
+	Paths []string     `json:"paths"`
+	Rules []RenameRule `json:"rules"`
 }
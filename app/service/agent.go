@@ -0,0 +1,783 @@
+package service
+
+import (
+	"GoSearch/app/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/tmc/langchaingo/llms"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 文件操作类型
+const (
+	AgentOpRename       = "rename"
+	AgentOpMove         = "move"
+	AgentOpCreateFolder = "create_folder"
+	AgentOpDelete       = "delete"
+)
+
+// 计划与步骤的状态
+const (
+	PlanPending   = "pending"   // 等待用户确认
+	PlanExecuting = "executing" // 正在执行
+	PlanExecuted  = "executed"  // 已全部执行
+	PlanFailed    = "failed"    // 执行中途失败, 之前的步骤已生效
+	PlanRejected  = "rejected"  // 用户拒绝执行
+	PlanUndoing   = "undoing"   // 正在撤销
+	PlanUndone    = "undone"    // 已撤销
+
+	StepPending = "pending"
+	StepDone    = "done"
+	StepFailed  = "failed"
+	StepUndone  = "undone"
+)
+
+var (
+	fileAgent          *FileAgent
+	fileAgentOnce      sync.Once
+	MaxAgentRounds     = 8                // 一次规划中与大模型交互的最大轮数
+	MaxAgentSteps      = 200              // 一个计划最多包含的操作数量
+	MaxAgentSearchHits = 50               // 检索工具返回给模型的最大条目数
+	AgentLogMaxSize    = 100              // 操作日志最多保留的计划数量
+	AgentPlanTTL       = 30 * time.Minute // 待确认计划的有效期, 过期后文件可能已被改动, 需要重新规划
+	ErrPlanNotFound    = errors.New("plan not found")
+	ErrPlanExpired     = errors.New("plan expired, please plan again")
+)
+
+// FileOperator 实际执行文件操作的对象, 由控制器提供, 保证与界面上的操作使用相同的逻辑(包括缓存失效);
+// 计划只由 FileAgent 撤销, 因此 FileOperator 不应把操作写入 Journal
+type FileOperator interface {
+	RenameItem(path string, newName string) error
+	MoveItem(path string, targetDir string) error
+	CreateFolder(dirPath string, dirName string) error
+	DeleteItem(path string) (*TrashItem, error)
+	DeletePermanently(path string, recursive bool) error
+	RestoreTrashItem(id string) (string, error)
+}
+
+// AgentStep 计划中的一个文件操作
+type AgentStep struct {
+	Op         string `json:"op"`
+	Source     string `json:"source"`             // 受影响的路径, 新建文件夹时为父目录
+	Target     string `json:"target"`             // 操作完成后的路径, 删除时为空
+	TrashID    string `json:"trash_id,omitempty"` // 删除时回收站中项目的标识, 用于撤销
+	Reversible bool   `json:"reversible"`         // 是否可以撤销
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+}
+
+// AgentPlan 大模型生成的文件操作计划, 必须经用户确认后才会执行
+type AgentPlan struct {
+	ID            string       `json:"id"`
+	Instruction   string       `json:"instruction"`
+	BaseDir       string       `json:"base_dir"`
+	Summary       string       `json:"summary"`
+	PromptVersion string       `json:"prompt_version"` // 生成计划时使用的提示词版本
+	Steps         []*AgentStep `json:"steps"`
+	Status        string       `json:"status"`
+	CreatedAt     time.Time    `json:"created_at"`
+	ExecutedAt    *time.Time   `json:"executed_at,omitempty"`
+	UndoneAt      *time.Time   `json:"undone_at,omitempty"`
+}
+
+// FileAgent 管理待确认的计划与已执行计划的撤销日志;
+// 计划与步骤的字段只在持有 lock 时修改, 返回给调用方的都是副本
+type FileAgent struct {
+	lock     sync.Mutex
+	pending  map[string]*AgentPlan // 等待确认的计划, 只保存在内存中
+	history  []*AgentPlan          // 已执行(或撤销)的计划, 持久化到磁盘
+	filePath string
+}
+
+// GetFileAgent 获取文件操作助手单例对象
+func GetFileAgent() *FileAgent {
+	fileAgentOnce.Do(func() {
+		fileAgent = &FileAgent{pending: make(map[string]*AgentPlan)}
+		if bootConf, _, err := EnsureConfigInitialized(); err == nil && bootConf != nil {
+			fileAgent.filePath = utils.Join(bootConf.CustomConfigDir, utils.AgentLogFileName)
+			if err = fileAgent.load(); err != nil {
+				log.Printf("FileAgent: load log error: %v", err)
+			}
+		}
+	})
+	return fileAgent
+}
+
+// Plan 根据用户指令生成文件操作计划(dry-run), 计划中列出所有受影响的路径, 不会修改任何文件
+func (a *FileAgent) Plan(ctx context.Context, instruction, baseDir string) (*AgentPlan, error) {
+	if strings.TrimSpace(instruction) == "" {
+		return nil, fmt.Errorf("instruction is empty")
+	}
+	if baseDir == "" {
+		return nil, fmt.Errorf("base directory cannot be empty")
+	}
+	client, err := currentLLM()
+	if err != nil {
+		return nil, err
+	}
+
+	planner := newAgentPlanner(filepath.Clean(baseDir))
+	prompt, err := RenderPrompt(PromptAgent, NewPromptData(planner.baseDir))
+	if err != nil {
+		return nil, err
+	}
+	var content []llms.MessageContent
+	content = append(content, llms.TextParts(llms.ChatMessageTypeSystem, prompt.Text))
+	content = append(content, llms.TextParts(llms.ChatMessageTypeHuman, instruction))
+
+	plan := &AgentPlan{
+		ID:            fmt.Sprintf("%d", time.Now().UnixNano()),
+		Instruction:   instruction,
+		BaseDir:       planner.baseDir,
+		PromptVersion: prompt.Version,
+		Status:        PlanPending,
+		CreatedAt:     time.Now(),
+	}
+	for round := 0; round < MaxAgentRounds; round++ {
+		response, err := generateWithRetry(ctx, client, UsageAgent, content, llms.WithTools(agentTools), llms.WithTemperature(0.2))
+		if err != nil {
+			return nil, err
+		}
+		if len(response.Choices) == 0 {
+			return nil, errors.New("empty response from llm")
+		}
+		choice := response.Choices[0]
+		if len(choice.ToolCalls) == 0 {
+			plan.Summary = strings.TrimSpace(choice.Content)
+			break
+		}
+
+		// 将模型的工具调用与工具的返回结果加入对话, 继续下一轮
+		parts := make([]llms.ContentPart, 0, len(choice.ToolCalls)+1)
+		if choice.Content != "" {
+			parts = append(parts, llms.TextPart(choice.Content))
+		}
+		for _, call := range choice.ToolCalls {
+			parts = append(parts, call)
+		}
+		content = append(content, llms.MessageContent{Role: llms.ChatMessageTypeAI, Parts: parts})
+		for _, call := range choice.ToolCalls {
+			content = append(content, llms.MessageContent{
+				Role: llms.ChatMessageTypeTool,
+				Parts: []llms.ContentPart{llms.ToolCallResponse{
+					ToolCallID: call.ID,
+					Name:       call.FunctionCall.Name,
+					Content:    planner.dispatch(call.FunctionCall),
+				}},
+			})
+		}
+	}
+	plan.Steps = planner.steps
+	if len(plan.Steps) == 0 {
+		return plan, nil
+	}
+
+	a.lock.Lock()
+	a.expirePending(time.Now())
+	a.pending[plan.ID] = plan
+	res := plan.clone()
+	a.lock.Unlock()
+	log.Printf("FileAgent: plan %s with %d steps, prompt: %s", plan.ID, len(plan.Steps), prompt.Version)
+	return res, nil
+}
+
+// Execute 执行用户确认后的计划, 遇到错误时停止, 已完成的步骤记录到撤销日志
+func (a *FileAgent) Execute(planID string, operator FileOperator) (*AgentPlan, error) {
+	// 从待确认列表中取出后计划只属于当前调用, 重复确认会返回 ErrPlanNotFound
+	a.lock.Lock()
+	plan, ok := a.pending[planID]
+	if !ok {
+		a.lock.Unlock()
+		return nil, ErrPlanNotFound
+	}
+	delete(a.pending, planID)
+	if time.Since(plan.CreatedAt) > AgentPlanTTL {
+		a.lock.Unlock()
+		return nil, ErrPlanExpired
+	}
+	plan.Status = PlanExecuting
+	a.lock.Unlock()
+
+	var (
+		status = PlanExecuted
+		err    error
+	)
+	for _, step := range plan.Steps {
+		trashID, applyErr := a.apply(step, operator)
+		a.lock.Lock()
+		if applyErr != nil {
+			step.Status, step.Error = StepFailed, applyErr.Error()
+		} else {
+			step.Status, step.TrashID = StepDone, trashID
+		}
+		a.lock.Unlock()
+		if err = applyErr; err != nil {
+			status = PlanFailed
+			log.Printf("FileAgent: plan %s step %s %s failed: %v", plan.ID, step.Op, step.Source, err)
+			break
+		}
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	now := time.Now()
+	plan.Status = status
+	plan.ExecutedAt = &now
+	a.record(plan)
+	return plan.clone(), err
+}
+
+// Reject 放弃待确认的计划
+func (a *FileAgent) Reject(planID string) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	plan, ok := a.pending[planID]
+	if !ok {
+		return ErrPlanNotFound
+	}
+	plan.Status = PlanRejected
+	delete(a.pending, planID)
+	return nil
+}
+
+// expirePending 丢弃超过有效期的待确认计划, 调用方需持有 lock
+func (a *FileAgent) expirePending(now time.Time) {
+	for id, plan := range a.pending {
+		if now.Sub(plan.CreatedAt) > AgentPlanTTL {
+			delete(a.pending, id)
+		}
+	}
+}
+
+// Undo 按相反顺序撤销计划中已完成的步骤, 目标路径已被改动或原路径已被占用时停止;
+// 开始前将计划标记为 PlanUndoing, 同一计划同时只能有一个撤销在进行
+func (a *FileAgent) Undo(planID string, operator FileOperator) (*AgentPlan, error) {
+	a.lock.Lock()
+	var plan *AgentPlan
+	for _, p := range a.history {
+		if p.ID == planID {
+			plan = p
+			break
+		}
+	}
+	if plan == nil {
+		a.lock.Unlock()
+		return nil, ErrPlanNotFound
+	}
+	switch plan.Status {
+	case PlanUndone:
+		res := plan.clone()
+		a.lock.Unlock()
+		return res, fmt.Errorf("plan %s has already been undone", planID)
+	case PlanUndoing:
+		res := plan.clone()
+		a.lock.Unlock()
+		return res, fmt.Errorf("plan %s is being undone", planID)
+	}
+	prevStatus := plan.Status
+	plan.Status = PlanUndoing
+	a.lock.Unlock()
+
+	// 步骤的路径在计划生成后不再变化, 状态只由当前调用修改, 不加锁读取
+	var err error
+	for i := len(plan.Steps) - 1; i >= 0; i-- {
+		step := plan.Steps[i]
+		if step.Status != StepDone {
+			continue
+		}
+		if !step.Reversible {
+			log.Printf("FileAgent: skip irreversible step %s %s", step.Op, step.Source)
+			continue
+		}
+		err = a.revert(step, operator)
+		a.lock.Lock()
+		if err != nil {
+			step.Error = fmt.Sprintf("undo failed: %v", err)
+		} else {
+			step.Status = StepUndone
+		}
+		a.lock.Unlock()
+		if err != nil {
+			break
+		}
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if err == nil {
+		now := time.Now()
+		plan.Status = PlanUndone
+		plan.UndoneAt = &now
+	} else {
+		// 已撤销的步骤标记为 StepUndone, 再次撤销时从失败的步骤继续
+		plan.Status = prevStatus
+	}
+	if saveErr := a.save(); saveErr != nil {
+		log.Printf("FileAgent: save log error: %v", saveErr)
+	}
+	return plan.clone(), err
+}
+
+// History 返回已执行计划的日志(副本), 最新的在前
+func (a *FileAgent) History() []*AgentPlan {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	res := make([]*AgentPlan, 0, len(a.history))
+	for i := len(a.history) - 1; i >= 0; i-- {
+		res = append(res, a.history[i].clone())
+	}
+	return res
+}
+
+// clone 复制计划与其中的步骤, 调用方需持有 FileAgent.lock
+func (plan *AgentPlan) clone() *AgentPlan {
+	res := *plan
+	res.Steps = make([]*AgentStep, len(plan.Steps))
+	for i, step := range plan.Steps {
+		copied := *step
+		res.Steps[i] = &copied
+	}
+	return &res
+}
+
+// apply 执行单个步骤, 执行前再次检查路径, 防止确认期间文件被改动; 删除时返回回收站中项目的标识
+func (a *FileAgent) apply(step *AgentStep, operator FileOperator) (string, error) {
+	switch step.Op {
+	case AgentOpRename, AgentOpMove:
+		if _, err := os.Lstat(step.Source); err != nil {
+			return "", err
+		}
+		if _, err := os.Lstat(step.Target); err == nil {
+			return "", fmt.Errorf("target %s already exists", step.Target)
+		}
+		if step.Op == AgentOpRename {
+			return "", operator.RenameItem(step.Source, filepath.Base(step.Target))
+		}
+		return "", operator.MoveItem(step.Source, filepath.Dir(step.Target))
+	case AgentOpCreateFolder:
+		if _, err := os.Lstat(step.Target); err == nil {
+			return "", fmt.Errorf("target %s already exists", step.Target)
+		}
+		return "", operator.CreateFolder(step.Source, filepath.Base(step.Target))
+	case AgentOpDelete:
+		if _, err := os.Lstat(step.Source); err != nil {
+			return "", err
+		}
+		item, err := operator.DeleteItem(step.Source)
+		if err != nil {
+			return "", err
+		}
+		return item.ID, nil
+	default:
+		return "", fmt.Errorf("unknown operation: %s", step.Op)
+	}
+}
+
+// revert 执行单个步骤的逆操作
+func (a *FileAgent) revert(step *AgentStep, operator FileOperator) error {
+	if step.Op == AgentOpDelete {
+		// 从回收站恢复, 原位置已被占用时失败
+		_, err := operator.RestoreTrashItem(step.TrashID)
+		return err
+	}
+	if _, err := os.Lstat(step.Target); err != nil {
+		return fmt.Errorf("%s has been changed: %w", step.Target, err)
+	}
+	switch step.Op {
+	case AgentOpRename, AgentOpMove:
+		if _, err := os.Lstat(step.Source); err == nil {
+			return fmt.Errorf("%s already exists", step.Source)
+		}
+		if step.Op == AgentOpRename {
+			return operator.RenameItem(step.Target, filepath.Base(step.Source))
+		}
+		return operator.MoveItem(step.Target, filepath.Dir(step.Source))
+	case AgentOpCreateFolder:
+		// 只删除空文件夹, 文件夹中已有其他内容时删除会失败
+		return operator.DeletePermanently(step.Target, false)
+	default:
+		return fmt.Errorf("operation %s cannot be undone", step.Op)
+	}
+}
+
+// record 将执行过的计划写入日志, 调用方需持有 lock
+func (a *FileAgent) record(plan *AgentPlan) {
+	a.history = append(a.history, plan)
+	if len(a.history) > AgentLogMaxSize {
+		a.history = a.history[len(a.history)-AgentLogMaxSize:]
+	}
+	if err := a.save(); err != nil {
+		log.Printf("FileAgent: save log error: %v", err)
+	}
+}
+
+func (a *FileAgent) load() error {
+	data, err := os.ReadFile(a.filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if err = json.Unmarshal(data, &a.history); err != nil {
+		return err
+	}
+	// 撤销过程中退出时, 未撤销的步骤仍为 StepDone, 允许再次撤销
+	for _, plan := range a.history {
+		if plan.Status == PlanUndoing {
+			plan.Status = PlanExecuted
+		}
+	}
+	return nil
+}
+
+func (a *FileAgent) save() error {
+	if a.filePath == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(a.history, "", " ")
+	if err != nil {
+		return err
+	}
+	return utils.StoreFile(a.filePath, data)
+}
+
+// agentPlanner 处理一次规划中模型的工具调用, 记录计划并通过已计划的步骤模拟操作后的文件状态
+type agentPlanner struct {
+	baseDir  string
+	realBase string // 解析符号链接后的工作目录
+	steps    []*AgentStep
+}
+
+func newAgentPlanner(baseDir string) *agentPlanner {
+	return &agentPlanner{baseDir: baseDir, realBase: evalExisting(baseDir)}
+}
+
+// 工具的参数
+type agentToolArgs struct {
+	Path           string   `json:"path"`
+	NewName        string   `json:"new_name"`
+	TargetDir      string   `json:"target_dir"`
+	Name           string   `json:"name"`
+	Query          string   `json:"query"`
+	FileType       []string `json:"file_type"`
+	MinSize        uint64   `json:"min_size"`
+	MaxSize        uint64   `json:"max_size"`
+	ModifiedAfter  string   `json:"modified_after"`
+	ModifiedBefore string   `json:"modified_before"`
+}
+
+// dispatch 执行一次工具调用, 返回给模型的内容; 错误同样返回给模型以便其调整
+func (p *agentPlanner) dispatch(call *llms.FunctionCall) string {
+	if call == nil {
+		return "error: empty function call"
+	}
+	var args agentToolArgs
+	if err := json.Unmarshal([]byte(call.Arguments), &args); err != nil {
+		return fmt.Sprintf("error: invalid arguments: %v", err)
+	}
+	var (
+		res string
+		err error
+	)
+	switch call.Name {
+	case "search_files":
+		res, err = p.search(&args)
+	case "rename_item":
+		res, err = p.rename(args.Path, args.NewName)
+	case "move_item":
+		res, err = p.move(args.Path, args.TargetDir)
+	case "create_folder":
+		res, err = p.createFolder(args.Path, args.Name)
+	case "delete_item":
+		res, err = p.delete(args.Path)
+	default:
+		err = fmt.Errorf("unknown tool %s", call.Name)
+	}
+	if err != nil {
+		return "error: " + err.Error()
+	}
+	return res
+}
+
+func (p *agentPlanner) search(args *agentToolArgs) (string, error) {
+	params := &SearchParams{
+		BaseDir:  p.baseDir,
+		Query:    args.Query,
+		FileType: args.FileType,
+		MinSize:  args.MinSize,
+		MaxSize:  args.MaxSize,
+	}
+	if args.Path != "" {
+		dir, err := p.resolve(args.Path)
+		if err != nil {
+			return "", err
+		}
+		params.BaseDir = dir
+	}
+	var err error
+	if params.ModifiedAfter, err = parseAgentDate(args.ModifiedAfter); err != nil {
+		return "", err
+	}
+	if params.ModifiedBefore, err = parseAgentDate(args.ModifiedBefore); err != nil {
+		return "", err
+	}
+	items, err := SearchItems(params)
+	if err != nil {
+		return "", err
+	}
+
+	type hit struct {
+		Path    string `json:"path"`
+		IsDir   bool   `json:"is_dir"`
+		Size    int64  `json:"size"`
+		ModTime string `json:"mod_time"`
+	}
+	hits := make([]hit, 0, len(items))
+	for _, item := range items {
+		if len(hits) >= MaxAgentSearchHits {
+			break
+		}
+		hits = append(hits, hit{Path: item.Path, IsDir: item.IsDir, Size: item.Size, ModTime: item.ModTime.Format("2006-01-02 15:04")})
+	}
+	data, err := json.Marshal(map[string]interface{}{"total": len(items), "items": hits})
+	return string(data), err
+}
+
+func parseAgentDate(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return nil, fmt.Errorf("invalid date %s, use YYYY-MM-DD", value)
+	}
+	return &t, nil
+}
+
+func (p *agentPlanner) rename(path, newName string) (string, error) {
+	source, err := p.existing(path)
+	if err != nil {
+		return "", err
+	}
+	if err = validateName(newName); err != nil {
+		return "", err
+	}
+	target := filepath.Join(filepath.Dir(source), newName)
+	if err = p.add(AgentOpRename, source, target, true); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("planned: rename %s -> %s", source, target), nil
+}
+
+func (p *agentPlanner) move(path, targetDir string) (string, error) {
+	source, err := p.existing(path)
+	if err != nil {
+		return "", err
+	}
+	dir, err := p.resolve(targetDir)
+	if err != nil {
+		return "", err
+	}
+	if !p.exists(dir) {
+		return "", fmt.Errorf("target directory %s does not exist, call create_folder first", dir)
+	}
+	if dir == source || strings.HasPrefix(dir, source+string(filepath.Separator)) {
+		return "", fmt.Errorf("cannot move %s into itself", source)
+	}
+	target := filepath.Join(dir, filepath.Base(source))
+	if err = p.add(AgentOpMove, source, target, true); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("planned: move %s -> %s", source, target), nil
+}
+
+func (p *agentPlanner) createFolder(parent, name string) (string, error) {
+	dir, err := p.resolve(parent)
+	if err != nil {
+		return "", err
+	}
+	// 允许模型直接传入完整路径
+	if name == "" {
+		dir, name = filepath.Dir(dir), filepath.Base(dir)
+	}
+	if err = validateName(name); err != nil {
+		return "", err
+	}
+	if !p.exists(dir) {
+		return "", fmt.Errorf("parent directory %s does not exist", dir)
+	}
+	target := filepath.Join(dir, name)
+	if err = p.add(AgentOpCreateFolder, dir, target, true); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("planned: create folder %s", target), nil
+}
+
+func (p *agentPlanner) delete(path string) (string, error) {
+	source, err := p.existing(path)
+	if err != nil {
+		return "", err
+	}
+	if source == p.baseDir {
+		return "", fmt.Errorf("cannot delete the working directory")
+	}
+	if err = p.add(AgentOpDelete, source, "", true); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("planned: move %s to trash", source), nil
+}
+
+// add 将步骤加入计划
+func (p *agentPlanner) add(op, source, target string, reversible bool) error {
+	if len(p.steps) >= MaxAgentSteps {
+		return fmt.Errorf("too many operations in one plan (max %d)", MaxAgentSteps)
+	}
+	if target != "" && p.exists(target) {
+		return fmt.Errorf("%s already exists", target)
+	}
+	p.steps = append(p.steps, &AgentStep{Op: op, Source: source, Target: target, Reversible: reversible, Status: StepPending})
+	return nil
+}
+
+// resolve 将相对路径转换为绝对路径, 并确保在工作目录内; 解析符号链接后再判断, 指向工作目录外的链接同样被拒绝
+func (p *agentPlanner) resolve(path string) (string, error) {
+	if path == "" {
+		return "", fmt.Errorf("path is empty")
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(p.baseDir, path)
+	}
+	path = filepath.Clean(path)
+	for _, check := range [][2]string{{p.baseDir, path}, {p.realBase, evalExisting(path)}} {
+		rel, err := filepath.Rel(check[0], check[1])
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return "", fmt.Errorf("%s is outside the working directory %s", path, p.baseDir)
+		}
+	}
+	return path, nil
+}
+
+// evalExisting 解析路径中已存在部分的符号链接, 计划中尚未创建的部分原样保留
+func evalExisting(path string) string {
+	rest := ""
+	for {
+		if real, err := filepath.EvalSymlinks(path); err == nil {
+			return filepath.Join(real, rest)
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return filepath.Join(path, rest)
+		}
+		rest = filepath.Join(filepath.Base(path), rest)
+		path = parent
+	}
+}
+
+// existing 解析路径并确认该路径在计划执行到当前步骤时仍然存在
+func (p *agentPlanner) existing(path string) (string, error) {
+	path, err := p.resolve(path)
+	if err != nil {
+		return "", err
+	}
+	if path == p.baseDir {
+		return "", fmt.Errorf("cannot operate on the working directory itself")
+	}
+	if !p.exists(path) {
+		return "", fmt.Errorf("%s does not exist", path)
+	}
+	return path, nil
+}
+
+// exists 综合磁盘状态与计划中之前的步骤判断路径是否存在: 从最后一步向前回放,
+// 位于被移动或重命名的文件夹中的路径换算为移动前的路径, 直到得到执行计划前磁盘上的路径
+func (p *agentPlanner) exists(path string) bool {
+	for i := len(p.steps) - 1; i >= 0; i-- {
+		step := p.steps[i]
+		switch step.Op {
+		case AgentOpCreateFolder:
+			if path == step.Target {
+				return true
+			}
+			if isSubPath(step.Target, path) {
+				// 新建的文件夹中只有之后的步骤放入的内容
+				return false
+			}
+		case AgentOpDelete:
+			if path == step.Source || isSubPath(step.Source, path) {
+				return false
+			}
+		case AgentOpRename, AgentOpMove:
+			if path == step.Target || isSubPath(step.Target, path) {
+				path = step.Source + path[len(step.Target):]
+			} else if path == step.Source || isSubPath(step.Source, path) {
+				return false
+			}
+		}
+	}
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+// isSubPath 判断 path 是否位于 dir 之中(不包括 dir 本身)
+func isSubPath(dir, path string) bool {
+	return strings.HasPrefix(path, dir+string(filepath.Separator))
+}
+
+// validateName 检查文件名, 不允许包含路径分隔符、指向上级目录或使用当前系统不支持的名称
+func validateName(name string) error {
+	return utils.ValidateFileName(GetSysInfoInstance().OS, name)
+}
+
+// agentTools 提供给大模型的工具定义
+var agentTools = []llms.Tool{
+	agentTool("search_files", "在当前工作目录(或其子目录)中检索文件, 返回匹配的路径列表(只读)", map[string]any{
+		"path":            map[string]any{"type": "string", "description": "检索的目录, 为空时为当前工作目录"},
+		"query":           map[string]any{"type": "string", "description": "文件名关键字, 可为空"},
+		"file_type":       map[string]any{"type": "array", "items": map[string]any{"type": "string"}, "description": "文件扩展名列表, 不带点, 例如 [\"png\", \"jpg\"]"},
+		"min_size":        map[string]any{"type": "integer", "description": "最小文件大小(字节)"},
+		"max_size":        map[string]any{"type": "integer", "description": "最大文件大小(字节)"},
+		"modified_after":  map[string]any{"type": "string", "description": "修改时间下限, 格式 YYYY-MM-DD"},
+		"modified_before": map[string]any{"type": "string", "description": "修改时间上限, 格式 YYYY-MM-DD"},
+	}, nil),
+	agentTool("rename_item", "计划重命名文件或文件夹(不会立即执行)", map[string]any{
+		"path":     map[string]any{"type": "string", "description": "要重命名的文件路径"},
+		"new_name": map[string]any{"type": "string", "description": "新的名称, 不包含路径"},
+	}, []string{"path", "new_name"}),
+	agentTool("move_item", "计划将文件或文件夹移动到另一个文件夹(不会立即执行)", map[string]any{
+		"path":       map[string]any{"type": "string", "description": "要移动的文件路径"},
+		"target_dir": map[string]any{"type": "string", "description": "目标文件夹路径"},
+	}, []string{"path", "target_dir"}),
+	agentTool("create_folder", "计划新建文件夹(不会立即执行)", map[string]any{
+		"path": map[string]any{"type": "string", "description": "父文件夹路径"},
+		"name": map[string]any{"type": "string", "description": "新文件夹名称"},
+	}, []string{"path", "name"}),
+	agentTool("delete_item", "计划将文件或文件夹移到回收站(不会立即执行, 只在用户明确要求时使用)", map[string]any{
+		"path": map[string]any{"type": "string", "description": "要删除的文件路径"},
+	}, []string{"path"}),
+}
+
+func agentTool(name, description string, properties map[string]any, required []string) llms.Tool {
+	parameters := map[string]any{
+		"type":       "object",
+		"properties": properties,
+	}
+	if len(required) > 0 {
+		parameters["required"] = required
+	}
+	return llms.Tool{
+		Type: "function",
+		Function: &llms.FunctionDefinition{
+			Name:        name,
+			Description: description,
+			Parameters:  parameters,
+		},
+	}
+}
@@ -0,0 +1,325 @@
+package service
+
+import (
+	"GoSearch/app/dto"
+	"GoSearch/app/utils"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// 批量重命名规则类型
+const (
+	RenameRuleReplace   = "replace"
+	RenameRuleSequence  = "sequence"
+	RenameRuleCase      = "case"
+	RenameRuleDate      = "date"
+	RenameRuleExtension = "extension"
+)
+
+var (
+	MaxBatchRename     = 10000 // 一次批量重命名的最大数量
+	ErrRenameConflicts = errors.New("batch rename has conflicts")
+	dateTokenReplacer  = strings.NewReplacer("YYYY", "2006", "YY", "06", "MM", "01", "DD", "02", "hh", "15", "mm", "04", "ss", "05")
+)
+
+// RenamePreview 批量重命名中一个项目的预览结果
+type RenamePreview struct {
+	Path     string `json:"path"`
+	OldName  string `json:"old_name"`
+	NewName  string `json:"new_name"`
+	NewPath  string `json:"new_path"`
+	Changed  bool   `json:"changed"`
+	Conflict string `json:"conflict,omitempty"` // 无法重命名的原因, 为空时可以执行
+}
+
+// renameMove 一次重命名
+type renameMove struct {
+	from string
+	to   string
+}
+
+// PreviewBatchRename 按规则计算新名称, 标出非法名称、重复名称与已被占用的名称, 不修改任何文件
+func PreviewBatchRename(params *dto.BatchRenameParams) ([]*RenamePreview, error) {
+	if params == nil || len(params.Paths) == 0 {
+		return nil, fmt.Errorf("nothing to rename")
+	}
+	if len(params.Paths) > MaxBatchRename {
+		return nil, fmt.Errorf("too many items to rename (max %d)", MaxBatchRename)
+	}
+	rules, err := compileRenameRules(params.Rules)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		sysOS    = GetSysInfoInstance().OS
+		previews = make([]*RenamePreview, 0, len(params.Paths))
+		selected = make(map[string]bool, len(params.Paths))
+	)
+	for i, path := range params.Paths {
+		path = filepath.Clean(path)
+		preview := &RenamePreview{Path: path, OldName: filepath.Base(path)}
+		previews = append(previews, preview)
+		if selected[nameKey(sysOS, path)] {
+			preview.Conflict = "selected more than once"
+			continue
+		}
+		selected[nameKey(sysOS, path)] = true
+
+		info, err := os.Lstat(path)
+		if err != nil {
+			preview.Conflict = err.Error()
+			continue
+		}
+		if preview.NewName, err = rules.apply(path, info, i); err != nil {
+			preview.Conflict = err.Error()
+			continue
+		}
+		preview.NewPath = filepath.Join(filepath.Dir(path), preview.NewName)
+		preview.Changed = preview.NewName != preview.OldName
+		if err = utils.ValidateFileName(sysOS, preview.NewName); err != nil {
+			preview.Conflict = err.Error()
+		}
+	}
+
+	// 新名称之间不能重复(不区分大小写的系统上忽略大小写), 也不能与未参与重命名的项目重名
+	targets := make(map[string]*RenamePreview, len(previews))
+	for _, preview := range previews {
+		if preview.NewPath == "" {
+			continue
+		}
+		key := nameKey(sysOS, preview.NewPath)
+		if other, ok := targets[key]; ok {
+			preview.Conflict = fmt.Sprintf("same name as %s", other.OldName)
+			if other.Conflict == "" {
+				other.Conflict = fmt.Sprintf("same name as %s", preview.OldName)
+			}
+			continue
+		}
+		targets[key] = preview
+		if preview.Changed && preview.Conflict == "" && !selected[key] && occupied(preview.NewPath, preview.Path) {
+			preview.Conflict = fmt.Sprintf("%s already exists", preview.NewName)
+		}
+	}
+	return previews, nil
+}
+
+// BatchRename 执行批量重命名, 有任何冲突时不做修改并返回预览与 ErrRenameConflicts;
+// 执行中途失败时回滚已完成的部分
+func BatchRename(params *dto.BatchRenameParams) ([]*RenamePreview, error) {
+	previews, err := PreviewBatchRename(params)
+	if err != nil {
+		return nil, err
+	}
+	var moves []renameMove
+	for _, preview := range previews {
+		if preview.Conflict != "" {
+			return previews, ErrRenameConflicts
+		}
+		if preview.Changed {
+			moves = append(moves, renameMove{from: preview.Path, to: preview.NewPath})
+		}
+	}
+	return previews, renameAll(moves)
+}
+
+// renameAll 分两步重命名: 先全部改为临时名称, 再改为目标名称, 以支持互换名称与只改变大小写;
+// 任何一步失败时按相反顺序回滚已完成的重命名
+func renameAll(moves []renameMove) error {
+	var (
+		stamp = time.Now().UnixNano()
+		temps = make([]string, len(moves))
+		done  []renameMove
+	)
+	rollback := func(cause error) error {
+		for i := len(done) - 1; i >= 0; i-- {
+			if err := os.Rename(done[i].to, done[i].from); err != nil {
+				return fmt.Errorf("%w; rollback of %s failed: %v", cause, done[i].to, err)
+			}
+		}
+		return cause
+	}
+	for i, move := range moves {
+		temps[i] = filepath.Join(filepath.Dir(move.from), fmt.Sprintf(".gosearch-rename-%d-%d", stamp, i))
+		if err := os.Rename(move.from, temps[i]); err != nil {
+			return rollback(err)
+		}
+		done = append(done, renameMove{from: move.from, to: temps[i]})
+	}
+	for i, move := range moves {
+		if _, err := os.Lstat(move.to); err == nil {
+			return rollback(fmt.Errorf("%s already exists", move.to))
+		}
+		if err := os.Rename(temps[i], move.to); err != nil {
+			return rollback(err)
+		}
+		done = append(done, renameMove{from: temps[i], to: move.to})
+	}
+	return nil
+}
+
+// nameKey 比较路径时使用的键, Windows 与 macOS 的文件系统默认不区分大小写
+func nameKey(sysOS, path string) string {
+	if sysOS == utils.WINDOWS || sysOS == utils.MAC {
+		return strings.ToLower(path)
+	}
+	return path
+}
+
+// renameRule 编译后的规则
+type renameRule struct {
+	dto.RenameRule
+	pattern *regexp.Regexp
+	layout  string
+}
+
+type renameRules []*renameRule
+
+func compileRenameRules(rules []dto.RenameRule) (renameRules, error) {
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("no rename rules")
+	}
+	res := make(renameRules, 0, len(rules))
+	for _, rule := range rules {
+		compiled := &renameRule{RenameRule: rule}
+		switch rule.Type {
+		case RenameRuleReplace:
+			if rule.Find == "" {
+				return nil, fmt.Errorf("replace rule needs a pattern")
+			}
+			expr := rule.Find
+			if !rule.Regex {
+				expr = regexp.QuoteMeta(expr)
+			}
+			if rule.IgnoreCase {
+				expr = "(?i)" + expr
+			}
+			pattern, err := regexp.Compile(expr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern %q: %w", rule.Find, err)
+			}
+			compiled.pattern = pattern
+		case RenameRuleSequence:
+			if compiled.Step == 0 {
+				compiled.Step = 1
+			}
+		case RenameRuleCase:
+			if rule.Case != "lower" && rule.Case != "upper" && rule.Case != "title" {
+				return nil, fmt.Errorf("unknown case %q", rule.Case)
+			}
+		case RenameRuleDate:
+			format := rule.Format
+			if format == "" {
+				format = "YYYY-MM-DD"
+			}
+			compiled.layout = dateTokenReplacer.Replace(format)
+		case RenameRuleExtension:
+		default:
+			return nil, fmt.Errorf("unknown rename rule %q", rule.Type)
+		}
+		res = append(res, compiled)
+	}
+	return res, nil
+}
+
+// apply 依次应用规则, index 为项目在选择中的位置
+func (rules renameRules) apply(path string, info os.FileInfo, index int) (string, error) {
+	stem, ext := splitExt(info.Name(), info.IsDir())
+	for _, rule := range rules {
+		switch rule.Type {
+		case RenameRuleReplace:
+			if rule.IncludeExt {
+				stem, ext = splitExt(rule.replace(stem+ext), info.IsDir())
+			} else {
+				stem = rule.replace(stem)
+			}
+		case RenameRuleSequence:
+			number := fmt.Sprintf("%0*d", rule.Padding, rule.Start+index*rule.Step)
+			stem = rule.insert(stem, number)
+		case RenameRuleCase:
+			stem = changeCase(stem, rule.Case)
+		case RenameRuleDate:
+			date := info.ModTime()
+			if rule.DateSource == "exif" {
+				if exif, err := ReadExif(path); err == nil {
+					if taken, err := exif.DateTaken(); err == nil {
+						date = taken
+					}
+				}
+			}
+			stem = rule.insert(stem, date.Format(rule.layout))
+		case RenameRuleExtension:
+			if info.IsDir() {
+				continue
+			}
+			switch {
+			case rule.Case != "":
+				ext = changeCase(ext, rule.Case)
+			case rule.Extension == "":
+				ext = ""
+			default:
+				ext = "." + strings.TrimPrefix(rule.Extension, ".")
+			}
+		}
+	}
+	name := strings.TrimSpace(stem) + ext
+	if name == "" {
+		return "", fmt.Errorf("new name is empty")
+	}
+	return name, nil
+}
+
+func (rule *renameRule) replace(s string) string {
+	if rule.Regex {
+		return rule.pattern.ReplaceAllString(s, rule.Replace)
+	}
+	return rule.pattern.ReplaceAllLiteralString(s, rule.Replace)
+}
+
+// insert 按位置将 value 加到名称中
+func (rule *renameRule) insert(stem, value string) string {
+	switch rule.Position {
+	case "prefix":
+		return value + rule.Separator + stem
+	case "replace":
+		return value
+	default:
+		return stem + rule.Separator + value
+	}
+}
+
+// splitExt 拆分名称与扩展名, 文件夹与以点开头且没有其他点的名称没有扩展名
+func splitExt(name string, isDir bool) (string, string) {
+	if isDir {
+		return name, ""
+	}
+	ext := filepath.Ext(name)
+	if ext == name {
+		return name, ""
+	}
+	return strings.TrimSuffix(name, ext), ext
+}
+
+func changeCase(s, mode string) string {
+	switch mode {
+	case "lower":
+		return strings.ToLower(s)
+	case "upper":
+		return strings.ToUpper(s)
+	case "title":
+		runes := []rune(strings.ToLower(s))
+		for i, r := range runes {
+			if i == 0 || unicode.IsSpace(runes[i-1]) || strings.ContainsRune("-_.", runes[i-1]) {
+				runes[i] = unicode.ToUpper(r)
+			}
+		}
+		return string(runes)
+	}
+	return s
+}
@@ -0,0 +1,204 @@
+package service
+
+import (
+	"hash/maphash"
+)
+
+// PathCache 的淘汰策略
+const (
+	CachePolicyLRU      = "lru"      // 单一LRU链表
+	CachePolicyWTinyLFU = "wtinylfu" // 窗口LRU + 频率草图准入 + 分段LRU主区, 抗扫描
+)
+
+// 条目所在的分段
+const (
+	segNone uint8 = iota
+	segWindow
+	segProbation
+	segProtected
+	segPinned
+)
+
+var (
+	CacheWindowRatio    = 0.1  // W-TinyLFU 窗口区占总容量的比例
+	CacheProtectedRatio = 0.8  // 主区中保护段占主区的比例
+	CachePinnedRatio    = 0.5  // 固定(收藏/常用)文件夹最多占用的容量比例
+	SketchWidth         = 4096 // 频率草图每行的计数器数量, 取2的幂
+)
+
+const (
+	sketchDepth    = 4  // 频率草图的行数(哈希函数个数)
+	sketchMaxCount = 15 // 计数器上限, 与4bit计数器一致
+)
+
+// lruList 带头尾哨兵结点的双向链表, 复用 DirContent 中的 pre/next 指针
+type lruList struct {
+	head, tail *DirContent
+	size       uint64 // 链表中条目的总大小
+	len        int
+	segment    uint8
+}
+
+func newLRUList(segment uint8) *lruList {
+	head, tail := NewDirContent(), NewDirContent()
+	head.next = tail
+	tail.pre = head
+	return &lruList{head: head, tail: tail, segment: segment}
+}
+
+func (l *lruList) pushFront(dirCnt *DirContent) {
+	dirCnt.next = l.head.next
+	dirCnt.pre = l.head
+	l.head.next.pre = dirCnt
+	l.head.next = dirCnt
+	dirCnt.segment = l.segment
+	l.size += dirCnt.Size
+	l.len++
+}
+
+func (l *lruList) remove(dirCnt *DirContent) {
+	dirCnt.pre.next = dirCnt.next
+	dirCnt.next.pre = dirCnt.pre
+	dirCnt.pre, dirCnt.next = nil, nil
+	dirCnt.segment = segNone
+	l.size -= dirCnt.Size
+	l.len--
+}
+
+// replace 用 dirCnt 替换链表中的 old, 保持其位置
+func (l *lruList) replace(old, dirCnt *DirContent) {
+	dirCnt.pre, dirCnt.next = old.pre, old.next
+	old.pre.next = dirCnt
+	old.next.pre = dirCnt
+	old.pre, old.next = nil, nil
+	dirCnt.segment = l.segment
+	old.segment = segNone
+	l.size = l.size - old.Size + dirCnt.Size
+}
+
+func (l *lruList) moveToFront(dirCnt *DirContent) {
+	l.remove(dirCnt)
+	l.pushFront(dirCnt)
+}
+
+// back 返回最久未访问的条目, 链表为空时返回nil
+func (l *lruList) back() *DirContent {
+	if l.len == 0 {
+		return nil
+	}
+	return l.tail.pre
+}
+
+// each 从尾部(最久未访问)开始遍历, 回调中可以移除当前条目
+func (l *lruList) each(fn func(dirCnt *DirContent)) {
+	for node := l.tail.pre; node != l.head; {
+		pre := node.pre
+		fn(node)
+		node = pre
+	}
+}
+
+// frequencySketch Count-Min草图, 以很小的内存近似记录每个路径的访问频率;
+// 累计一定次数的访问后所有计数减半, 使旧的热点逐渐失效
+type frequencySketch struct {
+	seed      maphash.Seed
+	table     [][]uint8
+	mask      uint64
+	additions int
+	resetAt   int
+}
+
+func newFrequencySketch(width int) *frequencySketch {
+	size := 1
+	for size < width {
+		size <<= 1
+	}
+	table := make([][]uint8, sketchDepth)
+	for i := range table {
+		table[i] = make([]uint8, size)
+	}
+	return &frequencySketch{
+		seed:    maphash.MakeSeed(),
+		table:   table,
+		mask:    uint64(size - 1),
+		resetAt: size * 10,
+	}
+}
+
+// indexes 使用一次哈希派生出每一行的位置
+func (s *frequencySketch) indexes(key string) [sketchDepth]uint64 {
+	var idx [sketchDepth]uint64
+	h := maphash.String(s.seed, key)
+	h1, h2 := h, ((h>>32)|(h<<32))|1
+	for i := range idx {
+		idx[i] = (h1 + uint64(i)*h2) & s.mask
+	}
+	return idx
+}
+
+func (s *frequencySketch) increment(key string) {
+	for i, idx := range s.indexes(key) {
+		if s.table[i][idx] < sketchMaxCount {
+			s.table[i][idx]++
+		}
+	}
+	s.additions++
+	if s.additions >= s.resetAt {
+		s.reset()
+	}
+}
+
+func (s *frequencySketch) estimate(key string) uint8 {
+	res := uint8(sketchMaxCount)
+	for i, idx := range s.indexes(key) {
+		if s.table[i][idx] < res {
+			res = s.table[i][idx]
+		}
+	}
+	return res
+}
+
+func (s *frequencySketch) reset() {
+	for _, row := range s.table {
+		for i := range row {
+			row[i] >>= 1
+		}
+	}
+	s.additions /= 2
+}
+
+// expiryHeap 按过期时间排序的最小堆, 堆中的位置记录在 DirContent.heapIndex 中以便删除
+type expiryHeap []*DirContent
+
+func (h expiryHeap) Len() int { return len(h) }
+
+func (h expiryHeap) Less(i, j int) bool { return h[i].ExpiredTime.Before(h[j].ExpiredTime) }
+
+func (h expiryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].heapIndex = i
+	h[j].heapIndex = j
+}
+
+func (h *expiryHeap) Push(x any) {
+	dirCnt := x.(*DirContent)
+	dirCnt.heapIndex = len(*h)
+	*h = append(*h, dirCnt)
+}
+
+// replace 用 dirCnt 替换堆中的 old, 两者的过期时间相同, 不需要调整堆
+func (h expiryHeap) replace(old, dirCnt *DirContent) {
+	dirCnt.heapIndex = old.heapIndex
+	h[old.heapIndex] = dirCnt
+	old.heapIndex = -1
+}
+
+func (h *expiryHeap) Pop() any {
+	old := *h
+	n := len(old)
+	dirCnt := old[n-1]
+	old[n-1] = nil
+	dirCnt.heapIndex = -1
+	*h = old[:n-1]
+	return dirCnt
+}
@@ -0,0 +1,169 @@
+package service
+
+import (
+	"GoSearch/app/utils"
+	"encoding/gob"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// cacheSnapshotVersion 快照格式的版本, 修改 cachedDir 后需要同步修改, 旧版本的快照会被忽略
+const cacheSnapshotVersion = 1
+
+// cacheSnapshot cache快照的持久化格式
+type cacheSnapshot struct {
+	Version int
+	SavedAt time.Time
+	Entries []*cachedDir // 从最久未访问到最近访问排列, 恢复时按顺序放入以保持访问顺序
+}
+
+// cachedDir 快照中的一个文件夹
+type cachedDir struct {
+	Path      string
+	ModTime   time.Time
+	LastIndex time.Time
+	Files     []*FileSystemEntry
+	SubDirs   []*FileSystemEntry
+}
+
+// SaveSnapshot 将cache中的条目写入配置目录, 下次启动时恢复; 未开启快照时删除旧的快照文件
+func (cache *PathCache) SaveSnapshot() error {
+	filePath, enabled, err := cacheSnapshotPath()
+	if err != nil {
+		return err
+	}
+	if !enabled {
+		if err = os.Remove(filePath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	snapshot := &cacheSnapshot{Version: cacheSnapshotVersion, SavedAt: time.Now()}
+	cache.policyLock.Lock()
+	now := time.Now()
+	// 固定的文件夹最后放入, 其余分段按淘汰顺序(先淘汰的在前)排列
+	for _, list := range []*lruList{cache.window, cache.probation, cache.protected, cache.pinned} {
+		list.each(func(dirCnt *DirContent) {
+			// 已失效的条目不再保存; 尚未核对过的恢复条目保持快照中的内容, 下次启动时仍会核对
+			if dirCnt.IsModified || now.After(dirCnt.ExpiredTime) {
+				return
+			}
+			snapshot.Entries = append(snapshot.Entries, newCachedDir(dirCnt))
+		})
+	}
+	cache.policyLock.Unlock()
+
+	// 先写临时文件再替换, 防止写入中断导致快照损坏
+	tmpPath := filePath + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	if err = gob.NewEncoder(file).Encode(snapshot); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err = file.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmpPath, filePath); err != nil {
+		return err
+	}
+	log.Printf("PathCache: saved %d entries to snapshot", len(snapshot.Entries))
+	return nil
+}
+
+// LoadSnapshot 从配置目录恢复上次退出时保存的条目. 恢复的条目在第一次命中时
+// 与文件夹当前的修改时间比较, 不一致时视为未命中并重新读取
+func (cache *PathCache) LoadSnapshot() error {
+	filePath, enabled, err := cacheSnapshotPath()
+	if err != nil || !enabled {
+		return err
+	}
+	file, err := os.Open(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+
+	snapshot := &cacheSnapshot{}
+	if err = gob.NewDecoder(file).Decode(snapshot); err != nil {
+		return fmt.Errorf("decode %s: %w", filePath, err)
+	}
+	if snapshot.Version != cacheSnapshotVersion {
+		log.Printf("PathCache: ignore snapshot version %d", snapshot.Version)
+		return nil
+	}
+	for _, entry := range snapshot.Entries {
+		if err = cache.Put(entry.dirContent()); err != nil {
+			return err
+		}
+	}
+	log.Printf("PathCache: restored %d entries from snapshot saved at %s",
+		len(snapshot.Entries), snapshot.SavedAt.Format(time.DateTime))
+	return nil
+}
+
+// revalidate 恢复的条目第一次命中时检查文件夹的修改时间, 文件夹已被修改或无法访问时返回false
+func (dirCnt *DirContent) revalidate() bool {
+	if !dirCnt.restored || dirCnt.validated.Load() {
+		return true
+	}
+	info, err := os.Stat(dirCnt.Path + utils.SEGMENT)
+	if err != nil || !info.ModTime().Equal(dirCnt.ModTime) {
+		return false
+	}
+	dirCnt.validated.Store(true)
+	return true
+}
+
+func newCachedDir(dirCnt *DirContent) *cachedDir {
+	entry := &cachedDir{
+		Path:      dirCnt.Path,
+		ModTime:   dirCnt.ModTime,
+		LastIndex: dirCnt.LastIndex,
+		Files:     make([]*FileSystemEntry, 0, len(dirCnt.Files)),
+		SubDirs:   make([]*FileSystemEntry, 0, len(dirCnt.SubDirs)),
+	}
+	for _, file := range dirCnt.Files {
+		entry.Files = append(entry.Files, file)
+	}
+	for _, subDir := range dirCnt.SubDirs {
+		entry.SubDirs = append(entry.SubDirs, subDir)
+	}
+	return entry
+}
+
+func (entry *cachedDir) dirContent() *DirContent {
+	dirCnt := &DirContent{
+		Path:      entry.Path,
+		ModTime:   entry.ModTime,
+		LastIndex: entry.LastIndex,
+		Files:     make(map[string]*FileSystemEntry, len(entry.Files)),
+		SubDirs:   make(map[string]*FileSystemEntry, len(entry.SubDirs)),
+		restored:  true,
+	}
+	for _, file := range entry.Files {
+		dirCnt.Files[file.Name] = file
+	}
+	for _, subDir := range entry.SubDirs {
+		dirCnt.SubDirs[subDir.Name] = subDir
+	}
+	dirCnt.Size = dirCnt.getSize()
+	return dirCnt
+}
+
+// cacheSnapshotPath 返回快照文件的路径以及是否开启了快照
+func cacheSnapshotPath() (string, bool, error) {
+	bootConf, appConf, err := EnsureConfigInitialized()
+	if err != nil || bootConf == nil {
+		return "", false, fmt.Errorf("boot config is nil")
+	}
+	return utils.Join(bootConf.CustomConfigDir, utils.CacheSnapshotFileName), appConf != nil && appConf.CacheSnapshot, nil
+}
@@ -27,6 +27,17 @@ type AppConfig struct {
 	AppVersion string `json:"app_version" mapstructure:"app_version"`
 	Theme      string `json:"theme" mapstructure:"theme"`
 	Language   string `json:"language" mapstructure:"language"`
+	// 大模型提示词的语言: "zh", "en", 为空时根据界面语言与系统语言选择
+	PromptLanguage string `json:"prompt_language" mapstructure:"prompt_language"`
+	// 文件夹内容缓存(PathCache)的参数, 为0时使用默认值
+	CacheMaxBytes       uint64   `json:"cache_max_bytes" mapstructure:"cache_max_bytes"`             // 最大容量(B), 默认根据系统内存选择
+	CacheMaxEntries     int      `json:"cache_max_entries" mapstructure:"cache_max_entries"`         // 最多缓存的文件夹数量, 默认不限制
+	CacheTTLSeconds     int      `json:"cache_ttl_seconds" mapstructure:"cache_ttl_seconds"`         // 条目过期时间(秒)
+	CacheJanitorSeconds int      `json:"cache_janitor_seconds" mapstructure:"cache_janitor_seconds"` // 清理过期条目的间隔(秒)
+	CachePolicy         string   `json:"cache_policy" mapstructure:"cache_policy"`                   // 淘汰策略: "wtinylfu"(默认), "lru"
+	PinnedDirs          []string `json:"pinned_dirs" mapstructure:"pinned_dirs"`                     // 固定在缓存中的文件夹(收藏、常用)
+	PrefetchDirs        int      `json:"prefetch_dirs" mapstructure:"prefetch_dirs"`                 // 打开文件夹后预取的文件夹数量, 小于0时关闭预取
+	CacheSnapshot       bool     `json:"cache_snapshot" mapstructure:"cache_snapshot"`               // 退出时保存缓存快照, 下次启动时恢复
 	//CustomDataDir string `json:"custom_data_dir" mapstructure:"custom_data_dir"`
 }
 
@@ -189,6 +200,13 @@ func (appConf *AppConfig) SetAppConfig(newConf *AppConfig) error {
 	return nil
 }
 
+// SetPinnedDirs 修改固定在缓存中的文件夹
+func (appConf *AppConfig) SetPinnedDirs(dirs []string) {
+	aLock.Lock()
+	defer aLock.Unlock()
+	appConf.PinnedDirs = dirs
+}
+
 // StoreAppConfig 保存主配置文件
 func (appConf *AppConfig) StoreAppConfig() error {
 	var (
@@ -258,6 +276,12 @@ func (bootConf *BootAppConfig) SetBootConfig(desDir string) error {
 				// 删除文件错误只记录中log中
 				_ = utils.RemoveFile(utils.Join(oldDir, entry.Name()))
 			}
+			// 加密的密钥文件无法由内存中的数据重新生成, 直接移动到新目录
+			if entry.Name() == utils.SecretFileName {
+				if err = os.Rename(utils.Join(oldDir, entry.Name()), utils.Join(desDir, entry.Name())); err != nil {
+					log.Println("Move secret file error:", err)
+				}
+			}
 		}
 	}
 
@@ -0,0 +1,200 @@
+package service
+
+import (
+	"GoSearch/app/dto"
+	"GoSearch/app/utils"
+	"context"
+	"encoding/json"
+	"github.com/tmc/langchaingo/llms"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultWindowID = "main"
+	MaxHistoryTurns = 6 // 最多保留的历史轮数, 防止上下文无限增长
+)
+
+var (
+	convLock      sync.Mutex
+	conversations = make(map[string]*Conversation) // key: 窗口ID
+)
+
+// Conversation 单个窗口的大模型检索会话, 保存历史消息和上一轮的结构化检索条件
+type Conversation struct {
+	lock   sync.Mutex
+	turns  []conversationTurn
+	params *SearchParams // 当前生效的检索条件(经过用户确认或编辑)
+}
+
+type conversationTurn struct {
+	query  string // 用户输入
+	answer string // 模型输出(或用户编辑后)的检索条件JSON
+}
+
+// llmParams 与提示词中约定的JSON格式保持一致
+type llmParams struct {
+	Query          string           `json:"Query,omitempty"`
+	FileType       []string         `json:"FileType,omitempty"`
+	MinSize        uint64           `json:"MinSize,omitempty"`
+	MaxSize        uint64           `json:"MaxSize,omitempty"`
+	ModifiedAfter  *time.Time       `json:"ModifiedAfter,omitempty"`
+	ModifiedBefore *time.Time       `json:"ModifiedBefore,omitempty"`
+	Metadata       []dto.MetaFilter `json:"Metadata,omitempty"`
+}
+
+// GetConversation 获取窗口对应的会话, 不存在则创建
+func GetConversation(windowID string) *Conversation {
+	if windowID == "" {
+		windowID = DefaultWindowID
+	}
+	convLock.Lock()
+	defer convLock.Unlock()
+	conv, ok := conversations[windowID]
+	if !ok {
+		conv = &Conversation{}
+		conversations[windowID] = conv
+	}
+	return conv
+}
+
+// Refine 将用户的新输入连同历史消息一起发送给大模型, 得到修改后的检索条件
+func (c *Conversation) Refine(ctx context.Context, query string) (*SearchParams, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	// 1. 规则解析足够可信时跳过大模型
+	rule, confidence := ParseNaturalQuery(query, time.Now())
+	if confidence >= NLConfidenceThreshold {
+		return c.applyRule(query, rule)
+	}
+
+	// 多轮检索时在检索提示词之后追加说明
+	data := NewPromptData("")
+	search, err := RenderPrompt(PromptSearch, data)
+	if err != nil {
+		return nil, err
+	}
+	refine, err := RenderPrompt(PromptRefine, data)
+	if err != nil {
+		return nil, err
+	}
+	var content []llms.MessageContent
+	content = append(content, llms.TextParts(llms.ChatMessageTypeSystem, search.Text+refine.Text))
+	for _, turn := range c.turns {
+		content = append(content, llms.TextParts(llms.ChatMessageTypeHuman, turn.query))
+		content = append(content, llms.TextParts(llms.ChatMessageTypeAI, turn.answer))
+	}
+	content = append(content, llms.TextParts(llms.ChatMessageTypeHuman, query))
+
+	params, output, err := generateParams(ctx, content, search.Version+"+"+refine.Version, search.Digest+refine.Digest)
+	if err != nil {
+		// 2. 大模型不可用时使用规则解析的结果
+		if confidence > 0 && ctx.Err() == nil {
+			log.Printf("LLM unavailable, fallback to rule-based parser: %v", err)
+			return c.applyRule(query, rule)
+		}
+		return nil, err
+	}
+	c.appendTurn(query, output)
+	c.params = params
+	return params.clone(), nil
+}
+
+// applyRule 使用规则解析的结果, 追问时覆盖到上一轮的条件上
+func (c *Conversation) applyRule(query string, rule *SearchParams) (*SearchParams, error) {
+	params := rule
+	if len(c.turns) > 0 {
+		params = MergeParams(c.params, rule)
+	}
+	data, err := json.Marshal(params.toLLMParams())
+	if err != nil {
+		return nil, err
+	}
+	c.appendTurn(query, string(data))
+	c.params = params
+	return params.clone(), nil
+}
+
+// Params 返回当前生效的检索条件, 没有则返回nil
+func (c *Conversation) Params() *SearchParams {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.params == nil {
+		return nil
+	}
+	return c.params.clone()
+}
+
+// SetParams 保存用户确认或编辑后的检索条件, 后续追问以此为基础
+func (c *Conversation) SetParams(params *SearchParams) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	data, err := json.Marshal(params.toLLMParams())
+	if err != nil {
+		return err
+	}
+	// 用编辑后的条件替换上一轮模型的输出, 保证模型看到的是用户确认过的条件
+	if n := len(c.turns); n > 0 {
+		c.turns[n-1].answer = string(data)
+	} else {
+		c.appendTurn(params.Query, string(data))
+	}
+	c.params = params.clone()
+	return nil
+}
+
+// Reset 清空会话
+func (c *Conversation) Reset() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.turns = nil
+	c.params = nil
+}
+
+func (c *Conversation) appendTurn(query, answer string) {
+	c.turns = append(c.turns, conversationTurn{query: query, answer: answer})
+	if len(c.turns) > MaxHistoryTurns {
+		c.turns = c.turns[len(c.turns)-MaxHistoryTurns:]
+	}
+}
+
+// ToDTO 转换为前端使用的检索条件, 用于展示和编辑模型解析出的过滤条件
+func (params *SearchParams) ToDTO() *dto.SearchParams {
+	res := &dto.SearchParams{
+		Query:       params.Query,
+		CurrentPath: params.BaseDir,
+		FileType:    params.FileType,
+		MinSize:     params.MinSize,
+		MaxSize:     params.MaxSize,
+		Metadata:    params.Metadata,
+	}
+	if params.ModifiedAfter != nil {
+		res.ModifiedAfter = params.ModifiedAfter.UTC().Format(utils.TimeLayOut)
+	}
+	if params.ModifiedBefore != nil {
+		res.ModifiedBefore = params.ModifiedBefore.UTC().Format(utils.TimeLayOut)
+	}
+	return res
+}
+
+func (params *SearchParams) toLLMParams() *llmParams {
+	return &llmParams{
+		Query:          params.Query,
+		FileType:       params.FileType,
+		MinSize:        params.MinSize,
+		MaxSize:        params.MaxSize,
+		ModifiedAfter:  params.ModifiedAfter,
+		ModifiedBefore: params.ModifiedBefore,
+		Metadata:       params.Metadata,
+	}
+}
+
+func (params *SearchParams) clone() *SearchParams {
+	cp := *params
+	cp.FileType = append([]string(nil), params.FileType...)
+	cp.Metadata = append([]dto.MetaFilter(nil), params.Metadata...)
+	return &cp
+}
@@ -0,0 +1,246 @@
+package service
+
+import (
+	"GoSearch/app/utils"
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// 内置的文件模板, 自定义模板放在配置目录的 templates 文件夹下, 以文件名作为模板名称
+const (
+	TemplateText     = "text"     // 空文本文件
+	TemplateMarkdown = "markdown" // 以文件名作为标题的Markdown文件
+	TemplateDocx     = "docx"     // 只有一个空段落的Word文档
+)
+
+var (
+	MaxUniqueNames = 1000 // 自动重命名时最多尝试的序号
+)
+
+// CreateOptions 新建文件/文件夹的选项
+type CreateOptions struct {
+	IsDir    bool   // 新建文件夹
+	Template string // 文件模板: 内置模板名称或 templates 文件夹下的文件名, 为空时按扩展名选择内置模板
+	KeepName bool   // 已存在同名项目时返回错误, 而不是自动重命名为 "name (2)"
+}
+
+// CreateResult 新建的结果
+type CreateResult struct {
+	Path    string `json:"path"`    // 实际创建的文件或文件夹
+	Created string `json:"created"` // 新建的最上层项目: 多级路径中第一个原本不存在的文件夹, 没有新建中间文件夹时与 Path 相同
+}
+
+// FileTemplate 可用的文件模板
+type FileTemplate struct {
+	Name    string `json:"name"`
+	Ext     string `json:"ext"`     // 建议的扩展名
+	Builtin bool   `json:"builtin"` // 是否为内置模板
+}
+
+// CreateItem 在 dirPath 下新建文件或文件夹, name 可以包含多级路径(例如 a/b/c), 中间缺少的文件夹会被创建;
+// 最后一级已存在时自动重命名为 "name (2)" 等
+func CreateItem(dirPath, name string, opts CreateOptions) (*CreateResult, error) {
+	if dirPath == "" || name == "" {
+		return nil, fmt.Errorf("path is null")
+	}
+	var (
+		sysOS = GetSysInfoInstance().OS
+		parts = splitName(name)
+	)
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("invalid name %q", name)
+	}
+	for _, part := range parts {
+		if err := utils.ValidateFileName(sysOS, part); err != nil {
+			return nil, err
+		}
+	}
+	if info, err := os.Stat(dirPath); err != nil {
+		return nil, err
+	} else if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dirPath)
+	}
+	var content []byte
+	if !opts.IsDir {
+		var err error
+		if content, err = templateContent(opts.Template, parts[len(parts)-1]); err != nil {
+			return nil, err
+		}
+	}
+
+	// 记录第一个需要新建的中间文件夹, 撤销时整个移到回收站
+	result := &CreateResult{}
+	parent := dirPath
+	for _, part := range parts[:len(parts)-1] {
+		parent = filepath.Join(parent, part)
+		if _, err := os.Lstat(parent); result.Created == "" && os.IsNotExist(err) {
+			result.Created = parent
+		}
+	}
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return nil, err
+	}
+
+	base := parts[len(parts)-1]
+	for i := 1; i <= MaxUniqueNames; i++ {
+		target := filepath.Join(parent, uniqueName(base, i, opts.IsDir))
+		err := createAt(target, opts.IsDir, content)
+		switch {
+		case err == nil:
+			result.Path = target
+			if result.Created == "" {
+				result.Created = target
+			}
+			return result, nil
+		case !errors.Is(err, os.ErrExist) || opts.KeepName:
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("too many items named %q in %s", base, parent)
+}
+
+// FileTemplates 返回内置模板与 templates 文件夹下的自定义模板
+func FileTemplates() ([]*FileTemplate, error) {
+	templates := []*FileTemplate{
+		{Name: TemplateText, Ext: ".txt", Builtin: true},
+		{Name: TemplateMarkdown, Ext: ".md", Builtin: true},
+		{Name: TemplateDocx, Ext: ".docx", Builtin: true},
+	}
+	dir, err := templateDir()
+	if err != nil {
+		return templates, nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return templates, nil
+		}
+		return nil, err
+	}
+	custom := make([]*FileTemplate, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Type().IsRegular() {
+			custom = append(custom, &FileTemplate{Name: entry.Name(), Ext: filepath.Ext(entry.Name())})
+		}
+	}
+	sort.Slice(custom, func(i, j int) bool { return custom[i].Name < custom[j].Name })
+	return append(templates, custom...), nil
+}
+
+// createAt 创建单个文件或文件夹, 已存在时返回 os.ErrExist
+func createAt(target string, isDir bool, content []byte) error {
+	if isDir {
+		return os.Mkdir(target, 0755)
+	}
+	file, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(content); err != nil {
+		_ = file.Close()
+		_ = os.Remove(target)
+		return err
+	}
+	return file.Close()
+}
+
+// uniqueName 第一次使用原名称, 之后依次为 "name (2)", 文件的序号放在扩展名之前
+func uniqueName(name string, i int, isDir bool) string {
+	if i == 1 {
+		return name
+	}
+	ext := ""
+	if !isDir {
+		ext = filepath.Ext(name)
+		// ".gitignore" 等以点开头的文件没有扩展名
+		if ext == name {
+			ext = ""
+		}
+	}
+	return fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, ext), i, ext)
+}
+
+// splitName 按 / 与当前系统的分隔符拆分多级路径, 忽略空的部分
+func splitName(name string) []string {
+	return strings.FieldsFunc(name, func(r rune) bool {
+		return r == '/' || r == filepath.Separator
+	})
+}
+
+// templateContent 返回新文件的初始内容
+func templateContent(template, fileName string) ([]byte, error) {
+	if template == "" {
+		switch strings.ToLower(filepath.Ext(fileName)) {
+		case ".md", ".markdown":
+			template = TemplateMarkdown
+		case ".docx":
+			template = TemplateDocx
+		default:
+			template = TemplateText
+		}
+	}
+	switch template {
+	case TemplateText:
+		return nil, nil
+	case TemplateMarkdown:
+		title := strings.TrimSuffix(fileName, filepath.Ext(fileName))
+		return []byte("# " + title + "\n\n"), nil
+	case TemplateDocx:
+		return docxSkeleton()
+	}
+
+	// 自定义模板只允许使用 templates 文件夹下的文件名, 防止读取任意文件
+	if filepath.Base(template) != template || template == "." || template == ".." {
+		return nil, fmt.Errorf("invalid template %q", template)
+	}
+	dir, err := templateDir()
+	if err != nil {
+		return nil, err
+	}
+	content, err := os.ReadFile(filepath.Join(dir, template))
+	if err != nil {
+		return nil, fmt.Errorf("read template %s: %w", template, err)
+	}
+	return content, nil
+}
+
+func templateDir() (string, error) {
+	bootConf, _, err := EnsureConfigInitialized()
+	if err != nil || bootConf == nil {
+		return "", fmt.Errorf("boot config is nil")
+	}
+	return utils.Join(bootConf.CustomConfigDir, utils.TemplateDirName), nil
+}
+
+// docxSkeleton 生成最小的Word文档: 内容类型、关系与只有一个空段落的正文
+func docxSkeleton() ([]byte, error) {
+	parts := []struct{ name, body string }{
+		{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/word/document.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.document.main+xml"/></Types>`},
+		{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="word/document.xml"/></Relationships>`},
+		{"word/document.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main"><w:body><w:p/></w:body></w:document>`},
+	}
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, part := range parts {
+		w, err := zw.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err = w.Write([]byte(part.body)); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
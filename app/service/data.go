@@ -18,10 +18,46 @@ var (
 type UData struct {
 	Model    string `json:"model" mapstructure:"model"`
 	BaseURL  string `json:"base_url" mapstructure:"base_url"`
-	ApiKey   string `json:"api_key" mapstructure:"api_key"`
+	ApiKey   string `json:"api_key,omitempty" mapstructure:"api_key"` // 加密保存在系统密钥环或加密文件中, 不写入data.json
 	IsOpenAI bool   `json:"is_open_ai" mapstructure:"is_open_ai"`
+	// 语义检索使用的嵌入模型配置
+	EmbeddingProvider string `json:"embedding_provider" mapstructure:"embedding_provider"` // "openai", "ollama"
+	EmbeddingModel    string `json:"embedding_model" mapstructure:"embedding_model"`
+	EmbeddingBaseURL  string `json:"embedding_base_url" mapstructure:"embedding_base_url"` // 为空时openai使用BaseURL, ollama使用本地默认地址
+	// 检索结果重排
+	RerankTokenBudget int `json:"rerank_token_budget" mapstructure:"rerank_token_budget"` // 单次重排的token预算, 为0时使用默认值
+	// 大模型用量与限额, 按服务商(由BaseURL区分)统计, 为0时表示不限制; ProviderQuotas 中没有配置的服务商使用这里的价格与限额
+	PromptPrice       float64                   `json:"prompt_price" mapstructure:"prompt_price"`               // 每百万输入token的价格
+	CompletionPrice   float64                   `json:"completion_price" mapstructure:"completion_price"`       // 每百万输出token的价格
+	MonthlyTokenLimit uint64                    `json:"monthly_token_limit" mapstructure:"monthly_token_limit"` // 每月token上限
+	MonthlyCostLimit  float64                   `json:"monthly_cost_limit" mapstructure:"monthly_cost_limit"`   // 每月费用上限
+	ProviderQuotas    map[string]*ProviderQuota `json:"provider_quotas" mapstructure:"provider_quotas"`         // key: 服务商, 见 LLMProvider
+	// 只返回给前端, 密钥没有得到系统保护时的提示, 不写入data.json
+	SecretWarning string `json:"secret_warning,omitempty" mapstructure:"-"`
 	//dataFilePath string
-	uLock sync.Locker
+	uLock     sync.Locker
+	storedKey string // 已写入密钥存储的ApiKey, 用于判断是否需要更新
+}
+
+// ProviderQuota 单个服务商的价格与每月限额, 为0时表示不限制
+type ProviderQuota struct {
+	PromptPrice       float64 `json:"prompt_price" mapstructure:"prompt_price"`
+	CompletionPrice   float64 `json:"completion_price" mapstructure:"completion_price"`
+	MonthlyTokenLimit uint64  `json:"monthly_token_limit" mapstructure:"monthly_token_limit"`
+	MonthlyCostLimit  float64 `json:"monthly_cost_limit" mapstructure:"monthly_cost_limit"`
+}
+
+// Quota 服务商的价格与限额, 没有单独配置时使用默认值
+func (u *UData) Quota(provider string) ProviderQuota {
+	if quota, ok := u.ProviderQuotas[provider]; ok && quota != nil {
+		return *quota
+	}
+	return ProviderQuota{
+		PromptPrice:       u.PromptPrice,
+		CompletionPrice:   u.CompletionPrice,
+		MonthlyTokenLimit: u.MonthlyTokenLimit,
+		MonthlyCostLimit:  u.MonthlyCostLimit,
+	}
 }
 
 func GetUserData() (*UData, error) {
@@ -62,6 +98,10 @@ func GetUserData() (*UData, error) {
 		if err = parseUserData(dataDir, userData); err != nil {
 			return
 		}
+		// 3.从密钥存储中读取ApiKey, 旧版本明文保存的ApiKey自动迁移
+		if err = userData.loadApiKey(); err != nil {
+			log.Printf("Load api key error: %v", err)
+		}
 
 		if err != nil && userData == nil {
 			userData = defaultUserData
@@ -105,6 +145,10 @@ func (u *UData) SetUserData(newUserData *UData) error {
 		}
 		newField := newDataVal.Field(i)
 		curField := curDataVal.Field(i)
+		// 前端拿到的是脱敏后的ApiKey, 原样传回时不覆盖
+		if fieldType.Name == "ApiKey" && newField.String() != "" && newField.String() == MaskSecret(u.ApiKey) {
+			continue
+		}
 		if newField.IsValid() {
 			if !reflect.DeepEqual(newField.Interface(), curField.Interface()) {
 				if curField.CanSet() {
@@ -116,13 +160,38 @@ func (u *UData) SetUserData(newUserData *UData) error {
 	return nil
 }
 
-// StoreUserData 保存用户数据
+// snapshot 返回用户数据的只读副本, 与 SetUserData 互斥
+func (u *UData) snapshot() *UData {
+	u.uLock.Lock()
+	defer u.uLock.Unlock()
+	conf := *u
+	conf.uLock = &sync.RWMutex{}
+	return &conf
+}
+
+// StoreUserData 保存用户数据, ApiKey 单独加密保存
 func (u *UData) StoreUserData() error {
 	var (
 		data []byte
 		err  error
 	)
-	if data, err = json.MarshalIndent(u, "", " "); err != nil {
+	if u.ApiKey != u.storedKey {
+		store := GetSecretStore()
+		if u.ApiKey == "" {
+			err = store.Delete(SecretApiKey)
+		} else {
+			err = store.Set(SecretApiKey, u.ApiKey)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to store api key in %s: %w", store.Name(), err)
+		}
+		u.storedKey = u.ApiKey
+	}
+
+	plain := *u
+	plain.ApiKey = ""
+	plain.SecretWarning = ""
+	if data, err = json.MarshalIndent(&plain, "", " "); err != nil {
 		return fmt.Errorf("failed to marshal default user data: %w", err)
 	}
 	if data == nil || len(data) == 0 || string(data) == "null" {
@@ -134,3 +203,30 @@ func (u *UData) StoreUserData() error {
 	}
 	return nil
 }
+
+// Masked 返回ApiKey脱敏后的副本, 用于返回给前端
+func (u *UData) Masked() *UData {
+	masked := u.snapshot()
+	masked.ApiKey = MaskSecret(masked.ApiKey)
+	masked.SecretWarning = SecretWarning()
+	masked.storedKey = ""
+	return masked
+}
+
+// loadApiKey 从密钥存储中读取ApiKey, data.json中存在明文ApiKey时迁移至密钥存储并重写data.json
+func (u *UData) loadApiKey() error {
+	store := GetSecretStore()
+	if u.ApiKey != "" {
+		log.Printf("Migrating plaintext api key to %s", store.Name())
+		return u.StoreUserData()
+	}
+	key, err := store.Get(SecretApiKey)
+	if err == ErrSecretNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	u.ApiKey = key
+	u.storedKey = key
+	return nil
+}
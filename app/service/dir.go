@@ -3,11 +3,11 @@ package service
 import (
 	"GoSearch/app/utils"
 	"errors"
-	"fmt"
 	"log"
+	"math"
 	"os"
 	"path/filepath"
-	"strings"
+	"sync/atomic"
 	"time"
 	"unsafe"
 )
@@ -44,9 +44,14 @@ type DirContent struct {
 	Error       error                       `json:"error,omitempty"` // 如果扫描此目录时发生错误
 	Size        uint64
 	LastIndex   time.Time
+	ModTime     time.Time   `json:"mod_time"` // 读取时文件夹的修改时间, 用于判断快照中的条目是否仍然有效
 	ExpiredTime time.Time   // 设置过期时间
 	IsModified  bool        // 记录当前文件夹下是否有item被修改
 	next, pre   *DirContent // 双向链表
+	segment     uint8       // 在cache中所属的分段
+	heapIndex   int         // 在cache过期堆中的位置
+	restored    bool        // 是否从cache快照中恢复
+	validated   atomic.Bool // 恢复的条目是否已与磁盘上的修改时间核对过
 }
 
 func NewDirContent() *DirContent {
@@ -79,6 +84,9 @@ func (dirCnt *DirContent) GetDirCnt(dirPath string) error {
 			log.Println(err)
 		}
 	}(dir)
+	if info, err := dir.Stat(); err == nil {
+		dirCnt.ModTime = info.ModTime()
+	}
 	if files, err = dir.Readdir(-1); err != nil {
 		log.Printf("Error reading directory: %v", err)
 		return err
@@ -107,36 +115,51 @@ func (dirCnt *DirContent) GetDirCnt(dirPath string) error {
 	return nil
 }
 
-func (dirCnt *DirContent) RenameItem(path, parentPath, newName string) error {
-	sysInfo = GetSysInfoInstance()
-	if err := os.Rename(path, filepath.Join(parentPath, newName, utils.SEGMENT)); err != nil {
-		return err
+// clone 复制条目及其中的两个map, 条目本身共享; 修改副本中的条目时需先复制该条目
+func (dirCnt *DirContent) clone() *DirContent {
+	res := &DirContent{
+		Path:        dirCnt.Path,
+		Files:       make(map[string]*FileSystemEntry, len(dirCnt.Files)),
+		SubDirs:     make(map[string]*FileSystemEntry, len(dirCnt.SubDirs)),
+		Error:       dirCnt.Error,
+		Size:        dirCnt.Size,
+		LastIndex:   dirCnt.LastIndex,
+		ModTime:     dirCnt.ModTime,
+		ExpiredTime: dirCnt.ExpiredTime,
+		IsModified:  dirCnt.IsModified,
+		restored:    dirCnt.restored,
 	}
-	//// 修改后端保存的信息
-	//if item, exist := dirCnt.SubDirs[curName]; exist {
-	//	item.Name = newName
-	//	item.IsModified = true
-	//	delete(dirCnt.SubDirs, curName)
-	//	dirCnt.SubDirs[newName] = item
-	//}
-	//if item, exist := dirCnt.Files[curName]; exist {
-	//	item.Name = newName
-	//	item.IsModified = true
-	//	delete(dirCnt.Files, curName)
-	//	dirCnt.Files[newName] = item
-	//}
-	//dirCnt.IsModified = true
-	return nil
+	res.validated.Store(dirCnt.validated.Load())
+	for name, entry := range dirCnt.Files {
+		res.Files[name] = entry
+	}
+	for name, entry := range dirCnt.SubDirs {
+		res.SubDirs[name] = entry
+	}
+	return res
 }
 
-func (dirCnt *DirContent) DeleteItem(path string) error {
-	err := utils.RemoveFile(path)
-	if err != nil {
-		log.Println(err)
-		strs := strings.Split(err.Error(), ":")
-		return fmt.Errorf(strs[len(strs)-1])
+// renameEntry 将文件夹中的条目 oldName 改名为 newName(不访问磁盘), 被替换的同名条目一并移除
+func (dirCnt *DirContent) renameEntry(oldName, newName string) {
+	var renamed *FileSystemEntry
+	for _, entries := range []map[string]*FileSystemEntry{dirCnt.Files, dirCnt.SubDirs} {
+		if entry, ok := entries[oldName]; ok {
+			copied := *entry
+			renamed = &copied
+			delete(entries, oldName)
+		}
+		delete(entries, newName)
+	}
+	if renamed == nil {
+		return
+	}
+	renamed.Name = newName
+	renamed.Path = filepath.Join(dirCnt.Path, utils.SEGMENT, newName)
+	if renamed.IsDir {
+		dirCnt.SubDirs[newName] = renamed
+	} else {
+		dirCnt.Files[newName] = renamed
 	}
-	return nil
 }
 
 // TODO: 获取文件夹大的大小
@@ -144,40 +167,42 @@ func (dirCnt *DirContent) GetDirSize(path string) int64 {
 	return 0
 }
 
+// getSize 计算目录内容实际占用的内存: 结构体本身、路径字符串、两个map(含桶的开销)以及其中的每个条目
 func (dirCnt *DirContent) getSize() uint64 {
-	var (
-		size     uint64
-		fileSize uint64
-	)
-	if len(dirCnt.Path) > 0 {
-		size += uint64(len(dirCnt.Path)) * uint64(unsafe.Sizeof(dirCnt.Path[0]))
+	size := uint64(unsafe.Sizeof(*dirCnt)) + uint64(len(dirCnt.Path))
+	if dirCnt.Error != nil {
+		size += uint64(len(dirCnt.Error.Error()))
 	}
-	size += uint64(unsafe.Sizeof(dirCnt.Error))
-	if len(dirCnt.Files) > 0 {
-		for _, v := range dirCnt.Files {
-			fileSize = v.getSize()
-			break
-		}
-	} else if len(dirCnt.SubDirs) > 0 {
-		for _, v := range dirCnt.SubDirs {
-			fileSize = v.getSize()
-			break
+	for _, entries := range []map[string]*FileSystemEntry{dirCnt.Files, dirCnt.SubDirs} {
+		size += mapOverhead(len(entries))
+		for name, entry := range entries {
+			// map的key与条目的Name通常共享底层数组, 这里按独立分配计算, 宁可高估
+			size += uint64(len(name)) + entry.getSize()
 		}
 	}
-	size += uint64(len(dirCnt.Files)+len(dirCnt.SubDirs)) * fileSize
 	return size
 }
 
+// getSize 计算单个条目实际占用的内存: 结构体本身以及路径、名称字符串
 func (entry *FileSystemEntry) getSize() uint64 {
+	return uint64(unsafe.Sizeof(*entry)) + uint64(len(entry.Path)) + uint64(len(entry.Name))
+}
+
+// mapOverhead 估算 map[string]*FileSystemEntry 自身占用的内存, 不依赖具体的实现:
+// 每个槽位包含键、值与1字节的元数据(旧版的 tophash 或 Go 1.24 起 Swiss table 的控制字节),
+// 两种实现的装载率都在扩容后的一半到 7/8 之间, 按 mapMinLoad 计算槽位数量, 宁可高估
+func mapOverhead(n int) uint64 {
+	const (
+		mapHeader  = 48  // map 头部结构的近似大小
+		mapMinLoad = 0.5 // 扩容后刚好减半的装载率
+	)
 	var (
-		size uint64
+		key   string
+		value *FileSystemEntry
+		slot  = uint64(unsafe.Sizeof(key)+unsafe.Sizeof(value)) + 1
 	)
-	if len(entry.Path) > 0 {
-		size += uint64(len(entry.Path)) * uint64(unsafe.Sizeof(entry.Path[0]))
+	if n == 0 {
+		return mapHeader
 	}
-	if len(entry.Name) > 0 {
-		size += uint64(len(entry.Name)) * uint64(unsafe.Sizeof(entry.Name[0]))
-	}
-	size += uint64(unsafe.Sizeof(entry.IsDir) + unsafe.Sizeof(entry.Size) + unsafe.Sizeof(entry.ModTime) + unsafe.Sizeof(entry.Mode))
-	return size
+	return mapHeader + uint64(math.Ceil(float64(n)/mapMinLoad))*slot
 }
@@ -0,0 +1,169 @@
+package service
+
+import (
+	"GoSearch/app/utils"
+	"fmt"
+	"github.com/tmc/langchaingo/embeddings"
+	"github.com/tmc/langchaingo/llms/ollama"
+	"github.com/tmc/langchaingo/llms/openai"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	ollamaDefaultURL = "http://localhost:11434"
+	snippetSize      = 512 // 文本类文件读取前512字节作为内容摘要
+	snippetMaxFile   = 4 * utils.MB
+)
+
+// 可以读取内容摘要的文本类文件扩展名
+var textExts = map[string]struct{}{
+	"txt": {}, "md": {}, "markdown": {}, "csv": {}, "log": {}, "json": {}, "xml": {}, "yaml": {}, "yml": {},
+	"ini": {}, "toml": {}, "html": {}, "htm": {}, "go": {}, "py": {}, "java": {}, "c": {}, "cpp": {}, "h": {},
+	"js": {}, "jsx": {}, "ts": {}, "css": {}, "sql": {}, "sh": {}, "bat": {},
+}
+
+// NewEmbedder 根据用户配置创建嵌入模型, 支持OpenAI兼容的 /embeddings 接口和Ollama
+func NewEmbedder(conf *UData) (embeddings.Embedder, error) {
+	var (
+		client embeddings.EmbedderClient
+		err    error
+	)
+	if conf == nil || conf.EmbeddingModel == "" {
+		return nil, fmt.Errorf("embedding model is not configured")
+	}
+
+	switch conf.EmbeddingProvider {
+	case utils.OLLAMA:
+		baseURL := conf.EmbeddingBaseURL
+		if baseURL == "" {
+			baseURL = ollamaDefaultURL
+		}
+		// ollama.WithServerURL 解析失败会直接退出进程, 这里提前校验
+		if _, err = url.Parse(baseURL); err != nil {
+			return nil, fmt.Errorf("invalid ollama url %s: %w", baseURL, err)
+		}
+		client, err = ollama.New(ollama.WithModel(conf.EmbeddingModel), ollama.WithServerURL(baseURL))
+	case utils.OPENAI, "":
+		baseURL := conf.EmbeddingBaseURL
+		if baseURL == "" {
+			baseURL = conf.BaseURL
+		}
+		client, err = openai.New(
+			openai.WithModel(conf.Model),
+			openai.WithEmbeddingModel(conf.EmbeddingModel),
+			openai.WithBaseURL(baseURL),
+			openai.WithToken(conf.ApiKey),
+		)
+	default:
+		return nil, fmt.Errorf("unsupported embedding provider: %s", conf.EmbeddingProvider)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return embeddings.NewEmbedder(client)
+}
+
+// embeddingModelID 标识当前嵌入模型, 模型变化后已有向量失效
+func embeddingModelID(conf *UData) string {
+	if conf == nil {
+		return ""
+	}
+	provider := conf.EmbeddingProvider
+	if provider == "" {
+		provider = utils.OPENAI
+	}
+	return provider + "/" + conf.EmbeddingModel
+}
+
+// EntryDocument 将文件条目(名称+大小+类型+时间+内容摘要)编码为用于嵌入的文本
+func EntryDocument(entry *FileSystemEntry) string {
+	var (
+		sb  strings.Builder
+		ext = strings.ToLower(strings.TrimPrefix(filepath.Ext(entry.Name), "."))
+	)
+	sb.WriteString("name: ")
+	sb.WriteString(entry.Name)
+	if entry.IsDir {
+		sb.WriteString("\ntype: folder")
+	} else {
+		sb.WriteString("\ntype: ")
+		if ext == "" {
+			sb.WriteString("file")
+		} else {
+			sb.WriteString(ext)
+		}
+		sb.WriteString("\nsize: ")
+		sb.WriteString(formatSize(uint64(entry.Size)))
+	}
+	sb.WriteString("\nmodified: ")
+	sb.WriteString(describeTime(entry.ModTime))
+	sb.WriteString("\nfolder: ")
+	sb.WriteString(filepath.Base(filepath.Dir(entry.Path)))
+
+	if snippet := readSnippet(entry, ext); snippet != "" {
+		sb.WriteString("\ncontent: ")
+		sb.WriteString(snippet)
+	}
+	return sb.String()
+}
+
+// describeTime 同时给出日期、月份与季节, 便于"去年春天修改的"这类查询命中
+func describeTime(t time.Time) string {
+	var season string
+	switch t.Month() {
+	case time.March, time.April, time.May:
+		season = "spring 春"
+	case time.June, time.July, time.August:
+		season = "summer 夏"
+	case time.September, time.October, time.November:
+		season = "autumn 秋"
+	default:
+		season = "winter 冬"
+	}
+	return fmt.Sprintf("%s (%s %d, %s)", t.Format("2006-01-02"), t.Month(), t.Year(), season)
+}
+
+func formatSize(size uint64) string {
+	switch {
+	case size >= utils.GB:
+		return fmt.Sprintf("%.1fGB", float64(size)/float64(utils.GB))
+	case size >= utils.MB:
+		return fmt.Sprintf("%.1fMB", float64(size)/float64(utils.MB))
+	case size >= utils.KB:
+		return fmt.Sprintf("%.1fKB", float64(size)/float64(utils.KB))
+	default:
+		return fmt.Sprintf("%dB", size)
+	}
+}
+
+// readSnippet 读取文本类文件开头的内容作为摘要
+func readSnippet(entry *FileSystemEntry, ext string) string {
+	if entry.IsDir || entry.Size == 0 || uint64(entry.Size) > snippetMaxFile {
+		return ""
+	}
+	if _, ok := textExts[ext]; !ok {
+		return ""
+	}
+	file, err := os.Open(entry.Path)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	buf := make([]byte, snippetSize)
+	n, _ := file.Read(buf)
+	buf = buf[:n]
+	// 去掉末尾被截断的多字节字符
+	for i := 0; i < utf8.UTFMax && len(buf) > 0 && !utf8.Valid(buf); i++ {
+		buf = buf[:len(buf)-1]
+	}
+	if !utf8.Valid(buf) {
+		return ""
+	}
+	return strings.Join(strings.Fields(string(buf)), " ")
+}
@@ -0,0 +1,278 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// EXIF 标签
+const (
+	exifTagMake             = 0x010F
+	exifTagModel            = 0x0110
+	exifTagOrientation      = 0x0112
+	exifTagDateTime         = 0x0132
+	exifTagExposureTime     = 0x829A
+	exifTagFNumber          = 0x829D
+	exifTagIFDPointer       = 0x8769
+	exifTagISO              = 0x8827
+	exifTagGPSPointer       = 0x8825
+	exifTagDateTimeOriginal = 0x9003
+	exifTagFocalLength      = 0x920A
+	exifTagLensModel        = 0xA434
+	exifTagGPSLatitudeRef   = 0x0001
+	exifTagGPSLatitude      = 0x0002
+	exifTagGPSLongitudeRef  = 0x0003
+	exifTagGPSLongitude     = 0x0004
+	exifTagGPSAltitudeRef   = 0x0005
+	exifTagGPSAltitude      = 0x0006
+	exifTypeASCII           = 2
+	exifTypeRational        = 5
+	exifTypeSRational       = 10
+	exifDateLayout          = "2006:01:02 15:04:05"
+)
+
+var (
+	MaxExifSize = 1 << 16 // APP1 段最大长度
+	ErrNoExif   = errors.New("no exif data")
+)
+
+// ExifData JPEG 中的 EXIF 原始数据(TIFF 格式)与字节序
+type ExifData struct {
+	order binary.ByteOrder
+	data  []byte
+}
+
+// ReadExif 读取 JPEG 文件中的 EXIF 数据, 只解析文件开头的标记段而不读取图像数据
+func ReadExif(path string) (*ExifData, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+	var marker [2]byte
+	if _, err = io.ReadFull(r, marker[:]); err != nil || marker != [2]byte{0xFF, 0xD8} {
+		return nil, ErrNoExif
+	}
+	for {
+		if _, err = io.ReadFull(r, marker[:]); err != nil || marker[0] != 0xFF {
+			return nil, ErrNoExif
+		}
+		// SOS 之后是图像数据, 不会再有 APP1
+		if marker[1] == 0xDA || marker[1] == 0xD9 {
+			return nil, ErrNoExif
+		}
+		var length uint16
+		if err = binary.Read(r, binary.BigEndian, &length); err != nil || length < 2 {
+			return nil, ErrNoExif
+		}
+		size := int(length) - 2
+		if marker[1] != 0xE1 || size > MaxExifSize {
+			if _, err = r.Discard(size); err != nil {
+				return nil, ErrNoExif
+			}
+			continue
+		}
+		segment := make([]byte, size)
+		if _, err = io.ReadFull(r, segment); err != nil {
+			return nil, ErrNoExif
+		}
+		if !bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			continue
+		}
+		return parseTIFFHeader(segment[6:])
+	}
+}
+
+func parseTIFFHeader(data []byte) (*ExifData, error) {
+	if len(data) < 8 {
+		return nil, ErrNoExif
+	}
+	exif := &ExifData{data: data}
+	switch string(data[:2]) {
+	case "II":
+		exif.order = binary.LittleEndian
+	case "MM":
+		exif.order = binary.BigEndian
+	default:
+		return nil, ErrNoExif
+	}
+	return exif, nil
+}
+
+// DateTaken 返回拍摄时间(DateTimeOriginal), 没有时使用 DateTime; EXIF 时间没有时区, 按本地时间解析
+func (e *ExifData) DateTaken() (time.Time, error) {
+	ifd0 := int(e.order.Uint32(e.data[4:8]))
+	if pointer, ok := e.tagValue(ifd0, exifTagIFDPointer); ok {
+		if value, ok := e.tagString(int(pointer), exifTagDateTimeOriginal); ok {
+			return time.ParseInLocation(exifDateLayout, value, time.Local)
+		}
+	}
+	if value, ok := e.tagString(ifd0, exifTagDateTime); ok {
+		return time.ParseInLocation(exifDateLayout, value, time.Local)
+	}
+	return time.Time{}, fmt.Errorf("exif has no date")
+}
+
+// Orientation 返回图像方向(1-8), 没有记录时为1
+func (e *ExifData) Orientation() int {
+	ifd0 := int(e.order.Uint32(e.data[4:8]))
+	if value, ok := e.tagValue(ifd0, exifTagOrientation); ok && value >= 1 && value <= 8 {
+		return int(value)
+	}
+	return 1
+}
+
+// Camera 返回相机厂商、型号与镜头型号
+func (e *ExifData) Camera() (string, string, string) {
+	ifd0 := int(e.order.Uint32(e.data[4:8]))
+	maker, _ := e.tagString(ifd0, exifTagMake)
+	model, _ := e.tagString(ifd0, exifTagModel)
+	var lens string
+	if pointer, ok := e.tagValue(ifd0, exifTagIFDPointer); ok {
+		lens, _ = e.tagString(int(pointer), exifTagLensModel)
+	}
+	return maker, model, lens
+}
+
+// Exposure 返回曝光时间(秒)、光圈值、ISO 与焦距(毫米), 没有记录的为0
+func (e *ExifData) Exposure() (exposure, fNumber float64, iso int, focalLength float64) {
+	ifd0 := int(e.order.Uint32(e.data[4:8]))
+	pointer, ok := e.tagValue(ifd0, exifTagIFDPointer)
+	if !ok {
+		return
+	}
+	if values, ok := e.tagRationals(int(pointer), exifTagExposureTime); ok {
+		exposure = values[0]
+	}
+	if values, ok := e.tagRationals(int(pointer), exifTagFNumber); ok {
+		fNumber = values[0]
+	}
+	if value, ok := e.tagValue(int(pointer), exifTagISO); ok {
+		iso = int(value)
+	}
+	if values, ok := e.tagRationals(int(pointer), exifTagFocalLength); ok {
+		focalLength = values[0]
+	}
+	return
+}
+
+// GPS 返回拍摄位置的纬度、经度(南纬、西经为负)与海拔(米), 没有位置信息时 ok 为 false
+func (e *ExifData) GPS() (latitude, longitude, altitude float64, ok bool) {
+	ifd0 := int(e.order.Uint32(e.data[4:8]))
+	pointer, found := e.tagValue(ifd0, exifTagGPSPointer)
+	if !found {
+		return
+	}
+	gps := int(pointer)
+	lat, latOK := e.tagRationals(gps, exifTagGPSLatitude)
+	lon, lonOK := e.tagRationals(gps, exifTagGPSLongitude)
+	if !latOK || !lonOK || len(lat) < 3 || len(lon) < 3 {
+		return
+	}
+	latitude = lat[0] + lat[1]/60 + lat[2]/3600
+	longitude = lon[0] + lon[1]/60 + lon[2]/3600
+	if ref, _ := e.tagString(gps, exifTagGPSLatitudeRef); ref == "S" {
+		latitude = -latitude
+	}
+	if ref, _ := e.tagString(gps, exifTagGPSLongitudeRef); ref == "W" {
+		longitude = -longitude
+	}
+	if values, found := e.tagRationals(gps, exifTagGPSAltitude); found {
+		altitude = values[0]
+		// AltitudeRef 为 BYTE 类型, 1 表示海平面以下
+		if entry, found := e.findTag(gps, exifTagGPSAltitudeRef); found && entry[8] == 1 {
+			altitude = -altitude
+		}
+	}
+	return latitude, longitude, altitude, true
+}
+
+// findTag 在 offset 处的 IFD 中查找标签, 返回 12 字节的条目
+func (e *ExifData) findTag(offset int, tag uint16) ([]byte, bool) {
+	if offset < 0 || offset+2 > len(e.data) {
+		return nil, false
+	}
+	count := int(e.order.Uint16(e.data[offset:]))
+	for i := 0; i < count; i++ {
+		start := offset + 2 + i*12
+		if start+12 > len(e.data) {
+			return nil, false
+		}
+		entry := e.data[start : start+12]
+		if e.order.Uint16(entry) == tag {
+			return entry, true
+		}
+	}
+	return nil, false
+}
+
+// tagValue 读取 LONG/SHORT 类型标签的值
+func (e *ExifData) tagValue(offset int, tag uint16) (uint32, bool) {
+	entry, ok := e.findTag(offset, tag)
+	if !ok {
+		return 0, false
+	}
+	if e.order.Uint16(entry[2:]) == 3 {
+		return uint32(e.order.Uint16(entry[8:])), true
+	}
+	return e.order.Uint32(entry[8:]), true
+}
+
+// tagString 读取 ASCII 类型标签的值, 不超过 4 字节时保存在条目中, 否则条目中是偏移量
+func (e *ExifData) tagString(offset int, tag uint16) (string, bool) {
+	entry, ok := e.findTag(offset, tag)
+	if !ok || e.order.Uint16(entry[2:]) != exifTypeASCII {
+		return "", false
+	}
+	count := int(e.order.Uint32(entry[4:]))
+	value := entry[8:12]
+	if count > 4 {
+		start := int(e.order.Uint32(entry[8:]))
+		if start < 0 || start+count > len(e.data) {
+			return "", false
+		}
+		value = e.data[start : start+count]
+	} else {
+		value = value[:count]
+	}
+	return strings.TrimRight(string(value), "\x00 "), true
+}
+
+// tagRationals 读取 RATIONAL/SRATIONAL 类型标签的值, 数据总是保存在偏移量处
+func (e *ExifData) tagRationals(offset int, tag uint16) ([]float64, bool) {
+	entry, ok := e.findTag(offset, tag)
+	if !ok {
+		return nil, false
+	}
+	kind := e.order.Uint16(entry[2:])
+	if kind != exifTypeRational && kind != exifTypeSRational {
+		return nil, false
+	}
+	count := int(e.order.Uint32(entry[4:]))
+	start := int(e.order.Uint32(entry[8:]))
+	if count <= 0 || count > 16 || start < 0 || start+count*8 > len(e.data) {
+		return nil, false
+	}
+	values := make([]float64, count)
+	for i := range values {
+		numerator, denominator := e.order.Uint32(e.data[start+i*8:]), e.order.Uint32(e.data[start+i*8+4:])
+		if denominator == 0 {
+			continue
+		}
+		if kind == exifTypeSRational {
+			values[i] = float64(int32(numerator)) / float64(int32(denominator))
+		} else {
+			values[i] = float64(numerator) / float64(denominator)
+		}
+	}
+	return values, true
+}
@@ -29,6 +29,7 @@ type SearchPool struct {
 	wg      sync.WaitGroup        // 等待所有协程完成
 	ctx     context.Context       // 用于取消操作
 	cancel  context.CancelFunc
+	params  *SearchParams
 }
 
 func NewSearchPool(workers int) *SearchPool {
@@ -44,6 +45,7 @@ func NewSearchPool(workers int) *SearchPool {
 
 // Start 启动协程池
 func (p *SearchPool) Start(params *SearchParams) {
+	p.params = params
 	// 启动目录生成协程, 生成搜索目录
 	go p.Schedule(params)
 
@@ -97,6 +99,12 @@ func (p *SearchPool) WaitAndStop() {
 	p.wg.Wait()
 	// 释放资源
 	close(p.results)
+	// 检索过程中新读取的元数据写入索引文件
+	if len(p.params.metaConds) > 0 {
+		if err := GetMetaIndex().Save(); err != nil {
+			log.Printf("save metadata index error: %v", err)
+		}
+	}
 }
 
 // Run 进行item检索
@@ -111,7 +119,6 @@ func (t *SearchTask) Run(results chan *FileSystemEntry) {
 			continue
 		}
 
-		fileModTime := entryInfo.ModTime().Unix()
 		entryName := entryInfo.Name()
 
 		// 对文件名进行匹配（前缀匹配）
@@ -121,61 +128,71 @@ func (t *SearchTask) Run(results chan *FileSystemEntry) {
 			}
 		}
 
-		// 对类型进行匹配
-		if len(t.params.FileType) > 0 {
-			extIndex := strings.LastIndex(entryName, ".")
-			if extIndex != -1 {
-				entryType := entryName[strings.LastIndex(entryName, ".")+1:]
-				flag := false
-				for _, typ := range t.params.FileType {
-					if entryType == typ {
-						flag = true
-					}
-				}
-				if !flag {
-					continue
-				}
-			} else {
-				continue
-			}
+		item := &FileSystemEntry{
+			Path:    utils.Join(t.currPath, entryName),
+			Name:    entryName,
+			IsDir:   entry.IsDir(),
+			Size:    entryInfo.Size(),
+			ModTime: entryInfo.ModTime(),
+			Mode:    entryInfo.Mode(),
 		}
+		// 都满足则匹配成功
+		if t.params.matchFilters(item) {
+			results <- item
+		}
+	}
+}
 
-		// 对大小进行匹配
-		if t.params.MinSize != 0 || t.params.MaxSize != 0 {
-			if entry.IsDir() { // 不匹配文件夹
-				continue
-			}
-			size := uint64(entryInfo.Size())
-			if t.params.MinSize > 0 && size < t.params.MinSize {
-				continue
-			}
-			if t.params.MaxSize > 0 && size > t.params.MaxSize {
-				continue
+// matchFilters 检查类型、大小、修改时间与元数据条件, 不检查名称; 向量检索的结果也使用该方法过滤
+func (params *SearchParams) matchFilters(entry *FileSystemEntry) bool {
+	// 对类型进行匹配
+	if len(params.FileType) > 0 {
+		extIndex := strings.LastIndex(entry.Name, ".")
+		if extIndex == -1 {
+			return false
+		}
+		entryType := entry.Name[extIndex+1:]
+		flag := false
+		for _, typ := range params.FileType {
+			if entryType == typ {
+				flag = true
 			}
 		}
+		if !flag {
+			return false
+		}
+	}
 
-		// 对日期进行匹配
-		if t.params.ModifiedAfter != nil {
-			if fileModTime < t.params.ModifiedAfter.Unix() {
-				continue
-			}
+	// 对大小进行匹配
+	if params.MinSize != 0 || params.MaxSize != 0 {
+		if entry.IsDir { // 不匹配文件夹
+			return false
 		}
-		if t.params.ModifiedBefore != nil {
-			if fileModTime > t.params.ModifiedBefore.Unix() {
-				continue
-			}
+		size := uint64(entry.Size)
+		if params.MinSize > 0 && size < params.MinSize {
+			return false
 		}
+		if params.MaxSize > 0 && size > params.MaxSize {
+			return false
+		}
+	}
 
-		// 都满足则匹配成功
-		results <- &FileSystemEntry{
-			Path:    utils.Join(t.currPath, entryName),
-			Name:    entryName,
-			IsDir:   entry.IsDir(),
-			Size:    entryInfo.Size(),
-			ModTime: entryInfo.ModTime(),
-			Mode:    entryInfo.Mode(),
+	// 对日期进行匹配
+	fileModTime := entry.ModTime.Unix()
+	if params.ModifiedAfter != nil && fileModTime < params.ModifiedAfter.Unix() {
+		return false
+	}
+	if params.ModifiedBefore != nil && fileModTime > params.ModifiedBefore.Unix() {
+		return false
+	}
+
+	// 对元数据进行匹配, 需要读取文件, 放在最后
+	if len(params.metaConds) > 0 {
+		if entry.IsDir || !GetMetaIndex().Match(entry, params.metaConds) {
+			return false
 		}
 	}
+	return true
 }
 
 func (p *SearchPool) Results() ([]*FileSystemEntry, error) {
@@ -0,0 +1,426 @@
+package service
+
+import (
+	"GoSearch/app/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// 操作日志中记录的操作类型
+const (
+	JournalRename  = "rename"
+	JournalMove    = "move"
+	JournalCreate  = "create"
+	JournalTrash   = "trash"
+	JournalBatch   = "batch_rename"   // 批量重命名, 各个项目保存在 Items 中, 作为一个整体撤销
+	JournalReplace = "rename_replace" // 替换同名项目的重命名、移动或复制, Items 中依次为移到回收站与该操作, 作为一个整体撤销
+)
+
+var (
+	journal            *Journal
+	journalOnce        sync.Once
+	JournalMaxSize     = 200 // 操作日志最多保留的操作数量
+	ErrNothingToUndo   = errors.New("nothing to undo")
+	ErrNothingToRedo   = errors.New("nothing to redo")
+	ErrJournalConflict = errors.New("item has been changed since the operation")
+)
+
+// FileState 项目在操作完成时的状态, 撤销或重做前与磁盘上的状态比较, 判断项目是否已被改动
+type FileState struct {
+	IsDir   bool      `json:"is_dir"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// JournalEntry 一次可撤销的文件操作
+type JournalEntry struct {
+	ID        string          `json:"id"`
+	Op        string          `json:"op"`
+	Source    string          `json:"source"`             // 操作前的路径, 新建时为空
+	Target    string          `json:"target"`             // 操作后的路径, 移到回收站时为空
+	TrashID   string          `json:"trash_id,omitempty"` // 项目当前在回收站中时的标识(删除后或撤销新建后)
+	State     *FileState      `json:"state,omitempty"`    // 项目当前所在路径上的状态, 在回收站中时为空
+	Items     []*JournalEntry `json:"items,omitempty"`    // 批量重命名中的各个项目
+	Undone    bool            `json:"undone"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// Journal 文件操作日志, 支持按顺序撤销与重做; 已撤销的操作位于末尾, 记录新的操作时丢弃
+type Journal struct {
+	lock     sync.Mutex
+	entries  []*JournalEntry
+	filePath string
+}
+
+// GetJournal 获取操作日志单例对象
+func GetJournal() *Journal {
+	journalOnce.Do(func() {
+		journal = &Journal{}
+		if bootConf, _, err := EnsureConfigInitialized(); err == nil && bootConf != nil {
+			journal.filePath = utils.Join(bootConf.CustomConfigDir, utils.JournalFileName)
+			if err = journal.load(); err != nil {
+				log.Printf("Journal: load error: %v", err)
+			}
+		}
+	})
+	return journal
+}
+
+// Record 记录一次已经完成的操作, 同时清空可重做的操作
+func (j *Journal) Record(op, source, target, trashID string) *JournalEntry {
+	entry := newJournalEntry(op, source, target, trashID)
+	j.push(entry)
+	return entry
+}
+
+// RecordRename 记录一次重命名, 替换了同名项目时与将其移到回收站一起记录为一个操作
+func (j *Journal) RecordRename(result *RenameResult) *JournalEntry {
+	if result.Replaced == nil {
+		return j.Record(JournalRename, result.Path, result.NewPath, "")
+	}
+	return j.RecordReplace(JournalRename, result.Path, result.NewPath, result.Replaced)
+}
+
+// RecordReplace 将替换了同名项目的操作与将该项目移到回收站一起记录为一个操作,
+// op 为 JournalRename、JournalMove 或 JournalCreate(复制, source 为空)
+func (j *Journal) RecordReplace(op, source, target string, replaced *TrashItem) *JournalEntry {
+	entry := newJournalEntry(JournalReplace, source, target, "")
+	entry.State = nil
+	entry.Items = []*JournalEntry{
+		newJournalEntry(JournalTrash, target, "", replaced.ID),
+		newJournalEntry(op, source, target, ""),
+	}
+	j.push(entry)
+	return entry
+}
+
+// RecordBatch 将一次批量重命名记录为一个操作
+func (j *Journal) RecordBatch(previews []*RenamePreview) *JournalEntry {
+	var items []*JournalEntry
+	for _, preview := range previews {
+		if preview.Changed {
+			items = append(items, &JournalEntry{Op: JournalRename, Source: preview.Path, Target: preview.NewPath, State: fileStateOf(preview.NewPath)})
+		}
+	}
+	if len(items) == 0 {
+		return nil
+	}
+	entry := &JournalEntry{
+		ID:        fmt.Sprintf("%d", time.Now().UnixNano()),
+		Op:        JournalBatch,
+		Source:    filepath.Dir(items[0].Source),
+		Items:     items,
+		CreatedAt: time.Now(),
+	}
+	j.push(entry)
+	return entry
+}
+
+// push 追加操作并丢弃可重做的操作
+func (j *Journal) push(entry *JournalEntry) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	j.entries = append(j.entries[:j.done()], entry)
+	if len(j.entries) > JournalMaxSize {
+		j.entries = j.entries[len(j.entries)-JournalMaxSize:]
+	}
+	j.store()
+}
+
+// Undo 撤销最近一次操作, 项目已被改动或原位置已被占用时返回 ErrJournalConflict 且不做任何修改;
+// 返回的是操作的副本
+func (j *Journal) Undo() (*JournalEntry, error) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	i := j.done() - 1
+	if i < 0 {
+		return nil, ErrNothingToUndo
+	}
+	entry := j.entries[i]
+	if err := entry.revert(); err != nil {
+		return entry.clone(), err
+	}
+	entry.Undone = true
+	j.store()
+	return entry.clone(), nil
+}
+
+// Redo 重做最近一次撤销的操作, 返回的是操作的副本
+func (j *Journal) Redo() (*JournalEntry, error) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	i := j.done()
+	if i >= len(j.entries) {
+		return nil, ErrNothingToRedo
+	}
+	entry := j.entries[i]
+	if err := entry.apply(); err != nil {
+		return entry.clone(), err
+	}
+	entry.Undone = false
+	j.store()
+	return entry.clone(), nil
+}
+
+// History 返回操作日志的副本, 最新的在前
+func (j *Journal) History() []*JournalEntry {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	res := make([]*JournalEntry, 0, len(j.entries))
+	for i := len(j.entries) - 1; i >= 0; i-- {
+		res = append(res, j.entries[i].clone())
+	}
+	return res
+}
+
+// clone 复制操作及其中的状态与批量项目, 撤销与重做只修改日志中的原对象, 调用方需持有 Journal.lock
+func (e *JournalEntry) clone() *JournalEntry {
+	res := *e
+	if e.State != nil {
+		state := *e.State
+		res.State = &state
+	}
+	if e.Items != nil {
+		res.Items = make([]*JournalEntry, len(e.Items))
+		for i, item := range e.Items {
+			res.Items[i] = item.clone()
+		}
+	}
+	return &res
+}
+
+// done 返回未撤销的操作数量, 调用方需持有锁
+func (j *Journal) done() int {
+	n := len(j.entries)
+	for n > 0 && j.entries[n-1].Undone {
+		n--
+	}
+	return n
+}
+
+// store 保存操作日志, 失败时只记录日志, 调用方需持有锁
+func (j *Journal) store() {
+	if j.filePath == "" {
+		return
+	}
+	data, err := json.MarshalIndent(j.entries, "", " ")
+	if err == nil {
+		err = utils.StoreFile(j.filePath, data)
+	}
+	if err != nil {
+		log.Printf("Journal: store error: %v", err)
+	}
+}
+
+func (j *Journal) load() error {
+	data, err := os.ReadFile(j.filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	return json.Unmarshal(data, &j.entries)
+}
+
+// revert 执行操作的逆操作
+func (e *JournalEntry) revert() error {
+	switch e.Op {
+	case JournalRename, JournalMove:
+		return e.rename(e.Target, e.Source)
+	case JournalCreate:
+		// 新建的项目移到回收站而不是直接删除, 重做时再恢复
+		if err := checkState(e.Target, e.State); err != nil {
+			return err
+		}
+		item, err := MoveToTrash(e.Target)
+		if err != nil {
+			return err
+		}
+		e.TrashID, e.State = item.ID, nil
+		return nil
+	case JournalTrash:
+		return e.restore(e.Source)
+	case JournalBatch:
+		return e.renameBatch(false)
+	case JournalReplace:
+		return e.revertGroup()
+	default:
+		return fmt.Errorf("unknown operation: %s", e.Op)
+	}
+}
+
+// apply 重新执行已撤销的操作
+func (e *JournalEntry) apply() error {
+	switch e.Op {
+	case JournalRename, JournalMove:
+		return e.rename(e.Source, e.Target)
+	case JournalCreate:
+		return e.restore(e.Target)
+	case JournalTrash:
+		if err := checkState(e.Source, e.State); err != nil {
+			return err
+		}
+		item, err := MoveToTrash(e.Source)
+		if err != nil {
+			return err
+		}
+		e.TrashID, e.State = item.ID, nil
+		return nil
+	case JournalBatch:
+		return e.renameBatch(true)
+	case JournalReplace:
+		return e.applyGroup()
+	default:
+		return fmt.Errorf("unknown operation: %s", e.Op)
+	}
+}
+
+// revertGroup 按相反顺序撤销组中的操作, 中途失败时重做已撤销的操作, 使项目保持撤销前的状态
+func (e *JournalEntry) revertGroup() error {
+	for i := len(e.Items) - 1; i >= 0; i-- {
+		if err := e.Items[i].revert(); err != nil {
+			for _, item := range e.Items[i+1:] {
+				if rollbackErr := item.apply(); rollbackErr != nil {
+					log.Printf("Journal: roll back %s %s error: %v", item.Op, item.Source, rollbackErr)
+				}
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// applyGroup 按顺序重做组中的操作, 中途失败时撤销已重做的操作
+func (e *JournalEntry) applyGroup() error {
+	for i, item := range e.Items {
+		if err := item.apply(); err != nil {
+			for k := i - 1; k >= 0; k-- {
+				if rollbackErr := e.Items[k].revert(); rollbackErr != nil {
+					log.Printf("Journal: roll back %s %s error: %v", e.Items[k].Op, e.Items[k].Source, rollbackErr)
+				}
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// renameBatch 重做(forward)或撤销批量重命名, 先检查所有项目, 有冲突时不做任何修改
+func (e *JournalEntry) renameBatch(forward bool) error {
+	var (
+		moves = make([]renameMove, 0, len(e.Items))
+		froms = make(map[string]bool, len(e.Items))
+	)
+	for _, item := range e.Items {
+		move := renameMove{from: item.Target, to: item.Source}
+		if forward {
+			move = renameMove{from: item.Source, to: item.Target}
+		}
+		if err := checkState(move.from, item.State); err != nil {
+			return err
+		}
+		moves = append(moves, move)
+		froms[move.from] = true
+	}
+	for _, move := range moves {
+		// 被批量中其他项目占用的名称在执行时会先空出来
+		if !froms[move.to] && occupied(move.to, move.from) {
+			return fmt.Errorf("%w: %s already exists", ErrJournalConflict, move.to)
+		}
+	}
+	if err := renameAll(moves); err != nil {
+		return err
+	}
+	for i, item := range e.Items {
+		item.State = fileStateOf(moves[i].to)
+	}
+	return nil
+}
+
+// rename 将项目从 from 移回 to, 移动前检查 from 未被改动且 to 未被占用;
+// 跨设备的移动先复制再删除. 只改变大小写时 to 与 from 是同一个项目, 因此先直接重命名
+func (e *JournalEntry) rename(from, to string) error {
+	if err := checkState(from, e.State); err != nil {
+		return err
+	}
+	if occupied(to, from) {
+		return fmt.Errorf("%w: %s already exists", ErrJournalConflict, to)
+	}
+	err := os.Rename(from, to)
+	if isCrossDevice(err) {
+		err = MovePath(from, to)
+	}
+	if err != nil {
+		return err
+	}
+	e.State = fileStateOf(to)
+	return nil
+}
+
+// restore 将项目从回收站恢复到 path
+func (e *JournalEntry) restore(path string) error {
+	if _, err := RestoreTrashItem(e.TrashID); err != nil {
+		if errors.Is(err, ErrTrashConflict) || errors.Is(err, ErrTrashNotFound) {
+			return fmt.Errorf("%w: %w", ErrJournalConflict, err)
+		}
+		return err
+	}
+	e.TrashID, e.State = "", fileStateOf(path)
+	return nil
+}
+
+// checkState 检查 path 上的项目与记录的状态一致; 文件夹只比较类型, 其中内容的变化不影响撤销
+func checkState(path string, state *FileState) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return fmt.Errorf("%w: %s no longer exists", ErrJournalConflict, path)
+	}
+	if state == nil {
+		return nil
+	}
+	if info.IsDir() != state.IsDir ||
+		!info.IsDir() && (info.Size() != state.Size || !info.ModTime().Equal(state.ModTime)) {
+		return fmt.Errorf("%w: %s has been modified", ErrJournalConflict, path)
+	}
+	return nil
+}
+
+// occupied 判断 path 是否已被其他项目占用; 不区分大小写的文件系统上只改变大小写时 path 与 self 是同一个项目
+func occupied(path, self string) bool {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return false
+	}
+	selfInfo, err := os.Lstat(self)
+	return err != nil || !os.SameFile(info, selfInfo)
+}
+
+func newJournalEntry(op, source, target, trashID string) *JournalEntry {
+	entry := &JournalEntry{
+		ID:        fmt.Sprintf("%d", time.Now().UnixNano()),
+		Op:        op,
+		Source:    source,
+		Target:    target,
+		TrashID:   trashID,
+		CreatedAt: time.Now(),
+	}
+	if target != "" {
+		entry.State = fileStateOf(target)
+	}
+	return entry
+}
+
+func fileStateOf(path string) *FileState {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return nil
+	}
+	return &FileState{IsDir: info.IsDir(), Size: info.Size(), ModTime: info.ModTime()}
+}
@@ -3,86 +3,291 @@ package service
 import (
 	"GoSearch/app/utils"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/tmc/langchaingo/llms"
 	"github.com/tmc/langchaingo/llms/openai"
+	"io"
 	"log"
+	"math/rand"
+	"net"
+	"net/http"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
 var (
-	llm  *openai.LLM
-	temp = 0.6
-	//llmOnce sync.Once
+	llm           atomic.Pointer[llmClient] // 最近一次创建的客户端, 配置变化时整体替换
+	llmLock       sync.Mutex                // 串行化客户端的创建
+	temp          = 0.6
+	LLMTimeout    = 30 * time.Second // 单次请求大模型的超时时间
+	LLMRetryTimes = 3                // 遇到临时错误时的最大尝试次数
+	LLMRetryDelay = 500 * time.Millisecond
 )
 
+// LLMStatusError 大模型接口返回了非 2xx 的状态码
+type LLMStatusError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *LLMStatusError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("API returned unexpected status code: %d", e.StatusCode)
+	}
+	return fmt.Sprintf("API returned unexpected status code: %d: %s", e.StatusCode, e.Message)
+}
+
+// statusDoer 将非 2xx 的响应转换为 LLMStatusError, 重试时按状态码判断而不是匹配错误文本
+type statusDoer struct {
+	client *http.Client
+}
+
+func (d statusDoer) Do(req *http.Request) (*http.Response, error) {
+	resp, err := d.client.Do(req)
+	if err != nil || resp.StatusCode/100 == 2 {
+		return resp, err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	var payload struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	msg := strings.TrimSpace(string(body))
+	if json.Unmarshal(body, &payload) == nil && payload.Error.Message != "" {
+		msg = payload.Error.Message
+	}
+	return nil, &LLMStatusError{StatusCode: resp.StatusCode, Message: msg}
+}
+
 type Message struct {
 	Role    string `json:"role"`
 	Content string `json:"content"`
 }
 
+// llmClient 大模型客户端与本次请求使用的用户数据快照, 一次请求(包括重试)只使用同一个快照,
+// 与前端同时修改配置不会相互影响
+type llmClient struct {
+	*openai.LLM
+	conf *UData
+}
+
 // EnsureInitialLLM 确保大模型对象被初始化
 func EnsureInitialLLM() error {
-	var err error = nil
-	if userData, err = GetUserData(); err != nil {
+	_, err := currentLLM()
+	return err
+}
+
+// currentLLM 返回当前配置对应的大模型客户端, 只在模型、地址或密钥变化时重新创建
+func currentLLM() (*llmClient, error) {
+	data, err := GetUserData()
+	if err == nil && data == nil {
+		err = errors.New("user data unavailable")
+	}
+	if err != nil {
 		log.Print("初始化大模型出错:", err)
+		return nil, err
 	}
-	if err = loadLLM(userData); err != nil {
+	conf := data.snapshot()
+	if client := llm.Load(); client != nil && client.sameEndpoint(conf) {
+		return &llmClient{LLM: client.LLM, conf: conf}, nil
+	}
+
+	llmLock.Lock()
+	defer llmLock.Unlock()
+	if client := llm.Load(); client != nil && client.sameEndpoint(conf) {
+		return &llmClient{LLM: client.LLM, conf: conf}, nil
+	}
+	client, err := loadLLM(conf)
+	if err != nil {
 		log.Print("初始化大模型出错:", err)
+		return nil, err
 	}
-	return err
+	llm.Store(client)
+	return client, nil
+}
+
+// sameEndpoint 判断客户端是否由相同的模型、地址与密钥创建
+func (c *llmClient) sameEndpoint(conf *UData) bool {
+	return c.conf.Model == conf.Model && c.conf.BaseURL == conf.BaseURL && c.conf.ApiKey == conf.ApiKey
 }
 
 // loadLLM 初始化大模型
-func loadLLM(conf *UData) error {
-	var (
-		err error
-	)
-	if llm, err = openai.New(
+func loadLLM(conf *UData) (*llmClient, error) {
+	client, err := openai.New(
 		openai.WithModel(conf.Model),
 		openai.WithBaseURL(conf.BaseURL),
 		openai.WithToken(conf.ApiKey),
-	); err != nil {
+		openai.WithHTTPClient(statusDoer{client: http.DefaultClient}),
+	)
+	if err != nil {
 		log.Printf("初始化大语言模型失败: %v\n", err)
-		return err
+		return nil, err
 	}
-	return nil
+	return &llmClient{LLM: client, conf: conf}, nil
 }
 
-// ParseParamsFromLLM 从用户查询中解析出结构化查询条件
-func ParseParamsFromLLM(query string) (*SearchParams, error) {
+// ParseParamsFromLLM 从用户查询中解析出结构化查询条件, ctx 取消时(例如用户发起了新的检索)立即返回
+// 规则解析足够可信时跳过大模型, 大模型不可用时使用规则解析的结果
+func ParseParamsFromLLM(ctx context.Context, query string) (*SearchParams, error) {
+	rule, confidence := ParseNaturalQuery(query, time.Now())
+	if confidence >= NLConfidenceThreshold {
+		return rule, nil
+	}
+
+	prompt, err := RenderPrompt(PromptSearch, NewPromptData(""))
+	if err != nil {
+		return nil, err
+	}
+	var content []llms.MessageContent
+	content = append(content, llms.TextParts(llms.ChatMessageTypeSystem, prompt.Text))
+	content = append(content, llms.TextParts(llms.ChatMessageTypeHuman, query))
+
+	searchParams, _, err := generateParams(ctx, content, prompt.Version, prompt.Digest)
+	if err != nil && confidence > 0 && ctx.Err() == nil {
+		log.Printf("LLM unavailable, fallback to rule-based parser: %v", err)
+		return rule, nil
+	}
+	return searchParams, err
+}
+
+// generateParams 请求大模型并将输出解析为结构化查询条件, 同时返回模型的原始输出,
+// promptVersion 为系统提示词的版本, 与缓存条目一起保存; promptDigest 为系统提示词的摘要, 参与生成缓存键
+func generateParams(ctx context.Context, content []llms.MessageContent, promptVersion, promptDigest string) (*SearchParams, string, error) {
 	var (
-		ctx      = context.Background()
 		response *llms.ContentResponse
+		output   string
+		cached   bool
+		client   *llmClient
 		err      error
 	)
 
-	if err = EnsureInitialLLM(); err != nil {
-		return nil, err
+	if client, err = currentLLM(); err != nil {
+		return nil, "", err
 	}
 
-	var content []llms.MessageContent
+	// 1. 相同的查询直接使用缓存
+	cache := GetLLMCache()
+	key, day := CacheKey(client.conf.Model, promptVersion+"@"+promptDigest, messageTexts(content))
+	if output, cached = cache.Get(key); !cached {
+		start := time.Now()
+		if response, err = generateWithRetry(ctx, client, UsageSearch, content, llms.WithTemperature(temp)); err != nil {
+			log.Println("模型输出失败:", err)
+			return nil, "", err
+		}
+		log.Printf("大模型输出耗时: %v, 提示词版本: %s", time.Since(start), promptVersion)
+		if len(response.Choices) == 0 {
+			return nil, "", errors.New("empty response from llm")
+		}
+		output = response.Choices[0].Content
+	}
 
-	start := time.Now()
-	content = append(content, llms.TextParts(llms.ChatMessageTypeSystem, utils.SystemPrompt))
-	content = append(content, llms.TextParts(llms.ChatMessageTypeHuman, query))
+	searchParams := &SearchParams{}
+	if err = utils.UnmarshalJSON(output, searchParams); err != nil {
+		return nil, "", err
+	}
+	if _, err = compileMetaFilters(searchParams.Metadata); err != nil {
+		return nil, "", err
+	}
+	// 2. 只缓存能够正确解析的输出
+	if !cached {
+		cache.Put(key, &LLMCacheEntry{
+			Output:        output,
+			Model:         client.conf.Model,
+			PromptVersion: promptVersion,
+			Day:           day,
+		})
+	}
+	return searchParams, output, nil
+}
 
-	if response, err = llm.GenerateContent(ctx, content, llms.WithTemperature(temp)); err != nil {
-		log.Println("模型输出失败:", err)
-		return nil, err
+// generateWithRetry 为每次请求设置超时, 遇到临时错误时指数退避重试, 每次请求都记录用量, purpose 为请求的用途
+func generateWithRetry(ctx context.Context, client *llmClient, purpose string, content []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	var (
+		response *llms.ContentResponse
+		delay    = LLMRetryDelay
+		usage    = GetUsageTracker()
+		err      error
+	)
+	for attempt := 1; attempt <= LLMRetryTimes; attempt++ {
+		// 超出本月限额时不再请求
+		if err = usage.CheckQuota(client.conf); err != nil {
+			return nil, err
+		}
+		start := time.Now()
+		callCtx, cancel := context.WithTimeout(ctx, LLMTimeout)
+		response, err = client.GenerateContent(callCtx, content, options...)
+		cancel()
+		usage.Record(client.conf, purpose, content, response, time.Since(start), err)
+		if err == nil {
+			return response, nil
+		}
+		// 检索会话已取消, 或者是不可恢复的错误, 直接返回
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if !isTransientError(err) || attempt == LLMRetryTimes {
+			break
+		}
+		log.Printf("请求大模型失败(第%d次), %v后重试: %v", attempt, delay, err)
+		select {
+		case <-time.After(delay + time.Duration(rand.Int63n(int64(delay/2)+1))):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		delay *= 2
 	}
-	log.Println("大模型输出耗时：", time.Since(start))
+	return nil, err
+}
 
-	searchParams := &SearchParams{}
-	if err = utils.UnmarshalJSON(response.Choices[0].Content, searchParams); err != nil {
-		return nil, err
+// isTransientError 判断是否为超时、限流、服务端临时故障或网络连接错误等可以重试的错误
+func isTransientError(err error) bool {
+	var statusErr *LLMStatusError
+	if errors.As(err, &statusErr) {
+		switch statusErr.StatusCode {
+		case http.StatusRequestTimeout, http.StatusTooManyRequests, http.StatusInternalServerError,
+			http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
 	}
-	return searchParams, nil
+	// 连接被拒绝、被重置等网络层错误
+	var opErr *net.OpError
+	return errors.As(err, &opErr)
+}
+
+// messageTexts 提取除系统提示词以外的消息文本, 用于生成缓存键; 系统提示词包含当前时间, 以 Prompt.Digest 代替
+func messageTexts(content []llms.MessageContent) []string {
+	var texts []string
+	for _, msg := range content {
+		if msg.Role == llms.ChatMessageTypeSystem {
+			continue
+		}
+		for _, part := range msg.Parts {
+			if text, ok := part.(llms.TextContent); ok {
+				texts = append(texts, string(msg.Role)+":"+text.Text)
+			}
+		}
+	}
+	return texts
 }
 
 // TestLLM 测试大模型是否可用
 func TestLLM() string {
-	if err := EnsureInitialLLM(); err != nil {
+	client, err := currentLLM()
+	if err != nil {
 		if strings.Contains(err.Error(), "missing the OpenAI API key") {
 			log.Println("missing the OpenAI API key")
 			return "missing the OpenAI API key"
@@ -93,12 +298,11 @@ func TestLLM() string {
 	var (
 		ctx      = context.Background()
 		response *llms.ContentResponse
-		err      error
 	)
 	var content []llms.MessageContent
 	content = append(content, llms.TextParts(llms.ChatMessageTypeSystem, "你是一个嵌入至由Go404工作室开发的GoSearch文件检索桌面应用的智能文件搜索助手"))
 	content = append(content, llms.TextParts(llms.ChatMessageTypeHuman, "你好, 你是谁"))
-	if response, err = llm.GenerateContent(ctx, content, llms.WithTemperature(temp)); err != nil {
+	if response, err = generateWithRetry(ctx, client, UsageTest, content, llms.WithTemperature(temp)); err != nil {
 		log.Println("模型输出失败:", err)
 		return err.Error()
 	}
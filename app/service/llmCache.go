@@ -0,0 +1,181 @@
+package service
+
+import (
+	"GoSearch/app/utils"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	llmCache        *LLMCache
+	llmCacheOnce    sync.Once
+	LLMCacheMaxSize = 500                 // 最多缓存的条目数量
+	LLMCacheTTL     = 30 * 24 * time.Hour // 与日期无关的查询缓存有效期
+)
+
+// 包含相对日期的查询(今天、上周、last month...)的解析结果依赖当天日期, 只在当天有效
+var relativeDateRe = regexp.MustCompile(`(?i)(今天|今日|昨天|前天|明天|本周|这周|上周|上个?星期|本月|这个月|上个?月|今年|去年|前年|最近|近\d*[天周月年]|\d+\s*[天周个月年]+[前内]|以来|today|yesterday|tomorrow|tonight|this\s+(week|month|year)|last\s+(week|month|year|spring|summer|autumn|fall|winter|\d+)|past\s+\d*|recent|ago|since)`)
+
+// LLMCacheEntry 缓存的大模型输出
+type LLMCacheEntry struct {
+	Output        string    `json:"output"`
+	Model         string    `json:"model"`
+	PromptVersion string    `json:"prompt_version"`
+	Day           string    `json:"day,omitempty"` // 不为空时表示该条目只在这一天有效
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// LLMCache 大模型响应的磁盘缓存, key为 规范化的查询+模型+提示词版本 的摘要
+type LLMCache struct {
+	lock     sync.Mutex
+	entries  map[string]*LLMCacheEntry
+	filePath string
+}
+
+// GetLLMCache 获取缓存单例对象
+func GetLLMCache() *LLMCache {
+	llmCacheOnce.Do(func() {
+		llmCache = &LLMCache{entries: make(map[string]*LLMCacheEntry)}
+		if bootConf, _, err := EnsureConfigInitialized(); err == nil && bootConf != nil {
+			llmCache.filePath = utils.Join(bootConf.CustomConfigDir, utils.LLMCacheFileName)
+			if err = llmCache.load(); err != nil {
+				log.Printf("LLMCache: load error: %v", err)
+			}
+		}
+	})
+	return llmCache
+}
+
+// CacheKey 根据会话内容、模型与提示词版本生成缓存键, 相对日期的查询额外带上当天日期
+func CacheKey(model, promptVersion string, messages []string) (string, string) {
+	var (
+		h   = sha256.New()
+		day string
+	)
+	h.Write([]byte(model))
+	h.Write([]byte{0})
+	h.Write([]byte(promptVersion))
+	for _, msg := range messages {
+		normalized := normalizeQuery(msg)
+		if relativeDateRe.MatchString(normalized) {
+			day = time.Now().Format("2006-01-02")
+		}
+		h.Write([]byte{0})
+		h.Write([]byte(normalized))
+	}
+	if day != "" {
+		h.Write([]byte{0})
+		h.Write([]byte(day))
+	}
+	return hex.EncodeToString(h.Sum(nil)), day
+}
+
+// Get 查找缓存, 过期条目会被删除
+func (c *LLMCache) Get(key string) (string, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	entry, ok := c.entries[key]
+	if !ok {
+		return "", false
+	}
+	if c.expired(entry, time.Now()) {
+		delete(c.entries, key)
+		return "", false
+	}
+	return entry.Output, true
+}
+
+// Put 写入缓存并保存到磁盘
+func (c *LLMCache) Put(key string, entry *LLMCacheEntry) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	entry.CreatedAt = time.Now()
+	c.entries[key] = entry
+	c.evict()
+	if err := c.save(); err != nil {
+		log.Printf("LLMCache: save error: %v", err)
+	}
+}
+
+// Clear 清空缓存
+func (c *LLMCache) Clear() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.entries = make(map[string]*LLMCacheEntry)
+	return c.save()
+}
+
+func (c *LLMCache) expired(entry *LLMCacheEntry, now time.Time) bool {
+	if entry.Day != "" {
+		return entry.Day != now.Format("2006-01-02")
+	}
+	return now.Sub(entry.CreatedAt) > LLMCacheTTL
+}
+
+// evict 清理过期条目, 超出容量时淘汰最早写入的条目
+func (c *LLMCache) evict() {
+	now := time.Now()
+	for key, entry := range c.entries {
+		if c.expired(entry, now) {
+			delete(c.entries, key)
+		}
+	}
+	if len(c.entries) <= LLMCacheMaxSize {
+		return
+	}
+	keys := make([]string, 0, len(c.entries))
+	for key := range c.entries {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return c.entries[keys[i]].CreatedAt.Before(c.entries[keys[j]].CreatedAt)
+	})
+	for _, key := range keys[:len(keys)-LLMCacheMaxSize] {
+		delete(c.entries, key)
+	}
+}
+
+func (c *LLMCache) load() error {
+	data, err := os.ReadFile(c.filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if err = json.Unmarshal(data, &c.entries); err != nil {
+		c.entries = make(map[string]*LLMCacheEntry)
+		return err
+	}
+	if c.entries == nil {
+		c.entries = make(map[string]*LLMCacheEntry)
+	}
+	return nil
+}
+
+func (c *LLMCache) save() error {
+	if c.filePath == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(c.entries, "", " ")
+	if err != nil {
+		return err
+	}
+	return utils.StoreFile(c.filePath, data)
+}
+
+// normalizeQuery 统一大小写、全角标点与空白, 使等价的查询命中同一缓存
+func normalizeQuery(query string) string {
+	query = strings.ToLower(strings.TrimSpace(query))
+	query = strings.NewReplacer("，", ",", "。", ".", "：", ":", "；", ";", "！", "!", "？", "?", "（", "(", "）", ")").Replace(query)
+	query = strings.Join(strings.Fields(query), " ")
+	return strings.TrimRight(query, ".!?")
+}
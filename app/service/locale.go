@@ -0,0 +1,23 @@
+package service
+
+import (
+	"os"
+	"strings"
+)
+
+// envLanguage 环境变量中的语言, 例如 zh_CN.UTF-8 返回 zh_CN, 未设置或为 C/POSIX 时返回空
+func envLanguage() string {
+	lang := os.Getenv("LC_ALL")
+	if lang == "" {
+		lang = os.Getenv("LC_MESSAGES")
+	}
+	if lang == "" {
+		lang = os.Getenv("LANG")
+	}
+	lang, _, _ = strings.Cut(lang, ".")
+	lang, _, _ = strings.Cut(lang, "@")
+	if lang == "C" || lang == "POSIX" {
+		return ""
+	}
+	return lang
+}
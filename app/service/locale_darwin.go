@@ -0,0 +1,20 @@
+//go:build darwin
+
+package service
+
+import (
+	"os/exec"
+	"strings"
+)
+
+// systemLanguage 从访达启动时没有 LANG 等环境变量, 读取系统偏好设置中的地区, 例如 zh_CN
+func systemLanguage() string {
+	if lang := envLanguage(); lang != "" {
+		return lang
+	}
+	out, err := exec.Command("/usr/bin/defaults", "read", "-g", "AppleLocale").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
@@ -0,0 +1,8 @@
+//go:build !windows && !darwin
+
+package service
+
+// systemLanguage 系统语言, 例如 zh_CN
+func systemLanguage() string {
+	return envLanguage()
+}
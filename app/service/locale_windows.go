@@ -0,0 +1,13 @@
+//go:build windows
+
+package service
+
+import "golang.org/x/sys/windows"
+
+// systemLanguage 用户的首选界面语言, 例如 zh-CN
+func systemLanguage() string {
+	if langs, err := windows.GetUserPreferredUILanguages(windows.MUI_LANGUAGE_NAME); err == nil && len(langs) > 0 {
+		return langs[0]
+	}
+	return envLanguage()
+}
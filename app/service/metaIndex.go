@@ -0,0 +1,648 @@
+package service
+
+import (
+	"GoSearch/app/dto"
+	"GoSearch/app/utils"
+	"encoding/gob"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 支持过滤的元数据字段
+const (
+	MetaCamera   = "camera"   // 相机品牌与型号
+	MetaTaken    = "taken"    // 拍摄时间
+	MetaWidth    = "width"    // 图片宽度(像素)
+	MetaHeight   = "height"   // 图片高度(像素)
+	MetaArtist   = "artist"   // 歌手
+	MetaAlbum    = "album"    // 专辑
+	MetaTitle    = "title"    // 音频或文档的标题
+	MetaGenre    = "genre"    // 流派
+	MetaAuthor   = "author"   // 文档作者
+	MetaPages    = "pages"    // 文档页数
+	MetaDuration = "duration" // 音频时长(秒)
+)
+
+// 元数据字段的取值类型
+const (
+	metaText = iota
+	metaNumber
+	metaDate
+)
+
+// 可以提供元数据的文件类别
+const (
+	metaImage uint8 = 1 << iota
+	metaAudio
+	metaDocument
+)
+
+// metaIndexVersion 快照格式的版本, 修改字段的含义后需要同步修改, 旧版本的快照会被忽略
+const metaIndexVersion = 1
+
+var (
+	MetaIndexMaxRows    = 200000 // 索引的最大文件数, 超出时淘汰最久未使用的条目
+	MetaIndexEvictRatio = 0.1    // 每次淘汰的比例
+)
+
+var (
+	metaFields = map[string]struct {
+		kind   int
+		groups uint8
+	}{
+		MetaCamera:   {metaText, metaImage},
+		MetaTaken:    {metaDate, metaImage},
+		MetaWidth:    {metaNumber, metaImage},
+		MetaHeight:   {metaNumber, metaImage},
+		MetaArtist:   {metaText, metaAudio},
+		MetaAlbum:    {metaText, metaAudio},
+		MetaTitle:    {metaText, metaAudio | metaDocument},
+		MetaGenre:    {metaText, metaAudio},
+		MetaAuthor:   {metaText, metaDocument},
+		MetaPages:    {metaNumber, metaDocument},
+		MetaDuration: {metaNumber, metaAudio},
+	}
+	// 字段的其他写法
+	metaAliases = map[string]string{
+		"相机": MetaCamera, "拍摄": MetaTaken, "拍摄时间": MetaTaken, "宽": MetaWidth, "宽度": MetaWidth,
+		"高": MetaHeight, "高度": MetaHeight, "歌手": MetaArtist, "艺术家": MetaArtist, "专辑": MetaAlbum,
+		"标题": MetaTitle, "流派": MetaGenre, "作者": MetaAuthor, "页数": MetaPages, "时长": MetaDuration,
+	}
+	// 查询中的元数据条件, 例如 camera:Canon、pages:>20、artist:"周杰伦"
+	metaTokenRe     = regexp.MustCompile(`(?i)(?:^|\s)(` + metaKeyPattern() + `)\s*[:：]\s*(>=|<=|>|<|=)?\s*(?:"([^"]*)"|“([^”]*)”|([^\s"“]+))`)
+	metaDateLayouts = []struct {
+		layout        string
+		years, months int
+		days          int
+	}{
+		{"2006", 1, 0, 0}, {"2006-01", 0, 1, 0}, {"2006/01", 0, 1, 0}, {"2006-01-02", 0, 0, 1}, {"2006/01/02", 0, 0, 1},
+	}
+)
+
+var (
+	metaIndex     *MetaIndex
+	metaIndexOnce sync.Once
+)
+
+// metaCondition 编译后的元数据条件, 数值与时间统一为闭区间 [lo, hi], 时间以秒为单位
+type metaCondition struct {
+	field  string
+	kind   int
+	groups uint8
+	text   string // 小写
+	exact  bool
+	lo, hi float64
+}
+
+// metaRow 从一个文件中读取到的元数据
+type metaRow struct {
+	text   map[string]string
+	number map[string]float64
+}
+
+// metaSnapshot 元数据索引的持久化格式, 每个字段一列, 同一行属于同一个文件
+type metaSnapshot struct {
+	Version  int
+	Paths    []string
+	Sizes    []int64
+	ModTimes []int64
+	Used     []int64
+	Text     map[string][]string
+	Number   map[string][]float64
+}
+
+// MetaIndex 按列保存文件元数据的索引, 文件的大小与修改时间不变时直接使用索引中的值,
+// 检索时不需要重新解析每一个文件
+type MetaIndex struct {
+	lock     sync.RWMutex
+	saveLock sync.Mutex
+	rows     map[string]int // key: 文件绝对路径, value: 行号
+	paths    []string
+	sizes    []int64
+	modTimes []int64 // 纳秒
+	used     []int64 // 最后一次检索命中该行的时间, 用于淘汰
+	text     map[string][]string
+	number   map[string][]float64 // NaN 表示文件没有该项元数据
+	free     []int                // 被淘汰后可以复用的行
+	filePath string
+	dirty    bool
+}
+
+// GetMetaIndex 获取元数据索引单例对象, 首次调用时从配置目录加载
+func GetMetaIndex() *MetaIndex {
+	metaIndexOnce.Do(func() {
+		metaIndex = &MetaIndex{
+			rows:   make(map[string]int),
+			text:   make(map[string][]string),
+			number: make(map[string][]float64),
+		}
+		for name, field := range metaFields {
+			if field.kind == metaText {
+				metaIndex.text[name] = nil
+			} else {
+				metaIndex.number[name] = nil
+			}
+		}
+		if bootConf, _, err := EnsureConfigInitialized(); err == nil && bootConf != nil {
+			metaIndex.filePath = utils.Join(bootConf.CustomConfigDir, utils.MetaIndexFileName)
+			if err = metaIndex.load(); err != nil {
+				log.Printf("MetaIndex: load error: %v", err)
+			}
+		}
+	})
+	return metaIndex
+}
+
+// ExtractMetaFilters 从查询中取出 key:value 形式的元数据条件, 返回条件与剩余的查询
+func ExtractMetaFilters(query string) ([]dto.MetaFilter, string) {
+	matches := metaTokenRe.FindAllStringSubmatchIndex(query, -1)
+	if len(matches) == 0 {
+		return nil, query
+	}
+	var (
+		filters = make([]dto.MetaFilter, 0, len(matches))
+		rest    strings.Builder
+		last    int
+	)
+	for _, m := range matches {
+		filters = append(filters, metaToken(query, m))
+		rest.WriteString(query[last:m[0]])
+		rest.WriteByte(' ')
+		last = m[1]
+	}
+	rest.WriteString(query[last:])
+	return filters, strings.Join(strings.Fields(rest.String()), " ")
+}
+
+// metaToken 将 metaTokenRe 的一个匹配转换为过滤条件
+func metaToken(text string, m []int) dto.MetaFilter {
+	filter := dto.MetaFilter{Field: metaFieldName(text[m[2]:m[3]])}
+	if m[4] != -1 {
+		filter.Op = text[m[4]:m[5]]
+	}
+	for i := 6; i < len(m); i += 2 {
+		if m[i] != -1 {
+			filter.Value = text[m[i]:m[i+1]]
+			break
+		}
+	}
+	return filter
+}
+
+func metaFieldName(field string) string {
+	field = strings.ToLower(strings.TrimSpace(field))
+	if name, ok := metaAliases[field]; ok {
+		return name
+	}
+	return field
+}
+
+// metaKeyPattern 所有字段名与别名组成的正则, 较长的在前, 避免"宽度"被匹配为"宽"
+func metaKeyPattern() string {
+	keys := make([]string, 0, len(metaFields)+len(metaAliases))
+	for name := range metaFields {
+		keys = append(keys, name)
+	}
+	for alias := range metaAliases {
+		keys = append(keys, alias)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if len(keys[i]) != len(keys[j]) {
+			return len(keys[i]) > len(keys[j])
+		}
+		return keys[i] < keys[j]
+	})
+	return strings.Join(keys, "|")
+}
+
+// compileMetaFilters 校验并编译元数据条件
+func compileMetaFilters(filters []dto.MetaFilter) ([]*metaCondition, error) {
+	conds := make([]*metaCondition, 0, len(filters))
+	for _, filter := range filters {
+		name := metaFieldName(filter.Field)
+		field, ok := metaFields[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown metadata field: %s", filter.Field)
+		}
+		cond := &metaCondition{field: name, kind: field.kind, groups: field.groups, lo: math.Inf(-1), hi: math.Inf(1)}
+		op, value := strings.TrimSpace(filter.Op), strings.TrimSpace(filter.Value)
+		// 操作符也可以写在值中, 例如 {"field": "pages", "value": ">20"}
+		if op == "" {
+			op, value = splitMetaOp(value)
+		}
+		if value == "" {
+			return nil, fmt.Errorf("metadata field %s: value is empty", name)
+		}
+		var err error
+		if field.kind == metaText {
+			err = cond.compileText(op, value)
+		} else {
+			err = cond.compileRange(op, value)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("metadata field %s: %w", name, err)
+		}
+		conds = append(conds, cond)
+	}
+	return conds, nil
+}
+
+func splitMetaOp(value string) (string, string) {
+	for _, op := range []string{">=", "<=", ">", "<", "="} {
+		if strings.HasPrefix(value, op) {
+			return op, strings.TrimSpace(value[len(op):])
+		}
+	}
+	return "", value
+}
+
+func (cond *metaCondition) compileText(op, value string) error {
+	switch op {
+	case "", ":", "~":
+	case "=":
+		cond.exact = true
+	default:
+		return fmt.Errorf("invalid operator %s for text", op)
+	}
+	cond.text = strings.ToLower(value)
+	return nil
+}
+
+// compileRange 将数值或时间条件转换为闭区间, 时间的精度为年、月或日时表示整个时间段
+func (cond *metaCondition) compileRange(op, value string) error {
+	// 范围: 2020..2022, 10..20, 省略一端表示不限
+	if low, high, ok := strings.Cut(value, ".."); ok {
+		if op != "" && op != "=" {
+			return fmt.Errorf("invalid operator %s for range", op)
+		}
+		if low = strings.TrimSpace(low); low != "" {
+			start, _, err := cond.parseBound(low)
+			if err != nil {
+				return err
+			}
+			cond.lo = start
+		}
+		if high = strings.TrimSpace(high); high != "" {
+			_, end, err := cond.parseBound(high)
+			if err != nil {
+				return err
+			}
+			cond.hi = end
+		}
+		if cond.lo > cond.hi {
+			return fmt.Errorf("invalid range: %s", value)
+		}
+		return nil
+	}
+
+	start, end, err := cond.parseBound(value)
+	if err != nil {
+		return err
+	}
+	switch op {
+	case "", "=":
+		cond.lo, cond.hi = start, end
+	case ">":
+		cond.lo = math.Nextafter(end, math.Inf(1))
+	case ">=":
+		cond.lo = start
+	case "<":
+		cond.hi = math.Nextafter(start, math.Inf(-1))
+	case "<=":
+		cond.hi = end
+	default:
+		return fmt.Errorf("invalid operator: %s", op)
+	}
+	return nil
+}
+
+// parseBound 解析一个数值或时间, 返回它覆盖的闭区间
+func (cond *metaCondition) parseBound(value string) (float64, float64, error) {
+	if cond.kind == metaDate {
+		return parseMetaDate(value)
+	}
+	value = strings.TrimSuffix(strings.ToLower(value), "px")
+	if n, err := strconv.ParseFloat(value, 64); err == nil {
+		return n, n, nil
+	}
+	// 时长也可以写作 3m30s、1h
+	if cond.field == MetaDuration {
+		if d, err := time.ParseDuration(value); err == nil {
+			return d.Seconds(), d.Seconds(), nil
+		}
+	}
+	return 0, 0, fmt.Errorf("invalid number: %s", value)
+}
+
+// parseMetaDate 解析 YYYY、YYYY-MM、YYYY-MM-DD 或 RFC3339 格式的时间, 返回覆盖的起止秒数
+func parseMetaDate(value string) (float64, float64, error) {
+	for _, l := range metaDateLayouts {
+		if t, err := time.ParseInLocation(l.layout, value, time.Local); err == nil {
+			return float64(t.Unix()), float64(t.AddDate(l.years, l.months, l.days).Unix() - 1), nil
+		}
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return float64(t.Unix()), float64(t.Unix()), nil
+	}
+	return 0, 0, fmt.Errorf("invalid date: %s", value)
+}
+
+func (cond *metaCondition) matchText(value string) bool {
+	if value == "" {
+		return false
+	}
+	value = strings.ToLower(value)
+	if cond.exact {
+		return value == cond.text
+	}
+	return strings.Contains(value, cond.text)
+}
+
+// matchNumber NaN 与任何区间比较都为false, 缺少该项元数据的文件不匹配
+func (cond *metaCondition) matchNumber(value float64) bool {
+	return value >= cond.lo && value <= cond.hi
+}
+
+// metaFileGroup 按扩展名判断文件能提供哪一类元数据
+func metaFileGroup(path string) uint8 {
+	ext := strings.ToLower(filepath.Ext(path))
+	switch {
+	case thumbnailExts[ext] != "":
+		return metaImage
+	case ext == ".mp3" || ext == ".flac":
+		return metaAudio
+	case ext == ".pdf" || ext == ".docx" || ext == ".xlsx" || ext == ".pptx":
+		return metaDocument
+	}
+	return 0
+}
+
+// Match 判断文件的元数据是否满足全部条件; 文件未修改时使用索引中的值, 否则重新读取并更新索引
+func (mi *MetaIndex) Match(entry *FileSystemEntry, conds []*metaCondition) bool {
+	group := metaFileGroup(entry.Path)
+	for _, cond := range conds {
+		// 不可能有该项元数据的文件不需要读取
+		if cond.groups&group == 0 {
+			return false
+		}
+	}
+	if matched, ok := mi.lookup(entry, conds); ok {
+		return matched
+	}
+	row := readMetaRow(entry.Path, group)
+	mi.store(entry, row)
+	return row.match(conds)
+}
+
+// lookup 使用索引中的值进行匹配, 文件不在索引中或已被修改时返回false
+func (mi *MetaIndex) lookup(entry *FileSystemEntry, conds []*metaCondition) (bool, bool) {
+	mi.lock.RLock()
+	defer mi.lock.RUnlock()
+	r, ok := mi.rows[entry.Path]
+	if !ok || mi.sizes[r] != entry.Size || mi.modTimes[r] != entry.ModTime.UnixNano() {
+		return false, false
+	}
+	atomic.StoreInt64(&mi.used[r], time.Now().Unix())
+	for _, cond := range conds {
+		if cond.kind == metaText {
+			if !cond.matchText(mi.text[cond.field][r]) {
+				return false, true
+			}
+		} else if !cond.matchNumber(mi.number[cond.field][r]) {
+			return false, true
+		}
+	}
+	return true, true
+}
+
+func (mi *MetaIndex) store(entry *FileSystemEntry, row *metaRow) {
+	mi.lock.Lock()
+	defer mi.lock.Unlock()
+	r, ok := mi.rows[entry.Path]
+	if !ok {
+		if len(mi.rows) >= MetaIndexMaxRows {
+			mi.evict()
+		}
+		r = mi.allocate()
+		mi.rows[entry.Path] = r
+		mi.paths[r] = entry.Path
+	}
+	mi.sizes[r], mi.modTimes[r], mi.used[r] = entry.Size, entry.ModTime.UnixNano(), time.Now().Unix()
+	for name, column := range mi.text {
+		column[r] = row.text[name]
+	}
+	for name, column := range mi.number {
+		if value, ok := row.number[name]; ok {
+			column[r] = value
+		} else {
+			column[r] = math.NaN()
+		}
+	}
+	mi.dirty = true
+}
+
+// allocate 分配一行, 优先复用被淘汰的行
+func (mi *MetaIndex) allocate() int {
+	if n := len(mi.free); n > 0 {
+		r := mi.free[n-1]
+		mi.free = mi.free[:n-1]
+		return r
+	}
+	mi.paths = append(mi.paths, "")
+	mi.sizes = append(mi.sizes, 0)
+	mi.modTimes = append(mi.modTimes, 0)
+	mi.used = append(mi.used, 0)
+	for name, column := range mi.text {
+		mi.text[name] = append(column, "")
+	}
+	for name, column := range mi.number {
+		mi.number[name] = append(column, math.NaN())
+	}
+	return len(mi.paths) - 1
+}
+
+// evict 淘汰最久未被检索使用的一部分行, 调用方需要持有写锁
+func (mi *MetaIndex) evict() {
+	rows := make([]int, 0, len(mi.rows))
+	for _, r := range mi.rows {
+		rows = append(rows, r)
+	}
+	sort.Slice(rows, func(i, j int) bool { return mi.used[rows[i]] < mi.used[rows[j]] })
+	n := max(1, int(float64(len(rows))*MetaIndexEvictRatio))
+	for _, r := range rows[:min(n, len(rows))] {
+		delete(mi.rows, mi.paths[r])
+		mi.paths[r] = ""
+		mi.free = append(mi.free, r)
+	}
+	log.Printf("MetaIndex: evicted %d rows", n)
+}
+
+// readMetaRow 读取文件的元数据, 读取失败的文件也会记录到索引中, 避免每次检索重复读取
+func readMetaRow(path string, group uint8) *metaRow {
+	row := &metaRow{text: make(map[string]string), number: make(map[string]float64)}
+	switch group {
+	case metaImage:
+		if info := readImageInfo(path); info != nil {
+			camera := info.Model
+			// 多数相机的型号中已经包含了品牌
+			if !strings.HasPrefix(strings.ToLower(info.Model), strings.ToLower(info.Make)) {
+				camera = info.Make + " " + info.Model
+			}
+			row.text[MetaCamera] = strings.TrimSpace(camera)
+			row.number[MetaWidth], row.number[MetaHeight] = float64(info.Width), float64(info.Height)
+			if info.DateTaken != nil {
+				row.number[MetaTaken] = float64(info.DateTaken.Unix())
+			}
+		}
+	case metaAudio:
+		if info, err := ReadAudioInfo(path); err == nil {
+			row.text[MetaArtist], row.text[MetaAlbum] = info.Artist, info.Album
+			row.text[MetaTitle], row.text[MetaGenre] = info.Title, info.Genre
+			if info.Duration > 0 {
+				row.number[MetaDuration] = info.Duration
+			}
+		}
+	case metaDocument:
+		if info, err := ReadDocumentInfo(path); err == nil {
+			row.text[MetaTitle], row.text[MetaAuthor] = info.Title, info.Author
+			if info.Pages > 0 {
+				row.number[MetaPages] = float64(info.Pages)
+			}
+		}
+	}
+	return row
+}
+
+func (row *metaRow) match(conds []*metaCondition) bool {
+	for _, cond := range conds {
+		if cond.kind == metaText {
+			if !cond.matchText(row.text[cond.field]) {
+				return false
+			}
+			continue
+		}
+		value, ok := row.number[cond.field]
+		if !ok || !cond.matchNumber(value) {
+			return false
+		}
+	}
+	return true
+}
+
+// Save 将索引写入配置目录, 没有变化时跳过
+func (mi *MetaIndex) Save() error {
+	mi.saveLock.Lock()
+	defer mi.saveLock.Unlock()
+
+	// 复制后释放锁再写文件, 不阻塞正在进行的检索
+	mi.lock.Lock()
+	if !mi.dirty || mi.filePath == "" {
+		mi.lock.Unlock()
+		return nil
+	}
+	snapshot := &metaSnapshot{
+		Version:  metaIndexVersion,
+		Paths:    make([]string, 0, len(mi.rows)),
+		Sizes:    make([]int64, 0, len(mi.rows)),
+		ModTimes: make([]int64, 0, len(mi.rows)),
+		Used:     make([]int64, 0, len(mi.rows)),
+		Text:     make(map[string][]string, len(mi.text)),
+		Number:   make(map[string][]float64, len(mi.number)),
+	}
+	// 跳过被淘汰的行
+	for r, path := range mi.paths {
+		if path == "" {
+			continue
+		}
+		snapshot.Paths = append(snapshot.Paths, path)
+		snapshot.Sizes = append(snapshot.Sizes, mi.sizes[r])
+		snapshot.ModTimes = append(snapshot.ModTimes, mi.modTimes[r])
+		snapshot.Used = append(snapshot.Used, atomic.LoadInt64(&mi.used[r]))
+		for name, column := range mi.text {
+			snapshot.Text[name] = append(snapshot.Text[name], column[r])
+		}
+		for name, column := range mi.number {
+			snapshot.Number[name] = append(snapshot.Number[name], column[r])
+		}
+	}
+	mi.dirty = false
+	mi.lock.Unlock()
+
+	// 先写临时文件再替换, 防止写入中断导致索引损坏
+	tmpPath := mi.filePath + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err == nil {
+		if err = gob.NewEncoder(file).Encode(snapshot); err != nil {
+			_ = file.Close()
+		} else if err = file.Close(); err == nil {
+			err = os.Rename(tmpPath, mi.filePath)
+		}
+	}
+	if err != nil {
+		mi.lock.Lock()
+		mi.dirty = true
+		mi.lock.Unlock()
+		return err
+	}
+	log.Printf("MetaIndex: saved %d rows", len(snapshot.Paths))
+	return nil
+}
+
+func (mi *MetaIndex) load() error {
+	file, err := os.Open(mi.filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+
+	snapshot := &metaSnapshot{}
+	if err = gob.NewDecoder(file).Decode(snapshot); err != nil {
+		return fmt.Errorf("decode %s: %w", mi.filePath, err)
+	}
+	if snapshot.Version != metaIndexVersion {
+		log.Printf("MetaIndex: ignore snapshot version %d", snapshot.Version)
+		return nil
+	}
+	n := len(snapshot.Paths)
+	if len(snapshot.Sizes) != n || len(snapshot.ModTimes) != n || len(snapshot.Used) != n {
+		return fmt.Errorf("decode %s: column length mismatch", mi.filePath)
+	}
+	// 字段与当前版本不一致的快照不能使用, 否则未修改的文件会缺少新增字段的值
+	for name := range mi.text {
+		if len(snapshot.Text[name]) != n {
+			log.Printf("MetaIndex: ignore snapshot without column %s", name)
+			return nil
+		}
+	}
+	for name := range mi.number {
+		if len(snapshot.Number[name]) != n {
+			log.Printf("MetaIndex: ignore snapshot without column %s", name)
+			return nil
+		}
+	}
+	for name := range mi.text {
+		mi.text[name] = snapshot.Text[name]
+	}
+	for name := range mi.number {
+		mi.number[name] = snapshot.Number[name]
+	}
+	mi.paths, mi.sizes, mi.modTimes, mi.used = snapshot.Paths, snapshot.Sizes, snapshot.ModTimes, snapshot.Used
+	for r, path := range mi.paths {
+		mi.rows[path] = r
+	}
+	log.Printf("MetaIndex: loaded %d rows", n)
+	return nil
+}
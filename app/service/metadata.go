@@ -0,0 +1,479 @@
+package service
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"golang.org/x/text/encoding/charmap"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	MaxTagSize      = 1 << 20 // 读取的 ID3v2 标签与 FLAC 元数据块的最大长度, 跳过其中的大封面图片
+	pdfInfoPattern  = regexp.MustCompile(`/Info\s+(\d+)\s+(\d+)\s+R`)
+	pdfPagesPattern = regexp.MustCompile(`<<[^<>]*/Type\s*/Pages\b[^<>]*>>`)
+	pdfCountPattern = regexp.MustCompile(`/Count\s+(\d+)`)
+	pdfPagePattern  = regexp.MustCompile(`/Type\s*/Page\b`)
+	pdfDatePattern  = regexp.MustCompile(`^D:(\d{4})(\d{2})?(\d{2})?(\d{2})?(\d{2})?(\d{2})?`)
+)
+
+// AudioInfo 音频文件的标签(ID3v1/ID3v2/FLAC Vorbis Comment)与流信息
+type AudioInfo struct {
+	Title      string  `json:"title,omitempty"`
+	Artist     string  `json:"artist,omitempty"`
+	Album      string  `json:"album,omitempty"`
+	Year       string  `json:"year,omitempty"`
+	Track      string  `json:"track,omitempty"`
+	Genre      string  `json:"genre,omitempty"`
+	Duration   float64 `json:"duration,omitempty"` // 秒, 只有 FLAC 可以直接读出
+	SampleRate int     `json:"sample_rate,omitempty"`
+	Channels   int     `json:"channels,omitempty"`
+}
+
+// DocumentInfo PDF 与 Office 文档的属性
+type DocumentInfo struct {
+	Title       string     `json:"title,omitempty"`
+	Author      string     `json:"author,omitempty"`
+	Subject     string     `json:"subject,omitempty"`
+	Application string     `json:"application,omitempty"`
+	Pages       int        `json:"pages,omitempty"`  // PDF、docx 的页数, pptx 的幻灯片数
+	Sheets      int        `json:"sheets,omitempty"` // xlsx 的工作表数
+	Words       int        `json:"words,omitempty"`
+	Created     *time.Time `json:"created,omitempty"`
+	Modified    *time.Time `json:"modified,omitempty"`
+}
+
+// ReadAudioInfo 读取 MP3 的 ID3 标签或 FLAC 的 Vorbis Comment 与流信息
+func ReadAudioInfo(path string) (*AudioInfo, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var magic [4]byte
+	if _, err = io.ReadFull(file, magic[:]); err != nil {
+		return nil, err
+	}
+	if _, err = file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	info := &AudioInfo{}
+	switch {
+	case string(magic[:]) == "fLaC":
+		err = readFLAC(file, info)
+	case string(magic[:3]) == "ID3":
+		err = readID3v2(file, info)
+	}
+	if err != nil {
+		return nil, err
+	}
+	// 没有 ID3v2 标签时使用文件末尾的 ID3v1
+	if *info == (AudioInfo{}) {
+		readID3v1(file, info)
+	}
+	if *info == (AudioInfo{}) {
+		return nil, fmt.Errorf("no audio tags")
+	}
+	return info, nil
+}
+
+// readID3v2 读取 ID3v2.2/2.3/2.4 中的文字帧
+func readID3v2(r io.Reader, info *AudioInfo) error {
+	var header [10]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return err
+	}
+	version, flags := header[3], header[5]
+	size := synchsafe(header[6:10])
+	if size > MaxTagSize {
+		size = MaxTagSize
+	}
+	data := make([]byte, size)
+	n, _ := io.ReadFull(r, data)
+	data = data[:n]
+	// 扩展头
+	if flags&0x40 != 0 && version >= 3 && len(data) >= 4 {
+		extSize := int(binary.BigEndian.Uint32(data))
+		if version == 4 {
+			extSize = synchsafe(data[:4])
+		} else {
+			extSize += 4
+		}
+		if extSize > len(data) {
+			return nil
+		}
+		data = data[extSize:]
+	}
+	idSize, headerSize := 4, 10
+	if version == 2 {
+		idSize, headerSize = 3, 6
+	}
+	for len(data) >= headerSize && data[0] != 0 {
+		id := string(data[:idSize])
+		var frameSize int
+		switch version {
+		case 2:
+			frameSize = int(data[3])<<16 | int(data[4])<<8 | int(data[5])
+		case 4:
+			frameSize = synchsafe(data[4:8])
+		default:
+			frameSize = int(binary.BigEndian.Uint32(data[4:8]))
+		}
+		if frameSize <= 0 || headerSize+frameSize > len(data) {
+			break
+		}
+		frame := data[headerSize : headerSize+frameSize]
+		data = data[headerSize+frameSize:]
+		if id[0] != 'T' || len(frame) < 2 {
+			continue
+		}
+		value := id3Text(frame[0], frame[1:])
+		switch id {
+		case "TIT2", "TT2":
+			info.Title = value
+		case "TPE1", "TP1":
+			info.Artist = value
+		case "TALB", "TAL":
+			info.Album = value
+		case "TYER", "TDRC", "TYE":
+			info.Year = value
+		case "TRCK", "TRK":
+			info.Track = value
+		case "TCON", "TCO":
+			info.Genre = value
+		}
+	}
+	return nil
+}
+
+// id3Text 按 ID3 的文字编码解码: 0 为 ISO-8859-1, 1 为带 BOM 的 UTF-16, 2 为 UTF-16BE, 3 为 UTF-8
+func id3Text(encoding byte, data []byte) string {
+	var text string
+	switch encoding {
+	case 1:
+		switch {
+		case bytes.HasPrefix(data, []byte{0xFF, 0xFE}):
+			text = decodeUTF16(data[2:], false)
+		case bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+			text = decodeUTF16(data[2:], true)
+		default:
+			text = decodeUTF16(data, false)
+		}
+	case 2:
+		text = decodeUTF16(data, true)
+	case 3:
+		text = string(data)
+	default:
+		text = latin1(data)
+	}
+	// 多个值以 0 分隔
+	text, _, _ = strings.Cut(text, "\x00")
+	return strings.TrimSpace(text)
+}
+
+// readID3v1 读取文件末尾 128 字节的 ID3v1 标签
+func readID3v1(file *os.File, info *AudioInfo) {
+	var tag [128]byte
+	if _, err := file.Seek(-128, io.SeekEnd); err != nil {
+		return
+	}
+	if _, err := io.ReadFull(file, tag[:]); err != nil || string(tag[:3]) != "TAG" {
+		return
+	}
+	field := func(data []byte) string {
+		data, _, _ = bytes.Cut(data, []byte{0})
+		return strings.TrimSpace(latin1(data))
+	}
+	info.Title, info.Artist, info.Album, info.Year = field(tag[3:33]), field(tag[33:63]), field(tag[63:93]), field(tag[93:97])
+	// ID3v1.1: 注释的最后一个字节为音轨号
+	if tag[125] == 0 && tag[126] != 0 {
+		info.Track = strconv.Itoa(int(tag[126]))
+	}
+}
+
+// readFLAC 读取 STREAMINFO 与 VORBIS_COMMENT 元数据块
+func readFLAC(r io.Reader, info *AudioInfo) error {
+	reader := bufio.NewReader(r)
+	if _, err := reader.Discard(4); err != nil {
+		return err
+	}
+	for {
+		var header [4]byte
+		if _, err := io.ReadFull(reader, header[:]); err != nil {
+			return nil
+		}
+		last, kind := header[0]&0x80 != 0, header[0]&0x7F
+		size := int(header[1])<<16 | int(header[2])<<8 | int(header[3])
+		if (kind != 0 && kind != 4) || size > MaxTagSize {
+			if _, err := reader.Discard(size); err != nil {
+				return nil
+			}
+		} else {
+			block := make([]byte, size)
+			if _, err := io.ReadFull(reader, block); err != nil {
+				return nil
+			}
+			if kind == 0 && len(block) >= 18 {
+				// 采样率 20 位, 声道数 3 位, 位深 5 位, 总采样数 36 位
+				info.SampleRate = int(block[10])<<12 | int(block[11])<<4 | int(block[12])>>4
+				info.Channels = int(block[12]>>1&0x07) + 1
+				samples := uint64(block[13]&0x0F)<<32 | uint64(binary.BigEndian.Uint32(block[14:18]))
+				if info.SampleRate > 0 {
+					info.Duration = float64(samples) / float64(info.SampleRate)
+				}
+			} else if kind == 4 {
+				readVorbisComment(block, info)
+			}
+		}
+		if last {
+			return nil
+		}
+	}
+}
+
+// readVorbisComment 解析 Vorbis Comment, 其中的长度为小端序, 注释为 KEY=value 形式的 UTF-8 文本
+func readVorbisComment(block []byte, info *AudioInfo) {
+	next := func() (string, bool) {
+		if len(block) < 4 {
+			return "", false
+		}
+		length := int(binary.LittleEndian.Uint32(block))
+		if length < 0 || 4+length > len(block) {
+			return "", false
+		}
+		value := string(block[4 : 4+length])
+		block = block[4+length:]
+		return value, true
+	}
+	if _, ok := next(); !ok { // vendor
+		return
+	}
+	if len(block) < 4 {
+		return
+	}
+	count := int(binary.LittleEndian.Uint32(block))
+	block = block[4:]
+	for i := 0; i < count; i++ {
+		comment, ok := next()
+		if !ok {
+			return
+		}
+		key, value, ok := strings.Cut(comment, "=")
+		if !ok {
+			continue
+		}
+		switch strings.ToUpper(key) {
+		case "TITLE":
+			info.Title = value
+		case "ARTIST":
+			info.Artist = value
+		case "ALBUM":
+			info.Album = value
+		case "DATE":
+			info.Year = value
+		case "TRACKNUMBER":
+			info.Track = value
+		case "GENRE":
+			info.Genre = value
+		}
+	}
+}
+
+func synchsafe(data []byte) int {
+	return int(data[0]&0x7F)<<21 | int(data[1]&0x7F)<<14 | int(data[2]&0x7F)<<7 | int(data[3]&0x7F)
+}
+
+func latin1(data []byte) string {
+	text, err := charmap.ISO8859_1.NewDecoder().Bytes(data)
+	if err != nil {
+		return string(data)
+	}
+	return string(text)
+}
+
+// ReadDocumentInfo 读取 PDF 的页数与文档信息字典, 或 Office 文档 docProps 中的属性
+func ReadDocumentInfo(path string) (*DocumentInfo, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".pdf":
+		return readPDFInfo(path)
+	case ".docx", ".xlsx", ".pptx":
+		return readOfficeInfo(path)
+	default:
+		return nil, fmt.Errorf("unsupported document type: %s", filepath.Ext(path))
+	}
+}
+
+// readPDFInfo 页数取页面树根节点的 /Count, 压缩在对象流中时逐个统计 /Type /Page;
+// 标题与作者来自 trailer 中 /Info 指向的对象
+func readPDFInfo(path string) (*DocumentInfo, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() > PreviewMaxDocument {
+		return nil, fmt.Errorf("document is too large")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(data, []byte("%PDF")) {
+		return nil, fmt.Errorf("not a pdf file")
+	}
+	objects := append([][]byte{data}, pdfObjectStreams(data)...)
+	doc := &DocumentInfo{}
+	for _, content := range objects {
+		for _, dict := range pdfPagesPattern.FindAll(content, -1) {
+			if match := pdfCountPattern.FindSubmatch(dict); match != nil {
+				doc.Pages = max(doc.Pages, atoi(string(match[1])))
+			}
+		}
+	}
+	if doc.Pages == 0 {
+		for _, content := range objects {
+			doc.Pages += len(pdfPagePattern.FindAll(content, -1))
+		}
+	}
+	// 增量更新的文件中最后一个 trailer 有效
+	if matches := pdfInfoPattern.FindAllSubmatch(data, -1); len(matches) > 0 {
+		match := matches[len(matches)-1]
+		header := regexp.MustCompile(`(?:^|\s)` + string(match[1]) + `\s+` + string(match[2]) + `\s+obj\b`)
+		if loc := header.FindAllIndex(data, -1); len(loc) > 0 {
+			dict := data[loc[len(loc)-1][1]:]
+			if end := bytes.Index(dict, []byte("endobj")); end >= 0 {
+				dict = dict[:end]
+			}
+			doc.Title = pdfInfoString(dict, "/Title")
+			doc.Author = pdfInfoString(dict, "/Author")
+			doc.Subject = pdfInfoString(dict, "/Subject")
+			doc.Application = pdfInfoString(dict, "/Producer")
+			doc.Created = parsePDFDate(pdfInfoString(dict, "/CreationDate"))
+			doc.Modified = parsePDFDate(pdfInfoString(dict, "/ModDate"))
+		}
+	}
+	return doc, nil
+}
+
+// pdfObjectStreams 解压 PDF 1.5 之后用于压缩对象的对象流
+func pdfObjectStreams(data []byte) [][]byte {
+	var res [][]byte
+	for _, match := range pdfStreamPattern.FindAllIndex(data, -1) {
+		dict := data[:match[0]]
+		if obj := bytes.LastIndex(dict, []byte(" obj")); obj >= 0 {
+			dict = dict[obj:]
+		}
+		if !bytes.Contains(dict, []byte("/ObjStm")) || !bytes.Contains(dict, []byte("/FlateDecode")) {
+			continue
+		}
+		end := bytes.Index(data[match[1]:], []byte("endstream"))
+		if end < 0 {
+			break
+		}
+		inflated, _ := io.ReadAll(io.LimitReader(zlibReader(data[match[1]:match[1]+end]), PreviewMaxDocument))
+		if len(inflated) > 0 {
+			res = append(res, inflated)
+		}
+	}
+	return res
+}
+
+// pdfInfoString 读取信息字典中 key 对应的字符串, 支持 (...) 与 <...> 两种形式
+func pdfInfoString(dict []byte, key string) string {
+	i := bytes.Index(dict, []byte(key))
+	if i < 0 {
+		return ""
+	}
+	rest := bytes.TrimLeft(dict[i+len(key):], " \t\r\n")
+	switch {
+	case bytes.HasPrefix(rest, []byte("(")):
+		// 文本字符串为 PDFDocEncoding 或带 BOM 的 UTF-16BE
+		value, _ := readPDFString(rest, 0)
+		return strings.TrimSpace(value)
+	case bytes.HasPrefix(rest, []byte("<")) && !bytes.HasPrefix(rest, []byte("<<")):
+		if end := bytes.IndexByte(rest, '>'); end > 0 {
+			return strings.TrimSpace(decodePDFHex(rest[1:end]))
+		}
+	}
+	return ""
+}
+
+// parsePDFDate 解析 D:YYYYMMDDHHmmSS 形式的日期, 忽略时区
+func parsePDFDate(value string) *time.Time {
+	match := pdfDatePattern.FindStringSubmatch(value)
+	if match == nil {
+		return nil
+	}
+	part := func(i, def int) int {
+		if match[i] == "" {
+			return def
+		}
+		return atoi(match[i])
+	}
+	date := time.Date(part(1, 0), time.Month(part(2, 1)), part(3, 1), part(4, 0), part(5, 0), part(6, 0), 0, time.Local)
+	return &date
+}
+
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
+
+// readOfficeInfo 读取 docProps/core.xml(标题、作者、时间)与 docProps/app.xml(页数、字数、应用程序)
+func readOfficeInfo(path string) (*DocumentInfo, error) {
+	reader, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	doc := &DocumentInfo{}
+	var core struct {
+		Title    string `xml:"title"`
+		Subject  string `xml:"subject"`
+		Creator  string `xml:"creator"`
+		Created  string `xml:"created"`
+		Modified string `xml:"modified"`
+	}
+	if err = readZipXML(&reader.Reader, "docProps/core.xml", &core); err == nil {
+		doc.Title, doc.Subject, doc.Author = core.Title, core.Subject, core.Creator
+		if created, err := time.Parse(time.RFC3339, core.Created); err == nil {
+			doc.Created = &created
+		}
+		if modified, err := time.Parse(time.RFC3339, core.Modified); err == nil {
+			doc.Modified = &modified
+		}
+	}
+	var app struct {
+		Application string `xml:"Application"`
+		Pages       int    `xml:"Pages"`
+		Slides      int    `xml:"Slides"`
+		Words       int    `xml:"Words"`
+	}
+	if err = readZipXML(&reader.Reader, "docProps/app.xml", &app); err == nil {
+		doc.Application, doc.Pages, doc.Words = app.Application, max(app.Pages, app.Slides), app.Words
+	}
+	var workbook struct {
+		Sheets []struct{} `xml:"sheets>sheet"`
+	}
+	if err = readZipXML(&reader.Reader, "xl/workbook.xml", &workbook); err == nil {
+		doc.Sheets = len(workbook.Sheets)
+	}
+	return doc, nil
+}
+
+func readZipXML(reader *zip.Reader, name string, v any) error {
+	file, err := reader.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return xml.NewDecoder(io.LimitReader(file, int64(MaxTagSize))).Decode(v)
+}
@@ -0,0 +1,499 @@
+package service
+
+import (
+	"GoSearch/app/utils"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// NLConfidenceThreshold 规则解析的置信度不低于该值时跳过大模型直接检索
+var NLConfidenceThreshold = 0.9
+
+// 文件类别与扩展名的对应关系, key为中英文的常见说法
+var typeKeywords = []struct {
+	pattern *regexp.Regexp
+	exts    []string
+}{
+	{regexp.MustCompile(`(?i)\bpdfs?\b`), []string{"pdf"}},
+	{regexp.MustCompile(`(?i)word文档|word文件|\bword\b(?:\s*(?:documents?|docs?|files?))?`), []string{"doc", "docx"}},
+	{regexp.MustCompile(`(?i)excel表格|excel文件|\bexcel\b(?:\s*(?:files?|sheets?))?|\bspreadsheets?\b|电子表格|表格`), []string{"xls", "xlsx", "csv"}},
+	{regexp.MustCompile(`(?i)\bpowerpoint\b|\bppts?\b|\bslides?\b|\bpresentations?\b|幻灯片|演示文稿`), []string{"ppt", "pptx"}},
+	{regexp.MustCompile(`(?i)\b(?:images?|photos?|pictures?|pics?|screenshots?)\b|图片|照片|相片|图像|截图`), []string{"jpg", "jpeg", "png", "gif", "bmp", "webp", "heic"}},
+	{regexp.MustCompile(`(?i)\b(?:videos?|movies?|films?)\b|视频|电影|影片`), []string{"mp4", "mkv", "avi", "mov", "wmv", "flv"}},
+	{regexp.MustCompile(`(?i)\b(?:audio|music|songs?|recordings?)\b|音频|音乐|歌曲|录音`), []string{"mp3", "wav", "flac", "aac", "ogg", "m4a"}},
+	{regexp.MustCompile(`(?i)\b(?:archives?|compressed)\b|压缩包|压缩文件`), []string{"zip", "rar", "7z", "tar", "gz"}},
+	{regexp.MustCompile(`(?i)\btext\s+files?\b|\bnotes\b|文本文件|文本|笔记`), []string{"txt", "md"}},
+	{regexp.MustCompile(`(?i)\b(?:source\s+code|code\s+files?)\b|源代码|代码`), []string{"go", "py", "java", "c", "cpp", "h", "js", "ts", "rs"}},
+	{regexp.MustCompile(`(?i)\b(?:programs?|executables?|installers?)\b|可执行文件|程序|安装包`), []string{"exe", "msi"}},
+	{regexp.MustCompile(`(?i)\bdocuments?\b|文档`), []string{"doc", "docx", "pdf", "txt", "md", "odt", "rtf"}},
+}
+
+// 可以直接作为扩展名识别的单词
+var knownExts = map[string]struct{}{
+	"pdf": {}, "doc": {}, "docx": {}, "xls": {}, "xlsx": {}, "csv": {}, "ppt": {}, "pptx": {}, "txt": {}, "md": {},
+	"jpg": {}, "jpeg": {}, "png": {}, "gif": {}, "bmp": {}, "webp": {}, "heic": {}, "svg": {}, "mp4": {}, "mkv": {},
+	"avi": {}, "mov": {}, "wmv": {}, "flv": {}, "mp3": {}, "wav": {}, "flac": {}, "aac": {}, "ogg": {}, "m4a": {},
+	"zip": {}, "rar": {}, "7z": {}, "tar": {}, "gz": {}, "exe": {}, "msi": {}, "iso": {}, "json": {}, "xml": {},
+	"html": {}, "go": {}, "py": {}, "java": {}, "cpp": {}, "js": {}, "ts": {}, "log": {}, "ini": {}, "yaml": {},
+}
+
+const (
+	sizeUnit = `((?:tb|gb|mb|kb|bytes?|t|g|m|k|b)\b|兆|千字节|字节)`
+	sizeNum  = `(\d+(?:\.\d+)?)\s*` + sizeUnit
+)
+
+var (
+	extDotRe     = regexp.MustCompile(`\.([a-zA-Z0-9]{1,5})\b`)
+	asciiWordRe  = regexp.MustCompile(`[a-zA-Z0-9]+`)
+	quotedRe     = regexp.MustCompile(`["“「'‘]([^"”」'’]+)["”」'’]`)
+	nameRe       = regexp.MustCompile(`(?i)(?:名为|名字(?:叫|是|为|包含)?|文件名(?:是|为|包含)?|叫做?|named|called|(?:starting|starts|beginning|begins)\s+with|name\s+(?:is|contains|starts\s+with))\s*([^\s的,，]+)`)
+	sizeBetween  = regexp.MustCompile(`(?i)(?:between\s+|在\s*)?(\d+(?:\.\d+)?)\s*` + sizeUnit + `?\s*(?:到|至|-|~|and|to)\s*` + sizeNum + `(?:\s*之间)?`)
+	sizeGreater  = regexp.MustCompile(`(?i)(大于等于|大于|超过|多于|高于|不小于|至少|>=|>|larger\s+than|bigger\s+than|greater\s+than|more\s+than|over|above|at\s+least|exceeding)\s*` + sizeNum)
+	sizeLess     = regexp.MustCompile(`(?i)(小于等于|小于|低于|少于|不超过|不大于|至多|<=|<|smaller\s+than|less\s+than|under|below|at\s+most|up\s+to)\s*` + sizeNum)
+	sizePostfix  = regexp.MustCompile(`(?i)` + sizeNum + `\s*(以上|以下|以内|or\s+more|or\s+larger|or\s+less|or\s+smaller)`)
+	recentRe     = regexp.MustCompile(`(?i)(?:最近|近|过去|前|in\s+the\s+(?:last|past)|(?:last|past))\s*(\d+|[一二两三四五六七八九十]+)\s*(?:个)?\s*(天|日|周|星期|礼拜|月|年|days?|weeks?|months?|years?)(?:\s*(?:内|以内|里))?`)
+	olderRe      = regexp.MustCompile(`(?i)(?:older\s+than|more\s+than|超过)\s*(\d+|[一二两三四五六七八九十]+)\s*(?:个)?\s*(天|日|周|星期|月|年|days?|weeks?|months?|years?)(?:\s*(?:前|以前|之前|ago|old))?|(\d+|[一二两三四五六七八九十]+)\s*(?:个)?\s*(天|日|周|星期|月|年|days?|weeks?|months?|years?)\s*(?:前|以前|之前|ago)`)
+	yearMonthRe  = regexp.MustCompile(`(?i)((?:19|20)\d{2})\s*年\s*(\d{1,2})\s*月(?:份)?|(january|february|march|april|may|june|july|august|september|october|november|december)\s+((?:19|20)\d{2})`)
+	monthOnlyRe  = regexp.MustCompile(`(\d{1,2})\s*月份?`)
+	yearRe       = regexp.MustCompile(`(?i)((?:19|20)\d{2})\s*年?`)
+	yearBoundRe  = regexp.MustCompile(`(?i)(?:since|after|before)\s+((?:19|20)\d{2})|((?:19|20)\d{2})\s*年?\s*(以后|之后|以来|以前|之前)`)
+	seasonRe     = regexp.MustCompile(`(?i)(去年|今年|last|this)\s*(春天|春季|夏天|夏季|秋天|秋季|冬天|冬季|spring|summer|autumn|fall|winter)`)
+	stopWordRe   = regexp.MustCompile(`(?i)\b(?:find|show|list|search|searching|look|looking|for|me|all|the|a|an|my|files?|folders?|that|which|were|was|are|is|modified|edited|changed|updated|created|saved|from|in|on|of|with|size|sized|and|or|any|please|get|give|to|than|ones|only|just|now|i|where|what)\b`)
+	cnStopWordRe = regexp.MustCompile(`帮我|请|给我|找一下|找到|查找|搜索|检索|列出|显示|找|搜|所有|全部|一下|文件夹|文件|目录|修改过|修改|编辑过|编辑|更新过|更新|创建|保存|在|中|里|下|和|或|以及|并且|是|被|过|了|些|那些|这些|哪些|有|我的|我|当前|大小|时间|类型|格式|个|内|之间|只要|只看|只|要|再|那|现在|换成|的`)
+)
+
+var (
+	monthNames = map[string]time.Month{
+		"january": time.January, "february": time.February, "march": time.March, "april": time.April,
+		"may": time.May, "june": time.June, "july": time.July, "august": time.August,
+		"september": time.September, "october": time.October, "november": time.November, "december": time.December,
+	}
+	cnDigits = map[rune]int{'一': 1, '二': 2, '两': 2, '三': 3, '四': 4, '五': 5, '六': 6, '七': 7, '八': 8, '九': 9}
+)
+
+// nlParser 对自然语言查询逐项匹配, 已匹配的部分从文本中移除, 用剩余文本的多少衡量置信度
+type nlParser struct {
+	text    string
+	now     time.Time
+	params  *SearchParams
+	matched int // 已识别的字符数量
+}
+
+// ParseNaturalQuery 基于规则解析常见的中英文自然语言检索条件, 返回与大模型解析相同结构的检索条件和置信度(0~1)
+func ParseNaturalQuery(query string, now time.Time) (*SearchParams, float64) {
+	p := &nlParser{
+		text:   " " + strings.ToLower(strings.TrimSpace(query)) + " ",
+		now:    now,
+		params: &SearchParams{},
+	}
+	// camera:Canon 这类条件中的引号与年份不能被文件名、时间的规则识别
+	p.parseMeta(query)
+	p.parseName(query)
+	p.parseSize()
+	p.parseTime()
+	p.parseType()
+	return p.params, p.confidence()
+}
+
+// consume 将匹配到的文本替换为空格
+func (p *nlParser) consume(loc []int) {
+	p.matched += len([]rune(strings.TrimSpace(p.text[loc[0]:loc[1]])))
+	p.text = p.text[:loc[0]] + strings.Repeat(" ", loc[1]-loc[0]) + p.text[loc[1]:]
+}
+
+func (p *nlParser) parseMeta(original string) {
+	// 条件的值需要保留原始大小写
+	originalPadded := " " + strings.TrimSpace(original) + " "
+	text := p.text
+	if len(originalPadded) == len(p.text) {
+		text = originalPadded
+	}
+	for _, loc := range metaTokenRe.FindAllStringSubmatchIndex(p.text, -1) {
+		p.params.Metadata = append(p.params.Metadata, metaToken(text, loc))
+		p.consume(loc[:2])
+	}
+}
+
+func (p *nlParser) parseName(original string) {
+	// 文件名需要保留原始大小写
+	lowerOriginal := " " + strings.ToLower(strings.TrimSpace(original)) + " "
+	originalPadded := " " + strings.TrimSpace(original) + " "
+	for _, re := range []*regexp.Regexp{quotedRe, nameRe} {
+		if loc := re.FindStringSubmatchIndex(p.text); loc != nil {
+			name := p.text[loc[2]:loc[3]]
+			if len(lowerOriginal) == len(originalPadded) && strings.HasPrefix(lowerOriginal[loc[2]:], name) {
+				name = originalPadded[loc[2]:loc[3]]
+			}
+			p.params.Query = strings.TrimSpace(name)
+			p.consume(loc[:2])
+			return
+		}
+	}
+}
+
+func (p *nlParser) parseSize() {
+	if m := sizeBetween.FindStringSubmatchIndex(p.text); m != nil {
+		// 第一个数值省略单位时(1-5MB)使用第二个数值的单位
+		lowUnit := p.text[m[8]:m[9]]
+		if m[4] != -1 {
+			lowUnit = p.text[m[4]:m[5]]
+		}
+		low, ok1 := parseSize(p.text[m[2]:m[3]], lowUnit)
+		high, ok2 := parseSize(p.text[m[6]:m[7]], p.text[m[8]:m[9]])
+		if ok1 && ok2 && low <= high {
+			p.params.MinSize, p.params.MaxSize = low, high
+			p.consume(m[:2])
+			return
+		}
+	}
+	if m := sizeGreater.FindStringSubmatchIndex(p.text); m != nil {
+		if size, ok := parseSize(p.text[m[4]:m[5]], p.text[m[6]:m[7]]); ok {
+			op := p.text[m[2]:m[3]]
+			if op == ">" || op == "大于" || op == "超过" || op == "多于" || op == "高于" ||
+				strings.HasSuffix(op, "than") || op == "over" || op == "above" || op == "exceeding" {
+				size++
+			}
+			p.params.MinSize = size
+			p.consume(m[:2])
+		}
+	}
+	if m := sizeLess.FindStringSubmatchIndex(p.text); m != nil {
+		if size, ok := parseSize(p.text[m[4]:m[5]], p.text[m[6]:m[7]]); ok {
+			op := p.text[m[2]:m[3]]
+			if (op == "<" || op == "小于" || op == "低于" || op == "少于" ||
+				strings.HasSuffix(op, "than") || op == "under" || op == "below") && size > 0 {
+				size--
+			}
+			p.params.MaxSize = size
+			p.consume(m[:2])
+		}
+	}
+	if m := sizePostfix.FindStringSubmatchIndex(p.text); m != nil {
+		if size, ok := parseSize(p.text[m[2]:m[3]], p.text[m[4]:m[5]]); ok {
+			switch suffix := p.text[m[6]:m[7]]; {
+			case suffix == "以上" || strings.HasPrefix(suffix, "or m") || strings.HasPrefix(suffix, "or la"):
+				p.params.MinSize = size
+			default:
+				p.params.MaxSize = size
+			}
+			p.consume(m[:2])
+		}
+	}
+}
+
+func (p *nlParser) parseTime() {
+	var (
+		y, m, d     = p.now.Date()
+		loc         = p.now.Location()
+		today       = time.Date(y, m, d, 0, 0, 0, 0, loc)
+		weekday     = (int(today.Weekday()) + 6) % 7 // 周一为一周的开始
+		thisWeek    = today.AddDate(0, 0, -weekday)
+		thisMonth   = time.Date(y, m, 1, 0, 0, 0, 0, loc)
+		thisYear    = time.Date(y, 1, 1, 0, 0, 0, 0, loc)
+		after       *time.Time
+		before      *time.Time
+		setRange    = func(start, end time.Time) { s, e := start, end.Add(-time.Second); after, before = &s, &e }
+		relativeDay = []struct {
+			re         *regexp.Regexp
+			start, end time.Time
+		}{
+			{regexp.MustCompile(`(?i)前天|day\s+before\s+yesterday`), today.AddDate(0, 0, -2), today.AddDate(0, 0, -1)},
+			{regexp.MustCompile(`(?i)昨天|昨日|yesterday`), today.AddDate(0, 0, -1), today},
+			{regexp.MustCompile(`(?i)今天|今日|today`), today, today.AddDate(0, 0, 1)},
+			{regexp.MustCompile(`(?i)上周|上个?星期|上个?礼拜|last\s+week`), thisWeek.AddDate(0, 0, -7), thisWeek},
+			{regexp.MustCompile(`(?i)本周|这周|这个?星期|this\s+week`), thisWeek, thisWeek.AddDate(0, 0, 7)},
+			{regexp.MustCompile(`(?i)上个?月|last\s+month`), thisMonth.AddDate(0, -1, 0), thisMonth},
+			{regexp.MustCompile(`(?i)本月|这个?月|this\s+month`), thisMonth, thisMonth.AddDate(0, 1, 0)},
+			{regexp.MustCompile(`(?i)前年`), thisYear.AddDate(-2, 0, 0), thisYear.AddDate(-1, 0, 0)},
+			{regexp.MustCompile(`(?i)去年|last\s+year`), thisYear.AddDate(-1, 0, 0), thisYear},
+			{regexp.MustCompile(`(?i)今年|this\s+year`), thisYear, thisYear.AddDate(1, 0, 0)},
+		}
+	)
+	defer func() {
+		p.params.ModifiedAfter, p.params.ModifiedBefore = after, before
+	}()
+
+	// 1. 季节: 去年春天, last spring
+	if mm := seasonRe.FindStringSubmatchIndex(p.text); mm != nil {
+		year := y
+		if rel := p.text[mm[2]:mm[3]]; rel == "去年" || rel == "last" {
+			year--
+		}
+		start, end := seasonRange(p.text[mm[4]:mm[5]], year, loc)
+		setRange(start, end)
+		p.consume(mm[:2])
+		return
+	}
+	// 2. 最近N天/past N weeks
+	if mm := recentRe.FindStringSubmatchIndex(p.text); mm != nil {
+		if n, ok := parseCount(p.text[mm[2]:mm[3]]); ok {
+			start := shiftTime(p.now, p.text[mm[4]:mm[5]], -n)
+			after = &start
+			p.consume(mm[:2])
+			return
+		}
+	}
+	// 3. N天前/older than 30 days
+	if mm := olderRe.FindStringSubmatchIndex(p.text); mm != nil {
+		countIdx, unitIdx := 2, 4
+		if mm[2] == -1 {
+			countIdx, unitIdx = 6, 8
+		}
+		if n, ok := parseCount(p.text[mm[countIdx]:mm[countIdx+1]]); ok {
+			end := shiftTime(p.now, p.text[mm[unitIdx]:mm[unitIdx+1]], -n)
+			before = &end
+			p.consume(mm[:2])
+			return
+		}
+	}
+	// 4. 今天、上周、去年等
+	for _, rd := range relativeDay {
+		if loc := rd.re.FindStringIndex(p.text); loc != nil {
+			setRange(rd.start, rd.end)
+			p.consume(loc)
+			return
+		}
+	}
+	if strings.Contains(p.text, "最近") || strings.Contains(p.text, "recent") {
+		start := today.AddDate(0, 0, -7)
+		after = &start
+		if loc := regexp.MustCompile(`最近|recently|recent`).FindStringIndex(p.text); loc != nil {
+			p.consume(loc)
+		}
+		return
+	}
+	// 5. 2023年以后, before 2024
+	if mm := yearBoundRe.FindStringSubmatchIndex(p.text); mm != nil {
+		var (
+			yearStr, word string
+		)
+		if mm[2] != -1 {
+			yearStr = p.text[mm[2]:mm[3]]
+			word = strings.Fields(p.text[mm[0]:mm[1]])[0]
+		} else {
+			yearStr, word = p.text[mm[4]:mm[5]], p.text[mm[6]:mm[7]]
+		}
+		year, _ := strconv.Atoi(yearStr)
+		switch word {
+		case "before", "以前", "之前":
+			end := time.Date(year, 1, 1, 0, 0, 0, 0, loc).Add(-time.Second)
+			before = &end
+		case "after":
+			start := time.Date(year+1, 1, 1, 0, 0, 0, 0, loc)
+			after = &start
+		default:
+			start := time.Date(year, 1, 1, 0, 0, 0, 0, loc)
+			after = &start
+		}
+		p.consume(mm[:2])
+		return
+	}
+	// 6. 2024年3月, March 2024
+	if mm := yearMonthRe.FindStringSubmatchIndex(p.text); mm != nil {
+		var (
+			year  int
+			month time.Month
+		)
+		if mm[2] != -1 {
+			year, _ = strconv.Atoi(p.text[mm[2]:mm[3]])
+			mon, _ := strconv.Atoi(p.text[mm[4]:mm[5]])
+			month = time.Month(mon)
+		} else {
+			month = monthNames[p.text[mm[6]:mm[7]]]
+			year, _ = strconv.Atoi(p.text[mm[8]:mm[9]])
+		}
+		if month >= time.January && month <= time.December {
+			start := time.Date(year, month, 1, 0, 0, 0, 0, loc)
+			setRange(start, start.AddDate(0, 1, 0))
+			p.consume(mm[:2])
+			return
+		}
+	}
+	// 7. 2023年, in 2023
+	if mm := yearRe.FindStringSubmatchIndex(p.text); mm != nil {
+		year, _ := strconv.Atoi(p.text[mm[2]:mm[3]])
+		start := time.Date(year, 1, 1, 0, 0, 0, 0, loc)
+		setRange(start, start.AddDate(1, 0, 0))
+		p.consume(mm[:2])
+		return
+	}
+	// 8. 3月份: 指今年的3月, 还没到则为去年的3月
+	if mm := monthOnlyRe.FindStringSubmatchIndex(p.text); mm != nil {
+		mon, _ := strconv.Atoi(p.text[mm[2]:mm[3]])
+		if mon >= 1 && mon <= 12 {
+			year := y
+			if time.Month(mon) > m {
+				year--
+			}
+			start := time.Date(year, time.Month(mon), 1, 0, 0, 0, 0, loc)
+			setRange(start, start.AddDate(0, 1, 0))
+			p.consume(mm[:2])
+		}
+	}
+}
+
+func (p *nlParser) parseType() {
+	var (
+		types = make([]string, 0)
+		seen  = make(map[string]struct{})
+		add   = func(exts ...string) {
+			for _, ext := range exts {
+				if _, ok := seen[ext]; !ok {
+					seen[ext] = struct{}{}
+					types = append(types, ext)
+				}
+			}
+		}
+	)
+	for _, kw := range typeKeywords {
+		for _, loc := range kw.pattern.FindAllStringIndex(p.text, -1) {
+			add(kw.exts...)
+			p.consume(loc)
+		}
+	}
+	for _, loc := range extDotRe.FindAllStringSubmatchIndex(p.text, -1) {
+		add(p.text[loc[2]:loc[3]])
+		p.consume(loc[:2])
+	}
+	for _, loc := range asciiWordRe.FindAllStringIndex(p.text, -1) {
+		if _, ok := knownExts[p.text[loc[0]:loc[1]]]; ok {
+			add(p.text[loc[0]:loc[1]])
+			p.consume(loc)
+		}
+	}
+	if len(types) > 0 {
+		p.params.FileType = types
+	}
+}
+
+// confidence 已识别的字符占比, 剩余文本去掉停用词和标点后为空时置信度为1
+func (p *nlParser) confidence() float64 {
+	if p.matched == 0 {
+		return 0
+	}
+	rest := stopWordRe.ReplaceAllString(p.text, " ")
+	rest = cnStopWordRe.ReplaceAllString(rest, " ")
+	residue := 0
+	for _, r := range rest {
+		if unicode.IsSpace(r) || unicode.IsPunct(r) || unicode.IsSymbol(r) {
+			continue
+		}
+		residue++
+	}
+	return float64(p.matched) / float64(p.matched+residue)
+}
+
+// MergeParams 将追问解析出的条件覆盖到上一轮的条件上, 用于离线时的多轮检索
+func MergeParams(prev, next *SearchParams) *SearchParams {
+	if prev == nil {
+		return next.clone()
+	}
+	merged := prev.clone()
+	if next.Query != "" {
+		merged.Query = next.Query
+	}
+	if len(next.FileType) > 0 {
+		merged.FileType = append([]string(nil), next.FileType...)
+	}
+	if next.MinSize != 0 || next.MaxSize != 0 {
+		merged.MinSize, merged.MaxSize = next.MinSize, next.MaxSize
+	}
+	if next.ModifiedAfter != nil || next.ModifiedBefore != nil {
+		merged.ModifiedAfter, merged.ModifiedBefore = next.ModifiedAfter, next.ModifiedBefore
+	}
+	// 同一字段的元数据条件以追问为准, 其他字段保留
+	for _, filter := range next.Metadata {
+		field := metaFieldName(filter.Field)
+		kept := merged.Metadata[:0]
+		for _, prev := range merged.Metadata {
+			if metaFieldName(prev.Field) != field {
+				kept = append(kept, prev)
+			}
+		}
+		merged.Metadata = kept
+	}
+	merged.Metadata = append(merged.Metadata, next.Metadata...)
+	return merged
+}
+
+func parseSize(num, unit string) (uint64, bool) {
+	value, err := strconv.ParseFloat(num, 64)
+	if err != nil {
+		return 0, false
+	}
+	var multiplier uint64
+	switch strings.ToLower(unit) {
+	case "tb", "t":
+		multiplier = utils.TB
+	case "gb", "g":
+		multiplier = utils.GB
+	case "mb", "m", "兆":
+		multiplier = utils.MB
+	case "kb", "k", "千字节":
+		multiplier = utils.KB
+	case "b", "byte", "bytes", "字节":
+		multiplier = 1
+	default:
+		return 0, false
+	}
+	return uint64(value * float64(multiplier)), true
+}
+
+// parseCount 解析阿拉伯数字或简单的中文数字(一~九十九)
+func parseCount(s string) (int, bool) {
+	if n, err := strconv.Atoi(s); err == nil {
+		return n, n > 0
+	}
+	var (
+		n   int
+		cur int
+	)
+	for _, r := range s {
+		if r == '十' {
+			if cur == 0 {
+				cur = 1
+			}
+			n += cur * 10
+			cur = 0
+			continue
+		}
+		digit, ok := cnDigits[r]
+		if !ok {
+			return 0, false
+		}
+		cur = digit
+	}
+	n += cur
+	return n, n > 0
+}
+
+func shiftTime(t time.Time, unit string, n int) time.Time {
+	switch {
+	case strings.HasPrefix(unit, "week") || unit == "周" || unit == "星期" || unit == "礼拜":
+		return t.AddDate(0, 0, 7*n)
+	case strings.HasPrefix(unit, "month") || unit == "月":
+		return t.AddDate(0, n, 0)
+	case strings.HasPrefix(unit, "year") || unit == "年":
+		return t.AddDate(n, 0, 0)
+	default:
+		return t.AddDate(0, 0, n)
+	}
+}
+
+func seasonRange(season string, year int, loc *time.Location) (time.Time, time.Time) {
+	var start time.Time
+	switch season {
+	case "春天", "春季", "spring":
+		start = time.Date(year, time.March, 1, 0, 0, 0, 0, loc)
+	case "夏天", "夏季", "summer":
+		start = time.Date(year, time.June, 1, 0, 0, 0, 0, loc)
+	case "秋天", "秋季", "autumn", "fall":
+		start = time.Date(year, time.September, 1, 0, 0, 0, 0, loc)
+	default:
+		start = time.Date(year, time.December, 1, 0, 0, 0, 0, loc)
+	}
+	return start, start.AddDate(0, 3, 0)
+}
@@ -0,0 +1,187 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrNoOpener    = errors.New("no program is available to open files")
+	ErrNoTerminal  = errors.New("no terminal emulator was found")
+	ErrAppNotFound = errors.New("application not found")
+)
+
+var (
+	openerListener   func(*OpenFailure)
+	openerLock       sync.Mutex
+	OpenerCheckDelay = 500 * time.Millisecond // 启动后在该时长内失败退出的视为打开失败, 通过监听函数通知
+	// 不传给子进程的环境变量前缀: WebView 的运行参数、本程序自己的启动通知标识
+	OpenerEnvBlocklist = []string{"WEBVIEW2_", "WEBKIT_", "GIO_LAUNCHED_DESKTOP_FILE", "DESKTOP_STARTUP_ID", "XDG_ACTIVATION_TOKEN"}
+)
+
+// Application 可以打开文件的应用
+type Application struct {
+	ID      string `json:"id"` // Linux 为 desktop 文件 ID, Windows 为程序名, macOS 为应用路径
+	Name    string `json:"name"`
+	Icon    string `json:"icon,omitempty"`
+	Default bool   `json:"default"` // 是否为该类型的默认应用
+}
+
+// OpenFailure 启动后很快失败退出的程序, 此时打开请求已经返回, 通过监听函数通知界面
+type OpenFailure struct {
+	Program string `json:"program"`
+	Error   string `json:"error"`
+}
+
+// SetOpenerListener 设置打开失败时的监听函数
+func SetOpenerListener(listener func(*OpenFailure)) {
+	openerLock.Lock()
+	openerListener = listener
+	openerLock.Unlock()
+}
+
+// OpenPath 使用系统默认的应用打开文件或文件夹
+func OpenPath(path string) error {
+	cmd, err := openCommand(path)
+	if err != nil {
+		return err
+	}
+	return startDetached(cmd)
+}
+
+// ListApplications 列出可以打开该文件的应用, 默认应用在最前
+func ListApplications(path string) ([]*Application, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	return listApplications(path, info)
+}
+
+// OpenWith 使用指定的应用打开文件, appID 为 ListApplications 返回的 ID
+func OpenWith(path, appID string) error {
+	if appID == "" {
+		return OpenPath(path)
+	}
+	cmd, err := openWithCommand(path, appID)
+	if err != nil {
+		return err
+	}
+	return startDetached(cmd)
+}
+
+// RevealPath 在文件管理器中显示并选中文件或文件夹
+func RevealPath(path string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	return revealPath(abs)
+}
+
+// OpenTerminal 在文件夹中打开终端, 传入文件时使用其所在的文件夹
+func OpenTerminal(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	dir, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		dir = filepath.Dir(dir)
+	}
+	cmd, err := terminalCommand(dir)
+	if err != nil {
+		return err
+	}
+	return startDetached(cmd)
+}
+
+// startDetached 使用清理后的环境变量启动程序, 不等待其退出; 启动失败时返回错误,
+// 在 OpenerCheckDelay 内失败退出的在后台通知监听函数
+func startDetached(cmd *exec.Cmd) error {
+	cmd.Env = openerEnv()
+	detachProcess(cmd)
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("start %s: %w", filepath.Base(cmd.Path), err)
+	}
+	started := time.Now()
+	// 等待退出, 避免留下僵尸进程
+	go func() {
+		err := cmd.Wait()
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) || time.Since(started) > OpenerCheckDelay {
+			return
+		}
+		name := filepath.Base(cmd.Path)
+		if err = openerExitError(name, exitErr.ExitCode()); err == nil {
+			return
+		}
+		log.Printf("Opener: %v", err)
+		openerLock.Lock()
+		listener := openerListener
+		openerLock.Unlock()
+		if listener != nil {
+			listener(&OpenFailure{Program: name, Error: err.Error()})
+		}
+	}()
+	return nil
+}
+
+// openerEnv 当前进程的环境变量, 去掉 OpenerEnvBlocklist 中的项
+func openerEnv() []string {
+	env := os.Environ()
+	res := make([]string, 0, len(env))
+	for _, kv := range env {
+		name, _, _ := strings.Cut(kv, "=")
+		blocked := false
+		for _, prefix := range OpenerEnvBlocklist {
+			if strings.HasPrefix(strings.ToUpper(name), prefix) {
+				blocked = true
+				break
+			}
+		}
+		if !blocked {
+			res = append(res, kv)
+		}
+	}
+	return res
+}
+
+// openerExitError 将打开程序的退出码转换为可读的错误, xdg-open 的退出码见其手册
+func openerExitError(name string, code int) error {
+	// 资源管理器成功时也返回 1
+	if strings.EqualFold(name, "explorer.exe") && code == 1 {
+		return nil
+	}
+	if name == "xdg-open" {
+		switch code {
+		case 2:
+			return fmt.Errorf("xdg-open: file does not exist")
+		case 3:
+			return fmt.Errorf("%w: xdg-open could not find a program for this file type", ErrNoOpener)
+		case 4:
+			return fmt.Errorf("xdg-open: the application failed to open the file")
+		}
+	}
+	return fmt.Errorf("%s exited with code %d", name, code)
+}
+
+// lookProgram 返回第一个能在 PATH 中找到的程序
+func lookProgram(names ...string) (string, bool) {
+	for _, name := range names {
+		if path, err := exec.LookPath(name); err == nil {
+			return path, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,59 @@
+//go:build darwin
+
+package service
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+func openCommand(path string) (*exec.Cmd, error) {
+	return exec.Command("/usr/bin/open", path), nil
+}
+
+// listApplications 读取 LaunchServices 需要 cgo, 这里列出应用程序文件夹中的全部应用供用户选择
+func listApplications(path string, info os.FileInfo) ([]*Application, error) {
+	var res []*Application
+	dirs := []string{"/Applications", "/Applications/Utilities", "/System/Applications", "/System/Applications/Utilities"}
+	if home, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs, filepath.Join(home, "Applications"))
+	}
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if strings.HasSuffix(entry.Name(), ".app") {
+				res = append(res, &Application{ID: filepath.Join(dir, entry.Name()), Name: strings.TrimSuffix(entry.Name(), ".app")})
+			}
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res, nil
+}
+
+func openWithCommand(path, appID string) (*exec.Cmd, error) {
+	if info, err := os.Stat(appID); err != nil || !info.IsDir() || !strings.HasSuffix(appID, ".app") {
+		return nil, fmt.Errorf("%w: %s", ErrAppNotFound, appID)
+	}
+	return exec.Command("/usr/bin/open", "-a", appID, path), nil
+}
+
+func revealPath(abs string) error {
+	return startDetached(exec.Command("/usr/bin/open", "-R", abs))
+}
+
+func terminalCommand(dir string) (*exec.Cmd, error) {
+	return exec.Command("/usr/bin/open", "-a", "Terminal", dir), nil
+}
+
+// detachProcess 子进程使用新的会话, 不随本程序退出
+func detachProcess(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+}
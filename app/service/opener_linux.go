@@ -0,0 +1,574 @@
+//go:build linux
+
+package service
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/godbus/dbus/v5"
+	"io/fs"
+	"log"
+	"mime"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// freedesktop.org FileManager1 接口: https://www.freedesktop.org/wiki/Specifications/file-manager-interface/
+const (
+	fileManagerBusName = "org.freedesktop.FileManager1"
+	fileManagerPath    = "/org/freedesktop/FileManager1"
+	fileManagerIface   = "org.freedesktop.FileManager1"
+	revealTimeout      = 3 * time.Second
+)
+
+// linuxTerminals 常见的终端, 按优先级排列; workDir 为指定工作目录的参数(为空时依赖进程的工作目录),
+// exec 为执行命令的参数, 其后接命令与参数
+var linuxTerminals = []struct {
+	name    string
+	workDir func(dir string) []string
+	exec    []string
+}{
+	{"x-terminal-emulator", nil, []string{"-e"}},
+	{"gnome-terminal", func(dir string) []string { return []string{"--working-directory=" + dir} }, []string{"--"}},
+	{"konsole", func(dir string) []string { return []string{"--workdir", dir} }, []string{"-e"}},
+	{"xfce4-terminal", func(dir string) []string { return []string{"--working-directory=" + dir} }, []string{"-x"}},
+	{"mate-terminal", func(dir string) []string { return []string{"--working-directory=" + dir} }, []string{"-x"}},
+	{"kitty", func(dir string) []string { return []string{"--directory", dir} }, nil},
+	{"alacritty", func(dir string) []string { return []string{"--working-directory", dir} }, []string{"-e"}},
+	{"foot", func(dir string) []string { return []string{"--working-directory=" + dir} }, nil},
+	{"xterm", nil, []string{"-e"}},
+}
+
+// desktopEntry desktop 文件中与打开文件有关的项, 规范: https://specifications.freedesktop.org/desktop-entry-spec/latest/
+type desktopEntry struct {
+	id        string // desktop 文件 ID, 例如 org.gnome.gedit.desktop
+	file      string
+	name      string
+	exec      string
+	icon      string
+	mimeTypes []string
+	terminal  bool
+	noDisplay bool
+}
+
+// mimeApps mimeapps.list 中的关联, key 为 MIME 类型, value 为 desktop 文件 ID
+type mimeApps struct {
+	defaults map[string][]string
+	added    map[string][]string
+	removed  map[string]map[string]bool
+}
+
+func openCommand(path string) (*exec.Cmd, error) {
+	if program, ok := lookProgram("xdg-open"); ok {
+		return exec.Command(program, path), nil
+	}
+	if program, ok := lookProgram("gio"); ok {
+		return exec.Command(program, "open", path), nil
+	}
+	return nil, fmt.Errorf("%w: xdg-open was not found, please install xdg-utils", ErrNoOpener)
+}
+
+// listApplications 按 mimeapps.list 与 desktop 文件中的 MimeType 列出可以打开该类型的应用
+func listApplications(path string, info os.FileInfo) ([]*Application, error) {
+	var (
+		entries   = loadDesktopEntries()
+		assoc     = loadMimeApps()
+		mimeTypes = fileMimeTypes(path, info)
+		res       []*Application
+		seen      = make(map[string]bool)
+		add       = func(entry *desktopEntry, isDefault bool) {
+			if entry == nil || seen[entry.id] {
+				return
+			}
+			seen[entry.id] = true
+			res = append(res, &Application{ID: entry.id, Name: entry.name, Icon: entry.icon, Default: isDefault})
+		}
+	)
+	// 1. 默认应用, 只取第一个已安装的
+	for _, mimeType := range mimeTypes {
+		for _, id := range assoc.defaults[mimeType] {
+			if entry := entries[id]; entry != nil && len(res) == 0 {
+				add(entry, true)
+			}
+		}
+	}
+	// 2. 用户添加的关联
+	for _, mimeType := range mimeTypes {
+		for _, id := range assoc.added[mimeType] {
+			add(entries[id], false)
+		}
+	}
+	// 3. 声明支持该类型的应用, 按名称排列
+	var declared []*desktopEntry
+	for _, entry := range entries {
+		if entry.noDisplay || seen[entry.id] {
+			continue
+		}
+		for _, mimeType := range mimeTypes {
+			if assoc.removed[mimeType][entry.id] {
+				break
+			}
+			if entry.handles(mimeType) {
+				declared = append(declared, entry)
+				break
+			}
+		}
+	}
+	sort.Slice(declared, func(i, j int) bool { return declared[i].name < declared[j].name })
+	for _, entry := range declared {
+		add(entry, false)
+	}
+	return res, nil
+}
+
+func openWithCommand(path, appID string) (*exec.Cmd, error) {
+	entry := loadDesktopEntries()[appID]
+	if entry == nil {
+		return nil, fmt.Errorf("%w: %s", ErrAppNotFound, appID)
+	}
+	args, err := entry.command(path)
+	if err != nil {
+		return nil, err
+	}
+	// 命令行程序需要在终端中运行
+	if entry.terminal {
+		term, execArgs, ok := findTerminal()
+		if !ok {
+			return nil, fmt.Errorf("%w: %s needs a terminal", ErrNoTerminal, entry.name)
+		}
+		args = append(append([]string{term}, execArgs...), args...)
+	}
+	program, err := exec.LookPath(args[0])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrAppNotFound, args[0])
+	}
+	cmd := exec.Command(program, args[1:]...)
+	cmd.Dir = filepath.Dir(path)
+	return cmd, nil
+}
+
+// revealPath 通过 FileManager1 接口选中文件, 不可用时使用支持选中参数的文件管理器, 最后退化为打开所在的文件夹
+func revealPath(abs string) error {
+	conn, err := dbus.SessionBus()
+	if err == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), revealTimeout)
+		defer cancel()
+		call := conn.Object(fileManagerBusName, fileManagerPath).
+			CallWithContext(ctx, fileManagerIface+".ShowItems", 0, []string{fileURI(abs)}, "")
+		if err = call.Err; err == nil {
+			return nil
+		}
+	}
+	log.Printf("RevealPath: FileManager1 is unavailable: %v", err)
+
+	for _, fm := range []struct {
+		name string
+		args []string
+	}{
+		{"nautilus", []string{"--select", abs}},
+		{"dolphin", []string{"--select", abs}},
+		{"nemo", []string{abs}},
+	} {
+		if program, ok := lookProgram(fm.name); ok {
+			return startDetached(exec.Command(program, fm.args...))
+		}
+	}
+	return OpenPath(filepath.Dir(abs))
+}
+
+// terminalCommand 优先使用 $TERMINAL, 其次为 Debian 系的 x-terminal-emulator 与常见的终端
+func terminalCommand(dir string) (*exec.Cmd, error) {
+	var cmd *exec.Cmd
+	if term := os.Getenv("TERMINAL"); term != "" {
+		if program, err := exec.LookPath(term); err == nil {
+			cmd = exec.Command(program)
+		}
+	}
+	if cmd == nil {
+		for _, term := range linuxTerminals {
+			program, ok := lookProgram(term.name)
+			if !ok {
+				continue
+			}
+			var args []string
+			if term.workDir != nil {
+				args = term.workDir(dir)
+			}
+			cmd = exec.Command(program, args...)
+			break
+		}
+	}
+	if cmd == nil {
+		return nil, ErrNoTerminal
+	}
+	cmd.Dir = dir
+	return cmd, nil
+}
+
+// findTerminal 返回用于运行命令行程序的终端及其执行命令的参数
+func findTerminal() (string, []string, bool) {
+	if term := os.Getenv("TERMINAL"); term != "" {
+		if program, err := exec.LookPath(term); err == nil {
+			return program, []string{"-e"}, true
+		}
+	}
+	for _, term := range linuxTerminals {
+		if program, ok := lookProgram(term.name); ok {
+			return program, term.exec, true
+		}
+	}
+	return "", nil, false
+}
+
+// detachProcess 子进程使用新的会话, 不随本程序退出
+func detachProcess(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+}
+
+// fileMimeTypes 文件的 MIME 类型, 依次为按内容判断、按扩展名判断的结果, 文本文件追加 text/plain
+func fileMimeTypes(path string, info os.FileInfo) []string {
+	if info.IsDir() {
+		return []string{"inode/directory"}
+	}
+	var (
+		res  []string
+		seen = make(map[string]bool)
+	)
+	for _, mimeType := range []string{sniffMimeType(path), mime.TypeByExtension(strings.ToLower(filepath.Ext(path)))} {
+		if mimeType, _, err := mime.ParseMediaType(mimeType); err == nil && !seen[mimeType] {
+			seen[mimeType] = true
+			res = append(res, mimeType)
+		}
+	}
+	if len(res) > 0 && strings.HasPrefix(res[0], "text/") && !seen["text/plain"] {
+		res = append(res, "text/plain")
+	}
+	return res
+}
+
+func (entry *desktopEntry) handles(mimeType string) bool {
+	major, _, _ := strings.Cut(mimeType, "/")
+	for _, t := range entry.mimeTypes {
+		if t == mimeType || t == major+"/*" {
+			return true
+		}
+	}
+	return false
+}
+
+// command 展开 Exec 中的字段代码, 没有文件参数时将文件追加到最后
+func (entry *desktopEntry) command(path string) ([]string, error) {
+	args, err := splitDesktopExec(entry.exec)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", entry.id, err)
+	}
+	if len(args) == 0 {
+		return nil, fmt.Errorf("%s: Exec is empty", entry.id)
+	}
+	var (
+		res     = make([]string, 0, len(args)+1)
+		hasFile bool
+	)
+	for _, arg := range args {
+		switch arg {
+		case "%f", "%F":
+			res, hasFile = append(res, path), true
+			continue
+		case "%u", "%U":
+			res, hasFile = append(res, fileURI(path)), true
+			continue
+		case "%i":
+			if entry.icon != "" {
+				res = append(res, "--icon", entry.icon)
+			}
+			continue
+		}
+		var sb strings.Builder
+		for i := 0; i < len(arg); i++ {
+			if arg[i] != '%' || i+1 == len(arg) {
+				sb.WriteByte(arg[i])
+				continue
+			}
+			i++
+			switch arg[i] {
+			case '%':
+				sb.WriteByte('%')
+			case 'f', 'F':
+				sb.WriteString(path)
+				hasFile = true
+			case 'u', 'U':
+				sb.WriteString(fileURI(path))
+				hasFile = true
+			case 'c':
+				sb.WriteString(entry.name)
+			case 'k':
+				sb.WriteString(entry.file)
+			}
+			// 其余(包括已废弃的)字段代码直接删除
+		}
+		if sb.Len() > 0 {
+			res = append(res, sb.String())
+		}
+	}
+	if !hasFile {
+		res = append(res, path)
+	}
+	return res, nil
+}
+
+// splitDesktopExec 按 Exec 的引号规则拆分参数, 引号内的反斜杠转义下一个字符
+func splitDesktopExec(s string) ([]string, error) {
+	var (
+		args    []string
+		cur     strings.Builder
+		inQuote bool
+		hasArg  bool
+	)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case inQuote && c == '\\' && i+1 < len(s):
+			i++
+			cur.WriteByte(s[i])
+		case c == '"':
+			inQuote, hasArg = !inQuote, true
+		case !inQuote && (c == ' ' || c == '\t'):
+			if hasArg {
+				args = append(args, cur.String())
+				cur.Reset()
+				hasArg = false
+			}
+		default:
+			cur.WriteByte(c)
+			hasArg = true
+		}
+	}
+	if inQuote {
+		return nil, errors.New("unterminated quote in Exec")
+	}
+	if hasArg {
+		args = append(args, cur.String())
+	}
+	return args, nil
+}
+
+// loadDesktopEntries 读取所有应用的 desktop 文件, 同一 ID 以优先级高的目录为准
+func loadDesktopEntries() map[string]*desktopEntry {
+	entries := make(map[string]*desktopEntry)
+	for _, dataDir := range xdgDataDirs() {
+		root := filepath.Join(dataDir, "applications")
+		_ = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() || !strings.HasSuffix(path, ".desktop") {
+				return nil
+			}
+			rel, _ := filepath.Rel(root, path)
+			id := strings.ReplaceAll(filepath.ToSlash(rel), "/", "-")
+			if _, ok := entries[id]; ok {
+				return nil
+			}
+			// 优先级高的目录中被隐藏的条目(nil)也要占位, 使其他目录中的同名条目失效
+			entries[id] = readDesktopEntry(path, id)
+			return nil
+		})
+	}
+	for id, entry := range entries {
+		if entry == nil {
+			delete(entries, id)
+		}
+	}
+	return entries
+}
+
+// readDesktopEntry 读取 [Desktop Entry] 组, 名称使用当前语言的翻译; 隐藏或不可用的条目返回nil
+func readDesktopEntry(path, id string) *desktopEntry {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	var (
+		entry   = &desktopEntry{id: id, file: path}
+		values  = make(map[string]string)
+		inGroup bool
+		scanner = bufio.NewScanner(file)
+	)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		if line[0] == '[' {
+			inGroup = line == "[Desktop Entry]"
+			continue
+		}
+		if key, value, ok := strings.Cut(line, "="); ok && inGroup {
+			values[strings.TrimSpace(key)] = unescapeDesktopValue(strings.TrimSpace(value))
+		}
+	}
+	if values["Type"] != "Application" || values["Hidden"] == "true" || values["Exec"] == "" {
+		return nil
+	}
+	if tryExec := values["TryExec"]; tryExec != "" {
+		if _, err = exec.LookPath(tryExec); err != nil {
+			return nil
+		}
+	}
+	entry.name = values["Name"]
+	for _, locale := range desktopLocales() {
+		if name := values["Name["+locale+"]"]; name != "" {
+			entry.name = name
+			break
+		}
+	}
+	entry.exec, entry.icon = values["Exec"], values["Icon"]
+	entry.terminal, entry.noDisplay = values["Terminal"] == "true", values["NoDisplay"] == "true"
+	for _, mimeType := range strings.Split(values["MimeType"], ";") {
+		if mimeType = strings.TrimSpace(mimeType); mimeType != "" {
+			entry.mimeTypes = append(entry.mimeTypes, mimeType)
+		}
+	}
+	return entry
+}
+
+// unescapeDesktopValue 处理字符串值中的 \s \n \t \r \\ 转义
+func unescapeDesktopValue(value string) string {
+	if !strings.Contains(value, `\`) {
+		return value
+	}
+	return strings.NewReplacer(`\s`, " ", `\n`, "\n", `\t`, "\t", `\r`, "\r", `\\`, `\`).Replace(value)
+}
+
+// desktopLocales 当前语言对应的翻译键, 例如 zh_CN.UTF-8 依次为 zh_CN、zh
+func desktopLocales() []string {
+	lang := envLanguage()
+	if lang == "" {
+		return nil
+	}
+	locales := []string{lang}
+	if short, _, ok := strings.Cut(lang, "_"); ok {
+		locales = append(locales, short)
+	}
+	return locales
+}
+
+// loadMimeApps 按优先级读取各位置的 mimeapps.list
+func loadMimeApps() *mimeApps {
+	assoc := &mimeApps{
+		defaults: make(map[string][]string),
+		added:    make(map[string][]string),
+		removed:  make(map[string]map[string]bool),
+	}
+	var desktops []string
+	for _, desktop := range strings.Split(os.Getenv("XDG_CURRENT_DESKTOP"), ":") {
+		if desktop != "" {
+			desktops = append(desktops, strings.ToLower(desktop))
+		}
+	}
+	var files []string
+	addDir := func(dir string) {
+		for _, desktop := range desktops {
+			files = append(files, filepath.Join(dir, desktop+"-mimeapps.list"))
+		}
+		files = append(files, filepath.Join(dir, "mimeapps.list"))
+	}
+	for _, dir := range xdgConfigDirs() {
+		addDir(dir)
+	}
+	for _, dir := range xdgDataDirs() {
+		addDir(filepath.Join(dir, "applications"))
+	}
+	for _, path := range files {
+		assoc.read(path)
+	}
+	return assoc
+}
+
+func (assoc *mimeApps) read(path string) {
+	file, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	var (
+		group   string
+		scanner = bufio.NewScanner(file)
+	)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		if line[0] == '[' {
+			group = line
+			continue
+		}
+		mimeType, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		mimeType = strings.TrimSpace(mimeType)
+		for _, id := range strings.Split(value, ";") {
+			if id = strings.TrimSpace(id); id == "" {
+				continue
+			}
+			switch group {
+			case "[Default Applications]":
+				assoc.defaults[mimeType] = append(assoc.defaults[mimeType], id)
+			case "[Added Associations]":
+				assoc.added[mimeType] = append(assoc.added[mimeType], id)
+			case "[Removed Associations]":
+				if assoc.removed[mimeType] == nil {
+					assoc.removed[mimeType] = make(map[string]bool)
+				}
+				assoc.removed[mimeType][id] = true
+			}
+		}
+	}
+}
+
+// xdgDataDirs $XDG_DATA_HOME 与 $XDG_DATA_DIRS, 按优先级排列
+func xdgDataDirs() []string {
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			dataHome = filepath.Join(home, ".local", "share")
+		}
+	}
+	dataDirs := os.Getenv("XDG_DATA_DIRS")
+	if dataDirs == "" {
+		dataDirs = "/usr/local/share:/usr/share"
+	}
+	return xdgDirList(dataHome, dataDirs)
+}
+
+// xdgConfigDirs $XDG_CONFIG_HOME 与 $XDG_CONFIG_DIRS, 按优先级排列
+func xdgConfigDirs() []string {
+	configHome, _ := os.UserConfigDir()
+	configDirs := os.Getenv("XDG_CONFIG_DIRS")
+	if configDirs == "" {
+		configDirs = "/etc/xdg"
+	}
+	return xdgDirList(configHome, configDirs)
+}
+
+func xdgDirList(home, dirs string) []string {
+	var res []string
+	if home != "" {
+		res = append(res, home)
+	}
+	for _, dir := range strings.Split(dirs, ":") {
+		if filepath.IsAbs(dir) {
+			res = append(res, dir)
+		}
+	}
+	return res
+}
@@ -0,0 +1,34 @@
+//go:build !linux && !windows && !darwin
+
+package service
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+)
+
+// 其他系统不支持打开文件
+
+func openCommand(path string) (*exec.Cmd, error) {
+	return nil, fmt.Errorf("%w on %s", ErrNoOpener, runtime.GOOS)
+}
+
+func listApplications(path string, info os.FileInfo) ([]*Application, error) {
+	return nil, nil
+}
+
+func openWithCommand(path, appID string) (*exec.Cmd, error) {
+	return nil, fmt.Errorf("%w on %s", ErrNoOpener, runtime.GOOS)
+}
+
+func revealPath(abs string) error {
+	return fmt.Errorf("%w on %s", ErrNoOpener, runtime.GOOS)
+}
+
+func terminalCommand(dir string) (*exec.Cmd, error) {
+	return nil, fmt.Errorf("%w on %s", ErrNoTerminal, runtime.GOOS)
+}
+
+func detachProcess(cmd *exec.Cmd) {}
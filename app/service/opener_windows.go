@@ -0,0 +1,226 @@
+//go:build windows
+
+package service
+
+import (
+	"fmt"
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+const fileExtsKey = `Software\Microsoft\Windows\CurrentVersion\Explorer\FileExts\`
+
+// openCommand 通过 ShellExecute 打开文件, 不经过 cmd 解析, 路径中的 & % 等字符不需要转义
+func openCommand(path string) (*exec.Cmd, error) {
+	return exec.Command("rundll32.exe", "shell32.dll,ShellExec_RunDLL", path), nil
+}
+
+// listApplications 按注册表中扩展名的默认程序、OpenWithProgids 与 OpenWithList 列出可以打开该文件的应用
+func listApplications(path string, info os.FileInfo) ([]*Application, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	if info.IsDir() || ext == "" {
+		return nil, nil
+	}
+	var (
+		res  []*Application
+		seen = make(map[string]bool)
+		add  = func(id string, isDefault bool) {
+			if id == "" || seen[strings.ToLower(id)] {
+				return
+			}
+			if _, err := registryCommand(id); err != nil {
+				return
+			}
+			seen[strings.ToLower(id)] = true
+			res = append(res, &Application{ID: id, Name: applicationName(id), Default: isDefault})
+		}
+	)
+	// 1. 默认程序: 用户的选择优先于系统的关联
+	progID := readRegistryString(registry.CURRENT_USER, fileExtsKey+ext+`\UserChoice`, "ProgId")
+	if progID == "" {
+		progID = readRegistryString(registry.CLASSES_ROOT, ext, "")
+	}
+	add(progID, true)
+
+	// 2. 其他关联的程序
+	var others []string
+	for _, key := range []struct {
+		root registry.Key
+		path string
+	}{
+		{registry.CURRENT_USER, fileExtsKey + ext + `\OpenWithProgids`},
+		{registry.CLASSES_ROOT, ext + `\OpenWithProgids`},
+	} {
+		others = append(others, registryValueNames(key.root, key.path)...)
+	}
+	// OpenWithList 的值为 a、b、c... 对应的程序名, MRUList 记录使用顺序
+	if k, err := registry.OpenKey(registry.CURRENT_USER, fileExtsKey+ext+`\OpenWithList`, registry.QUERY_VALUE); err == nil {
+		names, _ := k.ReadValueNames(0)
+		for _, name := range names {
+			if name == "MRUList" {
+				continue
+			}
+			if exe, _, err := k.GetStringValue(name); err == nil {
+				others = append(others, exe)
+			}
+		}
+		k.Close()
+	}
+	if k, err := registry.OpenKey(registry.CLASSES_ROOT, ext+`\OpenWithList`, registry.ENUMERATE_SUB_KEYS); err == nil {
+		names, _ := k.ReadSubKeyNames(0)
+		others = append(others, names...)
+		k.Close()
+	}
+	start := len(res)
+	for _, id := range others {
+		add(id, false)
+	}
+	sort.Slice(res[start:], func(i, j int) bool { return res[start+i].Name < res[start+j].Name })
+	return res, nil
+}
+
+// openWithCommand 使用注册表中的打开命令, 将 %1 替换为文件路径; 命令行原样传给 CreateProcess, 保留其中的引号
+func openWithCommand(path, appID string) (*exec.Cmd, error) {
+	command, err := registryCommand(appID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrAppNotFound, appID)
+	}
+	command, replaced := expandCommand(command, path)
+	if !replaced {
+		command += ` "` + path + `"`
+	}
+	args, err := windows.DecomposeCommandLine(command)
+	if err != nil || len(args) == 0 {
+		return nil, fmt.Errorf("invalid command of %s: %s", appID, command)
+	}
+	cmd := exec.Command(args[0])
+	cmd.SysProcAttr = &syscall.SysProcAttr{CmdLine: command}
+	return cmd, nil
+}
+
+// expandCommand 将注册表命令中的 %1、%L 替换为文件路径并去掉 %*; 占位符没有被引号包围时为路径加上引号,
+// 避免含空格的路径被拆成多个参数. 逐个字符处理, 路径中的 % 不会被再次替换
+func expandCommand(command, path string) (string, bool) {
+	var (
+		res      strings.Builder
+		replaced bool
+	)
+	for i := 0; i < len(command); i++ {
+		if command[i] != '%' || i+1 >= len(command) {
+			res.WriteByte(command[i])
+			continue
+		}
+		switch command[i+1] {
+		case '1', 'L', 'l':
+			if i > 0 && command[i-1] == '"' {
+				res.WriteString(path)
+			} else {
+				res.WriteString(`"` + path + `"`)
+			}
+			replaced = true
+		case '*':
+		default:
+			res.WriteByte(command[i])
+			continue
+		}
+		i++
+	}
+	return res.String(), replaced
+}
+
+// revealPath 使用资源管理器选中文件; 参数需要写作 /select,"路径", 因此直接指定命令行
+func revealPath(abs string) error {
+	cmd := exec.Command("explorer.exe")
+	cmd.SysProcAttr = &syscall.SysProcAttr{CmdLine: `explorer.exe /select,"` + abs + `"`}
+	return startDetached(cmd)
+}
+
+// terminalCommand 优先使用 Windows Terminal, 否则在新的控制台中打开 cmd
+func terminalCommand(dir string) (*exec.Cmd, error) {
+	var cmd *exec.Cmd
+	if program, ok := lookProgram("wt.exe"); ok {
+		cmd = exec.Command(program, "-d", dir)
+	} else {
+		shell := os.Getenv("ComSpec")
+		if shell == "" {
+			shell = "cmd.exe"
+		}
+		cmd = exec.Command(shell)
+		cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: windows.CREATE_NEW_CONSOLE}
+	}
+	cmd.Dir = dir
+	return cmd, nil
+}
+
+// detachProcess 使用新的进程组, 控制台程序不弹出黑色窗口(需要新控制台的除外)
+func detachProcess(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.CreationFlags |= windows.CREATE_NEW_PROCESS_GROUP
+	if cmd.SysProcAttr.CreationFlags&windows.CREATE_NEW_CONSOLE == 0 {
+		cmd.SysProcAttr.CreationFlags |= windows.CREATE_NO_WINDOW
+	}
+}
+
+// registryCommand 程序的打开命令, id 为 ProgID 或 Applications 下的程序名(例如 notepad.exe)
+func registryCommand(id string) (string, error) {
+	for _, key := range []string{id, `Applications\` + id} {
+		if command := readRegistryString(registry.CLASSES_ROOT, key+`\shell\open\command`, ""); command != "" {
+			return command, nil
+		}
+	}
+	return "", ErrAppNotFound
+}
+
+// applicationName 程序的显示名称: FriendlyAppName, 其次为打开命令中的程序名
+func applicationName(id string) string {
+	if name := readRegistryString(registry.CLASSES_ROOT, `Applications\`+id, "FriendlyAppName"); name != "" && !strings.HasPrefix(name, "@") {
+		return name
+	}
+	if command, err := registryCommand(id); err == nil {
+		if args, err := windows.DecomposeCommandLine(command); err == nil && len(args) > 0 {
+			exe := filepath.Base(args[0])
+			if name := readRegistryString(registry.CLASSES_ROOT, `Applications\`+exe, "FriendlyAppName"); name != "" && !strings.HasPrefix(name, "@") {
+				return name
+			}
+			return strings.TrimSuffix(exe, filepath.Ext(exe))
+		}
+	}
+	return id
+}
+
+// readRegistryString 读取字符串值, REG_EXPAND_SZ 会展开其中的环境变量
+func readRegistryString(root registry.Key, path, name string) string {
+	k, err := registry.OpenKey(root, path, registry.QUERY_VALUE)
+	if err != nil {
+		return ""
+	}
+	defer k.Close()
+	value, valueType, err := k.GetStringValue(name)
+	if err != nil {
+		return ""
+	}
+	if valueType == registry.EXPAND_SZ {
+		if expanded, err := registry.ExpandString(value); err == nil {
+			value = expanded
+		}
+	}
+	return value
+}
+
+func registryValueNames(root registry.Key, path string) []string {
+	k, err := registry.OpenKey(root, path, registry.QUERY_VALUE)
+	if err != nil {
+		return nil
+	}
+	defer k.Close()
+	names, _ := k.ReadValueNames(0)
+	return names
+}
@@ -2,63 +2,107 @@ package service
 
 import (
 	"GoSearch/app/utils"
+	"container/heap"
+	"hash/maphash"
 	"log"
+	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 var (
-	pathCacheOnce sync.Once
-	ExpiredTime   = 5 * time.Minute // 设置cache30秒过期
-	JanitorTime   = 30 * time.Second
-	CacheRatio    = 0.3
+	pathCache       *PathCache
+	pathCacheOnce   sync.Once
+	ExpiredTime     = 5 * time.Minute // 未配置时cache的过期时间
+	JanitorTime     = 30 * time.Second
+	CacheRatio      = 0.3
+	CacheShards     = 16   // 分片数量, 取2的幂
+	AccessBufferLen = 1024 // 等待记录到淘汰策略中的访问数量, 超出时丢弃(只影响淘汰的精确度)
 )
 
+// PathCache 目录内容缓存.
+// 条目按路径哈希保存在多个分片中, 命中时只获取分片的读锁, 浏览不同文件夹不会互相阻塞;
+// 淘汰策略(各分段链表、频率草图)与过期堆由 policyLock 保护, 命中的访问先放入缓冲通道,
+// 由清理协程或下一次 Put 批量处理, 因此读操作不会因为调整链表而串行化.
+// 加锁顺序: policyLock -> 分片锁
 type PathCache struct {
-	lock             sync.RWMutex           // Cache的读写锁
-	directoryEntries map[string]*DirContent // 当前路径下的内容
-	curSize          uint64                 // Cache的当前容量, 以B为单位
-	maxSize          uint64                 // Cache的最大容量, 以B为单位
-	head, tail       *DirContent            // 使用LRU算法进行淘汰更新：定义头尾结点
-	cnt              int                    // 命中次数
-	janitorInterval  time.Duration          // 清理协程的运行间隔
-	janitorOnce      sync.Once              // 确保清理协程只启动一次
-	janitorStopChan  chan struct{}
+	seed   maphash.Seed
+	shards []*cacheShard
+
+	policyLock      sync.Mutex
+	curSize         uint64              // Cache的当前容量, 以B为单位
+	maxSize         uint64              // Cache的最大容量, 以B为单位
+	entries         int                 // 当前条目数
+	maxEntries      int                 // Cache最多保存的文件夹数量, 为0时不限制
+	ttl             time.Duration       // 条目的过期时间
+	policy          string              // 淘汰策略
+	window          *lruList            // 新条目先进入窗口区; LRU策略下所有条目都在窗口区
+	probation       *lruList            // 主区试用段: 从窗口区准入的条目
+	protected       *lruList            // 主区保护段: 在试用段中再次被访问的条目
+	pinned          *lruList            // 固定的文件夹(收藏、常用), 只在其他条目淘汰完后才会被淘汰
+	pinnedPaths     map[string]struct{} // 需要固定的文件夹路径
+	sketch          *frequencySketch    // 访问频率草图, 用于决定窗口区的条目能否进入主区
+	expiry          expiryHeap          // 按过期时间排序的最小堆, 清理协程只处理已过期的条目
+	stats           CacheStats          // 淘汰、过期等统计信息
+	hits            atomic.Uint64       // 命中、未命中与丢弃的访问在读锁下计数
+	misses          atomic.Uint64
+	dropped         atomic.Uint64
+	accesses        chan string   // 等待记录到淘汰策略中的访问
+	janitorInterval time.Duration // 清理协程的运行间隔
+	janitorOnce     sync.Once     // 确保清理协程只启动一次
+	janitorStopChan chan struct{}
+	janitorReset    chan struct{} // 修改清理间隔后通知清理协程
+}
+
+// cacheShard Cache分片, 每个分片有独立的读写锁
+type cacheShard struct {
+	lock    sync.RWMutex
+	entries map[string]*DirContent
+}
+
+// CacheStats Cache的统计信息, 用于调整容量等参数
+type CacheStats struct {
+	Policy        string  `json:"policy"`      // 淘汰策略
+	Hits          uint64  `json:"hits"`        // 命中次数
+	Misses        uint64  `json:"misses"`      // 未命中次数(包括已过期)
+	HitRate       float64 `json:"hit_rate"`    // 命中率
+	Evictions     uint64  `json:"evictions"`   // 因容量不足被淘汰的条目数
+	Expirations   uint64  `json:"expirations"` // 因过期而清除的条目数
+	Rejected      uint64  `json:"rejected"`    // 过大而未放入cache的条目数
+	Stale         uint64  `json:"stale"`       // 从快照恢复后因文件夹已被修改而丢弃的条目数
+	Dropped       uint64  `json:"dropped"`     // 缓冲区已满而未记录到淘汰策略的访问次数
+	Entries       int     `json:"entries"`     // 当前条目数
+	MaxEntries    int     `json:"max_entries"` // 最大条目数, 为0时不限制
+	CurSize       uint64  `json:"cur_size"`    // 当前占用, 以B为单位
+	MaxSize       uint64  `json:"max_size"`    // 最大容量, 以B为单位
+	WindowSize    uint64  `json:"window_size"` // 各分段的占用
+	ProbationSize uint64  `json:"probation_size"`
+	ProtectedSize uint64  `json:"protected_size"`
+	PinnedSize    uint64  `json:"pinned_size"`
+	PinnedEntries int     `json:"pinned_entries"`
+	Shards        int     `json:"shards"`
+	TTLSeconds    int     `json:"ttl_seconds"`
+	JanitorSecs   int     `json:"janitor_seconds"`
 }
 
 // GetPathCache 获取Cache单例对象
 func GetPathCache() *PathCache {
-	pathCache := &PathCache{}
 	pathCacheOnce.Do(func() {
-		sys := GetSysInfoInstance()
-		sysMem := sys.MemAll
-		// 根据系统内存来指定Cache大小
-		switch {
-		case sysMem <= 1*utils.GB:
-			log.Printf("系统内存: %v", sysMem)
-			log.Printf("Your Device's Mem is too Small.")
-			return
-		case sysMem > 1*utils.GB && sysMem <= 4*utils.GB:
-			pathCache.maxSize = utils.MB * 1
-		case sysMem > 4*utils.GB && sysMem <= 8*utils.GB:
-			pathCache.maxSize = utils.MB * 2
-		case sysMem >= 8*utils.GB:
-			pathCache.maxSize = utils.MB * 5
-		}
-		// 初始化双向链表
-		head, tail := NewDirContent(), NewDirContent()
-		head.next = tail
-		tail.pre = head
-		pathCache.head, pathCache.tail = head, tail
-
-		size := head.getSize()
-		pathCache.maxSize += size * 2 // 加上首尾结点的大小
-		pathCache.curSize = size * 2
-		pathCache.directoryEntries = make(map[string]*DirContent)
-
-		// 初始化轮询协程信息
-		pathCache.janitorInterval = JanitorTime
-		pathCache.janitorStopChan = make(chan struct{})
+		pathCache = newPathCache()
+
+		// 读取配置文件中的容量、过期时间等参数
+		_, appConf, err := EnsureConfigInitialized()
+		if err != nil {
+			log.Printf("PathCache: load app config error, use default: %v", err)
+		}
+		pathCache.Configure(appConf)
+		// 开启快照时恢复上次退出时的条目
+		if err = pathCache.LoadSnapshot(); err != nil {
+			log.Printf("PathCache: load snapshot error: %v", err)
+		}
 
 		// 启动轮询检查线程
 		pathCache.startJanitor()
@@ -66,57 +110,315 @@ func GetPathCache() *PathCache {
 	return pathCache
 }
 
+func newPathCache() *PathCache {
+	shards := 1
+	for shards < CacheShards {
+		shards <<= 1
+	}
+	cache := &PathCache{
+		seed:            maphash.MakeSeed(),
+		shards:          make([]*cacheShard, shards),
+		window:          newLRUList(segWindow),
+		probation:       newLRUList(segProbation),
+		protected:       newLRUList(segProtected),
+		pinned:          newLRUList(segPinned),
+		pinnedPaths:     make(map[string]struct{}),
+		sketch:          newFrequencySketch(SketchWidth),
+		accesses:        make(chan string, AccessBufferLen),
+		janitorStopChan: make(chan struct{}),
+		janitorReset:    make(chan struct{}, 1),
+	}
+	for i := range cache.shards {
+		cache.shards[i] = &cacheShard{entries: make(map[string]*DirContent)}
+	}
+	return cache
+}
+
+// Configure 根据配置修改容量、过期时间、清理间隔、淘汰策略与固定的文件夹, 配置为0时使用默认值,
+// 容量变小时立即淘汰多余的条目
+func (cache *PathCache) Configure(conf *AppConfig) {
+	var (
+		maxSize    = defaultCacheSize()
+		maxEntries int
+		ttl        = ExpiredTime
+		interval   = JanitorTime
+		policy     = CachePolicyWTinyLFU
+		pinned     []string
+	)
+	if conf != nil {
+		if conf.CacheMaxBytes > 0 {
+			maxSize = conf.CacheMaxBytes
+		}
+		if conf.CacheMaxEntries > 0 {
+			maxEntries = conf.CacheMaxEntries
+		}
+		if conf.CacheTTLSeconds > 0 {
+			ttl = time.Duration(conf.CacheTTLSeconds) * time.Second
+		}
+		if conf.CacheJanitorSeconds > 0 {
+			interval = time.Duration(conf.CacheJanitorSeconds) * time.Second
+		}
+		if conf.CachePolicy == CachePolicyLRU {
+			policy = CachePolicyLRU
+		}
+		pinned = conf.PinnedDirs
+	}
+
+	cache.policyLock.Lock()
+	cache.maxSize = maxSize
+	cache.maxEntries = maxEntries
+	cache.ttl = ttl
+	cache.policy = policy
+	changed := cache.janitorInterval != interval
+	cache.janitorInterval = interval
+	cache.pinnedPaths = make(map[string]struct{}, len(pinned))
+	for _, path := range pinned {
+		cache.pinnedPaths[path] = struct{}{}
+	}
+	// 策略或固定的文件夹可能发生变化, 重新划分所有条目
+	cache.resegment()
+	cache.evict()
+	cache.policyLock.Unlock()
+
+	if changed {
+		select {
+		case cache.janitorReset <- struct{}{}:
+		default:
+		}
+	}
+	log.Printf("PathCache: policy %s, max size %d B, max entries %d, ttl %v, janitor interval %v, pinned %d",
+		policy, maxSize, maxEntries, ttl, interval, len(pinned))
+}
+
+// defaultCacheSize 未配置容量时根据系统内存来指定Cache大小
+func defaultCacheSize() uint64 {
+	sysMem := GetSysInfoInstance().MemAll
+	switch {
+	case sysMem <= 1*utils.GB:
+		// 内存较小时仍然保留少量缓存, 容量为0时所有条目都会被拒绝
+		log.Printf("系统内存: %v, use a small cache", sysMem)
+		return utils.KB * 512
+	case sysMem > 1*utils.GB && sysMem <= 4*utils.GB:
+		return utils.MB * 1
+	case sysMem > 4*utils.GB && sysMem <= 8*utils.GB:
+		return utils.MB * 2
+	default:
+		return utils.MB * 5
+	}
+}
+
 func (cache *PathCache) Put(dirCnt *DirContent) error {
+	if dirCnt == nil || dirCnt.Path == "" {
+		return nil
+	}
+	cache.policyLock.Lock()
+	defer cache.policyLock.Unlock()
+	// 先处理积压的访问记录, 使淘汰时的访问频率更准确
+	cache.drainAccesses()
+
 	// 当键值过大(超过cache容量30%时不放入cache)
 	if cache.maxSize > 0 && float64(dirCnt.Size) > float64(cache.maxSize)*CacheRatio {
+		cache.stats.Rejected++
 		return nil
 	}
+	// 已存在时先移除旧条目, 防止重复计算容量
+	if old := cache.lookup(dirCnt.Path); old != nil {
+		cache.removeNode(old)
+	}
 
-	cache.lock.Lock()
-	defer cache.lock.Unlock()
-
-	// cache容量不足进行淘汰
-	if cache.curSize >= cache.maxSize || cache.curSize+dirCnt.Size > cache.maxSize {
-		tail := cache.tail.pre
-		cache.removeNode(tail)
+	// 放入cache, 同时设置过期时间; 新条目先进入窗口区, 固定的文件夹直接进入固定区
+	dirCnt.ExpiredTime = time.Now().Add(cache.ttl)
+	if _, ok := cache.pinnedPaths[dirCnt.Path]; ok {
+		cache.addNode(cache.pinned, dirCnt)
+		cache.balancePinned()
+	} else {
+		cache.addNode(cache.window, dirCnt)
 	}
-	// 放入cache, 同时设置过期时间
-	dirCnt.ExpiredTime = time.Now().Add(ExpiredTime)
-	cache.addNodeToHead(dirCnt)
+	// cache容量不足进行淘汰, 直到放得下新条目
+	cache.evict()
 	log.Println("Cache 未命中")
 	return nil
 }
 
+// Get 只获取所在分片的读锁; 已过期或被修改的条目视为未命中, 由清理协程或下一次 Put 移除
 func (cache *PathCache) Get(dirPath string) (*DirContent, bool) {
-	var (
-		dirContent *DirContent
-		exist      bool
-	)
-	cache.lock.Lock()
-	defer cache.lock.Unlock()
-	// 未命中cache, 直接返回
-	if dirContent, exist = cache.directoryEntries[dirPath]; !exist {
-		return nil, false
+	shard := cache.shard(dirPath)
+	shard.lock.RLock()
+	dirContent, exist := shard.entries[dirPath]
+	valid := exist && !dirContent.IsModified && time.Now().Before(dirContent.ExpiredTime)
+	shard.lock.RUnlock()
+
+	// 从快照恢复的条目在第一次命中时核对文件夹的修改时间, 文件夹已被修改时丢弃
+	if valid && !dirContent.revalidate() {
+		cache.discard(dirContent)
+		valid = false
 	}
-	// 命中时判断键是否过期, 如果过期则移除该键
-	if time.Now().After(dirContent.ExpiredTime) {
-		cache.removeNode(dirContent)
+	// 未命中时同样记录访问频率, 使经常访问的文件夹在下次放入时能够进入主区
+	cache.recordAccess(dirPath)
+	if !valid {
+		cache.misses.Add(1)
 		return nil, false
 	}
-	cache.moveToHead(dirContent)
-	cache.cnt++
+	cache.hits.Add(1)
 	return dirContent, true
 }
 
+// Contains 判断文件夹是否在cache中且未过期, 不计入命中率与访问频率, 供预取等后台任务使用
+func (cache *PathCache) Contains(dirPath string) bool {
+	shard := cache.shard(dirPath)
+	shard.lock.RLock()
+	defer shard.lock.RUnlock()
+	dirContent, exist := shard.entries[dirPath]
+	return exist && !dirContent.IsModified && time.Now().Before(dirContent.ExpiredTime)
+}
+
 func (cache *PathCache) Remove(dirPath string) *DirContent {
+	cache.policyLock.Lock()
+	defer cache.policyLock.Unlock()
+	dirCnt := cache.lookup(dirPath)
+	cache.removeNode(dirCnt)
+	return dirCnt
+}
+
+// Update 以写时复制的方式修改条目: 在副本上执行 fn 后替换原条目, 保留其所在分段与过期时间;
+// 已经返回给调用方的旧条目不会被修改. 条目不存在或已失效时返回 false
+func (cache *PathCache) Update(dirPath string, fn func(dirCnt *DirContent)) bool {
+	cache.policyLock.Lock()
+	defer cache.policyLock.Unlock()
+	old := cache.lookup(dirPath)
+	if old == nil || old.IsModified {
+		return false
+	}
+	list := cache.listOf(old)
+	if list == nil {
+		return false
+	}
+	dirCnt := old.clone()
+	fn(dirCnt)
+	dirCnt.Size = dirCnt.getSize()
+
+	list.replace(old, dirCnt)
+	cache.expiry.replace(old, dirCnt)
+	cache.curSize = cache.curSize - old.Size + dirCnt.Size
+	shard := cache.shard(dirPath)
+	shard.lock.Lock()
+	shard.entries[dirPath] = dirCnt
+	shard.lock.Unlock()
+	cache.evict()
+	return true
+}
+
+// RemoveTree 移除文件夹及其所有子文件夹的条目, 在文件夹被重命名或移动后调用
+func (cache *PathCache) RemoveTree(dirPath string) {
+	cache.policyLock.Lock()
+	defer cache.policyLock.Unlock()
 	var (
-		dirCnt = NewDirContent()
-		exist  bool
+		prefix = strings.TrimSuffix(dirPath, string(filepath.Separator)) + string(filepath.Separator)
+		stale  []*DirContent
 	)
-	if dirCnt, exist = cache.directoryEntries[dirPath]; exist {
+	for _, shard := range cache.shards {
+		shard.lock.RLock()
+		for path, dirCnt := range shard.entries {
+			if path == dirPath || strings.HasPrefix(path, prefix) {
+				stale = append(stale, dirCnt)
+			}
+		}
+		shard.lock.RUnlock()
+	}
+	for _, dirCnt := range stale {
 		cache.removeNode(dirCnt)
 	}
-	return dirCnt
+}
+
+// discard 移除从快照恢复后已经失效的条目, 条目已被替换时不做处理
+func (cache *PathCache) discard(dirCnt *DirContent) {
+	cache.policyLock.Lock()
+	defer cache.policyLock.Unlock()
+	if cache.lookup(dirCnt.Path) == dirCnt {
+		cache.removeNode(dirCnt)
+		cache.stats.Stale++
+	}
+}
+
+// Pin 固定文件夹(例如收藏或常用的文件夹), 固定的条目只在其他条目都被淘汰后才会被淘汰
+func (cache *PathCache) Pin(dirPath string) {
+	cache.policyLock.Lock()
+	defer cache.policyLock.Unlock()
+	cache.pinnedPaths[dirPath] = struct{}{}
+	if dirCnt := cache.lookup(dirPath); dirCnt != nil && dirCnt.segment != segPinned {
+		cache.listOf(dirCnt).remove(dirCnt)
+		cache.pinned.pushFront(dirCnt)
+		cache.balancePinned()
+	}
+}
+
+// Unpin 取消固定文件夹, 已缓存的条目按普通条目处理
+func (cache *PathCache) Unpin(dirPath string) {
+	cache.policyLock.Lock()
+	defer cache.policyLock.Unlock()
+	delete(cache.pinnedPaths, dirPath)
+	if dirCnt := cache.lookup(dirPath); dirCnt != nil && dirCnt.segment == segPinned {
+		cache.pinned.remove(dirCnt)
+		cache.mainList().pushFront(dirCnt)
+		cache.evict()
+	}
+}
+
+// PinnedDirs 返回固定的文件夹
+func (cache *PathCache) PinnedDirs() []string {
+	cache.policyLock.Lock()
+	defer cache.policyLock.Unlock()
+	res := make([]string, 0, len(cache.pinnedPaths))
+	for path := range cache.pinnedPaths {
+		res = append(res, path)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// Stats 返回Cache的统计信息
+func (cache *PathCache) Stats() *CacheStats {
+	cache.policyLock.Lock()
+	defer cache.policyLock.Unlock()
+	stats := cache.stats
+	stats.Hits = cache.hits.Load()
+	stats.Misses = cache.misses.Load()
+	stats.Dropped = cache.dropped.Load()
+	if total := stats.Hits + stats.Misses; total > 0 {
+		stats.HitRate = float64(stats.Hits) / float64(total)
+	}
+	stats.Entries = cache.entries
+	stats.MaxEntries = cache.maxEntries
+	stats.CurSize = cache.curSize
+	stats.MaxSize = cache.maxSize
+	stats.Policy = cache.policy
+	stats.WindowSize = cache.window.size
+	stats.ProbationSize = cache.probation.size
+	stats.ProtectedSize = cache.protected.size
+	stats.PinnedSize = cache.pinned.size
+	stats.PinnedEntries = cache.pinned.len
+	stats.Shards = len(cache.shards)
+	stats.TTLSeconds = int(cache.ttl / time.Second)
+	stats.JanitorSecs = int(cache.janitorInterval / time.Second)
+	return &stats
+}
+
+// ResetStats 清空命中率等计数
+func (cache *PathCache) ResetStats() {
+	cache.policyLock.Lock()
+	defer cache.policyLock.Unlock()
+	cache.stats = CacheStats{}
+	cache.hits.Store(0)
+	cache.misses.Store(0)
+	cache.dropped.Store(0)
+}
+
+// overCapacity 判断再放入 entries 个共 size 大小的条目后是否超出容量
+func (cache *PathCache) overCapacity(size uint64, entries int) bool {
+	if cache.curSize+size > cache.maxSize {
+		return true
+	}
+	return cache.maxEntries > 0 && cache.entries+entries > cache.maxEntries
 }
 
 func (cache *PathCache) startJanitor() {
@@ -137,65 +439,262 @@ func (cache *PathCache) StopJanitor() {
 	}
 }
 
+// runJanitor 定期清除过期条目, 同时将缓冲的访问记录到淘汰策略中
 func (cache *PathCache) runJanitor() {
-	ticker := time.NewTicker(JanitorTime)
+	cache.policyLock.Lock()
+	interval := cache.janitorInterval
+	cache.policyLock.Unlock()
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 	for {
 		select {
+		case path := <-cache.accesses:
+			cache.policyLock.Lock()
+			cache.onAccess(path)
+			cache.drainAccesses()
+			cache.policyLock.Unlock()
 		case <-ticker.C:
 			cache.evictExpired()
+		case <-cache.janitorReset:
+			cache.policyLock.Lock()
+			interval = cache.janitorInterval
+			cache.policyLock.Unlock()
+			ticker.Reset(interval)
 		case <-cache.janitorStopChan:
 			return
 		}
 	}
 }
 
-// evictExpired 清除过期数据和修改过的脏数据
+// evictExpired 从过期堆的堆顶开始清除已过期的条目, 只处理过期的条目而不遍历整个cache
 func (cache *PathCache) evictExpired() {
-	cache.lock.Lock()
-	defer cache.lock.Unlock()
+	cache.policyLock.Lock()
+	defer cache.policyLock.Unlock()
+	now := time.Now()
+	for len(cache.expiry) > 0 && now.After(cache.expiry[0].ExpiredTime) {
+		cache.removeNode(cache.expiry[0])
+		cache.stats.Expirations++
+	}
+}
+
+// recordAccess 将访问放入缓冲通道, 缓冲区已满时丢弃, 不阻塞读操作
+func (cache *PathCache) recordAccess(dirPath string) {
+	select {
+	case cache.accesses <- dirPath:
+	default:
+		cache.dropped.Add(1)
+	}
+}
+
+// drainAccesses 处理缓冲通道中积压的访问记录, 调用方需持有 policyLock
+func (cache *PathCache) drainAccesses() {
+	for {
+		select {
+		case path := <-cache.accesses:
+			cache.onAccess(path)
+		default:
+			return
+		}
+	}
+}
+
+// onAccess 记录访问频率, 条目仍在cache中时调整所在的分段
+func (cache *PathCache) onAccess(dirPath string) {
+	cache.sketch.increment(dirPath)
+	if dirCnt := cache.lookup(dirPath); dirCnt != nil {
+		cache.onHit(dirCnt)
+	}
+}
+
+// evict 淘汰条目直到满足容量限制, 然后将窗口区中超出比例的条目移入主区
+func (cache *PathCache) evict() {
+	for cache.overCapacity(0, 0) {
+		victim := cache.victim()
+		if victim == nil {
+			break
+		}
+		cache.removeNode(victim)
+		cache.stats.Evictions++
+	}
+	if cache.policy == CachePolicyWTinyLFU {
+		for cache.window.size > cache.windowMax() && cache.window.len > 1 {
+			candidate := cache.window.back()
+			cache.window.remove(candidate)
+			cache.probation.pushFront(candidate)
+		}
+	}
+}
+
+// victim 选出下一个被淘汰的条目.
+// W-TinyLFU: 窗口区超出比例时, 窗口区尾部的候选条目与主区尾部的条目比较访问频率,
+// 频率更高的留下, 因此一次递归检索访问的大量文件夹(只访问一次)无法挤掉常用的文件夹
+func (cache *PathCache) victim() *DirContent {
+	if cache.policy == CachePolicyLRU {
+		if victim := cache.window.back(); victim != nil {
+			return victim
+		}
+		return cache.pinned.back()
+	}
+
+	var candidate *DirContent
+	if cache.window.size > cache.windowMax() {
+		candidate = cache.window.back()
+	}
+	victim := cache.probation.back()
+	if victim == nil {
+		victim = cache.protected.back()
+	}
+	switch {
+	case candidate != nil && victim != nil:
+		if cache.sketch.estimate(candidate.Path) > cache.sketch.estimate(victim.Path) {
+			// 候选条目访问更频繁, 进入主区
+			cache.window.remove(candidate)
+			cache.probation.pushFront(candidate)
+			return victim
+		}
+		return candidate
+	case victim != nil:
+		return victim
+	}
+	if victim = cache.window.back(); victim != nil {
+		return victim
+	}
+	return cache.pinned.back()
+}
+
+// onHit 命中时调整条目所在的分段
+func (cache *PathCache) onHit(dirCnt *DirContent) {
+	switch dirCnt.segment {
+	case segNone:
+		return
+	case segProbation:
+		// 试用段中再次被访问, 晋升到保护段
+		cache.probation.remove(dirCnt)
+		cache.protected.pushFront(dirCnt)
+		cache.balanceProtected()
+	default:
+		cache.listOf(dirCnt).moveToFront(dirCnt)
+	}
+}
 
-	// 遍历链表, 从尾部开始检查
-	tail := cache.tail.pre
-	for tail != cache.head {
-		if time.Now().After(tail.ExpiredTime) || tail.IsModified {
-			cache.removeNode(tail)
+// balanceProtected 保护段超出比例时, 将最久未访问的条目降级到试用段
+func (cache *PathCache) balanceProtected() {
+	limit := uint64(float64(cache.maxSize-cache.windowMax()) * CacheProtectedRatio)
+	for cache.protected.size > limit && cache.protected.len > 1 {
+		dirCnt := cache.protected.back()
+		cache.protected.remove(dirCnt)
+		cache.probation.pushFront(dirCnt)
+	}
+}
+
+// balancePinned 固定区超出比例时, 将最久未访问的条目降级为普通条目
+func (cache *PathCache) balancePinned() {
+	limit := uint64(float64(cache.maxSize) * CachePinnedRatio)
+	for cache.pinned.size > limit && cache.pinned.len > 1 {
+		dirCnt := cache.pinned.back()
+		cache.pinned.remove(dirCnt)
+		cache.mainList().pushFront(dirCnt)
+	}
+}
+
+// resegment 按当前的策略与固定的文件夹重新划分所有条目, 保持各分段内的访问顺序
+func (cache *PathCache) resegment() {
+	var entries []*DirContent
+	for _, list := range cache.lists() {
+		list.each(func(dirCnt *DirContent) {
+			segment := dirCnt.segment
+			list.remove(dirCnt)
+			dirCnt.segment = segment // 暂存原来的分段
+			entries = append(entries, dirCnt)
+		})
+	}
+	for _, dirCnt := range entries {
+		switch _, pinned := cache.pinnedPaths[dirCnt.Path]; {
+		case pinned:
+			cache.pinned.pushFront(dirCnt)
+		case cache.policy == CachePolicyLRU || dirCnt.segment == segPinned:
+			cache.mainList().pushFront(dirCnt)
+		default:
+			cache.listOf(dirCnt).pushFront(dirCnt)
 		}
-		// 密码的: 忘记修改指针, 一旦开始执行轮询, 就拿着锁不放, 导致访问文件夹/文件就卡住
-		// TODO: 优化问题: 如果轮询线程长时间持有锁, 如何优化
-		tail = tail.pre
 	}
+	cache.balancePinned()
+	cache.balanceProtected()
 }
 
-func (cache *PathCache) moveToHead(dirCnt *DirContent) {
-	cache.removeNode(dirCnt)    // 先将结点移除
-	cache.addNodeToHead(dirCnt) // 再将结点添加至链表中
+func (cache *PathCache) windowMax() uint64 {
+	return uint64(float64(cache.maxSize) * CacheWindowRatio)
 }
 
+// mainList 普通条目(取消固定或降级的条目)放入的分段
+func (cache *PathCache) mainList() *lruList {
+	if cache.policy == CachePolicyLRU {
+		return cache.window
+	}
+	return cache.probation
+}
+
+func (cache *PathCache) lists() []*lruList {
+	return []*lruList{cache.window, cache.probation, cache.protected, cache.pinned}
+}
+
+func (cache *PathCache) listOf(dirCnt *DirContent) *lruList {
+	switch dirCnt.segment {
+	case segWindow:
+		return cache.window
+	case segProbation:
+		return cache.probation
+	case segProtected:
+		return cache.protected
+	case segPinned:
+		return cache.pinned
+	}
+	return nil
+}
+
+func (cache *PathCache) shard(dirPath string) *cacheShard {
+	return cache.shards[maphash.String(cache.seed, dirPath)&uint64(len(cache.shards)-1)]
+}
+
+// lookup 在分片中查找条目, 不判断是否过期
+func (cache *PathCache) lookup(dirPath string) *DirContent {
+	shard := cache.shard(dirPath)
+	shard.lock.RLock()
+	defer shard.lock.RUnlock()
+	return shard.entries[dirPath]
+}
+
+// removeNode 从分片、分段链表与过期堆中移除条目, 调用方需持有 policyLock
 func (cache *PathCache) removeNode(dirCnt *DirContent) {
-	if dirCnt == nil || dirCnt == cache.head || dirCnt == cache.tail {
+	if dirCnt == nil {
 		return
 	}
-	var (
-		curNode *DirContent
-		ok      bool
-	)
-	if curNode, ok = cache.directoryEntries[dirCnt.Path]; !ok {
+	shard := cache.shard(dirCnt.Path)
+	shard.lock.Lock()
+	if curNode, ok := shard.entries[dirCnt.Path]; !ok || curNode != dirCnt {
+		shard.lock.Unlock()
 		return
 	}
-	curNode.pre.next = curNode.next
-	curNode.next.pre = curNode.pre
+	delete(shard.entries, dirCnt.Path)
+	shard.lock.Unlock()
 
-	delete(cache.directoryEntries, dirCnt.Path)
+	if list := cache.listOf(dirCnt); list != nil {
+		list.remove(dirCnt)
+	}
+	heap.Remove(&cache.expiry, dirCnt.heapIndex)
 	cache.curSize -= dirCnt.Size
+	cache.entries--
 }
 
-func (cache *PathCache) addNodeToHead(dirCnt *DirContent) {
-	dirCnt.next = cache.head.next
-	dirCnt.pre = cache.head
-	cache.head.next.pre = dirCnt
-	cache.head.next = dirCnt
-
-	cache.directoryEntries[dirCnt.Path] = dirCnt
+// addNode 将条目放入分段链表、过期堆与分片, 调用方需持有 policyLock
+func (cache *PathCache) addNode(list *lruList, dirCnt *DirContent) {
+	list.pushFront(dirCnt)
+	heap.Push(&cache.expiry, dirCnt)
 	cache.curSize += dirCnt.Size
+	cache.entries++
+
+	shard := cache.shard(dirCnt.Path)
+	shard.lock.Lock()
+	shard.entries[dirCnt.Path] = dirCnt
+	shard.lock.Unlock()
 }
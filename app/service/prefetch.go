@@ -0,0 +1,190 @@
+package service
+
+import (
+	"context"
+	"log"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	prefetcher          *Prefetcher
+	prefetcherOnce      sync.Once
+	PrefetchDirs        = 4                      // 未配置时每次打开文件夹后预取的文件夹数量
+	PrefetchDelay       = 300 * time.Millisecond // 打开文件夹后等待一段时间再预取, 快速连续切换时不做无用的读取
+	PrefetchInterval    = 20 * time.Millisecond  // 相邻两次读取之间的间隔, 避免与前台的读取争抢磁盘
+	PrefetchRecent      = 7 * 24 * time.Hour     // 最近修改的子文件夹更可能被打开
+	PrefetchHistorySize = 4096                   // 最多记录的文件夹访问次数, 超出时计数减半并清除不常用的文件夹
+)
+
+// Prefetcher 在打开文件夹后, 于后台将接下来最可能打开的文件夹读入 PathCache:
+// 以前打开过的子文件夹(按打开次数)、最近修改的子文件夹、上级文件夹.
+// 每次打开新的文件夹都会取消上一次尚未完成的预取
+type Prefetcher struct {
+	lock   sync.Mutex
+	visits map[string]int     // 文件夹 -> 打开次数
+	cancel context.CancelFunc // 取消当前的预取任务
+	limit  int                // 每次预取的文件夹数量, 小于0时不预取
+}
+
+// GetPrefetcher 获取预取器单例对象
+func GetPrefetcher() *Prefetcher {
+	prefetcherOnce.Do(func() {
+		prefetcher = &Prefetcher{visits: make(map[string]int)}
+		_, appConf, err := EnsureConfigInitialized()
+		if err != nil {
+			log.Printf("Prefetcher: load app config error, use default: %v", err)
+		}
+		prefetcher.Configure(appConf)
+	})
+	return prefetcher
+}
+
+// Configure 根据配置修改每次预取的文件夹数量, 为0时使用默认值, 小于0时关闭预取
+func (p *Prefetcher) Configure(conf *AppConfig) {
+	limit := PrefetchDirs
+	if conf != nil && conf.PrefetchDirs != 0 {
+		limit = conf.PrefetchDirs
+	}
+	p.lock.Lock()
+	p.limit = limit
+	p.lock.Unlock()
+}
+
+// Visit 记录用户打开了 dirCnt 所在的文件夹, 并在后台预取接下来可能打开的文件夹
+func (p *Prefetcher) Visit(dirCnt *DirContent) {
+	if dirCnt == nil || dirCnt.Path == "" {
+		return
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.record(filepath.Clean(dirCnt.Path))
+
+	// 用户已经离开上一个文件夹, 取消上一次的预取
+	if p.cancel != nil {
+		p.cancel()
+		p.cancel = nil
+	}
+	if p.limit < 0 {
+		return
+	}
+	candidates := p.candidates(dirCnt, p.limit)
+	if len(candidates) == 0 {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	p.cancel = cancel
+	go p.run(ctx, candidates)
+}
+
+// Stop 取消尚未完成的预取
+func (p *Prefetcher) Stop() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.cancel != nil {
+		p.cancel()
+		p.cancel = nil
+	}
+}
+
+// run 依次读取候选文件夹并放入cache, 已在cache中的文件夹直接跳过
+func (p *Prefetcher) run(ctx context.Context, candidates []string) {
+	var (
+		cache  = GetPathCache()
+		loaded int
+		timer  = time.NewTimer(PrefetchDelay)
+	)
+	defer timer.Stop()
+	for _, dirPath := range candidates {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+		timer.Reset(PrefetchInterval)
+		if cache.Contains(dirPath) {
+			continue
+		}
+		dirCnt := NewDirContent()
+		if err := dirCnt.GetDirCnt(dirPath); err != nil {
+			log.Printf("Prefetcher: read %s error: %v", dirPath, err)
+			continue
+		}
+		// 读取期间用户可能已经离开, 此时不再放入cache, 避免挤掉有用的条目
+		if ctx.Err() != nil {
+			return
+		}
+		if err := cache.Put(dirCnt); err != nil {
+			log.Printf("Prefetcher: cache put error: %v", err)
+			continue
+		}
+		loaded++
+	}
+	log.Printf("Prefetcher: loaded %d of %d folders", loaded, len(candidates))
+}
+
+// candidates 按可能性从高到低返回最多 limit 个文件夹, 调用方需持有锁
+func (p *Prefetcher) candidates(dirCnt *DirContent, limit int) []string {
+	type candidate struct {
+		path    string
+		visits  int
+		modTime time.Time
+	}
+	var (
+		recent = time.Now().Add(-PrefetchRecent)
+		subs   = make([]candidate, 0, len(dirCnt.SubDirs))
+		res    = make([]string, 0, limit)
+	)
+	for _, entry := range dirCnt.SubDirs {
+		visits := p.visits[entry.Path]
+		if visits == 0 && entry.ModTime.Before(recent) {
+			continue
+		}
+		subs = append(subs, candidate{path: entry.Path, visits: visits, modTime: entry.ModTime})
+	}
+	// 打开过的子文件夹优先, 其次是最近修改的子文件夹
+	sort.Slice(subs, func(i, j int) bool {
+		if subs[i].visits != subs[j].visits {
+			return subs[i].visits > subs[j].visits
+		}
+		return subs[i].modTime.After(subs[j].modTime)
+	})
+
+	// 上级文件夹排在打开过的子文件夹之后、仅最近修改的子文件夹之前
+	parent := filepath.Dir(dirCnt.Path)
+	hasParent := parent != filepath.Clean(dirCnt.Path) && parent != "."
+	for _, sub := range subs {
+		if len(res) >= limit {
+			return res
+		}
+		if hasParent && sub.visits == 0 {
+			res = append(res, parent)
+			hasParent = false
+			if len(res) >= limit {
+				return res
+			}
+		}
+		res = append(res, sub.path)
+	}
+	if hasParent && len(res) < limit {
+		res = append(res, parent)
+	}
+	return res
+}
+
+// record 记录一次打开, 记录过多时所有计数减半并清除计数为0的文件夹, 调用方需持有锁
+func (p *Prefetcher) record(dirPath string) {
+	p.visits[dirPath]++
+	if len(p.visits) <= PrefetchHistorySize {
+		return
+	}
+	for path, visits := range p.visits {
+		if visits/2 == 0 && path != dirPath {
+			delete(p.visits, path)
+		} else {
+			p.visits[path] = max(visits/2, 1)
+		}
+	}
+}
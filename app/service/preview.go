@@ -0,0 +1,475 @@
+package service
+
+import (
+	"GoSearch/app/utils"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	_ "golang.org/x/image/bmp"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// 预览类型
+const (
+	PreviewText     = "text"
+	PreviewImage    = "image"
+	PreviewHex      = "hex"
+	PreviewDir      = "directory"
+	PreviewDocument = "document" // 从 PDF/Office 文件中提取的文字
+)
+
+// 预览内容通过资源服务器提供的路径前缀
+const PreviewURLPrefix = "/preview/"
+
+var (
+	previewStore        *PreviewStore
+	previewStoreOnce    sync.Once
+	PreviewTextBytes    = 64 * int(utils.KB)   // 文本预览读取的最大字节数
+	PreviewHexBytes     = 4 * int(utils.KB)    // 十六进制预览读取的字节数
+	PreviewImageSize    = 512                  // 图片缩略图的最大边长
+	PreviewMaxImage     = 64 * int64(utils.MB) // 超过该大小的图片不解码
+	PreviewMaxPixels    = 64 * 1000 * 1000     // 超过该像素数的图片不解码, 防止解码炸弹
+	PreviewMaxDocument  = 64 * int64(utils.MB) // 超过该大小的文档不提取文字
+	PreviewDirEntries   = 100                  // 文件夹预览列出的最大条目数
+	PreviewTimeout      = 5 * time.Second      // 生成一个预览的最长时间
+	PreviewStoreEntries = 32                   // 资源服务器保留的预览内容数量
+)
+
+// Preview 文件预览的描述, 预览内容(文本、图片等)通过 URL 从资源服务器获取, 不经过 JSON 传递
+type Preview struct {
+	Path      string      `json:"path"`
+	Kind      string      `json:"kind"`
+	MimeType  string      `json:"mime_type"`
+	Size      int64       `json:"size"`
+	ModTime   time.Time   `json:"mod_time"`
+	Encoding  string      `json:"encoding,omitempty"` // 文本编码: utf-8, utf-16le, utf-16be, gb18030
+	Truncated bool        `json:"truncated"`          // 内容是否只包含文件的开头部分
+	Width     int         `json:"width,omitempty"`    // 原图尺寸
+	Height    int         `json:"height,omitempty"`   //
+	URL       string      `json:"url,omitempty"`      // 预览内容的地址, 文件夹预览为空
+	Summary   *DirSummary `json:"summary,omitempty"`  // 文件夹预览
+	Message   string      `json:"message,omitempty"`  // 无法生成完整预览时的说明
+}
+
+// DirSummary 文件夹预览: 直接包含的项目数量、文件大小之和与部分条目
+type DirSummary struct {
+	Files     int                `json:"files"`
+	Dirs      int                `json:"dirs"`
+	TotalSize int64              `json:"total_size"` // 直接包含的文件大小之和, 不含子文件夹
+	Types     map[string]int     `json:"types"`      // 各扩展名的文件数量
+	Entries   []*FileSystemEntry `json:"entries"`    // 文件夹在前, 按名称排序
+	Truncated bool               `json:"truncated"`
+}
+
+// previewContent 资源服务器保存的预览内容
+type previewContent struct {
+	id          string
+	contentType string
+	data        []byte
+}
+
+// PreviewStore 保存最近生成的预览内容并通过资源服务器提供, 只能访问生成过的预览, 不能读取任意文件
+type PreviewStore struct {
+	lock    sync.Mutex
+	entries []*previewContent // 最近生成的在后
+}
+
+// GetPreviewStore 获取预览内容存储单例对象, 同时作为资源服务器的 Handler
+func GetPreviewStore() *PreviewStore {
+	previewStoreOnce.Do(func() {
+		previewStore = &PreviewStore{}
+	})
+	return previewStore
+}
+
+// ServeHTTP 提供 /preview/<id> 的内容
+func (s *PreviewStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id, ok := strings.CutPrefix(r.URL.Path, PreviewURLPrefix)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	s.lock.Lock()
+	var content *previewContent
+	for _, entry := range s.entries {
+		if entry.id == id {
+			content = entry
+			break
+		}
+	}
+	s.lock.Unlock()
+	if content == nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", content.contentType)
+	w.Header().Set("Cache-Control", "private, max-age=300")
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content.data))
+}
+
+// put 保存预览内容, 返回访问地址
+func (s *PreviewStore) put(contentType string, data []byte) string {
+	content := &previewContent{id: fmt.Sprintf("%d", time.Now().UnixNano()), contentType: contentType, data: data}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.entries = append(s.entries, content)
+	if len(s.entries) > PreviewStoreEntries {
+		s.entries = s.entries[len(s.entries)-PreviewStoreEntries:]
+	}
+	return PreviewURLPrefix + content.id
+}
+
+// GetPreview 生成文件或文件夹的预览, 超过 PreviewTimeout 时返回错误
+func GetPreview(ctx context.Context, path string) (*Preview, error) {
+	if path == "" {
+		return nil, fmt.Errorf("path is null")
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	preview := &Preview{Path: path, Size: info.Size(), ModTime: info.ModTime()}
+	if info.IsDir() {
+		preview.Kind = PreviewDir
+		preview.Summary, err = summarizeDir(path)
+		return preview, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, PreviewTimeout)
+	defer cancel()
+	type result struct {
+		contentType string
+		data        []byte
+		err         error
+	}
+	// 解码图片等操作无法中断, 超时后在后台结束
+	done := make(chan result, 1)
+	go func() {
+		contentType, data, err := buildPreview(ctx, path, preview)
+		done <- result{contentType, data, err}
+	}()
+	select {
+	case res := <-done:
+		if res.err != nil {
+			return nil, res.err
+		}
+		preview.URL = GetPreviewStore().put(res.contentType, res.data)
+		return preview, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("preview %s timed out: %w", filepath.Base(path), ctx.Err())
+	}
+}
+
+// buildPreview 按文件类型生成预览内容, 无法识别的类型按内容判断是文本还是二进制
+func buildPreview(ctx context.Context, path string, preview *Preview) (string, []byte, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	preview.MimeType = mime.TypeByExtension(ext)
+	switch ext {
+	case ".jpg", ".jpeg", ".png", ".gif", ".webp", ".bmp":
+		if preview.Size > PreviewMaxImage {
+			preview.Message = "image is too large to preview"
+			break
+		}
+		data, err := previewImage(path, preview)
+		if err == nil {
+			preview.Kind = PreviewImage
+			return "image/jpeg", data, nil
+		}
+		preview.Message = err.Error()
+	case ".pdf", ".docx", ".xlsx", ".pptx":
+		if preview.Size > PreviewMaxDocument {
+			preview.Message = "document is too large to extract text"
+			break
+		}
+		text, truncated, err := ExtractDocumentText(ctx, path, PreviewTextBytes)
+		if err == nil {
+			preview.Kind, preview.Encoding, preview.Truncated = PreviewDocument, "utf-8", truncated
+			return "text/plain; charset=utf-8", []byte(text), nil
+		}
+		preview.Message = err.Error()
+	}
+
+	sample, err := readHead(path, PreviewTextBytes)
+	if err != nil {
+		return "", nil, err
+	}
+	if preview.MimeType == "" {
+		preview.MimeType = http.DetectContentType(sample)
+	}
+	if text, encoding, ok := decodeText(sample, int64(len(sample)) < preview.Size); ok {
+		preview.Kind, preview.Encoding = PreviewText, encoding
+		preview.Truncated = int64(len(sample)) < preview.Size
+		return "text/plain; charset=utf-8", []byte(text), nil
+	}
+	if len(sample) > PreviewHexBytes {
+		sample = sample[:PreviewHexBytes]
+	}
+	preview.Kind = PreviewHex
+	preview.Truncated = int64(len(sample)) < preview.Size
+	return "text/plain; charset=utf-8", []byte(hex.Dump(sample)), nil
+}
+
+// readHead 读取文件开头最多 n 个字节
+func readHead(path string, n int) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	buf := make([]byte, n)
+	read, err := io.ReadFull(file, buf)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return buf[:read], nil
+}
+
+// decodeText 识别文本编码并转换为 UTF-8: 先看 BOM, 再依次尝试 UTF-8、无 BOM 的 UTF-16 与 GB18030;
+// truncated 表示 data 只是文件的开头, 末尾可能有被截断的字符. 判断为二进制时返回 false
+func decodeText(data []byte, truncated bool) (string, string, bool) {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xEF, 0xBB, 0xBF}):
+		return trimPartialRune(data[3:], truncated), "utf-8", true
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}):
+		return decodeUTF16(data[2:], false), "utf-16le", true
+	case bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		return decodeUTF16(data[2:], true), "utf-16be", true
+	}
+	if len(data) == 0 {
+		return "", "utf-8", true
+	}
+	if text := trimPartialRune(data, truncated); utf8.ValidString(text) && !hasBinaryControl(text) {
+		return text, "utf-8", true
+	}
+	// 无 BOM 的 UTF-16: ASCII 字符的高字节为0, 零字节集中在偶数或奇数位置
+	var even, odd int
+	for i, b := range data {
+		if b == 0 {
+			if i%2 == 0 {
+				even++
+			} else {
+				odd++
+			}
+		}
+	}
+	half := len(data) / 2
+	if odd > half*3/10 && even <= half/20 {
+		return decodeUTF16(data, false), "utf-16le", true
+	}
+	if even > half*3/10 && odd <= half/20 {
+		return decodeUTF16(data, true), "utf-16be", true
+	}
+	if even+odd > 0 {
+		return "", "", false
+	}
+	// GB18030 兼容 GBK 与 GB2312, 无法解码的字符很少时认为是中文文本
+	decoded, err := simplifiedchinese.GB18030.NewDecoder().Bytes(data)
+	if err != nil {
+		return "", "", false
+	}
+	text := strings.TrimRight(string(decoded), string(utf8.RuneError))
+	if invalid := strings.Count(text, string(utf8.RuneError)); invalid*100 > utf8.RuneCountInString(text) || hasBinaryControl(text) {
+		return "", "", false
+	}
+	return text, "gb18030", true
+}
+
+// trimPartialRune 去掉因截断而不完整的最后一个 UTF-8 字符
+func trimPartialRune(data []byte, truncated bool) string {
+	if truncated {
+		for i := 0; i < utf8.UTFMax && len(data) > 0; i++ {
+			if r, size := utf8.DecodeLastRune(data); r != utf8.RuneError || size > 1 {
+				break
+			}
+			data = data[:len(data)-1]
+		}
+	}
+	return string(data)
+}
+
+func decodeUTF16(data []byte, bigEndian bool) string {
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		if bigEndian {
+			units[i] = uint16(data[2*i])<<8 | uint16(data[2*i+1])
+		} else {
+			units[i] = uint16(data[2*i+1])<<8 | uint16(data[2*i])
+		}
+	}
+	// 截断在代理对中间时去掉不完整的部分
+	if n := len(units); n > 0 && utf16.IsSurrogate(rune(units[n-1])) {
+		units = units[:n-1]
+	}
+	return string(utf16.Decode(units))
+}
+
+// hasBinaryControl 文本中出现除换行、制表等以外的控制字符时视为二进制
+func hasBinaryControl(text string) bool {
+	for _, r := range text {
+		if r < 0x20 && r != '\n' && r != '\r' && r != '\t' && r != '\f' && r != 0x1B {
+			return true
+		}
+	}
+	return false
+}
+
+// previewImage 解码图片并缩小到 PreviewImageSize 以内, 按 EXIF 方向旋转, 输出 JPEG
+func previewImage(path string, preview *Preview) ([]byte, error) {
+	img, err := decodeImage(path, PreviewMaxPixels)
+	if err != nil {
+		return nil, err
+	}
+	bounds := img.Bounds()
+	preview.Width, preview.Height = bounds.Dx(), bounds.Dy()
+	thumb := scaleImage(img, PreviewImageSize, color.White)
+	if exif, err := ReadExif(path); err == nil {
+		thumb = orientImage(thumb, exif.Orientation())
+	}
+	var buf bytes.Buffer
+	if err = jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: 85}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeImage 先读取图片尺寸, 像素数不超过 maxPixels 时才完整解码
+func decodeImage(path string, maxPixels int) (image.Image, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	config, _, err := image.DecodeConfig(file)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported image: %w", err)
+	}
+	if config.Width*config.Height > maxPixels {
+		return nil, fmt.Errorf("image is too large to preview (%dx%d)", config.Width, config.Height)
+	}
+	if _, err = file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(file)
+	return img, err
+}
+
+// scaleImage 等比缩小到最大边长 size 以内, background 不为 nil 时透明部分填充为该颜色
+func scaleImage(img image.Image, size int, background color.Color) *image.RGBA {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > size || height > size {
+		if width >= height {
+			width, height = size, max(1, height*size/width)
+		} else {
+			width, height = max(1, width*size/height), size
+		}
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	if background != nil {
+		draw.Draw(dst, dst.Bounds(), image.NewUniform(background), image.Point{}, draw.Src)
+	}
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Over, nil)
+	return dst
+}
+
+// orientImage 按 EXIF 方向(1-8)翻转或旋转图片
+func orientImage(img *image.RGBA, orientation int) *image.RGBA {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	// 5-8 需要交换宽高
+	dstW, dstH := width, height
+	if orientation >= 5 {
+		dstW, dstH = height, width
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2:
+				dx, dy = width-1-x, y
+			case 3:
+				dx, dy = width-1-x, height-1-y
+			case 4:
+				dx, dy = x, height-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = height-1-y, x
+			case 7:
+				dx, dy = height-1-y, width-1-x
+			case 8:
+				dx, dy = y, width-1-x
+			}
+			dst.SetRGBA(dx, dy, img.RGBAAt(bounds.Min.X+x, bounds.Min.Y+y))
+		}
+	}
+	return dst
+}
+
+// summarizeDir 统计文件夹直接包含的项目, 不递归子文件夹
+func summarizeDir(path string) (*DirSummary, error) {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	summary := &DirSummary{Types: make(map[string]int)}
+	items := make([]*FileSystemEntry, 0, len(entries))
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		item := &FileSystemEntry{
+			Name:    entry.Name(),
+			Path:    filepath.Join(path, entry.Name()),
+			IsDir:   entry.IsDir(),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+			Mode:    info.Mode(),
+		}
+		if item.IsDir {
+			summary.Dirs++
+		} else {
+			summary.Files++
+			summary.TotalSize += item.Size
+			ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(item.Name), "."))
+			summary.Types[ext]++
+		}
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].IsDir != items[j].IsDir {
+			return items[i].IsDir
+		}
+		return strings.ToLower(items[i].Name) < strings.ToLower(items[j].Name)
+	})
+	if len(items) > PreviewDirEntries {
+		items, summary.Truncated = items[:PreviewDirEntries], true
+	}
+	summary.Entries = items
+	return summary, nil
+}
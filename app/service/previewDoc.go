@@ -0,0 +1,387 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	pdfStreamPattern = regexp.MustCompile(`>>\s*stream\r?\n`)
+	pptxSlidePattern = regexp.MustCompile(`^ppt/slides/slide(\d+)\.xml$`)
+)
+
+// textCollector 收集提取出的文字, 超过 limit 字节时停止
+type textCollector struct {
+	buf       strings.Builder
+	limit     int
+	truncated bool
+}
+
+func (c *textCollector) write(s string) bool {
+	if c.truncated {
+		return false
+	}
+	if c.buf.Len()+len(s) > c.limit {
+		s = s[:c.limit-c.buf.Len()]
+		for len(s) > 0 && !utf8.ValidString(s) {
+			s = s[:len(s)-1]
+		}
+		c.buf.WriteString(s)
+		c.truncated = true
+		return false
+	}
+	c.buf.WriteString(s)
+	return true
+}
+
+// newline 换行, 不产生连续的空行
+func (c *textCollector) newline() {
+	if text := c.buf.String(); text != "" && !strings.HasSuffix(text, "\n") {
+		c.write("\n")
+	}
+}
+
+// ExtractDocumentText 提取 PDF、docx、xlsx、pptx 中的文字, 最多 limit 字节, 第二个返回值表示是否被截断;
+// PDF 只支持未加密、使用 FlateDecode 或未压缩的内容流, 使用 CID 字体(常见于中文 PDF)的文字无法直接还原
+func ExtractDocumentText(ctx context.Context, path string, limit int) (string, bool, error) {
+	collector := &textCollector{limit: limit}
+	var err error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".pdf":
+		err = extractPDFText(ctx, path, collector)
+	case ".docx":
+		err = extractOfficeText(ctx, path, []string{"word/document.xml"}, collector)
+	case ".xlsx":
+		err = extractOfficeText(ctx, path, []string{"xl/sharedStrings.xml"}, collector)
+	case ".pptx":
+		err = extractPPTXText(ctx, path, collector)
+	default:
+		err = fmt.Errorf("unsupported document type: %s", filepath.Ext(path))
+	}
+	if err != nil {
+		return "", false, err
+	}
+	text := strings.TrimSpace(collector.buf.String())
+	if text == "" {
+		return "", false, fmt.Errorf("no text found in %s", filepath.Base(path))
+	}
+	return text, collector.truncated, nil
+}
+
+// extractPPTXText 按幻灯片编号顺序提取文字
+func extractPPTXText(ctx context.Context, path string, collector *textCollector) error {
+	reader, err := zip.OpenReader(path)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	type slide struct {
+		number int
+		name   string
+	}
+	var slides []slide
+	for _, file := range reader.File {
+		if match := pptxSlidePattern.FindStringSubmatch(file.Name); match != nil {
+			number, _ := strconv.Atoi(match[1])
+			slides = append(slides, slide{number, file.Name})
+		}
+	}
+	sort.Slice(slides, func(i, j int) bool { return slides[i].number < slides[j].number })
+	names := make([]string, len(slides))
+	for i, s := range slides {
+		names[i] = s.name
+	}
+	return readOfficeParts(ctx, &reader.Reader, names, collector)
+}
+
+func extractOfficeText(ctx context.Context, path string, names []string, collector *textCollector) error {
+	reader, err := zip.OpenReader(path)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	return readOfficeParts(ctx, &reader.Reader, names, collector)
+}
+
+// readOfficeParts 读取 Office Open XML 中的文字: 各格式的文字都在 <t> 元素中, 段落(p)、共享字符串(si)结束时换行
+func readOfficeParts(ctx context.Context, reader *zip.Reader, names []string, collector *textCollector) error {
+	found := false
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		file, err := reader.Open(name)
+		if err != nil {
+			continue
+		}
+		found = true
+		err = readOfficeXML(file, collector)
+		file.Close()
+		if err != nil {
+			return err
+		}
+		collector.newline()
+		if collector.truncated {
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("document has no text part")
+	}
+	return nil
+}
+
+func readOfficeXML(r io.Reader, collector *textCollector) error {
+	decoder := xml.NewDecoder(r)
+	inText := false
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "t":
+				inText = true
+			case "tab":
+				collector.write("\t")
+			case "br":
+				collector.write("\n")
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p", "si":
+				collector.newline()
+			}
+		case xml.CharData:
+			if inText && !collector.write(string(t)) {
+				return nil
+			}
+		}
+	}
+}
+
+// extractPDFText 解压 PDF 中的内容流并取出文字绘制操作(Tj、TJ、'、")中的字符串
+func extractPDFText(ctx context.Context, path string, collector *textCollector) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if !bytes.HasPrefix(data, []byte("%PDF")) {
+		return fmt.Errorf("not a pdf file")
+	}
+	for _, match := range pdfStreamPattern.FindAllIndex(data, -1) {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		// 流的字典从所在对象的 obj 关键字开始
+		dict := data[:match[0]]
+		if obj := bytes.LastIndex(dict, []byte(" obj")); obj >= 0 {
+			dict = dict[obj:]
+		}
+		start := match[1]
+		end := bytes.Index(data[start:], []byte("endstream"))
+		if end < 0 {
+			break
+		}
+		stream := data[start : start+end]
+		// 只处理内容流, 跳过图片、字体等
+		if bytes.Contains(dict, []byte("/Subtype")) || bytes.Contains(dict, []byte("/Type")) {
+			continue
+		}
+		if bytes.Contains(dict, []byte("/FlateDecode")) {
+			inflated, err := io.ReadAll(io.LimitReader(zlibReader(stream), int64(PreviewMaxDocument)))
+			if len(inflated) == 0 && err != nil {
+				continue
+			}
+			stream = inflated
+		} else if bytes.Contains(dict, []byte("/Filter")) {
+			continue
+		}
+		if !parsePDFContent(stream, collector) {
+			break
+		}
+	}
+	return nil
+}
+
+// zlibReader 内容流可能末尾有多余的换行, 解压出错时返回已解压的部分
+func zlibReader(stream []byte) io.Reader {
+	reader, err := zlib.NewReader(bytes.NewReader(stream))
+	if err != nil {
+		return bytes.NewReader(nil)
+	}
+	return reader
+}
+
+// parsePDFContent 解析内容流中的字符串与文字操作符, 返回 false 表示已达到长度限制
+func parsePDFContent(content []byte, collector *textCollector) bool {
+	var (
+		pending []string // 等待绘制操作符的字符串
+		inArray bool
+	)
+	for i := 0; i < len(content); {
+		c := content[i]
+		switch {
+		case c == '(':
+			s, next := readPDFString(content, i)
+			pending = append(pending, s)
+			i = next
+		case c == '<' && i+1 < len(content) && content[i+1] != '<':
+			end := bytes.IndexByte(content[i:], '>')
+			if end < 0 {
+				return true
+			}
+			pending = append(pending, decodePDFHex(content[i+1:i+end]))
+			i += end + 1
+		case c == '[':
+			inArray = true
+			pending = pending[:0]
+			i++
+		case c == ']':
+			inArray = false
+			i++
+		case c == '%':
+			for i < len(content) && content[i] != '\n' && content[i] != '\r' {
+				i++
+			}
+		case isPDFRegular(c):
+			start := i
+			for i < len(content) && isPDFRegular(content[i]) {
+				i++
+			}
+			switch op := string(content[start:i]); op {
+			case "Tj", "TJ":
+				if !collector.write(strings.Join(pending, "")) {
+					return false
+				}
+				pending = pending[:0]
+			case "'", "\"":
+				collector.newline()
+				if !collector.write(strings.Join(pending, "")) {
+					return false
+				}
+				pending = pending[:0]
+			case "T*", "Td", "TD", "ET":
+				collector.newline()
+			default:
+				// TJ 数组中较大的负数间距通常表示单词之间的空格
+				if inArray && len(pending) > 0 {
+					if n, err := strconv.ParseFloat(op, 64); err == nil && n < -200 {
+						pending = append(pending, " ")
+					}
+				}
+			}
+		default:
+			i++
+		}
+	}
+	return true
+}
+
+func isPDFRegular(c byte) bool {
+	return !strings.ContainsRune(" \t\r\n\f\x00()<>[]{}/%", rune(c))
+}
+
+// readPDFString 读取从 start 处的 '(' 开始的字符串, 处理嵌套括号与转义, 返回字符串与结束后的位置
+func readPDFString(content []byte, start int) (string, int) {
+	var (
+		buf   []byte
+		depth = 0
+		i     = start
+	)
+	for ; i < len(content); i++ {
+		c := content[i]
+		switch c {
+		case '(':
+			depth++
+			if depth == 1 {
+				continue
+			}
+		case ')':
+			depth--
+			if depth == 0 {
+				return printablePDF(buf), i + 1
+			}
+		case '\\':
+			i++
+			if i >= len(content) {
+				break
+			}
+			switch e := content[i]; e {
+			case 'n':
+				buf = append(buf, '\n')
+			case 'r', '\n':
+			case 't':
+				buf = append(buf, '\t')
+			case 'b', 'f':
+			case '0', '1', '2', '3', '4', '5', '6', '7':
+				n := 0
+				for j := 0; j < 3 && i < len(content) && content[i] >= '0' && content[i] <= '7'; j++ {
+					n = n*8 + int(content[i]-'0')
+					i++
+				}
+				i--
+				buf = append(buf, byte(n))
+			default:
+				buf = append(buf, e)
+			}
+			continue
+		}
+		buf = append(buf, c)
+	}
+	return printablePDF(buf), i
+}
+
+func decodePDFHex(data []byte) string {
+	digits := make([]byte, 0, len(data))
+	for _, c := range data {
+		if unicode.Is(unicode.ASCII_Hex_Digit, rune(c)) {
+			digits = append(digits, c)
+		}
+	}
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	buf := make([]byte, len(digits)/2)
+	for i := range buf {
+		n, _ := strconv.ParseUint(string(digits[2*i:2*i+2]), 16, 8)
+		buf[i] = byte(n)
+	}
+	return printablePDF(buf)
+}
+
+// printablePDF 按单字节编码解释字符串, 含有不可打印字符时(通常是 CID 字体的字形编号)丢弃
+func printablePDF(data []byte) string {
+	// UTF-16BE 文本字符串
+	if bytes.HasPrefix(data, []byte{0xFE, 0xFF}) {
+		return decodeUTF16(data[2:], true)
+	}
+	runes := make([]rune, 0, len(data))
+	for _, b := range data {
+		if b < 0x20 && b != '\n' && b != '\t' {
+			return ""
+		}
+		runes = append(runes, rune(b))
+	}
+	return string(runes)
+}
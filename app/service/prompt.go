@@ -0,0 +1,237 @@
+package service
+
+import (
+	"GoSearch/app/utils"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// 提示词模板名称
+const (
+	PromptSearch = "search" // 自然语言检索条件解析
+	PromptRefine = "refine" // 多轮检索时追加在 search 之后的说明
+	PromptRerank = "rerank" // 检索结果重排
+	PromptAgent  = "agent"  // 文件操作助手
+)
+
+// BuiltinPromptVersion 内置提示词的版本, 修改内置模板后需要同步修改, 使旧的大模型缓存失效;
+// 用户自定义的模板使用内容摘要作为版本, 修改后自动生效
+const BuiltinPromptVersion = "3"
+
+//go:embed prompts/*.tmpl
+var builtinPrompts embed.FS
+
+// PromptData 渲染提示词时可用的变量, 每次请求时重新生成
+type PromptData struct {
+	Now           string   // 当前时间, 例如 2025-06-18 15:04
+	Weekday       string   // 星期
+	TimeZone      string   // 时区名称与UTC偏移, 例如 CST (UTC+08:00)
+	TimeExample   string   // 带时区的时间格式示例
+	OS            string   // 操作系统
+	PathSeparator string   // 路径分隔符
+	PathExample   string   // 当前系统的路径示例
+	Fields        []string // 检索条件中允许输出的字段
+	BaseDir       string   // 当前工作目录, 可能为空
+}
+
+// Prompt 渲染后的提示词
+type Prompt struct {
+	Name    string
+	Version string // 记录到缓存与日志中, 用于追踪提示词的修改
+	Text    string
+	Digest  string // 不含当前时间的渲染结果摘要, 用于生成缓存键; 语言、模板、时区、系统等变化时随之改变
+}
+
+// NewPromptData 根据当前时间与系统信息生成提示词变量
+func NewPromptData(baseDir string) *PromptData {
+	var (
+		now     = time.Now()
+		zone, _ = now.Zone()
+		sys     = GetSysInfoInstance()
+		example = "/home/user/Documents/report.pdf"
+	)
+	if sys.OS == utils.WINDOWS {
+		example = `C:\Users\user\Documents\report.pdf`
+	}
+	return &PromptData{
+		Now:           now.Format("2006-01-02 15:04"),
+		Weekday:       now.Weekday().String(),
+		TimeZone:      fmt.Sprintf("%s (UTC%s)", zone, now.Format("-07:00")),
+		TimeExample:   now.Format("2006-01-02T15:04:05-07:00"),
+		OS:            sys.OS,
+		PathSeparator: string(filepath.Separator),
+		PathExample:   example,
+		Fields:        jsonFields(reflect.TypeOf(llmParams{})),
+		BaseDir:       baseDir,
+	}
+}
+
+// RenderPrompt 渲染指定名称的提示词, 优先使用配置目录 prompts 文件夹下的自定义模板,
+// 模板语言见 promptLanguage
+func RenderPrompt(name string, data *PromptData) (*Prompt, error) {
+	var (
+		lang          = promptLanguage()
+		text, version string
+		custom        bool
+		err           error
+		prompt        *Prompt
+	)
+	if text, version, custom, err = loadPromptTemplate(name, lang); err != nil {
+		return nil, err
+	}
+	if prompt, err = executePrompt(name, version, text, data); err == nil || !custom {
+		return prompt, err
+	}
+	// 自定义模板有误时使用内置模板, 避免影响检索
+	log.Printf("Prompt: custom template %s error, fallback to builtin: %v", name, err)
+	if text, version, err = builtinPrompt(name, lang); err != nil {
+		return nil, err
+	}
+	return executePrompt(name, version, text, data)
+}
+
+func executePrompt(name, version, text string, data *PromptData) (*Prompt, error) {
+	var sb strings.Builder
+	tmpl, err := template.New(name).Funcs(template.FuncMap{"join": strings.Join}).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("parse prompt %s: %w", name, err)
+	}
+	if err = tmpl.Execute(&sb, data); err != nil {
+		return nil, fmt.Errorf("render prompt %s: %w", name, err)
+	}
+	prompt := &Prompt{Name: name, Version: version, Text: sb.String()}
+
+	// 当前时间每分钟都在变化, 计算摘要时去掉, 相对日期由 CacheKey 单独处理
+	stable := *data
+	stable.Now, stable.Weekday, stable.TimeExample = "", "", ""
+	sb.Reset()
+	if err = tmpl.Execute(&sb, &stable); err != nil {
+		return nil, fmt.Errorf("render prompt %s: %w", name, err)
+	}
+	sum := sha256.Sum256([]byte(sb.String()))
+	prompt.Digest = hex.EncodeToString(sum[:8])
+	return prompt, nil
+}
+
+// ExportPromptTemplates 将内置模板写入配置目录供用户修改, 已存在的文件不会被覆盖, 返回模板目录
+func ExportPromptTemplates() (string, error) {
+	dir, err := promptDir()
+	if err != nil {
+		return "", err
+	}
+	if err = utils.EnsureDirExists(dir, 0755); err != nil {
+		return "", err
+	}
+	entries, err := builtinPrompts.ReadDir("prompts")
+	if err != nil {
+		return "", err
+	}
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		if exist, _ := utils.IsPathExist(path); exist {
+			continue
+		}
+		data, err := builtinPrompts.ReadFile("prompts/" + entry.Name())
+		if err != nil {
+			return "", err
+		}
+		if err = utils.StoreFile(path, data); err != nil {
+			return "", err
+		}
+	}
+	return dir, nil
+}
+
+// loadPromptTemplate 读取模板内容与版本, 每次请求时读取, 修改模板无需重启应用
+func loadPromptTemplate(name, lang string) (string, string, bool, error) {
+	if dir, err := promptDir(); err == nil {
+		data, err := os.ReadFile(filepath.Join(dir, promptFileName(name, lang)))
+		if err == nil && len(strings.TrimSpace(string(data))) > 0 {
+			sum := sha256.Sum256(data)
+			return string(data), "custom-" + hex.EncodeToString(sum[:4]), true, nil
+		} else if err != nil && !os.IsNotExist(err) {
+			log.Printf("Prompt: read custom template %s error: %v", name, err)
+		}
+	}
+	text, version, err := builtinPrompt(name, lang)
+	return text, version, false, err
+}
+
+func builtinPrompt(name, lang string) (string, string, error) {
+	data, err := builtinPrompts.ReadFile("prompts/" + promptFileName(name, lang))
+	if err != nil {
+		return "", "", fmt.Errorf("prompt template %s not found: %w", name, err)
+	}
+	return string(data), fmt.Sprintf("builtin-%s-%s", lang, BuiltinPromptVersion), nil
+}
+
+func promptDir() (string, error) {
+	bootConf, _, err := EnsureConfigInitialized()
+	if err != nil || bootConf == nil {
+		return "", fmt.Errorf("boot config is nil")
+	}
+	return utils.Join(bootConf.CustomConfigDir, utils.PromptDirName), nil
+}
+
+func promptFileName(name, lang string) string {
+	return name + "." + lang + ".tmpl"
+}
+
+// promptLanguage 选择模板语言, 目前只提供中文与英文: 依次使用 AppConfig.PromptLanguage 与界面语言中支持的语言,
+// 两者都没有设置时才根据系统语言判断; 设置的语言都不支持或无法判断时使用中文(旧版本内置的提示词)
+func promptLanguage() string {
+	_, conf, err := EnsureConfigInitialized()
+	if err == nil && conf != nil {
+		if lang := supportedPromptLanguage(conf.PromptLanguage); lang != "" {
+			return lang
+		}
+		if lang := supportedPromptLanguage(conf.Language); lang != "" {
+			return lang
+		}
+		if conf.PromptLanguage != "" || conf.Language != "" {
+			return "zh"
+		}
+	}
+	if lang := supportedPromptLanguage(systemLanguage()); lang != "" {
+		return lang
+	}
+	return "zh"
+}
+
+// supportedPromptLanguage 返回语言代码对应的模板语言, 不支持时返回空
+func supportedPromptLanguage(lang string) string {
+	switch lang = strings.ToLower(lang); {
+	case strings.HasPrefix(lang, "zh"):
+		return "zh"
+	case strings.HasPrefix(lang, "en"):
+		return "en"
+	}
+	return ""
+}
+
+// jsonFields 返回结构体的JSON字段名
+func jsonFields(t reflect.Type) []string {
+	fields := make([]string, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		fields = append(fields, name)
+	}
+	return fields
+}
+
+// String 日志中记录的提示词标识, 例如 search@builtin-zh-2
+func (p *Prompt) String() string {
+	return p.Name + "@" + p.Version
+}
@@ -0,0 +1,267 @@
+package service
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"image"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 支持的哈希算法
+const (
+	HashMD5    = "md5"
+	HashSHA1   = "sha1"
+	HashSHA256 = "sha256"
+)
+
+var hashBufferSize = 1 << 20
+
+// FileProperties 文件或文件夹的完整属性, 系统不支持的项为空
+type FileProperties struct {
+	Path        string        `json:"path"`
+	Name        string        `json:"name"`
+	IsDir       bool          `json:"is_dir"`
+	Size        int64         `json:"size"`
+	MimeType    string        `json:"mime_type"` // 按内容判断, 无法判断时按扩展名
+	ModTime     time.Time     `json:"mod_time"`
+	Created     *time.Time    `json:"created,omitempty"`  // 创建时间, 部分 Linux 文件系统不记录
+	Accessed    *time.Time    `json:"accessed,omitempty"` // 最后访问时间
+	Changed     *time.Time    `json:"changed,omitempty"`  // 属性最后修改时间(ctime)
+	Owner       string        `json:"owner,omitempty"`
+	Group       string        `json:"group,omitempty"`
+	Permissions string        `json:"permissions"`          // 例如 -rw-r--r--
+	Octal       string        `json:"octal"`                // 例如 0644
+	Attributes  []string      `json:"attributes,omitempty"` // Windows 文件属性: readonly、hidden、system 等
+	IsSymlink   bool          `json:"is_symlink"`
+	LinkTarget  string        `json:"link_target,omitempty"`
+	HardLinks   uint64        `json:"hard_links,omitempty"`
+	Image       *ImageInfo    `json:"image,omitempty"`
+	Audio       *AudioInfo    `json:"audio,omitempty"`
+	Document    *DocumentInfo `json:"document,omitempty"`
+}
+
+// ImageInfo 图片的尺寸与 EXIF 信息
+type ImageInfo struct {
+	Width       int        `json:"width"`
+	Height      int        `json:"height"`
+	Format      string     `json:"format"`
+	Make        string     `json:"make,omitempty"`
+	Model       string     `json:"model,omitempty"`
+	Lens        string     `json:"lens,omitempty"`
+	DateTaken   *time.Time `json:"date_taken,omitempty"`
+	Orientation int        `json:"orientation,omitempty"`
+	Exposure    string     `json:"exposure,omitempty"` // 例如 1/125
+	FNumber     float64    `json:"f_number,omitempty"`
+	ISO         int        `json:"iso,omitempty"`
+	FocalLength float64    `json:"focal_length,omitempty"` // 毫米
+	GPS         *GPSInfo   `json:"gps,omitempty"`
+}
+
+// GPSInfo 拍摄位置
+type GPSInfo struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Altitude  float64 `json:"altitude"`
+}
+
+// GetProperties 读取文件或文件夹的属性; 符号链接显示目标的属性, 目标不存在时显示链接本身的属性.
+// 图片、音频与文档的元数据读取失败时忽略
+func GetProperties(path string) (*FileProperties, error) {
+	if path == "" {
+		return nil, fmt.Errorf("path is null")
+	}
+	path = filepath.Clean(path)
+	info, err := os.Lstat(path)
+	if err != nil {
+		return nil, err
+	}
+	props := &FileProperties{Path: path, Name: info.Name()}
+	if info.Mode()&os.ModeSymlink != 0 {
+		props.IsSymlink = true
+		props.LinkTarget, _ = os.Readlink(path)
+		if target, err := os.Stat(path); err == nil {
+			info = target
+		}
+	}
+	props.IsDir = info.IsDir()
+	props.Size = info.Size()
+	props.ModTime = info.ModTime()
+	props.Permissions = info.Mode().String()
+	props.Octal = octalMode(info.Mode())
+	statPlatform(path, info, props)
+	if props.IsDir {
+		props.MimeType = "inode/directory"
+		return props, nil
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		props.MimeType = "inode/symlink" // 目标不存在的链接
+		return props, nil
+	}
+	props.MimeType = sniffMimeType(path)
+
+	ext := strings.ToLower(filepath.Ext(path))
+	switch {
+	case thumbnailExts[ext] != "":
+		props.Image = readImageInfo(path)
+	case ext == ".mp3" || ext == ".flac":
+		props.Audio, _ = ReadAudioInfo(path)
+	case ext == ".pdf" || ext == ".docx" || ext == ".xlsx" || ext == ".pptx":
+		props.Document, _ = ReadDocumentInfo(path)
+	}
+	return props, nil
+}
+
+// ComputeHashes 计算文件的哈希值, algorithms 为空时计算全部支持的算法; 文件只读取一次, ctx 取消时停止
+func ComputeHashes(ctx context.Context, path string, algorithms []string) (map[string]string, error) {
+	if len(algorithms) == 0 {
+		algorithms = []string{HashMD5, HashSHA1, HashSHA256}
+	}
+	hashes := make(map[string]hash.Hash, len(algorithms))
+	writers := make([]io.Writer, 0, len(algorithms))
+	for _, algorithm := range algorithms {
+		var h hash.Hash
+		switch strings.ToLower(algorithm) {
+		case HashMD5:
+			h = md5.New()
+		case HashSHA1:
+			h = sha1.New()
+		case HashSHA256:
+			h = sha256.New()
+		default:
+			return nil, fmt.Errorf("unsupported hash algorithm: %s", algorithm)
+		}
+		hashes[strings.ToLower(algorithm)] = h
+		writers = append(writers, h)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	if info, err := file.Stat(); err != nil {
+		return nil, err
+	} else if info.IsDir() {
+		return nil, fmt.Errorf("cannot hash a folder")
+	}
+	writer := io.MultiWriter(writers...)
+	buf := make([]byte, hashBufferSize)
+	for {
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+		n, err := file.Read(buf)
+		writer.Write(buf[:n])
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	res := make(map[string]string, len(hashes))
+	for algorithm, h := range hashes {
+		res[algorithm] = hex.EncodeToString(h.Sum(nil))
+	}
+	return res, nil
+}
+
+// sniffMimeType 按文件开头的内容判断类型; 对 zip、纯文本等通用类型使用扩展名给出更具体的类型(如 docx),
+// 无法识别的内容再尝试按文本编码识别(如 GBK 文本)
+func sniffMimeType(path string) string {
+	head, err := readHead(path, 512)
+	byExt := mime.TypeByExtension(strings.ToLower(filepath.Ext(path)))
+	if err != nil || len(head) == 0 {
+		if byExt != "" {
+			return byExt
+		}
+		return "application/octet-stream"
+	}
+	detected := http.DetectContentType(head)
+	switch detected {
+	case "application/octet-stream", "text/plain; charset=utf-8", "application/zip", "text/xml; charset=utf-8":
+		if byExt != "" {
+			return byExt
+		}
+	}
+	if detected == "application/octet-stream" {
+		if _, encoding, ok := decodeText(head, true); ok {
+			return "text/plain; charset=" + encoding
+		}
+	}
+	return detected
+}
+
+// readImageInfo 读取图片尺寸, JPEG 另外读取 EXIF 中的相机、拍摄参数与位置
+func readImageInfo(path string) *ImageInfo {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	config, format, err := image.DecodeConfig(file)
+	file.Close()
+	if err != nil {
+		return nil
+	}
+	info := &ImageInfo{Width: config.Width, Height: config.Height, Format: format}
+	exif, err := ReadExif(path)
+	if err != nil {
+		return info
+	}
+	info.Make, info.Model, info.Lens = exif.Camera()
+	if taken, err := exif.DateTaken(); err == nil {
+		info.DateTaken = &taken
+	}
+	info.Orientation = exif.Orientation()
+	var exposure float64
+	exposure, info.FNumber, info.ISO, info.FocalLength = exif.Exposure()
+	if exposure > 0 && exposure < 1 {
+		info.Exposure = fmt.Sprintf("1/%.0f", 1/exposure)
+	} else if exposure >= 1 {
+		info.Exposure = strconv.FormatFloat(exposure, 'f', -1, 64) + "s"
+	}
+	if latitude, longitude, altitude, ok := exif.GPS(); ok {
+		info.GPS = &GPSInfo{Latitude: latitude, Longitude: longitude, Altitude: altitude}
+	}
+	return info
+}
+
+// octalMode 八进制权限, 包含 setuid、setgid 与粘滞位
+func octalMode(mode os.FileMode) string {
+	perm := uint32(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		perm |= 04000
+	}
+	if mode&os.ModeSetgid != 0 {
+		perm |= 02000
+	}
+	if mode&os.ModeSticky != 0 {
+		perm |= 01000
+	}
+	return fmt.Sprintf("%04o", perm)
+}
+
+// lookupOwner 将 uid、gid 转换为用户名与组名, 查不到时使用数字
+func lookupOwner(uid, gid uint32) (string, string) {
+	owner, group := strconv.FormatUint(uint64(uid), 10), strconv.FormatUint(uint64(gid), 10)
+	if u, err := user.LookupId(owner); err == nil {
+		owner = u.Username
+	}
+	if g, err := user.LookupGroupId(group); err == nil {
+		group = g.Name
+	}
+	return owner, group
+}
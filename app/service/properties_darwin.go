@@ -0,0 +1,27 @@
+//go:build darwin
+
+package service
+
+import (
+	"golang.org/x/sys/unix"
+	"os"
+	"time"
+)
+
+// statPlatform 读取创建、访问与属性修改时间、硬链接数与所有者
+func statPlatform(path string, info os.FileInfo, props *FileProperties) {
+	var stat unix.Stat_t
+	var err error
+	if info.Mode()&os.ModeSymlink != 0 {
+		err = unix.Lstat(path, &stat)
+	} else {
+		err = unix.Stat(path, &stat)
+	}
+	if err != nil {
+		return
+	}
+	created, accessed, changed := time.Unix(stat.Btim.Unix()), time.Unix(stat.Atim.Unix()), time.Unix(stat.Ctim.Unix())
+	props.Created, props.Accessed, props.Changed = &created, &accessed, &changed
+	props.HardLinks = uint64(stat.Nlink)
+	props.Owner, props.Group = lookupOwner(stat.Uid, stat.Gid)
+}
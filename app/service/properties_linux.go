@@ -0,0 +1,41 @@
+//go:build linux
+
+package service
+
+import (
+	"golang.org/x/sys/unix"
+	"os"
+	"syscall"
+	"time"
+)
+
+// statPlatform 使用 statx 读取创建时间(文件系统支持时)、访问与属性修改时间、硬链接数与所有者
+func statPlatform(path string, info os.FileInfo, props *FileProperties) {
+	var stx unix.Statx_t
+	flags := 0
+	if info.Mode()&os.ModeSymlink != 0 {
+		flags = unix.AT_SYMLINK_NOFOLLOW // 目标不存在的链接
+	}
+	mask := unix.STATX_BASIC_STATS | unix.STATX_BTIME
+	if err := unix.Statx(unix.AT_FDCWD, path, flags, mask, &stx); err == nil {
+		if stx.Mask&unix.STATX_BTIME != 0 {
+			props.Created = statxTime(stx.Btime)
+		}
+		props.Accessed, props.Changed = statxTime(stx.Atime), statxTime(stx.Ctime)
+		props.HardLinks = uint64(stx.Nlink)
+		props.Owner, props.Group = lookupOwner(stx.Uid, stx.Gid)
+		return
+	}
+	// 不支持 statx 的旧内核
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		accessed, changed := time.Unix(stat.Atim.Unix()), time.Unix(stat.Ctim.Unix())
+		props.Accessed, props.Changed = &accessed, &changed
+		props.HardLinks = uint64(stat.Nlink)
+		props.Owner, props.Group = lookupOwner(stat.Uid, stat.Gid)
+	}
+}
+
+func statxTime(ts unix.StatxTimestamp) *time.Time {
+	t := time.Unix(ts.Sec, int64(ts.Nsec))
+	return &t
+}
@@ -0,0 +1,8 @@
+//go:build !linux && !windows && !darwin
+
+package service
+
+import "os"
+
+// statPlatform 其他系统只显示通用属性
+func statPlatform(path string, info os.FileInfo, props *FileProperties) {}
@@ -0,0 +1,91 @@
+//go:build windows
+
+package service
+
+import (
+	"golang.org/x/sys/windows"
+	"os"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// fileBasicInfo FILE_BASIC_INFO, 其中的 ChangeTime 为属性最后修改时间
+type fileBasicInfo struct {
+	CreationTime   int64
+	LastAccessTime int64
+	LastWriteTime  int64
+	ChangeTime     int64
+	FileAttributes uint32
+	_              uint32
+}
+
+var windowsAttributes = []struct {
+	flag uint32
+	name string
+}{
+	{windows.FILE_ATTRIBUTE_READONLY, "readonly"},
+	{windows.FILE_ATTRIBUTE_HIDDEN, "hidden"},
+	{windows.FILE_ATTRIBUTE_SYSTEM, "system"},
+	{windows.FILE_ATTRIBUTE_ARCHIVE, "archive"},
+	{windows.FILE_ATTRIBUTE_COMPRESSED, "compressed"},
+	{windows.FILE_ATTRIBUTE_ENCRYPTED, "encrypted"},
+	{windows.FILE_ATTRIBUTE_OFFLINE, "offline"},
+	{windows.FILE_ATTRIBUTE_REPARSE_POINT, "reparse_point"},
+}
+
+// statPlatform 读取创建、访问与属性修改时间、文件属性、硬链接数与所有者
+func statPlatform(path string, info os.FileInfo, props *FileProperties) {
+	if data, ok := info.Sys().(*syscall.Win32FileAttributeData); ok {
+		created, accessed := time.Unix(0, data.CreationTime.Nanoseconds()), time.Unix(0, data.LastAccessTime.Nanoseconds())
+		props.Created, props.Accessed = &created, &accessed
+		for _, attribute := range windowsAttributes {
+			if data.FileAttributes&attribute.flag != 0 {
+				props.Attributes = append(props.Attributes, attribute.name)
+			}
+		}
+	}
+
+	if pathPtr, err := windows.UTF16PtrFromString(path); err == nil {
+		// 只需要读取属性的权限, 文件夹需要 FILE_FLAG_BACKUP_SEMANTICS 才能打开
+		handle, err := windows.CreateFile(pathPtr, windows.FILE_READ_ATTRIBUTES,
+			windows.FILE_SHARE_READ|windows.FILE_SHARE_WRITE|windows.FILE_SHARE_DELETE,
+			nil, windows.OPEN_EXISTING, windows.FILE_FLAG_BACKUP_SEMANTICS, 0)
+		if err == nil {
+			var byHandle windows.ByHandleFileInformation
+			if windows.GetFileInformationByHandle(handle, &byHandle) == nil {
+				props.HardLinks = uint64(byHandle.NumberOfLinks)
+			}
+			var basic fileBasicInfo
+			if windows.GetFileInformationByHandleEx(handle, windows.FileBasicInfo, (*byte)(unsafe.Pointer(&basic)), uint32(unsafe.Sizeof(basic))) == nil {
+				filetime := windows.Filetime{LowDateTime: uint32(basic.ChangeTime), HighDateTime: uint32(basic.ChangeTime >> 32)}
+				changed := time.Unix(0, filetime.Nanoseconds())
+				props.Changed = &changed
+			}
+			windows.CloseHandle(handle)
+		}
+	}
+
+	sd, err := windows.GetNamedSecurityInfo(path, windows.SE_FILE_OBJECT, windows.OWNER_SECURITY_INFORMATION|windows.GROUP_SECURITY_INFORMATION)
+	if err != nil {
+		return
+	}
+	if owner, _, err := sd.Owner(); err == nil && owner != nil {
+		props.Owner = accountName(owner)
+	}
+	if group, _, err := sd.Group(); err == nil && group != nil {
+		props.Group = accountName(group)
+	}
+}
+
+// accountName 将 SID 转换为 域\用户名, 查不到时使用 SID 字符串
+func accountName(sid *windows.SID) string {
+	account, domain, _, err := sid.LookupAccount("")
+	if err != nil {
+		return sid.String()
+	}
+	if domain != "" {
+		return domain + `\` + account
+	}
+	return account
+}
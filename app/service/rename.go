@@ -0,0 +1,81 @@
+package service
+
+import (
+	"GoSearch/app/utils"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+var ErrTargetExists = errors.New("an item with the same name already exists")
+
+// RenameResult 重命名的结果
+type RenameResult struct {
+	Path     string     `json:"path"`               // 原路径
+	NewPath  string     `json:"new_path"`           // 重命名后的路径
+	Replaced *TrashItem `json:"replaced,omitempty"` // 被替换并移到回收站的同名文件
+}
+
+// RenameItem 在原文件夹中重命名文件或文件夹:
+// 新名称按当前系统检查(不允许包含路径分隔符或指向上级目录), 已存在同名项目时返回 ErrTargetExists,
+// overwrite 为 true 时将同名文件移到回收站后再重命名(不替换文件夹); 只改变大小写时在不区分大小写的系统上同样有效
+func RenameItem(path, newName string, overwrite bool) (*RenameResult, error) {
+	if path == "" {
+		return nil, fmt.Errorf("path is null")
+	}
+	path = filepath.Clean(path)
+	info, err := os.Lstat(path)
+	if err != nil {
+		return nil, err
+	}
+	if err = utils.ValidateFileName(GetSysInfoInstance().OS, newName); err != nil {
+		return nil, err
+	}
+	result := &RenameResult{Path: path, NewPath: filepath.Join(filepath.Dir(path), newName)}
+	if result.NewPath == path {
+		return result, nil
+	}
+
+	if targetInfo, err := os.Lstat(result.NewPath); err == nil {
+		switch {
+		case os.SameFile(info, targetInfo):
+			// 不区分大小写的文件系统上只改变大小写, 新名称指向的就是原项目; 经过临时名称重命名, 保证大小写生效
+			return result, renameAll([]renameMove{{from: path, to: result.NewPath}})
+		case !overwrite:
+			return nil, fmt.Errorf("%w: %s", ErrTargetExists, newName)
+		case targetInfo.IsDir():
+			return nil, fmt.Errorf("%w: cannot replace folder %s", ErrTargetExists, newName)
+		}
+		if result.Replaced, err = MoveToTrash(result.NewPath); err != nil {
+			return nil, fmt.Errorf("move %s to trash before replacing: %w", newName, err)
+		}
+	}
+	if err = os.Rename(path, result.NewPath); err != nil {
+		if result.Replaced != nil {
+			if _, restoreErr := RestoreTrashItem(result.Replaced.ID); restoreErr != nil {
+				return nil, fmt.Errorf("%w; restore replaced %s failed: %v", err, newName, restoreErr)
+			}
+		}
+		return nil, err
+	}
+	return result, nil
+}
+
+// UpdateRenamed 就地更新缓存中父文件夹的条目, 并移除被重命名的文件夹及其子文件夹的缓存;
+// parentKey 为父文件夹在缓存中的键
+func (cache *PathCache) UpdateRenamed(parentKey string, result *RenameResult) {
+	oldName, newName := filepath.Base(result.Path), filepath.Base(result.NewPath)
+	updated := cache.Update(parentKey, func(dirCnt *DirContent) {
+		dirCnt.renameEntry(oldName, newName)
+		if info, err := os.Stat(dirCnt.Path + utils.SEGMENT); err == nil {
+			dirCnt.ModTime = info.ModTime()
+		}
+	})
+	if !updated {
+		cache.Remove(parentKey)
+	}
+	if result.Path != result.NewPath {
+		cache.RemoveTree(result.Path)
+	}
+}
@@ -0,0 +1,257 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/tmc/langchaingo/llms"
+	"log"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	rankStartTag = "<ranking>"
+	rankEndTag   = "</ranking>"
+)
+
+var (
+	RerankCandidates   = 30   // 参与重排的最大候选数量
+	DefaultTokenBudget = 4000 // 未配置时单次重排的token预算(提示词+输出)
+	MaxExplainTokens   = 600  // 解释说明最多输出的token数量
+	// 模型漏写或写错 rankEndTag 时, 排序部分超过该长度或首个片段后超过该时长即不再过滤, 直接输出
+	RerankStreamLimit = 1024
+	RerankStreamWait  = 5 * time.Second
+)
+
+// RerankResult 大模型重排的结果
+type RerankResult struct {
+	Items       []*FileSystemEntry `json:"items"`       // 重排后的结果, 未参与重排的条目按原顺序追加在后面
+	Explanation string             `json:"explanation"` // 模型对排名靠前结果的解释
+	Reranked    bool               `json:"reranked"`    // 为false时表示模型不可用, Items保持原顺序
+}
+
+// RerankResults 使用大模型根据原始问题对检索结果进行重排并生成解释,
+// onToken 用于将解释内容流式输出到前端, 模型不可用时退化为原顺序
+func RerankResults(ctx context.Context, question string, items []*FileSystemEntry, onToken func(chunk string)) (*RerankResult, error) {
+	var (
+		result = &RerankResult{Items: items}
+		client *llmClient
+		err    error
+	)
+	if len(items) == 0 || strings.TrimSpace(question) == "" {
+		return result, nil
+	}
+	if client, err = currentLLM(); err != nil {
+		log.Printf("Rerank: llm unavailable, keep original order: %v", err)
+		return result, nil
+	}
+	conf := client.conf
+
+	budget := conf.RerankTokenBudget
+	if budget <= 0 {
+		budget = DefaultTokenBudget
+	}
+	explainTokens := budget / 4
+	if explainTokens > MaxExplainTokens {
+		explainTokens = MaxExplainTokens
+	}
+	prompt, err := RenderPrompt(PromptRerank, NewPromptData(""))
+	if err != nil {
+		log.Printf("Rerank: render prompt error, keep original order: %v", err)
+		return result, nil
+	}
+	candidates, userPrompt := buildRerankPrompt(conf.Model, prompt.Text, question, items, budget-explainTokens)
+	if len(candidates) == 0 {
+		return result, nil
+	}
+
+	var content []llms.MessageContent
+	content = append(content, llms.TextParts(llms.ChatMessageTypeSystem, prompt.Text))
+	content = append(content, llms.TextParts(llms.ChatMessageTypeHuman, userPrompt))
+
+	// 流式输出无法安全重试, 只设置超时
+	usage := GetUsageTracker()
+	if err = usage.CheckQuota(conf); err != nil {
+		log.Printf("Rerank: %v, keep original order", err)
+		return result, nil
+	}
+	stream := &rerankStream{onToken: onToken}
+	callCtx, cancel := context.WithTimeout(ctx, LLMTimeout)
+	defer cancel()
+	start := time.Now()
+	response, err := client.GenerateContent(callCtx, content,
+		llms.WithTemperature(0.2),
+		llms.WithMaxTokens(explainTokens+len(candidates)*4),
+		llms.WithStreamingFunc(stream.write),
+	)
+	usage.Record(conf, UsageRerank, content, response, time.Since(start), err)
+	if err == nil {
+		stream.finish()
+	}
+	if err != nil || len(response.Choices) == 0 {
+		log.Printf("Rerank: llm generate error, keep original order: %v", err)
+		return result, nil
+	}
+
+	order, explanation := parseRerankOutput(response.Choices[0].Content, len(candidates))
+	if len(order) == 0 {
+		log.Printf("Rerank: ranking not found in llm output, keep original order")
+		result.Explanation = explanation
+		return result, nil
+	}
+	result.Items = mergeRanking(items, candidates, order)
+	result.Explanation = explanation
+	result.Reranked = true
+	log.Printf("Rerank: %d candidates reranked, prompt: %s", len(candidates), prompt)
+	return result, nil
+}
+
+// buildRerankPrompt 在token预算内尽可能多地加入候选条目
+func buildRerankPrompt(model, systemPrompt, question string, items []*FileSystemEntry, budget int) ([]*FileSystemEntry, string) {
+	var (
+		sb         strings.Builder
+		candidates []*FileSystemEntry
+	)
+	sb.WriteString("用户问题: ")
+	sb.WriteString(question)
+	sb.WriteString("\n候选文件:\n")
+	used := llms.CountTokens(model, systemPrompt+sb.String())
+
+	for i, entry := range items {
+		if i >= RerankCandidates {
+			break
+		}
+		ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(entry.Name), "."))
+		line := fmt.Sprintf("[%d] %s | %s | %s | %s | %s\n", len(candidates)+1, entry.Name, entry.Path,
+			formatSize(uint64(entry.Size)), entry.ModTime.Format("2006-01-02 15:04"), truncateRunes(readSnippet(entry, ext), 120))
+		cost := llms.CountTokens(model, line)
+		if used+cost > budget {
+			break
+		}
+		used += cost
+		sb.WriteString(line)
+		candidates = append(candidates, entry)
+	}
+	return candidates, sb.String()
+}
+
+// parseRerankOutput 解析模型输出中的排序编号(从1开始)与解释
+func parseRerankOutput(output string, n int) ([]int, string) {
+	start := strings.Index(output, rankStartTag)
+	end := strings.Index(output, rankEndTag)
+	if start == -1 || end == -1 || end < start {
+		return nil, strings.TrimSpace(output)
+	}
+	var (
+		order = make([]int, 0, n)
+		seen  = make(map[int]struct{}, n)
+	)
+	for _, field := range strings.FieldsFunc(output[start+len(rankStartTag):end], func(r rune) bool {
+		return r == ',' || r == '，' || r == ' '
+	}) {
+		idx, err := strconv.Atoi(strings.Trim(field, "[]"))
+		if err != nil || idx < 1 || idx > n {
+			continue
+		}
+		if _, ok := seen[idx]; ok {
+			continue
+		}
+		seen[idx] = struct{}{}
+		order = append(order, idx-1)
+	}
+	return order, strings.TrimSpace(output[end+len(rankEndTag):])
+}
+
+// mergeRanking 模型排序的候选在前, 被模型省略的候选和未参与重排的条目保持原顺序追加
+func mergeRanking(items, candidates []*FileSystemEntry, order []int) []*FileSystemEntry {
+	var (
+		res    = make([]*FileSystemEntry, 0, len(items))
+		placed = make(map[*FileSystemEntry]struct{}, len(order))
+	)
+	for _, idx := range order {
+		res = append(res, candidates[idx])
+		placed[candidates[idx]] = struct{}{}
+	}
+	for _, entry := range items {
+		if _, ok := placed[entry]; !ok {
+			res = append(res, entry)
+		}
+	}
+	return res
+}
+
+func truncateRunes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n]) + "..."
+}
+
+// rerankStream 过滤掉排序编号部分, 只将解释内容流式输出
+type rerankStream struct {
+	lock    sync.Mutex
+	buf     strings.Builder
+	emitted int       // 已输出的解释内容长度(相对于buf)
+	started time.Time // 收到第一个片段的时间
+	open    bool      // 排序部分已结束或放弃过滤, 之后的内容直接输出
+	onToken func(chunk string)
+}
+
+func (s *rerankStream) write(_ context.Context, chunk []byte) error {
+	if s.onToken == nil {
+		return nil
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.started.IsZero() {
+		s.started = time.Now()
+	}
+	s.buf.Write(chunk)
+
+	text := s.buf.String()
+	if !s.open {
+		if end := strings.Index(text, rankEndTag); end != -1 {
+			s.emitted = end + len(rankEndTag)
+		} else if s.waitRanking(text) {
+			return nil
+		}
+		s.open = true
+	}
+	s.flush(text)
+	return nil
+}
+
+// waitRanking 输出以 rankStartTag 开头且未超过长度与时间限制时继续等待 rankEndTag;
+// 不以 rankStartTag 开头说明模型没有按格式输出排序, 不再过滤
+func (s *rerankStream) waitRanking(text string) bool {
+	trimmed := strings.TrimLeft(text, " \t\r\n")
+	if len(trimmed) < len(rankStartTag) {
+		return strings.HasPrefix(rankStartTag, trimmed)
+	}
+	if !strings.HasPrefix(trimmed, rankStartTag) {
+		return false
+	}
+	return len(text) < RerankStreamLimit && time.Since(s.started) < RerankStreamWait
+}
+
+// finish 输出结束后调用, 输出中没有 rankEndTag 时将缓存的内容全部输出
+func (s *rerankStream) finish() {
+	if s.onToken == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.open = true
+	s.flush(s.buf.String())
+}
+
+func (s *rerankStream) flush(text string) {
+	if s.emitted < len(text) {
+		s.onToken(text[s.emitted:])
+		s.emitted = len(text)
+	}
+}
@@ -22,7 +22,10 @@ type SearchParams struct {
 	MaxSize        uint64
 	ModifiedAfter  *time.Time
 	ModifiedBefore *time.Time
-	SearchContent  bool // 是否搜索文件内容 (如果支持) Recursive bool // 是否递归搜索子目录 (通常默认为 true)
+	SearchContent  bool             // 是否搜索文件内容 (如果支持) Recursive bool // 是否递归搜索子目录 (通常默认为 true)
+	Metadata       []dto.MetaFilter // 图片、音频与文档的元数据条件
+
+	metaConds []*metaCondition // 编译后的元数据条件
 }
 
 // SearchItems 并发搜索文件
@@ -33,6 +36,9 @@ func SearchItems(searchParams *SearchParams) ([]*FileSystemEntry, error) {
 		err        error
 	)
 
+	if err = searchParams.compileMetadata(); err != nil {
+		return nil, err
+	}
 	searchPool = NewSearchPool(32)
 	searchPool.Start(searchParams)
 
@@ -48,11 +54,24 @@ func SearchItemsInStream(searchParams *SearchParams) (<-chan *FileSystemEntry, e
 		searchPool *SearchPool
 	)
 
+	if err := searchParams.compileMetadata(); err != nil {
+		return nil, err
+	}
 	searchPool = NewSearchPool(32)
 	searchPool.Start(searchParams)
 	return searchPool.results, nil
 }
 
+// compileMetadata 校验元数据条件, 检索时直接使用编译后的结果
+func (params *SearchParams) compileMetadata() error {
+	conds, err := compileMetaFilters(params.Metadata)
+	if err != nil {
+		return err
+	}
+	params.metaConds = conds
+	return nil
+}
+
 // ParseParams 解析用户搜索参数
 func ParseParams(param *dto.SearchParams) (*SearchParams, error) {
 	searchParams := &SearchParams{
@@ -61,6 +80,10 @@ func ParseParams(param *dto.SearchParams) (*SearchParams, error) {
 		MinSize:  param.MinSize,
 		MaxSize:  param.MaxSize,
 	}
+	// 取出查询中的元数据条件, 例如 "IMG camera:Canon taken:2023"
+	metadata, query := ExtractMetaFilters(param.Query)
+	searchParams.Query = query
+	searchParams.Metadata = append(append([]dto.MetaFilter(nil), param.Metadata...), metadata...)
 	if strings.HasSuffix(param.CurrentPath, ":") {
 		searchParams.BaseDir = utils.Join(param.CurrentPath)
 	}
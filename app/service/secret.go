@@ -0,0 +1,312 @@
+package service
+
+import (
+	"GoSearch/app/utils"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/scrypt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const (
+	secretService    = "GoSearch"
+	SecretApiKey     = "llm_api_key"
+	PassphraseEnv    = "GOSEARCH_SECRET_PASSPHRASE" // 设置后使用该口令加密文件, 否则使用本机随机生成的口令文件
+	passphraseLength = 32
+	protectedKeyTag  = "protected:" // 口令文件经过系统数据保护接口(keyProtection)加密时的前缀
+)
+
+var (
+	secretStore       SecretStore
+	secretStoreOnce   sync.Once
+	ErrSecretNotFound = errors.New("secret not found")
+)
+
+// SecretStore 敏感数据(例如大模型API Key)的加密存储
+type SecretStore interface {
+	Get(key string) (string, error)
+	Set(key, value string) error
+	Delete(key string) error
+	Name() string
+}
+
+// GetSecretStore 优先使用系统密钥环(Linux下为Secret Service, macOS下为钥匙串), 不可用时退化为口令加密的文件;
+// Windows 下口令文件使用 DPAPI 加密, 其他平台的口令文件与密文都保存在本机, 只依靠文件权限保护, 见 SecretWarning
+func GetSecretStore() SecretStore {
+	secretStoreOnce.Do(func() {
+		var err error
+		if secretStore, err = newKeyring(secretService); err == nil {
+			log.Printf("SecretStore: using %s", secretStore.Name())
+			return
+		}
+		log.Printf("SecretStore: system keyring unavailable (%v), fallback to encrypted file", err)
+		secretStore = newFileSecretStore()
+	})
+	return secretStore
+}
+
+// SecretWarning 密钥没有得到系统保护时返回提示, 由设置页面展示:
+// 使用加密文件且既没有设置 PassphraseEnv 也没有 keyProtection 时, 能读取配置目录的程序都能解密
+func SecretWarning() string {
+	if _, ok := GetSecretStore().(*fileSecretStore); !ok || os.Getenv(PassphraseEnv) != "" || keyProtection != "" {
+		return ""
+	}
+	return "The API key is encrypted with a key file stored on this computer. Set " + PassphraseEnv + " or enable a system keyring to protect it."
+}
+
+// MaskSecret 返回脱敏后的密钥, 只保留首尾少量字符用于辨认
+func MaskSecret(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	runes := []rune(secret)
+	if len(runes) <= 8 {
+		return strings.Repeat("*", len(runes))
+	}
+	return string(runes[:3]) + strings.Repeat("*", 8) + string(runes[len(runes)-4:])
+}
+
+// fileSecretStore 使用 scrypt + AES-GCM 加密的本地文件, 适用于没有图形会话的Linux等环境
+type fileSecretStore struct {
+	lock    sync.Mutex
+	keyPath string
+}
+
+// encryptedSecret 文件中每个密钥的存储格式
+type encryptedSecret struct {
+	Salt       string `json:"salt"`
+	Nonce      string `json:"nonce"`
+	Ciphertext string `json:"ciphertext"`
+}
+
+func newFileSecretStore() *fileSecretStore {
+	store := &fileSecretStore{}
+	// 口令文件与密文文件分开存放: 密文随配置目录迁移, 口令文件固定在引导目录
+	if bootDir, err := GetBootConfigDir(); err == nil {
+		store.keyPath = filepath.Join(bootDir, utils.SecretKeyFileName)
+	}
+	return store
+}
+
+func (s *fileSecretStore) Name() string {
+	return "encrypted file"
+}
+
+func (s *fileSecretStore) Get(key string) (string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	secrets, err := s.load()
+	if err != nil {
+		return "", err
+	}
+	item, ok := secrets[key]
+	if !ok {
+		return "", ErrSecretNotFound
+	}
+	return s.decrypt(item)
+}
+
+func (s *fileSecretStore) Set(key, value string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	secrets, err := s.load()
+	if err != nil {
+		return err
+	}
+	item, err := s.encrypt(value)
+	if err != nil {
+		return err
+	}
+	secrets[key] = item
+	return s.store(secrets)
+}
+
+func (s *fileSecretStore) Delete(key string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	secrets, err := s.load()
+	if err != nil {
+		return err
+	}
+	if _, ok := secrets[key]; !ok {
+		return nil
+	}
+	delete(secrets, key)
+	return s.store(secrets)
+}
+
+// filePath 密文文件保存在当前的配置目录下, 配置目录可能在运行期间被修改
+func (s *fileSecretStore) filePath() (string, error) {
+	bootConf, _, err := EnsureConfigInitialized()
+	if err != nil || bootConf == nil {
+		return "", fmt.Errorf("boot config is nil")
+	}
+	return utils.Join(bootConf.CustomConfigDir, utils.SecretFileName), nil
+}
+
+func (s *fileSecretStore) load() (map[string]*encryptedSecret, error) {
+	secrets := make(map[string]*encryptedSecret)
+	filePath, err := s.filePath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return secrets, nil
+		}
+		return nil, err
+	}
+	if err = json.Unmarshal(data, &secrets); err != nil {
+		return nil, fmt.Errorf("parse secret file %s: %w", filePath, err)
+	}
+	return secrets, nil
+}
+
+func (s *fileSecretStore) store(secrets map[string]*encryptedSecret) error {
+	filePath, err := s.filePath()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(secrets, "", " ")
+	if err != nil {
+		return err
+	}
+	if err = os.WriteFile(filePath, data, 0600); err != nil {
+		return fmt.Errorf("write secret file %s: %w", filePath, err)
+	}
+	return nil
+}
+
+func (s *fileSecretStore) encrypt(plaintext string) (*encryptedSecret, error) {
+	salt := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+	gcm, err := s.cipher(salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return &encryptedSecret{
+		Salt:       base64.StdEncoding.EncodeToString(salt),
+		Nonce:      base64.StdEncoding.EncodeToString(nonce),
+		Ciphertext: base64.StdEncoding.EncodeToString(gcm.Seal(nil, nonce, []byte(plaintext), nil)),
+	}, nil
+}
+
+func (s *fileSecretStore) decrypt(item *encryptedSecret) (string, error) {
+	var (
+		salt, nonce, ciphertext []byte
+		err                     error
+	)
+	if salt, err = base64.StdEncoding.DecodeString(item.Salt); err != nil {
+		return "", err
+	}
+	if nonce, err = base64.StdEncoding.DecodeString(item.Nonce); err != nil {
+		return "", err
+	}
+	if ciphertext, err = base64.StdEncoding.DecodeString(item.Ciphertext); err != nil {
+		return "", err
+	}
+	gcm, err := s.cipher(salt)
+	if err != nil {
+		return "", err
+	}
+	if len(nonce) != gcm.NonceSize() {
+		return "", fmt.Errorf("invalid nonce size")
+	}
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", fmt.Errorf("decrypt secret failed, passphrase may have changed: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// cipher 使用 scrypt 从口令派生 AES-256 密钥
+func (s *fileSecretStore) cipher(salt []byte) (cipher.AEAD, error) {
+	passphrase, err := s.passphrase()
+	if err != nil {
+		return nil, err
+	}
+	key, err := scrypt.Key(passphrase, salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// passphrase 读取环境变量中的口令, 未设置时使用(或生成)仅当前用户可读的口令文件,
+// 支持 keyProtection 的平台上口令文件再经过系统接口加密
+func (s *fileSecretStore) passphrase() ([]byte, error) {
+	if env := os.Getenv(PassphraseEnv); env != "" {
+		return []byte(env), nil
+	}
+	if s.keyPath == "" {
+		return nil, fmt.Errorf("secret key path is empty")
+	}
+	if data, err := os.ReadFile(s.keyPath); err == nil && len(data) > 0 {
+		if !strings.HasPrefix(string(data), protectedKeyTag) {
+			// 旧版本写入的未加密口令, 支持时改为加密保存
+			if keyProtection != "" {
+				if err = s.writeKey(data); err != nil {
+					log.Printf("SecretStore: protect secret key with %s error: %v", keyProtection, err)
+				}
+			}
+			return data, nil
+		}
+		blob, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(string(data), protectedKeyTag))
+		if err != nil {
+			return nil, fmt.Errorf("decode secret key %s: %w", s.keyPath, err)
+		}
+		if data, err = unprotectKey(blob); err != nil {
+			return nil, fmt.Errorf("unprotect secret key %s: %w", s.keyPath, err)
+		}
+		return data, nil
+	} else if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	key := make([]byte, passphraseLength)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+	encoded := []byte(base64.StdEncoding.EncodeToString(key))
+	if err := s.writeKey(encoded); err != nil {
+		return nil, err
+	}
+	return encoded, nil
+}
+
+// writeKey 保存口令文件, 支持时使用 keyProtection 加密
+func (s *fileSecretStore) writeKey(key []byte) error {
+	data := key
+	if keyProtection != "" {
+		blob, err := protectKey(key)
+		if err != nil {
+			return fmt.Errorf("protect secret key with %s: %w", keyProtection, err)
+		}
+		data = []byte(protectedKeyTag + base64.StdEncoding.EncodeToString(blob))
+	}
+	if err := os.WriteFile(s.keyPath, data, 0600); err != nil {
+		return fmt.Errorf("write secret key %s: %w", s.keyPath, err)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+//go:build darwin
+
+package service
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+const (
+	securityPath         = "/usr/bin/security"
+	securityItemNotFound = 44 // errSecItemNotFound 对应的退出码
+)
+
+// keychainKeyring 通过 security 命令访问登录钥匙串
+type keychainKeyring struct {
+	service string
+}
+
+func newKeyring(service string) (SecretStore, error) {
+	// 没有图形会话或钥匙串不可用时失败
+	if err := exec.Command(securityPath, "default-keychain").Run(); err != nil {
+		return nil, fmt.Errorf("default keychain unavailable: %w", err)
+	}
+	return &keychainKeyring{service: service}, nil
+}
+
+func (k *keychainKeyring) Name() string {
+	return "keychain"
+}
+
+func (k *keychainKeyring) Get(key string) (string, error) {
+	out, err := exec.Command(securityPath, "find-generic-password", "-s", k.service, "-a", key, "-w").Output()
+	if err != nil {
+		return "", keychainError(err)
+	}
+	return strings.TrimSuffix(string(out), "\n"), nil
+}
+
+// Set 通过标准输入执行命令, 密钥以十六进制传入, 不会出现在进程的命令行参数中
+func (k *keychainKeyring) Set(key, value string) error {
+	cmd := exec.Command(securityPath, "-i")
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -U -s %q -a %q -X %s\n", k.service, key, hex.EncodeToString([]byte(value))))
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("keychain: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	// 交互模式下命令失败时 security 仍然正常退出, 读回确认
+	if stored, err := k.Get(key); err != nil || stored != value {
+		return fmt.Errorf("keychain: failed to store %s: %s", key, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+func (k *keychainKeyring) Delete(key string) error {
+	err := exec.Command(securityPath, "delete-generic-password", "-s", k.service, "-a", key).Run()
+	if err = keychainError(err); errors.Is(err, ErrSecretNotFound) {
+		return nil
+	}
+	return err
+}
+
+func keychainError(err error) error {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == securityItemNotFound {
+		return ErrSecretNotFound
+	}
+	return err
+}
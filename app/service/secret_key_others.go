@@ -0,0 +1,14 @@
+//go:build !windows
+
+package service
+
+// keyProtection 其他平台没有可用的系统数据保护接口, 口令文件只依靠文件权限保护
+const keyProtection = ""
+
+func protectKey(key []byte) ([]byte, error) {
+	return key, nil
+}
+
+func unprotectKey(data []byte) ([]byte, error) {
+	return data, nil
+}
@@ -0,0 +1,35 @@
+//go:build windows
+
+package service
+
+import (
+	"golang.org/x/sys/windows"
+	"unsafe"
+)
+
+// keyProtection 口令文件使用 DPAPI 加密, 只有当前 Windows 用户能够解密
+const keyProtection = "DPAPI"
+
+func protectKey(key []byte) ([]byte, error) {
+	var out windows.DataBlob
+	in := windows.DataBlob{Size: uint32(len(key)), Data: &key[0]}
+	if err := windows.CryptProtectData(&in, nil, nil, 0, nil, windows.CRYPTPROTECT_UI_FORBIDDEN, &out); err != nil {
+		return nil, err
+	}
+	return copyBlob(&out), nil
+}
+
+func unprotectKey(data []byte) ([]byte, error) {
+	var out windows.DataBlob
+	in := windows.DataBlob{Size: uint32(len(data)), Data: &data[0]}
+	if err := windows.CryptUnprotectData(&in, nil, nil, 0, nil, windows.CRYPTPROTECT_UI_FORBIDDEN, &out); err != nil {
+		return nil, err
+	}
+	return copyBlob(&out), nil
+}
+
+// copyBlob 复制系统分配的输出并释放
+func copyBlob(blob *windows.DataBlob) []byte {
+	defer windows.LocalFree(windows.Handle(unsafe.Pointer(blob.Data)))
+	return append([]byte(nil), unsafe.Slice(blob.Data, blob.Size)...)
+}
@@ -0,0 +1,230 @@
+//go:build linux
+
+package service
+
+import (
+	"fmt"
+	"github.com/godbus/dbus/v5"
+	"time"
+)
+
+const (
+	secretBusName        = "org.freedesktop.secrets"
+	secretServicePath    = "/org/freedesktop/secrets"
+	secretDefaultAlias   = "/org/freedesktop/secrets/aliases/default"
+	secretServiceIface   = "org.freedesktop.Secret.Service"
+	secretCollectionFace = "org.freedesktop.Secret.Collection"
+	secretItemIface      = "org.freedesktop.Secret.Item"
+	secretPromptIface    = "org.freedesktop.Secret.Prompt"
+	secretPromptTimeout  = time.Minute
+)
+
+// dbusSecret 对应 Secret Service 规范中的 Secret 结构 (oayays)
+type dbusSecret struct {
+	Session     dbus.ObjectPath
+	Parameters  []byte
+	Value       []byte
+	ContentType string
+}
+
+// secretServiceKeyring 通过D-Bus访问freedesktop Secret Service (GNOME Keyring, KWallet等)
+type secretServiceKeyring struct {
+	conn    *dbus.Conn
+	service string
+}
+
+func newKeyring(service string) (SecretStore, error) {
+	conn, err := dbus.SessionBus()
+	if err != nil {
+		return nil, err
+	}
+	var hasOwner bool
+	if err = conn.BusObject().Call("org.freedesktop.DBus.NameHasOwner", 0, secretBusName).Store(&hasOwner); err != nil {
+		return nil, err
+	}
+	if !hasOwner {
+		// 服务可能支持按需激活
+		var activatable []string
+		if err = conn.BusObject().Call("org.freedesktop.DBus.ListActivatableNames", 0).Store(&activatable); err != nil {
+			return nil, err
+		}
+		found := false
+		for _, name := range activatable {
+			if name == secretBusName {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("secret service is not running")
+		}
+	}
+	keyring := &secretServiceKeyring{conn: conn, service: service}
+	// 确认能够建立会话
+	if _, err = keyring.openSession(); err != nil {
+		return nil, err
+	}
+	return keyring, nil
+}
+
+func (k *secretServiceKeyring) Name() string {
+	return "secret service"
+}
+
+func (k *secretServiceKeyring) Get(key string) (string, error) {
+	item, err := k.findItem(key)
+	if err != nil {
+		return "", err
+	}
+	session, err := k.openSession()
+	if err != nil {
+		return "", err
+	}
+	defer k.closeSession(session)
+
+	var secret dbusSecret
+	if err = k.conn.Object(secretBusName, item).Call(secretItemIface+".GetSecret", 0, session).Store(&secret); err != nil {
+		return "", err
+	}
+	return string(secret.Value), nil
+}
+
+func (k *secretServiceKeyring) Set(key, value string) error {
+	session, err := k.openSession()
+	if err != nil {
+		return err
+	}
+	defer k.closeSession(session)
+
+	collection := k.conn.Object(secretBusName, secretDefaultAlias)
+	if err = k.unlock([]dbus.ObjectPath{secretDefaultAlias}); err != nil {
+		return err
+	}
+	properties := map[string]dbus.Variant{
+		secretItemIface + ".Label":      dbus.MakeVariant(fmt.Sprintf("%s: %s", k.service, key)),
+		secretItemIface + ".Attributes": dbus.MakeVariant(k.attributes(key)),
+	}
+	secret := dbusSecret{
+		Session:     session,
+		Parameters:  []byte{},
+		Value:       []byte(value),
+		ContentType: "text/plain; charset=utf8",
+	}
+	var item, prompt dbus.ObjectPath
+	if err = collection.Call(secretCollectionFace+".CreateItem", 0, properties, secret, true).Store(&item, &prompt); err != nil {
+		return err
+	}
+	return k.prompt(prompt)
+}
+
+func (k *secretServiceKeyring) Delete(key string) error {
+	item, err := k.findItem(key)
+	if err == ErrSecretNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var prompt dbus.ObjectPath
+	if err = k.conn.Object(secretBusName, item).Call(secretItemIface+".Delete", 0).Store(&prompt); err != nil {
+		return err
+	}
+	return k.prompt(prompt)
+}
+
+func (k *secretServiceKeyring) attributes(key string) map[string]string {
+	return map[string]string{
+		"service":  k.service,
+		"username": key,
+	}
+}
+
+// findItem 根据属性查找条目, 被锁定的条目会先解锁
+func (k *secretServiceKeyring) findItem(key string) (dbus.ObjectPath, error) {
+	var unlocked, locked []dbus.ObjectPath
+	err := k.conn.Object(secretBusName, secretServicePath).
+		Call(secretServiceIface+".SearchItems", 0, k.attributes(key)).
+		Store(&unlocked, &locked)
+	if err != nil {
+		return "", err
+	}
+	if len(unlocked) > 0 {
+		return unlocked[0], nil
+	}
+	if len(locked) > 0 {
+		if err = k.unlock(locked[:1]); err != nil {
+			return "", err
+		}
+		return locked[0], nil
+	}
+	return "", ErrSecretNotFound
+}
+
+func (k *secretServiceKeyring) openSession() (dbus.ObjectPath, error) {
+	var (
+		output  dbus.Variant
+		session dbus.ObjectPath
+	)
+	err := k.conn.Object(secretBusName, secretServicePath).
+		Call(secretServiceIface+".OpenSession", 0, "plain", dbus.MakeVariant("")).
+		Store(&output, &session)
+	return session, err
+}
+
+func (k *secretServiceKeyring) closeSession(session dbus.ObjectPath) {
+	k.conn.Object(secretBusName, session).Call("org.freedesktop.Secret.Session.Close", 0)
+}
+
+func (k *secretServiceKeyring) unlock(objects []dbus.ObjectPath) error {
+	var (
+		unlocked []dbus.ObjectPath
+		prompt   dbus.ObjectPath
+	)
+	err := k.conn.Object(secretBusName, secretServicePath).
+		Call(secretServiceIface+".Unlock", 0, objects).
+		Store(&unlocked, &prompt)
+	if err != nil {
+		return err
+	}
+	return k.prompt(prompt)
+}
+
+// prompt 需要用户交互(例如输入密钥环密码)时弹出提示并等待完成
+func (k *secretServiceKeyring) prompt(prompt dbus.ObjectPath) error {
+	if prompt == "" || prompt == "/" {
+		return nil
+	}
+	if err := k.conn.AddMatchSignal(
+		dbus.WithMatchObjectPath(prompt),
+		dbus.WithMatchInterface(secretPromptIface),
+	); err != nil {
+		return err
+	}
+	defer k.conn.RemoveMatchSignal(
+		dbus.WithMatchObjectPath(prompt),
+		dbus.WithMatchInterface(secretPromptIface),
+	)
+	signals := make(chan *dbus.Signal, 1)
+	k.conn.Signal(signals)
+	defer k.conn.RemoveSignal(signals)
+
+	if err := k.conn.Object(secretBusName, prompt).Call(secretPromptIface+".Prompt", 0, "").Err; err != nil {
+		return err
+	}
+	timeout := time.After(secretPromptTimeout)
+	for {
+		select {
+		case signal := <-signals:
+			if signal.Path != prompt || signal.Name != secretPromptIface+".Completed" {
+				continue
+			}
+			if len(signal.Body) > 0 {
+				if dismissed, ok := signal.Body[0].(bool); ok && dismissed {
+					return fmt.Errorf("keyring prompt dismissed")
+				}
+			}
+			return nil
+		case <-timeout:
+			return fmt.Errorf("keyring prompt timeout")
+		}
+	}
+}
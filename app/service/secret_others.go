@@ -0,0 +1,10 @@
+//go:build !linux && !darwin
+
+package service
+
+import "fmt"
+
+// newKeyring Linux 使用 Secret Service, macOS 使用钥匙串, 其他平台使用加密文件
+func newKeyring(service string) (SecretStore, error) {
+	return nil, fmt.Errorf("system keyring is not supported on this platform")
+}
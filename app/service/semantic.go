@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+var (
+	SemanticTopK = 50 // 向量检索返回的候选数量
+	RRFConstant  = 60 // Reciprocal Rank Fusion 平滑常数
+)
+
+// SemanticSearch 使用嵌入向量检索baseDir下与查询语义最接近的条目
+func SemanticSearch(ctx context.Context, query, baseDir string, topK int) ([]*VectorHit, error) {
+	var (
+		conf   *UData
+		vector []float32
+		err    error
+	)
+	if conf, err = GetUserData(); err != nil || conf == nil {
+		return nil, fmt.Errorf("user data is nil")
+	}
+	embedder, err := NewEmbedder(conf)
+	if err != nil {
+		return nil, err
+	}
+	if vector, err = embedder.EmbedQuery(ctx, query); err != nil {
+		return nil, err
+	}
+
+	store := GetVectorStore()
+	hits := store.Search(vector, baseDir, topK)
+	// 过滤已经被删除的文件, 并同步清理向量库
+	alive := hits[:0]
+	for _, hit := range hits {
+		info, err := os.Lstat(hit.Entry.Path)
+		if os.IsNotExist(err) {
+			store.Remove(hit.Entry.Path)
+			continue
+		}
+		// 使用文件当前的大小与修改时间, 过滤条件按最新状态判断
+		if err == nil {
+			hit.Entry.Size, hit.Entry.ModTime, hit.Entry.Mode = info.Size(), info.ModTime(), info.Mode()
+		}
+		alive = append(alive, hit)
+	}
+	return alive, nil
+}
+
+// HybridSearch 合并关键字检索(SearchItems)与向量检索的结果, 使用RRF进行排序
+func HybridSearch(ctx context.Context, params *SearchParams, query string) ([]*FileSystemEntry, error) {
+	var (
+		keywordItems []*FileSystemEntry
+		vectorHits   []*VectorHit
+		err          error
+	)
+	if keywordItems, err = SearchItems(params); err != nil {
+		return nil, err
+	}
+	// 关键字命中的条目也提交给索引器, 逐步完善向量库
+	GetVectorStore().EnqueueEntries(keywordItems)
+
+	if vectorHits, err = SemanticSearch(ctx, query, params.BaseDir, SemanticTopK); err != nil {
+		// 嵌入模型不可用时退化为关键字检索
+		log.Printf("HybridSearch: semantic search unavailable: %v", err)
+	}
+	return FuseResults(params, query, keywordItems, vectorHits)
+}
+
+// FuseResults 使用 Reciprocal Rank Fusion 合并两路结果;
+// 向量检索的结果不要求名称匹配, 但需满足 params 中的类型、大小、时间与元数据条件
+func FuseResults(params *SearchParams, query string, keywordItems []*FileSystemEntry, vectorHits []*VectorHit) ([]*FileSystemEntry, error) {
+	type fused struct {
+		entry *FileSystemEntry
+		score float64
+	}
+	var (
+		merged = make(map[string]*fused, len(keywordItems)+len(vectorHits))
+		lower  = strings.ToLower(query)
+	)
+
+	// SearchItems 的结果由协程池并发产生, 没有顺序, 先按与查询的接近程度排序
+	sort.SliceStable(keywordItems, func(i, j int) bool {
+		ei, ej := strings.EqualFold(keywordItems[i].Name, query), strings.EqualFold(keywordItems[j].Name, query)
+		if ei != ej {
+			return ei
+		}
+		ci, cj := strings.Contains(strings.ToLower(keywordItems[i].Name), lower), strings.Contains(strings.ToLower(keywordItems[j].Name), lower)
+		if ci != cj {
+			return ci
+		}
+		if len(keywordItems[i].Name) != len(keywordItems[j].Name) {
+			return len(keywordItems[i].Name) < len(keywordItems[j].Name)
+		}
+		return keywordItems[i].ModTime.After(keywordItems[j].ModTime)
+	})
+
+	for rank, entry := range keywordItems {
+		merged[entry.Path] = &fused{entry: entry, score: 1.0 / float64(RRFConstant+rank+1)}
+	}
+	if len(params.Metadata) > 0 && params.metaConds == nil {
+		if err := params.compileMetadata(); err != nil {
+			return nil, err
+		}
+	}
+	filtered := make([]*VectorHit, 0, len(vectorHits))
+	for _, hit := range vectorHits {
+		if params.matchFilters(hit.Entry) {
+			filtered = append(filtered, hit)
+		}
+	}
+	for rank, hit := range filtered {
+		score := 1.0 / float64(RRFConstant+rank+1)
+		if item, ok := merged[hit.Entry.Path]; ok {
+			item.score += score
+			continue
+		}
+		merged[hit.Entry.Path] = &fused{entry: hit.Entry, score: score}
+	}
+
+	list := make([]*fused, 0, len(merged))
+	for _, item := range merged {
+		list = append(list, item)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].score != list[j].score {
+			return list[i].score > list[j].score
+		}
+		return list[i].entry.Path < list[j].entry.Path
+	})
+
+	result := make([]*FileSystemEntry, len(list))
+	for i, item := range list {
+		result[i] = item.entry
+	}
+	return result, nil
+}
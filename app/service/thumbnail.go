@@ -0,0 +1,503 @@
+package service
+
+import (
+	"GoSearch/app/utils"
+	"bytes"
+	"container/heap"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 缩略图尺寸, 与 freedesktop 缩略图规范中的目录名一致
+const (
+	ThumbnailNormal  = "normal"   // 128
+	ThumbnailLarge   = "large"    // 256
+	ThumbnailXLarge  = "x-large"  // 512
+	ThumbnailXXLarge = "xx-large" // 1024
+)
+
+// 缩略图通过资源服务器提供的路径前缀: /thumbnail/<size>/<hash>.png
+const ThumbnailURLPrefix = "/thumbnail/"
+
+// thumbnailSoftware 写入缩略图 Software 文本块的名称, 清理共享的缓存时只删除带有该名称的缩略图
+const thumbnailSoftware = "GoSearch"
+
+var (
+	thumbnailService     *ThumbnailService
+	thumbnailOnce        sync.Once
+	ThumbnailWorkers     = max(1, runtime.NumCPU()/2) // 生成缩略图的协程数量
+	ThumbnailMaxImage    = 64 * int64(utils.MB)       // 超过该大小的图片不生成缩略图
+	ThumbnailCacheSize   = 512 * int64(utils.MB)      // 磁盘缓存的最大大小, 超出时删除最久未生成的缩略图
+	ThumbnailPruneEvery  = 200                        // 每生成多少个缩略图检查一次缓存大小
+	ThumbnailFailDirName = "gosearch"                 // 生成失败的记录保存在 fail/<应用名> 下, 避免反复尝试
+	thumbnailPixels      = map[string]int{ThumbnailNormal: 128, ThumbnailLarge: 256, ThumbnailXLarge: 512, ThumbnailXXLarge: 1024}
+	thumbnailNamePattern = regexp.MustCompile(`^[0-9a-f]{32}\.png$`)
+	thumbnailExts        = map[string]string{
+		".jpg": "image/jpeg", ".jpeg": "image/jpeg", ".png": "image/png",
+		".gif": "image/gif", ".webp": "image/webp", ".bmp": "image/bmp",
+	}
+)
+
+// Thumbnail 一个文件的缩略图, URL 为空且未失败时表示正在生成, 生成后通过监听函数通知
+type Thumbnail struct {
+	Path   string `json:"path"`
+	Size   string `json:"size"`
+	URL    string `json:"url,omitempty"`
+	Failed bool   `json:"failed"` // 不支持的类型或无法生成
+}
+
+// thumbnailJob 等待生成的缩略图, 最近一次请求中的在前, 同一次请求中按请求顺序
+type thumbnailJob struct {
+	key   string
+	path  string
+	size  string
+	round int // 请求的轮次
+	order int // 在请求中的位置
+	index int // 在堆中的位置
+}
+
+type thumbnailQueue []*thumbnailJob
+
+func (q thumbnailQueue) Len() int { return len(q) }
+
+func (q thumbnailQueue) Less(i, j int) bool {
+	if q[i].round != q[j].round {
+		return q[i].round > q[j].round
+	}
+	return q[i].order < q[j].order
+}
+
+func (q thumbnailQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *thumbnailQueue) Push(x any) {
+	job := x.(*thumbnailJob)
+	job.index = len(*q)
+	*q = append(*q, job)
+}
+
+func (q *thumbnailQueue) Pop() any {
+	old := *q
+	job := old[len(old)-1]
+	*q = old[:len(old)-1]
+	job.index = -1
+	return job
+}
+
+// ThumbnailService 生成图片缩略图并缓存在磁盘上: Linux 上使用 freedesktop 缩略图规范的共享缓存
+// ($XDG_CACHE_HOME/thumbnails), 文件名为文件 URI 的 MD5, 文件的修改时间与大小记录在 PNG 的文本块中;
+// 文件被修改后缓存自动失效. 后台协程按优先级生成, 前端每次请求可见区域内的文件, 最近请求的最先生成
+type ThumbnailService struct {
+	lock     sync.Mutex
+	cond     *sync.Cond
+	queue    thumbnailQueue
+	jobs     map[string]*thumbnailJob // size+path -> 等待中的任务
+	round    int
+	writes   int
+	stopped  bool
+	dir      string
+	listener func(*Thumbnail)
+}
+
+// GetThumbnailService 获取缩略图服务单例对象, 同时作为资源服务器的 Handler
+func GetThumbnailService() *ThumbnailService {
+	thumbnailOnce.Do(func() {
+		thumbnailService = &ThumbnailService{jobs: make(map[string]*thumbnailJob), dir: thumbnailDir()}
+		thumbnailService.cond = sync.NewCond(&thumbnailService.lock)
+		for i := 0; i < ThumbnailWorkers; i++ {
+			go thumbnailService.work()
+		}
+	})
+	return thumbnailService
+}
+
+// thumbnailDir 缩略图缓存目录, Linux 上与文件管理器共享
+func thumbnailDir() string {
+	if GetSysInfoInstance().OS == utils.LINUX {
+		cacheHome := os.Getenv("XDG_CACHE_HOME")
+		if cacheHome == "" {
+			home, _ := os.UserHomeDir()
+			cacheHome = filepath.Join(home, ".cache")
+		}
+		return filepath.Join(cacheHome, "thumbnails")
+	}
+	cacheHome, err := os.UserCacheDir()
+	if err != nil {
+		cacheHome = os.TempDir()
+	}
+	return filepath.Join(cacheHome, "GoSearch", "thumbnails")
+}
+
+// SetListener 设置缩略图生成完成或失败时的监听函数
+func (s *ThumbnailService) SetListener(listener func(*Thumbnail)) {
+	s.lock.Lock()
+	s.listener = listener
+	s.lock.Unlock()
+}
+
+// Request 返回一组文件的缩略图: 缓存有效的直接返回地址, 其余的加入队列并排在之前请求的前面
+func (s *ThumbnailService) Request(paths []string, size string) ([]*Thumbnail, error) {
+	if _, ok := thumbnailPixels[size]; !ok {
+		return nil, fmt.Errorf("unknown thumbnail size: %s", size)
+	}
+	var (
+		res     = make([]*Thumbnail, 0, len(paths))
+		pending []string
+	)
+	for _, path := range paths {
+		thumb := &Thumbnail{Path: path, Size: size}
+		res = append(res, thumb)
+		info, err := os.Stat(path)
+		if err != nil || info.IsDir() || !thumbnailSupported(path, info) || strings.HasPrefix(path, s.dir) {
+			thumb.Failed = true
+			continue
+		}
+		uri, name := thumbnailName(path)
+		if validThumbnail(filepath.Join(s.dir, size, name), uri, info) {
+			thumb.URL = thumbnailURL(size, name, info)
+		} else if validThumbnail(filepath.Join(s.dir, "fail", ThumbnailFailDirName, name), uri, info) {
+			thumb.Failed = true
+		} else {
+			pending = append(pending, path)
+		}
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.stopped {
+		return nil, fmt.Errorf("thumbnail service stopped")
+	}
+	s.round++
+	for i, path := range pending {
+		key := size + "\x00" + path
+		if job, ok := s.jobs[key]; ok {
+			job.round, job.order = s.round, i
+			heap.Fix(&s.queue, job.index)
+			continue
+		}
+		job := &thumbnailJob{key: key, path: path, size: size, round: s.round, order: i}
+		s.jobs[key] = job
+		heap.Push(&s.queue, job)
+	}
+	s.cond.Broadcast()
+	return res, nil
+}
+
+// Cancel 取消尚未开始生成的缩略图, 例如文件已滚动出可见区域
+func (s *ThumbnailService) Cancel(paths []string, size string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, path := range paths {
+		key := size + "\x00" + path
+		if job, ok := s.jobs[key]; ok {
+			heap.Remove(&s.queue, job.index)
+			delete(s.jobs, key)
+		}
+	}
+}
+
+// Stop 停止生成缩略图, 正在生成的会完成
+func (s *ThumbnailService) Stop() {
+	s.lock.Lock()
+	s.stopped = true
+	s.queue, s.jobs = nil, make(map[string]*thumbnailJob)
+	s.cond.Broadcast()
+	s.lock.Unlock()
+}
+
+// ServeHTTP 提供缓存目录中的缩略图, 只接受尺寸目录与 MD5 文件名, 不能访问其他文件
+func (s *ThumbnailService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	size, name, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, ThumbnailURLPrefix), "/")
+	if _, known := thumbnailPixels[size]; !ok || !known || !thumbnailNamePattern.MatchString(name) {
+		http.NotFound(w, r)
+		return
+	}
+	file, err := os.Open(filepath.Join(s.dir, size, name))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	// 地址中带有原文件的修改时间, 文件改变后地址也会改变
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "private, max-age=86400")
+	http.ServeContent(w, r, name, info.ModTime(), file)
+}
+
+func (s *ThumbnailService) work() {
+	for {
+		s.lock.Lock()
+		for len(s.queue) == 0 && !s.stopped {
+			s.cond.Wait()
+		}
+		if s.stopped {
+			s.lock.Unlock()
+			return
+		}
+		job := heap.Pop(&s.queue).(*thumbnailJob)
+		delete(s.jobs, job.key)
+		s.lock.Unlock()
+
+		thumb := s.generate(job)
+		s.lock.Lock()
+		listener := s.listener
+		s.writes++
+		prune := (s.writes-1)%max(ThumbnailPruneEvery, 1) == 0
+		s.lock.Unlock()
+		if listener != nil {
+			listener(thumb)
+		}
+		if prune {
+			s.prune()
+		}
+	}
+}
+
+// generate 生成并保存缩略图, 失败时在 fail 目录中记录, 文件未改变前不再尝试
+func (s *ThumbnailService) generate(job *thumbnailJob) *Thumbnail {
+	thumb := &Thumbnail{Path: job.path, Size: job.size}
+	info, err := os.Stat(job.path)
+	if err != nil {
+		thumb.Failed = true
+		return thumb
+	}
+	uri, name := thumbnailName(job.path)
+	data, err := renderThumbnail(job.path, thumbnailPixels[job.size], uri, info)
+	if err != nil {
+		log.Printf("Thumbnail: generate %s error: %v", job.path, err)
+		thumb.Failed = true
+		failed, _ := encodeThumbnail(image.NewRGBA(image.Rect(0, 0, 1, 1)), uri, info)
+		if err = writeThumbnail(filepath.Join(s.dir, "fail", ThumbnailFailDirName, name), failed); err != nil {
+			log.Printf("Thumbnail: store failure of %s error: %v", job.path, err)
+		}
+		return thumb
+	}
+	if err = writeThumbnail(filepath.Join(s.dir, job.size, name), data); err != nil {
+		log.Printf("Thumbnail: store %s error: %v", job.path, err)
+		thumb.Failed = true
+		return thumb
+	}
+	thumb.URL = thumbnailURL(job.size, name, info)
+	return thumb
+}
+
+// prune 本程序生成的缩略图超过 ThumbnailCacheSize 时按生成时间删除最旧的, 直到低于上限的 90%;
+// Linux 上的缓存目录与其他程序共享, 只统计和删除 Software 文本块为本程序的缩略图
+func (s *ThumbnailService) prune() {
+	type cached struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+	var (
+		files []cached
+		total int64
+	)
+	for size := range thumbnailPixels {
+		entries, err := os.ReadDir(filepath.Join(s.dir, size))
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			info, err := entry.Info()
+			if err != nil || !thumbnailNamePattern.MatchString(entry.Name()) {
+				continue
+			}
+			path := filepath.Join(s.dir, size, entry.Name())
+			if texts, err := readPNGText(path); err != nil || texts["Software"] != thumbnailSoftware {
+				continue
+			}
+			files = append(files, cached{path, info.Size(), info.ModTime()})
+			total += info.Size()
+		}
+	}
+	if total <= ThumbnailCacheSize {
+		return
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+	for _, file := range files {
+		if total <= ThumbnailCacheSize*9/10 {
+			break
+		}
+		if err := os.Remove(file.path); err == nil {
+			total -= file.size
+		}
+	}
+}
+
+func thumbnailSupported(path string, info os.FileInfo) bool {
+	_, ok := thumbnailExts[strings.ToLower(filepath.Ext(path))]
+	return ok && info.Size() <= ThumbnailMaxImage
+}
+
+// thumbnailName 返回文件的 URI 与缩略图文件名(URI 的 MD5)
+func thumbnailName(path string) (string, string) {
+	uri := fileURI(path)
+	sum := md5.Sum([]byte(uri))
+	return uri, hex.EncodeToString(sum[:]) + ".png"
+}
+
+// fileURI 文件的绝对 file:// 地址
+func fileURI(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		abs = path
+	}
+	slashed := filepath.ToSlash(abs)
+	if !strings.HasPrefix(slashed, "/") {
+		slashed = "/" + slashed // Windows 盘符路径: file:///C:/...
+	}
+	return (&url.URL{Scheme: "file", Path: slashed}).String()
+}
+
+func thumbnailURL(size, name string, info os.FileInfo) string {
+	return fmt.Sprintf("%s%s/%s?v=%d", ThumbnailURLPrefix, size, name, info.ModTime().Unix())
+}
+
+// renderThumbnail 解码图片(动图取第一帧), 缩小后按 EXIF 方向旋转, 保留透明度
+func renderThumbnail(path string, size int, uri string, info os.FileInfo) ([]byte, error) {
+	img, err := decodeImage(path, PreviewMaxPixels)
+	if err != nil {
+		return nil, err
+	}
+	thumb := scaleImage(img, size, nil)
+	if exif, err := ReadExif(path); err == nil {
+		thumb = orientImage(thumb, exif.Orientation())
+	}
+	return encodeThumbnail(thumb, uri, info)
+}
+
+// encodeThumbnail 编码为 PNG 并在 IHDR 之后加入规范要求的文本块
+func encodeThumbnail(img image.Image, uri string, info os.FileInfo) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	data := buf.Bytes()
+	const ihdrEnd = 8 + 4 + 4 + 13 + 4 // 文件头 + IHDR 块
+	var chunks bytes.Buffer
+	chunks.Write(data[:ihdrEnd])
+	mimeType := thumbnailExts[strings.ToLower(filepath.Ext(info.Name()))]
+	for _, text := range [][2]string{
+		{"Thumb::URI", uri},
+		{"Thumb::MTime", strconv.FormatInt(info.ModTime().Unix(), 10)},
+		{"Thumb::Size", strconv.FormatInt(info.Size(), 10)},
+		{"Thumb::Mimetype", mimeType},
+		{"Software", thumbnailSoftware},
+	} {
+		writePNGChunk(&chunks, "tEXt", []byte(text[0]+"\x00"+text[1]))
+	}
+	chunks.Write(data[ihdrEnd:])
+	return chunks.Bytes(), nil
+}
+
+func writePNGChunk(w io.Writer, kind string, data []byte) {
+	var header [8]byte
+	binary.BigEndian.PutUint32(header[:4], uint32(len(data)))
+	copy(header[4:], kind)
+	crc := crc32.NewIEEE()
+	crc.Write(header[4:])
+	crc.Write(data)
+	w.Write(header[:])
+	w.Write(data)
+	binary.Write(w, binary.BigEndian, crc.Sum32())
+}
+
+// validThumbnail 检查缩略图中记录的 URI、修改时间与大小和原文件一致
+func validThumbnail(path, uri string, info os.FileInfo) bool {
+	texts, err := readPNGText(path)
+	if err != nil || texts["Thumb::URI"] != uri || texts["Thumb::MTime"] != strconv.FormatInt(info.ModTime().Unix(), 10) {
+		return false
+	}
+	// Thumb::Size 在规范中是可选的, 其他程序生成的缩略图可能没有
+	size, ok := texts["Thumb::Size"]
+	return !ok || size == strconv.FormatInt(info.Size(), 10)
+}
+
+// readPNGText 读取 PNG 中图像数据之前的 tEXt 块
+func readPNGText(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var signature [8]byte
+	if _, err = io.ReadFull(file, signature[:]); err != nil || string(signature[:]) != "\x89PNG\r\n\x1a\n" {
+		return nil, fmt.Errorf("not a png file")
+	}
+	texts := make(map[string]string)
+	for {
+		var header [8]byte
+		if _, err = io.ReadFull(file, header[:]); err != nil {
+			return nil, err
+		}
+		length, kind := binary.BigEndian.Uint32(header[:4]), string(header[4:])
+		if kind == "IDAT" || kind == "IEND" {
+			return texts, nil
+		}
+		if kind != "tEXt" || length > 64*uint32(utils.KB) {
+			if _, err = file.Seek(int64(length)+4, io.SeekCurrent); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		data := make([]byte, length+4)
+		if _, err = io.ReadFull(file, data); err != nil {
+			return nil, err
+		}
+		if key, value, ok := bytes.Cut(data[:length], []byte{0}); ok {
+			texts[string(key)] = string(value)
+		}
+	}
+}
+
+// writeThumbnail 先写入临时文件再重命名, 其他程序不会读到不完整的缩略图; 规范要求权限为 0600
+func writeThumbnail(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	temp, err := os.CreateTemp(filepath.Dir(path), ".gosearch-thumb-*")
+	if err != nil {
+		return err
+	}
+	_, err = temp.Write(data)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(temp.Name(), 0600)
+	}
+	if err == nil {
+		err = os.Rename(temp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(temp.Name())
+	}
+	return err
+}
@@ -0,0 +1,914 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// 传输操作类型
+const (
+	TransferCopy = "copy"
+	TransferMove = "move"
+)
+
+// 目标位置已存在同名项目时的处理方式, 两边都是文件夹时总是合并其中的内容
+const (
+	ConflictSkip      = "skip"
+	ConflictOverwrite = "overwrite"
+	ConflictKeepBoth  = "keep_both" // 以 "name (2)" 的形式保留两者
+	ConflictAsk       = "ask"       // 暂停任务, 等待用户通过 ResolveConflict 选择
+)
+
+// 传输任务的状态
+const (
+	TransferQueued   = "queued"
+	TransferRunning  = "running"
+	TransferPaused   = "paused"
+	TransferWaiting  = "waiting" // 等待用户处理冲突
+	TransferDone     = "done"
+	TransferFailed   = "failed"
+	TransferCanceled = "canceled"
+)
+
+// Windows 的 ERROR_NOT_SAME_DEVICE
+const errorNotSameDevice = syscall.Errno(0x11)
+
+var (
+	transferManager        *TransferManager
+	transferManagerOnce    sync.Once
+	MaxTransferJobs        = 2                      // 同时执行的任务数量, 其余任务排队
+	TransferBufferSize     = 1 << 20                // 复制文件时每次读写的大小
+	TransferNotifyInterval = 200 * time.Millisecond // 进度通知的最小间隔
+	TransferHistorySize    = 50                     // 保留的已结束任务数量
+	ErrTransferNotFound    = errors.New("transfer job not found")
+	ErrTransferCanceled    = errors.New("transfer canceled")
+)
+
+// TransferConflict 等待用户处理的冲突
+type TransferConflict struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+}
+
+// TransferJob 复制或移动任务的进度, 通过监听函数与 Jobs 提供给界面
+type TransferJob struct {
+	ID         string            `json:"id"`
+	Op         string            `json:"op"`
+	Sources    []string          `json:"sources"`
+	TargetDir  string            `json:"target_dir"`
+	Policy     string            `json:"policy"`
+	Status     string            `json:"status"`
+	TotalBytes int64             `json:"total_bytes"`
+	DoneBytes  int64             `json:"done_bytes"`
+	TotalFiles int               `json:"total_files"`
+	DoneFiles  int               `json:"done_files"`
+	Skipped    int               `json:"skipped"` // 因冲突或不支持的文件类型而跳过的文件数量
+	Current    string            `json:"current"` // 正在处理的文件
+	Speed      int64             `json:"speed"`   // 字节/秒
+	ETA        int64             `json:"eta"`     // 预计剩余秒数, 未知时为 -1
+	Conflict   *TransferConflict `json:"conflict,omitempty"`
+	Error      string            `json:"error,omitempty"`
+	Results    []string          `json:"results"` // 已完成的顶层项目在目标位置的路径
+	CreatedAt  time.Time         `json:"created_at"`
+	FinishedAt *time.Time        `json:"finished_at,omitempty"`
+}
+
+// Finished 任务是否已经结束
+func (j *TransferJob) Finished() bool {
+	return j.Status == TransferDone || j.Status == TransferFailed || j.Status == TransferCanceled
+}
+
+// conflictAnswer 用户对冲突的选择
+type conflictAnswer struct {
+	policy     string
+	applyToAll bool
+}
+
+// transferTask 任务的执行状态, job 中的字段由 lock 保护
+type transferTask struct {
+	lock       sync.Mutex
+	job        TransferJob
+	ctx        context.Context
+	cancel     context.CancelFunc
+	resume     chan struct{} // 暂停时不为空, 继续时关闭
+	started    bool          // 是否已经离开队列开始执行
+	answer     chan conflictAnswer
+	notify     func(*TransferJob)
+	lastNotify time.Time
+	lastBytes  int64
+	replaced   map[string]*TrashItem // 覆盖时移到回收站的项目, key: 目标路径
+}
+
+// TransferManager 管理复制与移动任务的队列
+type TransferManager struct {
+	lock     sync.Mutex
+	tasks    []*transferTask // 按提交顺序
+	slots    chan struct{}
+	listener func(*TransferJob)
+}
+
+// GetTransferManager 获取传输任务管理单例对象
+func GetTransferManager() *TransferManager {
+	transferManagerOnce.Do(func() {
+		transferManager = &TransferManager{slots: make(chan struct{}, max(MaxTransferJobs, 1))}
+	})
+	return transferManager
+}
+
+// SetListener 设置任务进度的监听函数, 任务状态变化与进度更新(节流)时调用
+func (m *TransferManager) SetListener(listener func(*TransferJob)) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.listener = listener
+}
+
+// Submit 提交复制或移动任务, 将 sources 放到 targetDir 下, 任务排队后在后台执行
+func (m *TransferManager) Submit(op string, sources []string, targetDir, policy string) (*TransferJob, error) {
+	if op != TransferCopy && op != TransferMove {
+		return nil, fmt.Errorf("unknown transfer operation: %s", op)
+	}
+	if policy == "" {
+		policy = ConflictAsk
+	}
+	if !validPolicy(policy) {
+		return nil, fmt.Errorf("unknown conflict policy: %s", policy)
+	}
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("nothing to %s", op)
+	}
+	if info, err := os.Stat(targetDir); err != nil {
+		return nil, err
+	} else if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", targetDir)
+	}
+	targetDir = filepath.Clean(targetDir)
+	cleaned := make([]string, 0, len(sources))
+	for _, source := range sources {
+		source = filepath.Clean(source)
+		if _, err := os.Lstat(source); err != nil {
+			return nil, err
+		}
+		if targetDir == source || strings.HasPrefix(targetDir, source+string(filepath.Separator)) {
+			return nil, fmt.Errorf("cannot %s %s into itself", op, source)
+		}
+		cleaned = append(cleaned, source)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	task := &transferTask{
+		job: TransferJob{
+			ID:        fmt.Sprintf("%d", time.Now().UnixNano()),
+			Op:        op,
+			Sources:   cleaned,
+			TargetDir: targetDir,
+			Policy:    policy,
+			Status:    TransferQueued,
+			ETA:       -1,
+			CreatedAt: time.Now(),
+		},
+		ctx:    ctx,
+		cancel: cancel,
+		answer: make(chan conflictAnswer, 1),
+		notify: m.notify,
+	}
+	m.lock.Lock()
+	m.tasks = append(m.tasks, task)
+	m.trim()
+	m.lock.Unlock()
+
+	go m.run(task)
+	return task.snapshot(), nil
+}
+
+// Jobs 返回所有任务, 按提交顺序
+func (m *TransferManager) Jobs() []*TransferJob {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	res := make([]*TransferJob, 0, len(m.tasks))
+	for _, task := range m.tasks {
+		res = append(res, task.snapshot())
+	}
+	return res
+}
+
+// Pause 暂停任务, 正在复制的文件在当前数据块写完后暂停
+func (m *TransferManager) Pause(id string) error {
+	task, err := m.find(id)
+	if err != nil {
+		return err
+	}
+	task.lock.Lock()
+	if task.job.Finished() {
+		task.lock.Unlock()
+		return fmt.Errorf("transfer %s has finished", id)
+	}
+	if task.resume == nil {
+		task.resume = make(chan struct{})
+		if task.job.Status == TransferRunning || task.job.Status == TransferQueued {
+			task.job.Status = TransferPaused
+		}
+	}
+	task.lock.Unlock()
+	task.publish(true)
+	return nil
+}
+
+// Resume 继续暂停的任务
+func (m *TransferManager) Resume(id string) error {
+	task, err := m.find(id)
+	if err != nil {
+		return err
+	}
+	task.lock.Lock()
+	if task.resume != nil {
+		close(task.resume)
+		task.resume = nil
+		if task.job.Status == TransferPaused && task.started {
+			task.job.Status = TransferRunning
+		} else if task.job.Status == TransferPaused {
+			task.job.Status = TransferQueued
+		}
+	}
+	task.lock.Unlock()
+	task.publish(true)
+	return nil
+}
+
+// Cancel 取消任务, 已经完成的文件保留在目标位置, 未写完的文件会被删除
+func (m *TransferManager) Cancel(id string) error {
+	task, err := m.find(id)
+	if err != nil {
+		return err
+	}
+	task.cancel()
+	return nil
+}
+
+// ResolveConflict 处理等待中的冲突, applyToAll 为 true 时之后的冲突使用相同的处理方式
+func (m *TransferManager) ResolveConflict(id string, policy string, applyToAll bool) error {
+	if policy == ConflictAsk || !validPolicy(policy) {
+		return fmt.Errorf("invalid conflict resolution: %s", policy)
+	}
+	task, err := m.find(id)
+	if err != nil {
+		return err
+	}
+	task.lock.Lock()
+	defer task.lock.Unlock()
+	if task.job.Conflict == nil {
+		return fmt.Errorf("transfer %s has no pending conflict", id)
+	}
+	select {
+	case task.answer <- conflictAnswer{policy: policy, applyToAll: applyToAll}:
+		return nil
+	default:
+		return fmt.Errorf("transfer %s conflict has already been resolved", id)
+	}
+}
+
+// Clear 移除已结束的任务
+func (m *TransferManager) Clear() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	tasks := m.tasks[:0]
+	for _, task := range m.tasks {
+		if !task.snapshot().Finished() {
+			tasks = append(tasks, task)
+		}
+	}
+	m.tasks = tasks
+}
+
+// Stop 取消所有任务, 在程序退出时调用
+func (m *TransferManager) Stop() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for _, task := range m.tasks {
+		task.cancel()
+	}
+}
+
+func (m *TransferManager) find(id string) (*transferTask, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for _, task := range m.tasks {
+		if task.job.ID == id {
+			return task, nil
+		}
+	}
+	return nil, ErrTransferNotFound
+}
+
+func (m *TransferManager) notify(job *TransferJob) {
+	m.lock.Lock()
+	listener := m.listener
+	m.lock.Unlock()
+	if listener != nil {
+		listener(job)
+	}
+}
+
+// trim 只保留最近 TransferHistorySize 个已结束的任务, 调用方需持有锁
+func (m *TransferManager) trim() {
+	finished := 0
+	for _, task := range m.tasks {
+		if task.snapshot().Finished() {
+			finished++
+		}
+	}
+	tasks := m.tasks[:0]
+	for _, task := range m.tasks {
+		if finished > TransferHistorySize && task.snapshot().Finished() {
+			finished--
+			continue
+		}
+		tasks = append(tasks, task)
+	}
+	m.tasks = tasks
+}
+
+// run 等待空闲的执行位置后执行任务
+func (m *TransferManager) run(task *transferTask) {
+	var err error
+	defer func() {
+		task.cancel()
+		task.finish(err)
+	}()
+	if err = task.checkpoint(); err != nil {
+		return
+	}
+	select {
+	case m.slots <- struct{}{}:
+		defer func() { <-m.slots }()
+	case <-task.ctx.Done():
+		err = ErrTransferCanceled
+		return
+	}
+
+	task.setStatus(TransferRunning)
+	if err = task.scan(); err != nil {
+		return
+	}
+	for _, source := range task.job.Sources {
+		if err = task.transfer(source); err != nil {
+			return
+		}
+	}
+}
+
+// scan 统计需要传输的文件数量与大小, 用于计算进度与剩余时间
+func (t *transferTask) scan() error {
+	var (
+		files int
+		bytes int64
+	)
+	for _, source := range t.job.Sources {
+		err := filepath.WalkDir(source, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if ctxErr := t.ctx.Err(); ctxErr != nil {
+				return ErrTransferCanceled
+			}
+			if d.IsDir() {
+				return nil
+			}
+			files++
+			if info, err := d.Info(); err == nil && info.Mode().IsRegular() {
+				bytes += info.Size()
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	t.lock.Lock()
+	t.job.TotalFiles, t.job.TotalBytes = files, bytes
+	t.lock.Unlock()
+	t.publish(true)
+	return nil
+}
+
+// transfer 传输一个顶层项目, 目标位置原本不存在时记入操作日志以便撤销
+func (t *transferTask) transfer(source string) error {
+	target := filepath.Join(t.job.TargetDir, filepath.Base(source))
+	if filepath.Dir(source) == t.job.TargetDir {
+		if t.job.Op == TransferMove {
+			// 移动到原来的文件夹, 不需要任何操作
+			return nil
+		}
+		// 在原文件夹中复制, 自动生成副本名称
+		target = t.uniqueTarget(target)
+	}
+	_, err := os.Lstat(target)
+	fresh := err != nil
+	result, err := t.place(source, target)
+	if err != nil || result == "" {
+		return err
+	}
+	t.lock.Lock()
+	t.job.Results = append(t.job.Results, result)
+	replaced := t.replaced[result]
+	t.lock.Unlock()
+	if replaced != nil {
+		// 与被替换的项目一起撤销
+		if t.job.Op == TransferMove {
+			GetJournal().RecordReplace(JournalMove, source, result, replaced)
+		} else {
+			GetJournal().RecordReplace(JournalCreate, "", result, replaced)
+		}
+	} else if fresh || result != target {
+		if t.job.Op == TransferMove {
+			GetJournal().Record(JournalMove, source, result, "")
+		} else {
+			GetJournal().Record(JournalCreate, "", result, "")
+		}
+	}
+	return nil
+}
+
+// place 将 source 传输到 target, 处理 target 已存在的情况, 返回最终的路径, 跳过时返回空
+func (t *transferTask) place(source, target string) (string, error) {
+	if err := t.checkpoint(); err != nil {
+		return "", err
+	}
+	info, err := os.Lstat(source)
+	if err != nil {
+		return "", err
+	}
+	if targetInfo, err := os.Lstat(target); err == nil {
+		if info.IsDir() && targetInfo.IsDir() {
+			return target, t.merge(source, target)
+		}
+		policy, err := t.resolve(source, target)
+		if err != nil {
+			return "", err
+		}
+		switch policy {
+		case ConflictSkip:
+			t.skip(source, info)
+			return "", nil
+		case ConflictOverwrite:
+			return target, t.replace(source, target, info)
+		case ConflictKeepBoth:
+			target = t.uniqueTarget(target)
+		}
+	}
+	return target, t.send(source, target, info)
+}
+
+// send 按任务类型移动或复制项目
+func (t *transferTask) send(source, target string, info os.FileInfo) error {
+	if t.job.Op == TransferMove {
+		return t.move(source, target, info)
+	}
+	return t.copy(source, target, info)
+}
+
+// replace 将已存在的 target 移到回收站后再传输, 传输失败时恢复被替换的项目
+func (t *transferTask) replace(source, target string, info os.FileInfo) error {
+	replaced, err := MoveToTrash(target)
+	if err != nil {
+		return fmt.Errorf("move %s to trash before replacing: %w", target, err)
+	}
+	if err = t.send(source, target, info); err == nil {
+		t.lock.Lock()
+		if t.replaced == nil {
+			t.replaced = make(map[string]*TrashItem)
+		}
+		t.replaced[target] = replaced
+		t.lock.Unlock()
+		return nil
+	}
+	// 复制失败时 target 中只有副本, 删除后恢复; 跨设备移动失败时 target 中可能已有移来的内容, 被替换的项目保留在回收站中
+	if t.job.Op == TransferCopy {
+		_ = os.RemoveAll(target)
+	}
+	if _, restoreErr := RestoreTrashItem(replaced.ID); restoreErr != nil {
+		return fmt.Errorf("%w; replaced %s is kept in trash: %v", err, target, restoreErr)
+	}
+	return err
+}
+
+// merge 将文件夹 source 中的内容合并到已存在的文件夹 target 中
+func (t *transferTask) merge(source, target string) error {
+	entries, err := os.ReadDir(source)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if _, err = t.place(filepath.Join(source, entry.Name()), filepath.Join(target, entry.Name())); err != nil {
+			return err
+		}
+	}
+	if t.job.Op == TransferMove {
+		// 有跳过的项目时文件夹不为空, 保留
+		_ = os.Remove(source)
+	}
+	return nil
+}
+
+// move 移动项目, 不在同一设备上时先复制再删除
+func (t *transferTask) move(source, target string, info os.FileInfo) error {
+	err := os.Rename(source, target)
+	if err == nil {
+		t.moved(target)
+		return nil
+	}
+	if !isCrossDevice(err) {
+		return err
+	}
+	t.lock.Lock()
+	skipped := t.job.Skipped
+	t.lock.Unlock()
+	if err = t.copy(source, target, info); err != nil {
+		return err
+	}
+	t.lock.Lock()
+	complete := skipped == t.job.Skipped
+	t.lock.Unlock()
+	if !complete {
+		// 有文件没有被复制, 保留源文件以免丢失
+		log.Printf("Transfer: keep %s because some items were skipped", source)
+		return nil
+	}
+	return os.RemoveAll(source)
+}
+
+// MovePath 将 source 移动为 target, 不在同一设备上时先复制再删除, target 已存在时返回错误;
+// 用于界面上的单个移动、文件操作助手以及撤销/重做, 不进入传输队列
+func MovePath(source, target string) error {
+	if _, err := os.Lstat(target); err == nil {
+		return fmt.Errorf("%s already exists", target)
+	}
+	info, err := os.Lstat(source)
+	if err != nil {
+		return err
+	}
+	if err = os.Rename(source, target); err == nil || !isCrossDevice(err) {
+		return err
+	}
+	// 只复制不移动: 复制过程中源文件保持不变, 全部复制成功后才删除源文件
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	t := &transferTask{job: TransferJob{Op: TransferCopy, Policy: ConflictSkip}, ctx: ctx, cancel: cancel}
+	if err = t.copy(source, target, info); err == nil && t.job.Skipped > 0 {
+		err = fmt.Errorf("%s contains files that cannot be copied", source)
+	}
+	if err != nil {
+		// target 原本不存在, 其中只有复制出的副本, 删除后源文件仍然完整
+		_ = os.RemoveAll(target)
+		return err
+	}
+	return os.RemoveAll(source)
+}
+
+// copy 复制文件、符号链接或整个文件夹, 保留修改时间与权限
+func (t *transferTask) copy(source, target string, info os.FileInfo) error {
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		link, err := os.Readlink(source)
+		if err != nil {
+			return err
+		}
+		_ = os.Remove(target)
+		if err = os.Symlink(link, target); err != nil {
+			return err
+		}
+		t.fileDone(source, 0)
+		return nil
+	case info.IsDir():
+		// 先保证可以写入其中的内容, 复制完成后再设置原来的权限与时间
+		if err := os.Mkdir(target, info.Mode().Perm()|0700); err != nil {
+			return err
+		}
+		entries, err := os.ReadDir(source)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if _, err = t.place(filepath.Join(source, entry.Name()), filepath.Join(target, entry.Name())); err != nil {
+				return err
+			}
+		}
+		if err = os.Chmod(target, info.Mode().Perm()); err != nil {
+			return err
+		}
+		return os.Chtimes(target, info.ModTime(), info.ModTime())
+	case info.Mode().IsRegular():
+		return t.copyFile(source, target, info)
+	default:
+		// 设备、管道、套接字等
+		log.Printf("Transfer: skip unsupported file %s", source)
+		t.skip(source, info)
+		return nil
+	}
+}
+
+// copyFile 先写入目标文件夹中的临时文件, 完成后再重命名, 取消或失败时不会留下不完整的文件
+func (t *transferTask) copyFile(source, target string, info os.FileInfo) (err error) {
+	src, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	tmp, err := os.CreateTemp(filepath.Dir(target), "."+filepath.Base(target)+".*.part")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+
+	t.setCurrent(source)
+	buf := make([]byte, TransferBufferSize)
+	for {
+		if err = t.checkpoint(); err != nil {
+			return err
+		}
+		n, readErr := src.Read(buf)
+		if n > 0 {
+			if _, err = tmp.Write(buf[:n]); err != nil {
+				return err
+			}
+			t.progress(int64(n))
+		}
+		if readErr == io.EOF {
+			break
+		} else if readErr != nil {
+			return readErr
+		}
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Chmod(tmp.Name(), info.Mode().Perm()); err != nil {
+		return err
+	}
+	if err = os.Chtimes(tmp.Name(), info.ModTime(), info.ModTime()); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp.Name(), target); err != nil {
+		return err
+	}
+	t.fileDone(source, 0)
+	return nil
+}
+
+// resolve 按任务的冲突策略处理冲突, 策略为 ask 时等待用户选择
+func (t *transferTask) resolve(source, target string) (string, error) {
+	t.lock.Lock()
+	policy := t.job.Policy
+	if policy == ConflictAsk {
+		t.job.Status = TransferWaiting
+		t.job.Conflict = &TransferConflict{Source: source, Target: target}
+	}
+	t.lock.Unlock()
+	if policy != ConflictAsk {
+		return policy, nil
+	}
+	t.publish(true)
+
+	var answer conflictAnswer
+	select {
+	case answer = <-t.answer:
+	case <-t.ctx.Done():
+		return "", ErrTransferCanceled
+	}
+	t.lock.Lock()
+	t.job.Conflict = nil
+	if answer.applyToAll {
+		t.job.Policy = answer.policy
+	}
+	if t.resume != nil {
+		t.job.Status = TransferPaused
+	} else {
+		t.job.Status = TransferRunning
+	}
+	t.lock.Unlock()
+	t.publish(true)
+	return answer.policy, nil
+}
+
+// checkpoint 在暂停时等待继续, 任务被取消时返回 ErrTransferCanceled
+func (t *transferTask) checkpoint() error {
+	for {
+		if t.ctx.Err() != nil {
+			return ErrTransferCanceled
+		}
+		t.lock.Lock()
+		resume := t.resume
+		t.lock.Unlock()
+		if resume == nil {
+			return nil
+		}
+		select {
+		case <-resume:
+		case <-t.ctx.Done():
+		}
+	}
+}
+
+// uniqueTarget 返回 target 所在文件夹中未被占用的名称
+func (t *transferTask) uniqueTarget(target string) string {
+	dir, base := filepath.Dir(target), filepath.Base(target)
+	info, err := os.Lstat(target)
+	isDir := err == nil && info.IsDir()
+	for i := 2; i <= MaxUniqueNames; i++ {
+		path := filepath.Join(dir, uniqueName(base, i, isDir))
+		if _, err = os.Lstat(path); err != nil {
+			return path
+		}
+	}
+	return filepath.Join(dir, uniqueName(base, int(time.Now().Unix()), isDir))
+}
+
+// moved 重命名完成后将其中的文件计入进度
+func (t *transferTask) moved(target string) {
+	var (
+		files int
+		bytes int64
+	)
+	_ = filepath.WalkDir(target, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			files++
+			if info, err := d.Info(); err == nil && info.Mode().IsRegular() {
+				bytes += info.Size()
+			}
+		}
+		return nil
+	})
+	t.lock.Lock()
+	t.job.DoneFiles += files
+	t.job.DoneBytes += bytes
+	t.job.Current = target
+	t.lock.Unlock()
+	t.publish(false)
+}
+
+// skip 将跳过的项目计入进度, 使剩余时间的估计不受影响
+func (t *transferTask) skip(source string, info os.FileInfo) {
+	var (
+		files int
+		bytes int64
+	)
+	if info.IsDir() {
+		_ = filepath.WalkDir(source, func(path string, d fs.DirEntry, err error) error {
+			if err == nil && !d.IsDir() {
+				files++
+				if info, err := d.Info(); err == nil && info.Mode().IsRegular() {
+					bytes += info.Size()
+				}
+			}
+			return nil
+		})
+	} else {
+		files = 1
+		if info.Mode().IsRegular() {
+			bytes = info.Size()
+		}
+	}
+	t.lock.Lock()
+	t.job.Skipped += files
+	t.job.DoneFiles += files
+	t.job.DoneBytes += bytes
+	t.lock.Unlock()
+	t.publish(false)
+}
+
+func (t *transferTask) setCurrent(path string) {
+	t.lock.Lock()
+	t.job.Current = path
+	t.lock.Unlock()
+}
+
+func (t *transferTask) progress(n int64) {
+	t.lock.Lock()
+	t.job.DoneBytes += n
+	t.lock.Unlock()
+	t.publish(false)
+}
+
+func (t *transferTask) fileDone(path string, n int64) {
+	t.lock.Lock()
+	t.job.DoneFiles++
+	t.job.DoneBytes += n
+	t.job.Current = path
+	t.lock.Unlock()
+	t.publish(false)
+}
+
+func (t *transferTask) setStatus(status string) {
+	t.lock.Lock()
+	if status == TransferRunning {
+		t.started = true
+		if t.resume != nil {
+			status = TransferPaused
+		}
+	}
+	t.job.Status = status
+	t.lock.Unlock()
+	t.publish(true)
+}
+
+// finish 记录任务结果并通知
+func (t *transferTask) finish(err error) {
+	now := time.Now()
+	t.lock.Lock()
+	switch {
+	case errors.Is(err, ErrTransferCanceled):
+		t.job.Status = TransferCanceled
+	case err != nil:
+		t.job.Status = TransferFailed
+		t.job.Error = err.Error()
+		log.Printf("Transfer: %s job %s failed: %v", t.job.Op, t.job.ID, err)
+	default:
+		t.job.Status = TransferDone
+	}
+	t.job.Conflict = nil
+	t.job.Current = ""
+	t.job.Speed, t.job.ETA = 0, 0
+	t.job.FinishedAt = &now
+	t.lock.Unlock()
+	t.publish(true)
+}
+
+// publish 更新速度与剩余时间并通知监听函数, force 为 false 时按 TransferNotifyInterval 节流
+func (t *transferTask) publish(force bool) {
+	now := time.Now()
+	t.lock.Lock()
+	elapsed := now.Sub(t.lastNotify)
+	if !force && elapsed < TransferNotifyInterval {
+		t.lock.Unlock()
+		return
+	}
+	if t.job.Status == TransferPaused {
+		t.job.Speed, t.job.ETA = 0, -1
+	} else if !t.lastNotify.IsZero() && t.job.Status == TransferRunning && elapsed > 0 {
+		// 指数平滑, 避免速度随单个数据块剧烈波动
+		instant := int64(float64(t.job.DoneBytes-t.lastBytes) / elapsed.Seconds())
+		if t.job.Speed == 0 {
+			t.job.Speed = instant
+		} else {
+			t.job.Speed = (t.job.Speed*7 + instant*3) / 10
+		}
+		t.job.ETA = -1
+		if t.job.Speed > 0 {
+			t.job.ETA = (t.job.TotalBytes - t.job.DoneBytes) / t.job.Speed
+		}
+	}
+	t.lastNotify, t.lastBytes = now, t.job.DoneBytes
+	t.lock.Unlock()
+	if t.notify != nil {
+		t.notify(t.snapshot())
+	}
+}
+
+// snapshot 返回任务当前状态的副本
+func (t *transferTask) snapshot() *TransferJob {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	job := t.job
+	job.Sources = append([]string(nil), t.job.Sources...)
+	job.Results = append([]string(nil), t.job.Results...)
+	if t.job.Conflict != nil {
+		conflict := *t.job.Conflict
+		job.Conflict = &conflict
+	}
+	return &job
+}
+
+func validPolicy(policy string) bool {
+	switch policy {
+	case ConflictSkip, ConflictOverwrite, ConflictKeepBoth, ConflictAsk:
+		return true
+	}
+	return false
+}
+
+// isCrossDevice 判断重命名是否因为源与目标不在同一设备(分区)上而失败
+func isCrossDevice(err error) bool {
+	var errno syscall.Errno
+	if !errors.As(err, &errno) {
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		return errno == errorNotSameDevice
+	}
+	return errno == syscall.EXDEV
+}
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+var (
+	ErrTrashConflict = errors.New("original location is occupied")
+	ErrTrashNotFound = errors.New("item is not in trash")
+)
+
+// TrashItem 回收站中的一个项目
+type TrashItem struct {
+	ID           string    `json:"id"`            // 平台相关的标识, 用于恢复或彻底删除, 前端不应解析
+	Name         string    `json:"name"`          // 原来的名称
+	OriginalPath string    `json:"original_path"` // 删除前的完整路径, 未知时为空
+	DeletedAt    time.Time `json:"deleted_at"`
+	Size         int64     `json:"size"` // 文件大小, 文件夹为0
+	IsDir        bool      `json:"is_dir"`
+}
+
+// MoveToTrash 将文件或文件夹移到系统回收站:
+// Linux 按 freedesktop.org Trash 规范, Windows 使用回收站, 其他系统使用 ~/.Trash
+func MoveToTrash(path string) (*TrashItem, error) {
+	if err := checkDeletable(path); err != nil {
+		return nil, err
+	}
+	return moveToTrash(filepath.Clean(path))
+}
+
+// ListTrash 列出回收站中的项目, 最近删除的在前
+func ListTrash() ([]*TrashItem, error) {
+	items, err := listTrash()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].DeletedAt.After(items[j].DeletedAt) })
+	return items, nil
+}
+
+// RestoreTrashItem 将项目恢复到原来的位置, 原位置已被占用时返回 ErrTrashConflict, 返回恢复后的路径
+func RestoreTrashItem(id string) (string, error) {
+	return restoreTrash(id)
+}
+
+// DeleteTrashItem 从回收站中彻底删除一个项目
+func DeleteTrashItem(id string) error {
+	return deleteTrash(id)
+}
+
+// EmptyTrash 清空回收站
+func EmptyTrash() error {
+	return emptyTrash()
+}
+
+// DeletePermanently 不经过回收站直接删除, recursive 为 false 时只能删除文件和空文件夹
+func DeletePermanently(path string, recursive bool) error {
+	if err := checkDeletable(path); err != nil {
+		return err
+	}
+	if recursive {
+		return os.RemoveAll(path)
+	}
+	return os.Remove(path)
+}
+
+// checkDeletable 拒绝删除不存在的路径、根目录与用户主目录
+func checkDeletable(path string) error {
+	if path == "" {
+		return fmt.Errorf("path is null")
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if _, err = os.Lstat(abs); err != nil {
+		return err
+	}
+	if filepath.Dir(abs) == abs {
+		return fmt.Errorf("cannot delete root directory %s", abs)
+	}
+	if home, err := os.UserHomeDir(); err == nil && filepath.Clean(home) == abs {
+		return fmt.Errorf("cannot delete home directory %s", abs)
+	}
+	return nil
+}
+
+// trashEntry 根据回收站中的文件补全项目的类型与大小
+func trashEntry(item *TrashItem, trashedPath string) *TrashItem {
+	if info, err := os.Lstat(trashedPath); err == nil {
+		item.IsDir = info.IsDir()
+		if !item.IsDir {
+			item.Size = info.Size()
+		}
+	}
+	return item
+}
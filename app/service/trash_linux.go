@@ -0,0 +1,328 @@
+//go:build linux
+
+package service
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/shirou/gopsutil/v3/disk"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// freedesktop.org Trash 规范: https://specifications.freedesktop.org/trash-spec/trashspec-latest.html
+const (
+	trashInfoExt    = ".trashinfo"
+	trashInfoHeader = "[Trash Info]"
+	trashDateLayout = "2006-01-02T15:04:05"
+)
+
+// trashDir 一个回收站目录, topDir 为空时是用户主回收站, 否则是挂载点下的回收站(信息文件中保存相对路径)
+type trashDir struct {
+	path   string
+	topDir string
+}
+
+func moveToTrash(path string) (*TrashItem, error) {
+	trash, err := trashFor(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, sub := range []string{"files", "info"} {
+		if err = os.MkdirAll(filepath.Join(trash.path, sub), 0700); err != nil {
+			return nil, err
+		}
+	}
+
+	originalPath := path
+	if trash.topDir != "" {
+		if originalPath, err = filepath.Rel(trash.topDir, path); err != nil {
+			return nil, err
+		}
+	}
+	deletedAt := time.Now().Truncate(time.Second) // 信息文件中只保存到秒
+	content := fmt.Sprintf("%s\nPath=%s\nDeletionDate=%s\n", trashInfoHeader,
+		(&url.URL{Path: originalPath}).EscapedPath(), deletedAt.Format(trashDateLayout))
+
+	// 先以独占方式创建信息文件来占用名称, 再移动文件, 防止与其他程序同时删除同名文件时互相覆盖
+	base := filepath.Base(path)
+	for i := 1; i <= MaxUniqueNames; i++ {
+		name := uniqueName(base, i, false)
+		infoPath := filepath.Join(trash.path, "info", name+trashInfoExt)
+		file, err := os.OpenFile(infoPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if errors.Is(err, os.ErrExist) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		_, err = file.WriteString(content)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		filesPath := filepath.Join(trash.path, "files", name)
+		if err == nil {
+			err = os.Rename(path, filesPath)
+		}
+		if err != nil {
+			_ = os.Remove(infoPath)
+			return nil, err
+		}
+		return trashEntry(&TrashItem{ID: infoPath, Name: base, OriginalPath: path, DeletedAt: deletedAt}, filesPath), nil
+	}
+	return nil, fmt.Errorf("too many items named %q in trash", base)
+}
+
+func listTrash() ([]*TrashItem, error) {
+	var items []*TrashItem
+	for _, trash := range trashDirs() {
+		entries, err := os.ReadDir(filepath.Join(trash.path, "info"))
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if !strings.HasSuffix(entry.Name(), trashInfoExt) {
+				continue
+			}
+			item, filesPath, err := readTrashInfo(trash, filepath.Join(trash.path, "info", entry.Name()))
+			if err != nil {
+				continue
+			}
+			// 跳过只有信息文件而没有对应文件的项目
+			if _, err = os.Lstat(filesPath); err != nil {
+				continue
+			}
+			items = append(items, trashEntry(item, filesPath))
+		}
+	}
+	return items, nil
+}
+
+func restoreTrash(id string) (string, error) {
+	trash, err := trashOf(id)
+	if err != nil {
+		return "", err
+	}
+	item, filesPath, err := readTrashInfo(trash, id)
+	if err != nil {
+		return "", err
+	}
+	if _, err = os.Lstat(item.OriginalPath); err == nil {
+		return "", fmt.Errorf("%w: %s", ErrTrashConflict, item.OriginalPath)
+	}
+	if err = os.MkdirAll(filepath.Dir(item.OriginalPath), 0755); err != nil {
+		return "", err
+	}
+	if err = os.Rename(filesPath, item.OriginalPath); err != nil {
+		return "", err
+	}
+	if err = os.Remove(id); err != nil {
+		return "", err
+	}
+	return item.OriginalPath, nil
+}
+
+func deleteTrash(id string) error {
+	trash, err := trashOf(id)
+	if err != nil {
+		return err
+	}
+	name := strings.TrimSuffix(filepath.Base(id), trashInfoExt)
+	if err = os.RemoveAll(filepath.Join(trash.path, "files", name)); err != nil {
+		return err
+	}
+	return os.Remove(id)
+}
+
+func emptyTrash() error {
+	var errs []error
+	for _, trash := range trashDirs() {
+		// 先删除文件再删除信息文件, 中途失败时不会留下没有信息的文件
+		for _, sub := range []string{"files", "info"} {
+			entries, err := os.ReadDir(filepath.Join(trash.path, sub))
+			if err != nil {
+				continue
+			}
+			for _, entry := range entries {
+				if err = os.RemoveAll(filepath.Join(trash.path, sub, entry.Name())); err != nil {
+					errs = append(errs, err)
+				}
+			}
+		}
+		_ = os.Remove(filepath.Join(trash.path, "directorysizes"))
+	}
+	return errors.Join(errs...)
+}
+
+// readTrashInfo 解析信息文件, 返回项目与回收站中的文件路径
+func readTrashInfo(trash *trashDir, infoPath string) (*TrashItem, string, error) {
+	file, err := os.Open(infoPath)
+	if err != nil {
+		return nil, "", err
+	}
+	defer file.Close()
+
+	var (
+		item    = &TrashItem{ID: infoPath}
+		name    = strings.TrimSuffix(filepath.Base(infoPath), trashInfoExt)
+		scanner = bufio.NewScanner(file)
+		inGroup bool
+	)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") {
+			inGroup = line == trashInfoHeader
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !inGroup || !ok {
+			continue
+		}
+		switch key {
+		case "Path":
+			if item.OriginalPath, err = url.PathUnescape(value); err != nil {
+				return nil, "", err
+			}
+		case "DeletionDate":
+			item.DeletedAt, _ = time.ParseInLocation(trashDateLayout, value, time.Local)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, "", err
+	}
+	if item.OriginalPath == "" {
+		return nil, "", fmt.Errorf("invalid trash info %s", infoPath)
+	}
+	if !filepath.IsAbs(item.OriginalPath) {
+		item.OriginalPath = filepath.Join(trash.topDir, item.OriginalPath)
+	}
+	item.Name = filepath.Base(item.OriginalPath)
+	return item, filepath.Join(trash.path, "files", name), nil
+}
+
+// trashOf 检查标识是否为已知回收站中的信息文件, 防止前端传入任意路径
+func trashOf(id string) (*trashDir, error) {
+	if !strings.HasSuffix(id, trashInfoExt) || filepath.Base(filepath.Dir(id)) != "info" {
+		return nil, ErrTrashNotFound
+	}
+	dir := filepath.Dir(filepath.Dir(filepath.Clean(id)))
+	for _, trash := range trashDirs() {
+		if trash.path == dir {
+			if _, err := os.Lstat(id); err != nil {
+				return nil, ErrTrashNotFound
+			}
+			return trash, nil
+		}
+	}
+	return nil, ErrTrashNotFound
+}
+
+// trashFor 选择存放 path 的回收站: 与主回收站在同一设备时使用主回收站,
+// 否则使用所在挂载点下的 .Trash/$uid 或 .Trash-$uid, 避免跨设备复制
+func trashFor(path string) (*trashDir, error) {
+	home := homeTrash()
+	dev, err := deviceOf(path)
+	if err != nil {
+		return nil, err
+	}
+	if homeDev, err := deviceOf(existingParent(home.path)); err == nil && homeDev == dev {
+		return home, nil
+	}
+	topDir := mountPoint(path, dev)
+	uid := strconv.Itoa(os.Getuid())
+	if shared := filepath.Join(topDir, ".Trash"); isSharedTrash(shared) {
+		return &trashDir{path: filepath.Join(shared, uid), topDir: topDir}, nil
+	}
+	trash := &trashDir{path: filepath.Join(topDir, ".Trash-"+uid), topDir: topDir}
+	if err = os.MkdirAll(trash.path, 0700); err != nil {
+		return nil, fmt.Errorf("no trash available on %s, delete permanently instead: %w", topDir, err)
+	}
+	return trash, nil
+}
+
+// trashDirs 返回主回收站与各挂载点下已存在的回收站
+func trashDirs() []*trashDir {
+	var (
+		dirs = []*trashDir{homeTrash()}
+		uid  = strconv.Itoa(os.Getuid())
+		seen = map[string]bool{dirs[0].path: true}
+	)
+	partitions, _ := disk.Partitions(false)
+	for _, partition := range partitions {
+		topDir := partition.Mountpoint
+		candidates := []string{filepath.Join(topDir, ".Trash-"+uid)}
+		if shared := filepath.Join(topDir, ".Trash"); isSharedTrash(shared) {
+			candidates = append(candidates, filepath.Join(shared, uid))
+		}
+		for _, path := range candidates {
+			if info, err := os.Stat(path); err != nil || !info.IsDir() || seen[path] {
+				continue
+			}
+			seen[path] = true
+			dirs = append(dirs, &trashDir{path: path, topDir: topDir})
+		}
+	}
+	return dirs
+}
+
+// homeTrash 用户主回收站: $XDG_DATA_HOME/Trash, 默认为 ~/.local/share/Trash
+func homeTrash() *trashDir {
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		home, _ := os.UserHomeDir()
+		dataHome = filepath.Join(home, ".local", "share")
+	}
+	return &trashDir{path: filepath.Join(dataHome, "Trash")}
+}
+
+// isSharedTrash 管理员创建的 $topdir/.Trash 必须是设置了粘滞位的文件夹且不能是符号链接
+func isSharedTrash(path string) bool {
+	info, err := os.Lstat(path)
+	return err == nil && info.IsDir() && info.Mode()&os.ModeSticky != 0
+}
+
+func deviceOf(path string) (uint64, error) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return 0, err
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, fmt.Errorf("cannot get device of %s", path)
+	}
+	return uint64(stat.Dev), nil
+}
+
+// mountPoint 向上查找与 path 在同一设备上的最上层文件夹
+func mountPoint(path string, dev uint64) string {
+	dir := filepath.Dir(path)
+	for {
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir
+		}
+		if parentDev, err := deviceOf(parent); err != nil || parentDev != dev {
+			return dir
+		}
+		dir = parent
+	}
+}
+
+// existingParent 返回路径本身或最近的已存在的上级文件夹
+func existingParent(path string) string {
+	for {
+		if _, err := os.Lstat(path); err == nil {
+			return path
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return path
+		}
+		path = parent
+	}
+}
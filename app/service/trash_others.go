@@ -0,0 +1,262 @@
+//go:build !linux && !windows
+
+package service
+
+import (
+	"GoSearch/app/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 其他系统(macOS)把项目移到 ~/.Trash, 其他卷上的项目移到卷上的 .Trashes/$uid; 系统没有公开记录原路径的格式,
+// 因此在配置目录下另外记录原路径与删除时间, 只有记录过的项目可以恢复
+var trashIndexLock sync.Mutex
+
+// volumesDir 外部卷的挂载位置
+const volumesDir = "/Volumes"
+
+type trashRecord struct {
+	OriginalPath string    `json:"original_path"`
+	DeletedAt    time.Time `json:"deleted_at"`
+}
+
+func moveToTrash(path string) (*TrashItem, error) {
+	dir, err := userTrashDir()
+	if err != nil {
+		return nil, err
+	}
+	trashIndexLock.Lock()
+	defer trashIndexLock.Unlock()
+	index := loadTrashIndex()
+
+	item, err := trashInto(dir, path, index)
+	// 其他卷上的项目无法移到 ~/.Trash, 改为使用卷上的 .Trashes/$uid
+	if isCrossDevice(err) {
+		if dir, err = volumeTrashDir(path); err != nil {
+			return nil, err
+		}
+		item, err = trashInto(dir, path, index)
+	}
+	return item, err
+}
+
+// trashInto 将项目移到回收站文件夹 dir 并记录原路径, 调用方需持有 trashIndexLock
+func trashInto(dir, path string, index map[string]*trashRecord) (*TrashItem, error) {
+	base := filepath.Base(path)
+	for i := 1; i <= MaxUniqueNames; i++ {
+		target := filepath.Join(dir, uniqueName(base, i, false))
+		if _, err := os.Lstat(target); err == nil {
+			continue
+		}
+		if err := os.Rename(path, target); err != nil {
+			return nil, err
+		}
+		record := &trashRecord{OriginalPath: path, DeletedAt: time.Now()}
+		index[target] = record
+		if err := storeTrashIndex(index); err != nil {
+			return nil, err
+		}
+		return trashEntry(&TrashItem{ID: target, Name: base, OriginalPath: path, DeletedAt: record.DeletedAt}, target), nil
+	}
+	return nil, fmt.Errorf("too many items named %q in trash", base)
+}
+
+func listTrash() ([]*TrashItem, error) {
+	dirs, err := trashDirs()
+	if err != nil {
+		return nil, err
+	}
+	trashIndexLock.Lock()
+	index := loadTrashIndex()
+	trashIndexLock.Unlock()
+
+	var items []*TrashItem
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if entry.Name() == ".DS_Store" {
+				continue
+			}
+			item := &TrashItem{ID: filepath.Join(dir, entry.Name()), Name: entry.Name()}
+			if record, ok := index[item.ID]; ok {
+				item.Name = filepath.Base(record.OriginalPath)
+				item.OriginalPath = record.OriginalPath
+				item.DeletedAt = record.DeletedAt
+			} else if info, err := entry.Info(); err == nil {
+				item.DeletedAt = info.ModTime()
+			}
+			items = append(items, trashEntry(item, item.ID))
+		}
+	}
+	return items, nil
+}
+
+func restoreTrash(id string) (string, error) {
+	id, err := trashPathOf(id)
+	if err != nil {
+		return "", err
+	}
+	trashIndexLock.Lock()
+	defer trashIndexLock.Unlock()
+	index := loadTrashIndex()
+	record, ok := index[id]
+	if !ok {
+		return "", fmt.Errorf("original location of %s is unknown", filepath.Base(id))
+	}
+	if _, err = os.Lstat(record.OriginalPath); err == nil {
+		return "", fmt.Errorf("%w: %s", ErrTrashConflict, record.OriginalPath)
+	}
+	if err = os.MkdirAll(filepath.Dir(record.OriginalPath), 0755); err != nil {
+		return "", err
+	}
+	if err = os.Rename(id, record.OriginalPath); err != nil {
+		return "", err
+	}
+	delete(index, id)
+	return record.OriginalPath, storeTrashIndex(index)
+}
+
+func deleteTrash(id string) error {
+	id, err := trashPathOf(id)
+	if err != nil {
+		return err
+	}
+	if err = os.RemoveAll(id); err != nil {
+		return err
+	}
+	trashIndexLock.Lock()
+	defer trashIndexLock.Unlock()
+	index := loadTrashIndex()
+	delete(index, id)
+	return storeTrashIndex(index)
+}
+
+func emptyTrash() error {
+	dirs, err := trashDirs()
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if err = os.RemoveAll(filepath.Join(dir, entry.Name())); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	trashIndexLock.Lock()
+	defer trashIndexLock.Unlock()
+	errs = append(errs, storeTrashIndex(map[string]*trashRecord{}))
+	return errors.Join(errs...)
+}
+
+// trashPathOf 检查标识是否为已知回收站文件夹下的项目, 防止前端传入任意路径
+func trashPathOf(id string) (string, error) {
+	dirs, err := trashDirs()
+	if err != nil {
+		return "", err
+	}
+	id = filepath.Clean(id)
+	if !slices.Contains(dirs, filepath.Dir(id)) || strings.HasPrefix(filepath.Base(id), "..") {
+		return "", ErrTrashNotFound
+	}
+	if _, err = os.Lstat(id); err != nil {
+		return "", ErrTrashNotFound
+	}
+	return id, nil
+}
+
+// trashDirs 返回 ~/.Trash 与各卷上已存在的 .Trashes/$uid
+func trashDirs() ([]string, error) {
+	home, err := userTrashDir()
+	if err != nil {
+		return nil, err
+	}
+	dirs := []string{home}
+	volumes, _ := filepath.Glob(filepath.Join(volumesDir, "*", ".Trashes", strconv.Itoa(os.Getuid())))
+	for _, dir := range volumes {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs, nil
+}
+
+func userTrashDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(home, ".Trash")
+	return dir, os.MkdirAll(dir, 0700)
+}
+
+// volumeTrashDir 返回 /Volumes 下的卷上当前用户的回收站 .Trashes/$uid, 其他位置没有可用的回收站
+func volumeTrashDir(path string) (string, error) {
+	rel, err := filepath.Rel(volumesDir, path)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return "", fmt.Errorf("%s is not on the same volume as the trash, delete permanently instead", path)
+	}
+	volume := filepath.Join(volumesDir, strings.SplitN(rel, string(filepath.Separator), 2)[0])
+	dir := filepath.Join(volume, ".Trashes", strconv.Itoa(os.Getuid()))
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("no trash available on %s, delete permanently instead: %w", volume, err)
+	}
+	return dir, nil
+}
+
+// loadTrashIndex 读取原路径记录, 以项目在回收站中的路径为键; 旧版本只记录了 ~/.Trash 下的名称, 读取时补全路径.
+// 调用方需持有 trashIndexLock
+func loadTrashIndex() map[string]*trashRecord {
+	index := make(map[string]*trashRecord)
+	if path, err := trashIndexPath(); err == nil {
+		if data, err := os.ReadFile(path); err == nil {
+			_ = json.Unmarshal(data, &index)
+		}
+	}
+	for key, record := range index {
+		if !filepath.IsAbs(key) {
+			if home, err := os.UserHomeDir(); err == nil {
+				index[filepath.Join(home, ".Trash", key)] = record
+			}
+			delete(index, key)
+		}
+	}
+	return index
+}
+
+// storeTrashIndex 保存原路径记录, 调用方需持有 trashIndexLock
+func storeTrashIndex(index map[string]*trashRecord) error {
+	path, err := trashIndexPath()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	return utils.StoreFile(path, data)
+}
+
+func trashIndexPath() (string, error) {
+	bootConf, _, err := EnsureConfigInitialized()
+	if err != nil || bootConf == nil {
+		return "", fmt.Errorf("boot config is nil")
+	}
+	return utils.Join(bootConf.CustomConfigDir, utils.TrashIndexFileName), nil
+}
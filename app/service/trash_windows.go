@@ -0,0 +1,257 @@
+//go:build windows
+
+package service
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf16"
+	"unsafe"
+)
+
+// Windows 回收站: 每个分区的 $Recycle.Bin\<SID> 下, 删除的项目重命名为 $R<随机>, 同名的 $I<随机> 保存原路径与删除时间
+const (
+	foDelete           = 0x0003
+	fofSilent          = 0x0004
+	fofNoConfirmation  = 0x0010
+	fofAllowUndo       = 0x0040
+	fofNoErrorUI       = 0x0400
+	sherbNoConfirm     = 0x0001
+	sherbNoProgressUI  = 0x0002
+	sherbNoSound       = 0x0004
+	recycleInfoV1Chars = 260
+)
+
+var (
+	shell32             = syscall.NewLazyDLL("shell32.dll")
+	procSHFileOperation = shell32.NewProc("SHFileOperationW")
+	procSHEmptyRecycle  = shell32.NewProc("SHEmptyRecycleBinW")
+)
+
+// shFileOpStruct 对应 SHFILEOPSTRUCTW
+type shFileOpStruct struct {
+	hwnd                  uintptr
+	wFunc                 uint32
+	pFrom                 *uint16
+	pTo                   *uint16
+	fFlags                uint16
+	fAnyOperationsAborted int32
+	hNameMappings         uintptr
+	lpszProgressTitle     *uint16
+}
+
+func moveToTrash(path string) (*TrashItem, error) {
+	// pFrom 以两个空字符结尾
+	from := utf16.Encode([]rune(path + "\x00\x00"))
+	op := &shFileOpStruct{
+		wFunc:  foDelete,
+		pFrom:  &from[0],
+		fFlags: fofAllowUndo | fofNoConfirmation | fofSilent | fofNoErrorUI,
+	}
+	started := time.Now().Add(-time.Second)
+	if ret, _, _ := procSHFileOperation.Call(uintptr(unsafe.Pointer(op))); ret != 0 {
+		return nil, fmt.Errorf("move %s to recycle bin failed: error 0x%x", path, ret)
+	}
+	if op.fAnyOperationsAborted != 0 {
+		return nil, fmt.Errorf("move %s to recycle bin was aborted", path)
+	}
+	// 回收站中的名称由系统生成, 按原路径查找刚刚删除的项目
+	items, err := listRecycleBin(filepath.VolumeName(path))
+	if err != nil {
+		return nil, err
+	}
+	var found *TrashItem
+	for _, item := range items {
+		if strings.EqualFold(item.OriginalPath, path) && !item.DeletedAt.Before(started) &&
+			(found == nil || item.DeletedAt.After(found.DeletedAt)) {
+			found = item
+		}
+	}
+	if found == nil {
+		// 文件过大等原因系统可能直接删除而不放入回收站
+		return nil, fmt.Errorf("%s was not moved to recycle bin", path)
+	}
+	return found, nil
+}
+
+func listTrash() ([]*TrashItem, error) {
+	var items []*TrashItem
+	for _, volume := range volumes() {
+		volumeItems, err := listRecycleBin(volume)
+		if err != nil {
+			continue
+		}
+		items = append(items, volumeItems...)
+	}
+	return items, nil
+}
+
+func restoreTrash(id string) (string, error) {
+	infoPath, dataPath, err := recycleEntryOf(id)
+	if err != nil {
+		return "", err
+	}
+	item, err := readRecycleInfo(infoPath)
+	if err != nil {
+		return "", err
+	}
+	if _, err = os.Lstat(item.OriginalPath); err == nil {
+		return "", fmt.Errorf("%w: %s", ErrTrashConflict, item.OriginalPath)
+	}
+	if err = os.MkdirAll(filepath.Dir(item.OriginalPath), 0755); err != nil {
+		return "", err
+	}
+	if err = os.Rename(dataPath, item.OriginalPath); err != nil {
+		return "", err
+	}
+	if err = os.Remove(infoPath); err != nil {
+		return "", err
+	}
+	return item.OriginalPath, nil
+}
+
+func deleteTrash(id string) error {
+	infoPath, dataPath, err := recycleEntryOf(id)
+	if err != nil {
+		return err
+	}
+	if err = os.RemoveAll(dataPath); err != nil {
+		return err
+	}
+	return os.Remove(infoPath)
+}
+
+func emptyTrash() error {
+	flags := uintptr(sherbNoConfirm | sherbNoProgressUI | sherbNoSound)
+	// 回收站为空时返回 E_UNEXPECTED, 不视为错误
+	if ret, _, _ := procSHEmptyRecycle.Call(0, 0, flags); ret != 0 && ret != 0x8000FFFF {
+		return fmt.Errorf("empty recycle bin failed: error 0x%x", ret)
+	}
+	return nil
+}
+
+// listRecycleBin 解析分区回收站中当前用户的 $I 文件
+func listRecycleBin(volume string) ([]*TrashItem, error) {
+	dir, err := recycleBinDir(volume)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var items []*TrashItem
+	for _, entry := range entries {
+		if !strings.HasPrefix(entry.Name(), "$I") {
+			continue
+		}
+		infoPath := filepath.Join(dir, entry.Name())
+		item, err := readRecycleInfo(infoPath)
+		if err != nil {
+			continue
+		}
+		dataPath := filepath.Join(dir, "$R"+strings.TrimPrefix(entry.Name(), "$I"))
+		if _, err = os.Lstat(dataPath); err != nil {
+			continue
+		}
+		items = append(items, trashEntry(item, dataPath))
+	}
+	return items, nil
+}
+
+// readRecycleInfo 解析 $I 文件: 版本(8字节)、大小(8字节)、删除时间(FILETIME), 之后是原路径;
+// 版本1为固定260个字符, 版本2为4字节长度加路径
+func readRecycleInfo(infoPath string) (*TrashItem, error) {
+	data, err := os.ReadFile(infoPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 24 {
+		return nil, fmt.Errorf("invalid recycle info %s", infoPath)
+	}
+	var (
+		version  = binary.LittleEndian.Uint64(data[0:8])
+		size     = int64(binary.LittleEndian.Uint64(data[8:16]))
+		fileTime = syscall.Filetime{
+			LowDateTime:  binary.LittleEndian.Uint32(data[16:20]),
+			HighDateTime: binary.LittleEndian.Uint32(data[20:24]),
+		}
+		raw []byte
+	)
+	switch version {
+	case 1:
+		raw = data[24:min(len(data), 24+recycleInfoV1Chars*2)]
+	case 2:
+		if len(data) < 28 {
+			return nil, fmt.Errorf("invalid recycle info %s", infoPath)
+		}
+		n := int(binary.LittleEndian.Uint32(data[24:28]))
+		raw = data[28:min(len(data), 28+n*2)]
+	default:
+		return nil, fmt.Errorf("unknown recycle info version %d", version)
+	}
+	chars := make([]uint16, len(raw)/2)
+	for i := range chars {
+		chars[i] = binary.LittleEndian.Uint16(raw[i*2:])
+	}
+	originalPath := syscall.UTF16ToString(chars)
+	return &TrashItem{
+		ID:           infoPath,
+		Name:         filepath.Base(originalPath),
+		OriginalPath: originalPath,
+		DeletedAt:    time.Unix(0, fileTime.Nanoseconds()),
+		Size:         size,
+	}, nil
+}
+
+// recycleEntryOf 检查标识是否为当前用户回收站中的 $I 文件, 返回 $I 与 $R 的路径
+func recycleEntryOf(id string) (string, string, error) {
+	id = filepath.Clean(id)
+	name := filepath.Base(id)
+	dir, err := recycleBinDir(filepath.VolumeName(id))
+	if err != nil || !strings.EqualFold(filepath.Dir(id), dir) || !strings.HasPrefix(name, "$I") {
+		return "", "", ErrTrashNotFound
+	}
+	if _, err = os.Lstat(id); err != nil {
+		return "", "", ErrTrashNotFound
+	}
+	return id, filepath.Join(dir, "$R"+strings.TrimPrefix(name, "$I")), nil
+}
+
+func recycleBinDir(volume string) (string, error) {
+	sid, err := currentUserSID()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(volume+`\`, "$Recycle.Bin", sid), nil
+}
+
+func currentUserSID() (string, error) {
+	token, err := syscall.OpenCurrentProcessToken()
+	if err != nil {
+		return "", err
+	}
+	defer token.Close()
+	user, err := token.GetTokenUser()
+	if err != nil {
+		return "", err
+	}
+	return user.User.Sid.String()
+}
+
+// volumes 返回存在的分区盘符, 例如 C:
+func volumes() []string {
+	var res []string
+	for letter := 'A'; letter <= 'Z'; letter++ {
+		volume := string(letter) + ":"
+		if _, err := os.Stat(volume + `\`); err == nil {
+			res = append(res, volume)
+		}
+	}
+	return res
+}
@@ -0,0 +1,451 @@
+package service
+
+import (
+	"GoSearch/app/utils"
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/tmc/langchaingo/llms"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 大模型请求的用途
+const (
+	UsageSearch = "search"
+	UsageRerank = "rerank"
+	UsageAgent  = "agent"
+	UsageTest   = "test"
+)
+
+const (
+	dayLayout   = "2006-01-02"
+	monthLayout = "2006-01"
+)
+
+var (
+	usageTracker     *UsageTracker
+	usageTrackerOnce sync.Once
+	ErrQuotaExceeded = errors.New("llm monthly quota exceeded")
+	UsageDetailDays  = 31 // 用量明细保留的天数, 更早的记录在启动时合并到汇总文件中
+)
+
+// UsageRecord 一次大模型请求的用量记录
+type UsageRecord struct {
+	Time             time.Time `json:"time"`
+	Provider         string    `json:"provider"`
+	Model            string    `json:"model"`
+	Purpose          string    `json:"purpose"`
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	Estimated        bool      `json:"estimated"` // 响应中没有用量信息时使用本地分词估算
+	Cost             float64   `json:"cost"`
+	LatencyMs        int64     `json:"latency_ms"`
+	Success          bool      `json:"success"`
+	Error            string    `json:"error,omitempty"`
+}
+
+// UsageTotals 一段时间内的用量汇总
+type UsageTotals struct {
+	Period           string  `json:"period"` // 日期(2006-01-02)或月份(2006-01)
+	Requests         int     `json:"requests"`
+	Failed           int     `json:"failed"`
+	PromptTokens     uint64  `json:"prompt_tokens"`
+	CompletionTokens uint64  `json:"completion_tokens"`
+	TotalTokens      uint64  `json:"total_tokens"`
+	Cost             float64 `json:"cost"`
+}
+
+// QuotaStatus 当前服务商本月的用量与限额
+type QuotaStatus struct {
+	Provider    string  `json:"provider"`
+	Month       string  `json:"month"`
+	UsedTokens  uint64  `json:"used_tokens"`
+	UsedCost    float64 `json:"used_cost"`
+	TokenLimit  uint64  `json:"token_limit"` // 为0时表示不限制
+	CostLimit   float64 `json:"cost_limit"`  // 为0时表示不限制
+	Exceeded    bool    `json:"exceeded"`
+	Description string  `json:"description"`
+}
+
+// UsageTracker 记录每次大模型请求的用量并按天、按月汇总, 明细以JSON Lines格式追加到磁盘,
+// 超过 UsageDetailDays 的明细在启动时合并到汇总文件, 日志不会无限增长
+type UsageTracker struct {
+	lock        sync.Mutex
+	daily       map[string]map[string]*UsageTotals // 日期 -> 服务商 -> 汇总
+	monthly     map[string]map[string]*UsageTotals // 月份 -> 服务商 -> 汇总
+	filePath    string
+	summaryPath string
+}
+
+// usageSummary 已从明细日志中移除的记录的汇总
+type usageSummary struct {
+	Through time.Time                          `json:"through"` // 不晚于该时间的记录都已计入汇总
+	Daily   map[string]map[string]*UsageTotals `json:"daily"`
+	Monthly map[string]map[string]*UsageTotals `json:"monthly"`
+}
+
+// GetUsageTracker 获取用量统计单例对象, 首次调用时从用量日志中恢复汇总数据
+func GetUsageTracker() *UsageTracker {
+	usageTrackerOnce.Do(func() {
+		usageTracker = &UsageTracker{
+			daily:   make(map[string]map[string]*UsageTotals),
+			monthly: make(map[string]map[string]*UsageTotals),
+		}
+		if bootConf, _, err := EnsureConfigInitialized(); err == nil && bootConf != nil {
+			usageTracker.filePath = utils.Join(bootConf.CustomConfigDir, utils.LLMUsageFileName)
+			usageTracker.summaryPath = utils.Join(bootConf.CustomConfigDir, utils.LLMUsageSummaryFileName)
+			if err = usageTracker.load(); err != nil {
+				log.Printf("UsageTracker: load usage log error: %v", err)
+			}
+		}
+	})
+	return usageTracker
+}
+
+// Record 根据请求与响应生成用量记录, 响应中没有token数量时在本地估算;
+// 没有得到响应的失败请求(网络错误、超时、服务端错误等)只计入请求次数, 不计token与费用, 不占用限额
+func (u *UsageTracker) Record(conf *UData, purpose string, content []llms.MessageContent, response *llms.ContentResponse, latency time.Duration, callErr error) *UsageRecord {
+	record := &UsageRecord{
+		Time:      time.Now(),
+		Provider:  LLMProvider(conf),
+		Purpose:   purpose,
+		LatencyMs: latency.Milliseconds(),
+		Success:   callErr == nil,
+	}
+	if conf != nil {
+		record.Model = conf.Model
+	}
+	if callErr != nil {
+		record.Error = callErr.Error()
+	}
+	if response != nil && len(response.Choices) > 0 {
+		info := response.Choices[0].GenerationInfo
+		record.PromptTokens = intFromInfo(info, "PromptTokens")
+		record.CompletionTokens = intFromInfo(info, "CompletionTokens")
+		// 服务商没有返回用量时按本地分词估算
+		if record.PromptTokens == 0 {
+			record.PromptTokens = estimateTokens(record.Model, content)
+			record.Estimated = true
+		}
+		if record.CompletionTokens == 0 {
+			record.CompletionTokens = llms.CountTokens(record.Model, response.Choices[0].Content)
+			record.Estimated = true
+		}
+	}
+	if conf != nil {
+		quota := conf.Quota(record.Provider)
+		record.Cost = (float64(record.PromptTokens)*quota.PromptPrice + float64(record.CompletionTokens)*quota.CompletionPrice) / 1e6
+	}
+
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	u.add(record)
+	if err := u.append(record); err != nil {
+		log.Printf("UsageTracker: write usage log error: %v", err)
+	}
+	return record
+}
+
+// CheckQuota 本月用量超过限额时返回错误, 阻止继续请求大模型
+func (u *UsageTracker) CheckQuota(conf *UData) error {
+	status := u.Quota(conf)
+	if status.Exceeded {
+		return fmt.Errorf("%w: %s", ErrQuotaExceeded, status.Description)
+	}
+	return nil
+}
+
+// Quota 当前服务商本月的用量与限额, 限额见 UData.Quota
+func (u *UsageTracker) Quota(conf *UData) *QuotaStatus {
+	var (
+		month  = time.Now().Format(monthLayout)
+		status = &QuotaStatus{Provider: LLMProvider(conf), Month: month}
+	)
+	if conf != nil {
+		quota := conf.Quota(status.Provider)
+		status.TokenLimit = quota.MonthlyTokenLimit
+		status.CostLimit = quota.MonthlyCostLimit
+	}
+	u.lock.Lock()
+	if totals, ok := u.monthly[month][status.Provider]; ok {
+		status.UsedTokens = totals.TotalTokens
+		status.UsedCost = totals.Cost
+	}
+	u.lock.Unlock()
+
+	switch {
+	case status.TokenLimit > 0 && status.UsedTokens >= status.TokenLimit:
+		status.Exceeded = true
+		status.Description = fmt.Sprintf("本月(%s)在 %s 上已使用 %d tokens, 达到上限 %d tokens, 请在设置中调整限额或等待下月",
+			month, status.Provider, status.UsedTokens, status.TokenLimit)
+	case status.CostLimit > 0 && status.UsedCost >= status.CostLimit:
+		status.Exceeded = true
+		status.Description = fmt.Sprintf("本月(%s)在 %s 上的费用已达到 %.4f, 超过上限 %.4f, 请在设置中调整限额或等待下月",
+			month, status.Provider, status.UsedCost, status.CostLimit)
+	default:
+		status.Description = fmt.Sprintf("本月(%s)在 %s 上已使用 %d tokens, 费用 %.4f", month, status.Provider, status.UsedTokens, status.UsedCost)
+	}
+	return status
+}
+
+// Daily 返回最近 days 天(包含今天)的用量汇总, 按日期从早到晚排列, 不区分服务商
+func (u *UsageTracker) Daily(days int) []*UsageTotals {
+	now := time.Now()
+	res := make([]*UsageTotals, 0, days)
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	for i := days - 1; i >= 0; i-- {
+		day := now.AddDate(0, 0, -i).Format(dayLayout)
+		res = append(res, sumTotals(day, u.daily[day]))
+	}
+	return res
+}
+
+// Monthly 返回最近 months 个月(包含本月)的用量汇总, 按月份从早到晚排列, 不区分服务商
+func (u *UsageTracker) Monthly(months int) []*UsageTotals {
+	now := time.Now()
+	first := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	res := make([]*UsageTotals, 0, months)
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	for i := months - 1; i >= 0; i-- {
+		month := first.AddDate(0, -i, 0).Format(monthLayout)
+		res = append(res, sumTotals(month, u.monthly[month]))
+	}
+	return res
+}
+
+// add 将记录累加到按天、按月的汇总中
+func (u *UsageTracker) add(record *UsageRecord) {
+	addUsage(u.daily, u.monthly, record)
+}
+
+func addUsage(daily, monthly map[string]map[string]*UsageTotals, record *UsageRecord) {
+	for _, item := range []struct {
+		totals map[string]map[string]*UsageTotals
+		period string
+	}{
+		{daily, record.Time.Format(dayLayout)},
+		{monthly, record.Time.Format(monthLayout)},
+	} {
+		byProvider, ok := item.totals[item.period]
+		if !ok {
+			byProvider = make(map[string]*UsageTotals)
+			item.totals[item.period] = byProvider
+		}
+		totals, ok := byProvider[record.Provider]
+		if !ok {
+			totals = &UsageTotals{Period: item.period}
+			byProvider[record.Provider] = totals
+		}
+		totals.Requests++
+		if !record.Success {
+			totals.Failed++
+		}
+		totals.PromptTokens += uint64(record.PromptTokens)
+		totals.CompletionTokens += uint64(record.CompletionTokens)
+		totals.TotalTokens += uint64(record.PromptTokens + record.CompletionTokens)
+		totals.Cost += record.Cost
+	}
+}
+
+// load 读取汇总文件与明细日志, 明细中超过 UsageDetailDays 的记录合并到汇总文件并从日志中移除
+func (u *UsageTracker) load() error {
+	summary := &usageSummary{
+		Daily:   make(map[string]map[string]*UsageTotals),
+		Monthly: make(map[string]map[string]*UsageTotals),
+	}
+	if data, err := os.ReadFile(u.summaryPath); err == nil {
+		if err = json.Unmarshal(data, summary); err != nil {
+			return fmt.Errorf("parse usage summary %s: %w", u.summaryPath, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	file, err := os.Open(u.filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			u.restore(summary, nil)
+			return nil
+		}
+		return err
+	}
+	var (
+		cutoff    = time.Now().AddDate(0, 0, -UsageDetailDays)
+		through   = summary.Through
+		recent    []*UsageRecord
+		recentRaw [][]byte
+		compacted bool
+	)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		record := &UsageRecord{}
+		// 跳过写入中断等原因损坏的行
+		if err = json.Unmarshal(scanner.Bytes(), record); err != nil {
+			continue
+		}
+		switch {
+		case !record.Time.After(through):
+			// 上次合并后日志没有重写成功, 已计入汇总
+			compacted = true
+		case record.Time.Before(cutoff):
+			addUsage(summary.Daily, summary.Monthly, record)
+			if record.Time.After(summary.Through) {
+				summary.Through = record.Time
+			}
+			compacted = true
+		default:
+			recent = append(recent, record)
+			recentRaw = append(recentRaw, append([]byte(nil), scanner.Bytes()...))
+		}
+	}
+	file.Close()
+	if err = scanner.Err(); err != nil {
+		return err
+	}
+	u.restore(summary, recent)
+	if !compacted {
+		return nil
+	}
+	// 先保存汇总再重写日志, 中途失败时依靠 Through 避免重复计入
+	if err = writeJSONFile(u.summaryPath, summary); err != nil {
+		return err
+	}
+	return rewriteLines(u.filePath, recentRaw)
+}
+
+// restore 由汇总与近期的明细恢复按天、按月的用量
+func (u *UsageTracker) restore(summary *usageSummary, recent []*UsageRecord) {
+	for period, byProvider := range summary.Daily {
+		u.daily[period] = make(map[string]*UsageTotals, len(byProvider))
+		for provider, totals := range byProvider {
+			copied := *totals
+			u.daily[period][provider] = &copied
+		}
+	}
+	for period, byProvider := range summary.Monthly {
+		u.monthly[period] = make(map[string]*UsageTotals, len(byProvider))
+		for provider, totals := range byProvider {
+			copied := *totals
+			u.monthly[period][provider] = &copied
+		}
+	}
+	for _, record := range recent {
+		u.add(record)
+	}
+}
+
+func writeJSONFile(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", " ")
+	if err != nil {
+		return err
+	}
+	tmpPath := path + ".tmp"
+	if err = os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// rewriteLines 先写临时文件再替换, 防止写入中断导致日志丢失
+func rewriteLines(path string, lines [][]byte) error {
+	tmpPath := path + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	for _, line := range lines {
+		w.Write(line)
+		w.WriteByte('\n')
+	}
+	if err = w.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err = file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+func (u *UsageTracker) append(record *UsageRecord) error {
+	if u.filePath == "" {
+		return nil
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(u.filePath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.Write(append(data, '\n'))
+	return err
+}
+
+// LLMProvider 使用BaseURL的主机名区分服务商, 未配置时为openai
+func LLMProvider(conf *UData) string {
+	if conf == nil || conf.BaseURL == "" {
+		return utils.OPENAI
+	}
+	if u, err := url.Parse(conf.BaseURL); err == nil && u.Host != "" {
+		return strings.ToLower(u.Host)
+	}
+	return conf.BaseURL
+}
+
+func sumTotals(period string, byProvider map[string]*UsageTotals) *UsageTotals {
+	sum := &UsageTotals{Period: period}
+	for _, totals := range byProvider {
+		sum.Requests += totals.Requests
+		sum.Failed += totals.Failed
+		sum.PromptTokens += totals.PromptTokens
+		sum.CompletionTokens += totals.CompletionTokens
+		sum.TotalTokens += totals.TotalTokens
+		sum.Cost += totals.Cost
+	}
+	return sum
+}
+
+func intFromInfo(info map[string]any, key string) int {
+	switch v := info[key].(type) {
+	case int:
+		return v
+	case int64:
+		return int(v)
+	case float64:
+		return int(v)
+	}
+	return 0
+}
+
+// estimateTokens 使用本地分词估算请求消息的token数量
+func estimateTokens(model string, content []llms.MessageContent) int {
+	var sb strings.Builder
+	for _, msg := range content {
+		for _, part := range msg.Parts {
+			switch p := part.(type) {
+			case llms.TextContent:
+				sb.WriteString(p.Text)
+			case llms.ToolCallResponse:
+				sb.WriteString(p.Content)
+			case llms.ToolCall:
+				if p.FunctionCall != nil {
+					sb.WriteString(p.FunctionCall.Arguments)
+				}
+			}
+			sb.WriteString("\n")
+		}
+	}
+	return llms.CountTokens(model, sb.String())
+}
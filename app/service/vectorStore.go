@@ -0,0 +1,464 @@
+package service
+
+import (
+	"GoSearch/app/utils"
+	"container/heap"
+	"context"
+	"encoding/gob"
+	"fmt"
+	"github.com/tmc/langchaingo/embeddings"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	vectorStore     *VectorStore
+	vectorStoreOnce sync.Once
+	EmbedBatchSize  = 32               // 每次请求嵌入的条目数量
+	EmbedTimeout    = 30 * time.Second // 单次嵌入请求超时时间
+	VectorFlushTime = 2 * time.Minute  // 向量库落盘间隔
+)
+
+// VectorRecord 向量库中的一条记录
+type VectorRecord struct {
+	Path    string
+	Name    string
+	IsDir   bool
+	Size    int64
+	ModTime time.Time
+	Mode    os.FileMode
+	Vector  []float32 // 已归一化的向量, 余弦相似度即为点积
+}
+
+// VectorHit 向量检索结果
+type VectorHit struct {
+	Entry *FileSystemEntry
+	Score float32
+}
+
+// vectorSnapshot 持久化格式
+type vectorSnapshot struct {
+	Model   string
+	Records []*VectorRecord
+}
+
+// indexJob 索引器提交的增量更新任务
+type indexJob struct {
+	dirPath string             // 完整列出的文件夹, 为空时不做清理
+	entries []*FileSystemEntry // 需要检查是否变化的条目
+}
+
+// VectorStore 本地向量库, 保存在配置目录下, 由索引器增量更新
+type VectorStore struct {
+	lock     sync.RWMutex
+	model    string                         // 生成向量所用的嵌入模型
+	records  map[string]*VectorRecord       // key: 文件绝对路径
+	byDir    map[string]map[string]struct{} // 按所在文件夹分组的路径, 清理文件夹时不必遍历整个向量库
+	enabled  atomic.Bool                    // 是否配置了嵌入模型, 由 SetEnabled 在配置修改时更新
+	filePath string
+	dirty    bool
+	queue    chan indexJob
+	stopChan chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// GetVectorStore 获取向量库单例对象, 首次调用时从配置目录加载
+func GetVectorStore() *VectorStore {
+	vectorStoreOnce.Do(func() {
+		vectorStore = &VectorStore{
+			records:  make(map[string]*VectorRecord),
+			byDir:    make(map[string]map[string]struct{}),
+			queue:    make(chan indexJob, 256),
+			stopChan: make(chan struct{}),
+		}
+		if bootConf, _, err := EnsureConfigInitialized(); err == nil && bootConf != nil {
+			vectorStore.filePath = utils.Join(bootConf.CustomConfigDir, utils.VectorFileName)
+			if err = vectorStore.load(); err != nil {
+				log.Printf("VectorStore: load error: %v", err)
+			}
+		}
+		if data, _ := GetUserData(); data != nil {
+			vectorStore.enabled.Store(data.EmbeddingModel != "")
+		}
+		vectorStore.wg.Add(1)
+		go vectorStore.runIndexer()
+	})
+	return vectorStore
+}
+
+// Enqueue 提交一个文件夹的完整列表, 变化的条目会在后台重新嵌入, 已删除的条目会被清理
+func (vs *VectorStore) Enqueue(dirCnt *DirContent) {
+	if dirCnt == nil {
+		return
+	}
+	entries := make([]*FileSystemEntry, 0, len(dirCnt.Files)+len(dirCnt.SubDirs))
+	for _, entry := range dirCnt.SubDirs {
+		e := *entry
+		entries = append(entries, &e)
+	}
+	for _, entry := range dirCnt.Files {
+		e := *entry
+		entries = append(entries, &e)
+	}
+	vs.submit(indexJob{dirPath: dirCnt.Path, entries: entries})
+}
+
+// EnqueueEntries 提交零散的条目(例如关键字检索的结果)
+func (vs *VectorStore) EnqueueEntries(entries []*FileSystemEntry) {
+	if len(entries) == 0 {
+		return
+	}
+	copied := make([]*FileSystemEntry, 0, len(entries))
+	for _, entry := range entries {
+		e := *entry
+		copied = append(copied, &e)
+	}
+	vs.submit(indexJob{entries: copied})
+}
+
+// SetEnabled 修改嵌入模型配置后调用, 未配置时不再提交索引任务
+func (vs *VectorStore) SetEnabled(enabled bool) {
+	vs.enabled.Store(enabled)
+}
+
+func (vs *VectorStore) submit(job indexJob) {
+	// 未配置嵌入模型时不建立索引
+	if !vs.enabled.Load() {
+		return
+	}
+	select {
+	case vs.queue <- job:
+	case <-vs.stopChan:
+	default:
+		// 队列已满时丢弃, 下次访问该文件夹时会重新提交
+		log.Printf("VectorStore: index queue is full, drop %d entries", len(job.entries))
+	}
+}
+
+// Search 在baseDir下查找与查询向量最相似的topK个条目
+func (vs *VectorStore) Search(query []float32, baseDir string, topK int) []*VectorHit {
+	if topK <= 0 || len(query) == 0 {
+		return nil
+	}
+	normalize(query)
+	prefix := baseDir
+	if prefix != "" && !strings.HasSuffix(prefix, string(filepath.Separator)) {
+		prefix += string(filepath.Separator)
+	}
+
+	vs.lock.RLock()
+	h := make(hitHeap, 0, topK)
+	for path, record := range vs.records {
+		if prefix != "" && !strings.HasPrefix(path, prefix) {
+			continue
+		}
+		if len(record.Vector) != len(query) {
+			continue
+		}
+		score := dot(query, record.Vector)
+		if h.Len() < topK {
+			heap.Push(&h, &VectorHit{Entry: record.entry(), Score: score})
+		} else if score > h[0].Score {
+			h[0] = &VectorHit{Entry: record.entry(), Score: score}
+			heap.Fix(&h, 0)
+		}
+	}
+	vs.lock.RUnlock()
+
+	// 按相似度从高到低输出
+	hits := make([]*VectorHit, h.Len())
+	for i := len(hits) - 1; i >= 0; i-- {
+		hits[i] = heap.Pop(&h).(*VectorHit)
+	}
+	return hits
+}
+
+// Remove 删除向量库中的条目
+func (vs *VectorStore) Remove(path string) {
+	vs.lock.Lock()
+	defer vs.lock.Unlock()
+	if _, ok := vs.records[path]; ok {
+		vs.delete(path)
+		vs.dirty = true
+	}
+}
+
+// put 插入或替换一条记录, 调用方需持有写锁
+func (vs *VectorStore) put(record *VectorRecord) {
+	vs.records[record.Path] = record
+	dir := filepath.Dir(record.Path)
+	paths, ok := vs.byDir[dir]
+	if !ok {
+		paths = make(map[string]struct{})
+		vs.byDir[dir] = paths
+	}
+	paths[record.Path] = struct{}{}
+}
+
+// delete 删除一条记录, 调用方需持有写锁
+func (vs *VectorStore) delete(path string) {
+	delete(vs.records, path)
+	dir := filepath.Dir(path)
+	if paths, ok := vs.byDir[dir]; ok {
+		delete(paths, path)
+		if len(paths) == 0 {
+			delete(vs.byDir, dir)
+		}
+	}
+}
+
+// Close 停止后台索引协程并保存向量库
+func (vs *VectorStore) Close() error {
+	vs.stopOnce.Do(func() {
+		close(vs.stopChan)
+	})
+	vs.wg.Wait()
+	return vs.save()
+}
+
+func (vs *VectorStore) runIndexer() {
+	defer vs.wg.Done()
+	ticker := time.NewTicker(VectorFlushTime)
+	defer ticker.Stop()
+	for {
+		select {
+		case job := <-vs.queue:
+			vs.index(job)
+		case <-ticker.C:
+			if err := vs.save(); err != nil {
+				log.Printf("VectorStore: save error: %v", err)
+			}
+		case <-vs.stopChan:
+			return
+		}
+	}
+}
+
+// index 对新增或修改过的条目重新嵌入, 并清理文件夹中已不存在的条目
+func (vs *VectorStore) index(job indexJob) {
+	var (
+		conf     *UData
+		embedder embeddings.Embedder
+		stale    []*FileSystemEntry
+		err      error
+	)
+	if conf, err = GetUserData(); err != nil || conf == nil || conf.EmbeddingModel == "" {
+		return
+	}
+	vs.checkModel(embeddingModelID(conf))
+
+	// 只读检查在读锁下进行, 不阻塞检索; 写锁只用于实际的删除
+	var removed []string
+	vs.lock.RLock()
+	if job.dirPath != "" {
+		present := make(map[string]struct{}, len(job.entries))
+		for _, entry := range job.entries {
+			present[entry.Path] = struct{}{}
+		}
+		for path := range vs.byDir[filepath.Clean(job.dirPath)] {
+			if _, ok := present[path]; !ok {
+				removed = append(removed, path)
+			}
+		}
+	}
+	for _, entry := range job.entries {
+		record, ok := vs.records[entry.Path]
+		if ok && record.Size == entry.Size && record.ModTime.Equal(entry.ModTime) {
+			continue
+		}
+		stale = append(stale, entry)
+	}
+	vs.lock.RUnlock()
+
+	if len(removed) > 0 {
+		vs.lock.Lock()
+		for _, path := range removed {
+			vs.delete(path)
+		}
+		vs.dirty = true
+		vs.lock.Unlock()
+	}
+
+	if len(stale) == 0 {
+		return
+	}
+	if embedder, err = NewEmbedder(conf); err != nil {
+		log.Printf("VectorStore: %v", err)
+		return
+	}
+	for start := 0; start < len(stale); start += EmbedBatchSize {
+		end := start + EmbedBatchSize
+		if end > len(stale) {
+			end = len(stale)
+		}
+		batch := stale[start:end]
+		texts := make([]string, len(batch))
+		for i, entry := range batch {
+			texts[i] = EntryDocument(entry)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), EmbedTimeout)
+		vectors, err := embedder.EmbedDocuments(ctx, texts)
+		cancel()
+		if err != nil {
+			log.Printf("VectorStore: embed %d entries error: %v", len(batch), err)
+			return
+		}
+		if len(vectors) != len(batch) {
+			log.Printf("VectorStore: expect %d vectors, got %d", len(batch), len(vectors))
+			return
+		}
+
+		vs.lock.Lock()
+		for i, entry := range batch {
+			normalize(vectors[i])
+			vs.put(&VectorRecord{
+				Path:    entry.Path,
+				Name:    entry.Name,
+				IsDir:   entry.IsDir,
+				Size:    entry.Size,
+				ModTime: entry.ModTime,
+				Mode:    entry.Mode,
+				Vector:  vectors[i],
+			})
+		}
+		vs.dirty = true
+		vs.lock.Unlock()
+
+		select {
+		case <-vs.stopChan:
+			return
+		default:
+		}
+	}
+}
+
+// checkModel 嵌入模型变化后清空向量库, 不同模型的向量不可比较
+func (vs *VectorStore) checkModel(model string) {
+	vs.lock.Lock()
+	defer vs.lock.Unlock()
+	if vs.model == model {
+		return
+	}
+	if len(vs.records) > 0 {
+		log.Printf("VectorStore: embedding model changed (%s -> %s), reset store", vs.model, model)
+	}
+	vs.model = model
+	vs.records = make(map[string]*VectorRecord)
+	vs.byDir = make(map[string]map[string]struct{})
+	vs.dirty = true
+}
+
+func (vs *VectorStore) load() error {
+	file, err := os.Open(vs.filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+
+	snapshot := &vectorSnapshot{}
+	if err = gob.NewDecoder(file).Decode(snapshot); err != nil {
+		return fmt.Errorf("decode %s: %w", vs.filePath, err)
+	}
+	vs.model = snapshot.Model
+	for _, record := range snapshot.Records {
+		vs.put(record)
+	}
+	log.Printf("VectorStore: loaded %d vectors", len(vs.records))
+	return nil
+}
+
+func (vs *VectorStore) save() error {
+	vs.lock.Lock()
+	defer vs.lock.Unlock()
+	if !vs.dirty || vs.filePath == "" {
+		return nil
+	}
+	snapshot := &vectorSnapshot{
+		Model:   vs.model,
+		Records: make([]*VectorRecord, 0, len(vs.records)),
+	}
+	for _, record := range vs.records {
+		snapshot.Records = append(snapshot.Records, record)
+	}
+
+	// 先写临时文件再替换, 防止写入中断导致向量库损坏
+	tmpPath := vs.filePath + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	if err = gob.NewEncoder(file).Encode(snapshot); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err = file.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmpPath, vs.filePath); err != nil {
+		return err
+	}
+	vs.dirty = false
+	return nil
+}
+
+func (record *VectorRecord) entry() *FileSystemEntry {
+	return &FileSystemEntry{
+		Path:    record.Path,
+		Name:    record.Name,
+		IsDir:   record.IsDir,
+		Size:    record.Size,
+		ModTime: record.ModTime,
+		Mode:    record.Mode,
+	}
+}
+
+func normalize(v []float32) {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	if sum == 0 {
+		return
+	}
+	norm := float32(math.Sqrt(sum))
+	if math.Abs(float64(norm)-1) < 1e-6 {
+		return
+	}
+	for i := range v {
+		v[i] /= norm
+	}
+}
+
+func dot(a, b []float32) float32 {
+	var sum float32
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+	return sum
+}
+
+// hitHeap 小顶堆, 用于维护相似度最高的topK个结果
+type hitHeap []*VectorHit
+
+func (h hitHeap) Len() int            { return len(h) }
+func (h hitHeap) Less(i, j int) bool  { return h[i].Score < h[j].Score }
+func (h hitHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *hitHeap) Push(x interface{}) { *h = append(*h, x.(*VectorHit)) }
+func (h *hitHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
@@ -2,18 +2,148 @@ package test
 
 import (
 	"GoSearch/app/controller"
+	"GoSearch/app/dto"
 	"GoSearch/app/service"
 	"GoSearch/app/utils"
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/shirou/gopsutil/v3/disk"
 	"github.com/shirou/gopsutil/v3/mem"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"image"
+	"image/png"
+	"io"
+	"math"
 	"math/rand"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
 	"time"
+	"unicode/utf16"
 )
 
+// TestMain 将配置、缓存、数据目录与主目录指向临时目录, 并关闭系统密钥环,
+// 测试不会读写用户真实的配置、回收站、用量记录与密钥; 工作目录也切换到临时目录,
+// 相对路径(例如 TestSetConfigDir 中的 Windows 路径在其他系统上)不会写入源码目录
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "gosearch-test-")
+	if err != nil {
+		panic(err)
+	}
+	if err = os.Chdir(dir); err != nil {
+		panic(err)
+	}
+	for _, name := range []string{"HOME", "USERPROFILE", "XDG_CONFIG_HOME", "XDG_CACHE_HOME", "XDG_DATA_HOME", "APPDATA", "LOCALAPPDATA"} {
+		_ = os.Setenv(name, filepath.Join(dir, strings.ToLower(name)))
+	}
+	_ = os.Setenv("DBUS_SESSION_BUS_ADDRESS", "disabled:")
+	code := m.Run()
+	_ = os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// fakeLLM 模拟 OpenAI 兼容的接口, 记录每次请求的请求体
+type fakeLLM struct {
+	lock     sync.Mutex
+	requests []string
+}
+
+func (f *fakeLLM) calls() int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return len(f.requests)
+}
+
+// toolCallsPrefix 模型输出以此开头时, 其余部分为工具调用列表, 见 toolCalls
+const toolCallsPrefix = "tool_calls:"
+
+// toolCalls 生成调用工具的模型输出, 每个调用为工具名与 JSON 格式的参数
+func toolCalls(calls ...[2]string) string {
+	var res []map[string]any
+	for i, call := range calls {
+		res = append(res, map[string]any{
+			"id": fmt.Sprintf("call_%d", i), "type": "function",
+			"function": map[string]string{"name": call[0], "arguments": call[1]},
+		})
+	}
+	data, _ := json.Marshal(res)
+	return toolCallsPrefix + string(data)
+}
+
+// startFakeLLM 启动模拟的大模型接口并让用户数据指向它, 测试结束后恢复原来的用户数据;
+// reply 根据第几次请求(从1开始)返回状态码与模型输出, 请求中带有 stream 时按 SSE 分段返回
+func startFakeLLM(t *testing.T, conf service.UData, reply func(call int) (int, string)) *fakeLLM {
+	t.Helper()
+	fake := &fakeLLM{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		fake.lock.Lock()
+		fake.requests = append(fake.requests, string(body))
+		call := len(fake.requests)
+		fake.lock.Unlock()
+
+		status, content := reply(call)
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			fmt.Fprintf(w, `{"error":{"message":%q}}`, content)
+			return
+		}
+		var req struct {
+			Stream bool `json:"stream"`
+		}
+		_ = json.Unmarshal(body, &req)
+		if !req.Stream {
+			message, finish := map[string]any{"role": "assistant", "content": content}, "stop"
+			if calls, ok := strings.CutPrefix(content, toolCallsPrefix); ok {
+				message["content"], message["tool_calls"], finish = "", json.RawMessage(calls), "tool_calls"
+			}
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"id": "fake", "object": "chat.completion", "model": "fake-model",
+				"choices": []map[string]any{{"index": 0, "finish_reason": finish, "message": message}},
+				"usage":   map[string]int{"prompt_tokens": 10, "completion_tokens": 5, "total_tokens": 15},
+			})
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for runes := []rune(content); len(runes) > 0; {
+			n := min(len(runes), 5)
+			data, _ := json.Marshal(map[string]any{
+				"id": "fake", "object": "chat.completion.chunk", "model": "fake-model",
+				"choices": []map[string]any{{"index": 0, "delta": map[string]string{"content": string(runes[:n])}}},
+			})
+			fmt.Fprintf(w, "data: %s\n\n", data)
+			runes = runes[n:]
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	t.Cleanup(server.Close)
+
+	data, err := service.GetUserData()
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := *data
+	if conf.Model == "" {
+		conf.Model = "fake-model"
+	}
+	conf.BaseURL, conf.ApiKey = server.URL+"/v1", "test-key"
+	if err = data.SetUserData(&conf); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = data.SetUserData(&prev) })
+	return fake
+}
+
 func TestSetAppConfig(t *testing.T) {
 	newConf := &service.AppConfig{
 		AppName:    "GoSearch",
@@ -135,6 +265,100 @@ func BenchmarkDir(b *testing.B) {
 	b.StopTimer() // 暂停计时器，准备索引操作
 }
 
+// BenchmarkDirPolicy 使用与 BenchmarkDir 相同的访问序列, 每访问1000次插入一次递归检索式的扫描(大量只访问一次的文件夹),
+// 比较LRU与W-TinyLFU两种淘汰策略的命中率
+func BenchmarkDirPolicy(b *testing.B) {
+	const scanSize = 2000
+	setupBenchmarkData(b)
+	for _, policy := range []string{service.CachePolicyLRU, service.CachePolicyWTinyLFU} {
+		b.Run(policy, func(b *testing.B) {
+			cache := service.GetPathCache()
+			cache.Configure(&service.AppConfig{CachePolicy: policy, CacheMaxBytes: 512 * utils.KB})
+			contents := make(map[string]*service.DirContent)
+			access := func(path string) {
+				if _, ok := cache.Get(path); ok {
+					return
+				}
+				dirCnt, ok := contents[path]
+				if !ok {
+					dirCnt = service.NewDirContent()
+					if err := dirCnt.GetDirCnt(path); err != nil {
+						// 扫描用的虚拟文件夹不存在, 按一个中等大小的文件夹计算
+						dirCnt = &service.DirContent{Path: path, Size: 4 * utils.KB}
+					}
+					contents[path] = dirCnt
+				}
+				_ = cache.Put(dirCnt)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				cache.ResetStats()
+				for j, idx := range generatedRandomIndices {
+					access(allRealDirectoryPaths[idx])
+					if j%1000 == 0 {
+						for k := 0; k < scanSize; k++ {
+							access(fmt.Sprintf("scan-%d-%d", j, k))
+						}
+					}
+				}
+			}
+			b.StopTimer()
+			b.ReportMetric(cache.Stats().HitRate, "hit-rate")
+		})
+	}
+}
+
+// TestPathCacheConcurrent 并发读写cache, 需要使用 go test -race 运行;
+// 检查各分段的占用与总占用一致, 并且过期的条目由清理协程清除
+func TestPathCacheConcurrent(t *testing.T) {
+	const (
+		workers = 8
+		rounds  = 2000
+		paths   = 300
+	)
+	cache := service.GetPathCache()
+	cache.Configure(&service.AppConfig{CacheMaxBytes: 256 * utils.KB, CacheMaxEntries: 100, CacheTTLSeconds: 1, CacheJanitorSeconds: 1})
+	defer cache.Configure(nil)
+
+	done := make(chan struct{})
+	for w := 0; w < workers; w++ {
+		go func(seed int64) {
+			defer func() { done <- struct{}{} }()
+			r := rand.New(rand.NewSource(seed))
+			for i := 0; i < rounds; i++ {
+				path := fmt.Sprintf("concurrent-%d", r.Intn(paths))
+				switch n := r.Intn(10); {
+				case n < 6:
+					if dirCnt, ok := cache.Get(path); ok && dirCnt.Path != path {
+						t.Errorf("Get(%s) returned %s", path, dirCnt.Path)
+					}
+				case n < 9:
+					_ = cache.Put(&service.DirContent{Path: path, Size: uint64(1+r.Intn(4)) * utils.KB})
+				default:
+					cache.Remove(path)
+				}
+			}
+		}(int64(w))
+	}
+	for w := 0; w < workers; w++ {
+		<-done
+	}
+
+	stats := cache.Stats()
+	if stats.CurSize > stats.MaxSize || stats.Entries > stats.MaxEntries {
+		t.Fatalf("cache over capacity: %+v", stats)
+	}
+	if sum := stats.WindowSize + stats.ProbationSize + stats.ProtectedSize + stats.PinnedSize; sum != stats.CurSize {
+		t.Fatalf("segment sizes %d != cur size %d", sum, stats.CurSize)
+	}
+
+	// 所有条目过期后由清理协程清除
+	time.Sleep(2500 * time.Millisecond)
+	if stats = cache.Stats(); stats.Entries != 0 || stats.CurSize != 0 {
+		t.Fatalf("expired entries not evicted: %+v", stats)
+	}
+}
+
 // 27920599800 ns/op ≈ 27.9 s/op
 func BenchmarkDirWoCache(b *testing.B) {
 	setupBenchmarkData(b)
@@ -159,7 +383,7 @@ func TestParseParams(t *testing.T) {
 	//input := "size: >1k <=10m type: txt .doc .xlsx name: myWord"
 	input := "myWord"
 	currPath := "E:"
-	params, err := service.ParseParams(input, currPath)
+	params, err := service.ParseParams(&dto.SearchParams{Query: input, CurrentPath: currPath})
 	if err != nil {
 		t.Log(err)
 		return
@@ -167,6 +391,68 @@ func TestParseParams(t *testing.T) {
 	t.Log(params)
 }
 
+func TestParseMetaFilters(t *testing.T) {
+	params, err := service.ParseParams(&dto.SearchParams{Query: `IMG camera:Canon taken:2023 artist:"周杰伦" 页数：>20`, CurrentPath: "E:"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if params.Query != "IMG" {
+		t.Errorf("query = %q, want IMG", params.Query)
+	}
+	want := []dto.MetaFilter{
+		{Field: "camera", Value: "Canon"},
+		{Field: "taken", Value: "2023"},
+		{Field: "artist", Value: "周杰伦"},
+		{Field: "pages", Op: ">", Value: "20"},
+	}
+	if fmt.Sprint(params.Metadata) != fmt.Sprint(want) {
+		t.Errorf("metadata = %v, want %v", params.Metadata, want)
+	}
+}
+
+func TestParseNaturalQuery(t *testing.T) {
+	now := time.Date(2025, 6, 18, 10, 0, 0, 0, time.Local) // 周三
+	cases := []struct {
+		query     string
+		types     []string
+		minSize   uint64
+		maxSize   uint64
+		after     string
+		before    string
+		confident bool
+	}{
+		{"上周修改的大于10MB的pdf", []string{"pdf"}, 10*utils.MB + 1, 0, "2025-06-09", "2025-06-15", true},
+		{"images from yesterday", []string{"jpg", "jpeg", "png", "gif", "bmp", "webp", "heic"}, 0, 0, "2025-06-17", "2025-06-17", true},
+		{"excel files under 2 MB", []string{"xls", "xlsx", "csv"}, 0, 2*utils.MB - 1, "", "", true},
+		{"the contract draft I edited last spring", nil, 0, 0, "2024-03-01", "2024-05-31", false},
+	}
+	for _, c := range cases {
+		params, confidence := service.ParseNaturalQuery(c.query, now)
+		if (confidence >= service.NLConfidenceThreshold) != c.confident {
+			t.Errorf("%s: unexpected confidence %.2f", c.query, confidence)
+		}
+		if strings.Join(params.FileType, ",") != strings.Join(c.types, ",") {
+			t.Errorf("%s: file type = %v, want %v", c.query, params.FileType, c.types)
+		}
+		if params.MinSize != c.minSize || params.MaxSize != c.maxSize {
+			t.Errorf("%s: size = [%d, %d], want [%d, %d]", c.query, params.MinSize, params.MaxSize, c.minSize, c.maxSize)
+		}
+		if got := formatDay(params.ModifiedAfter); got != c.after {
+			t.Errorf("%s: modified after = %s, want %s", c.query, got, c.after)
+		}
+		if got := formatDay(params.ModifiedBefore); got != c.before {
+			t.Errorf("%s: modified before = %s, want %s", c.query, got, c.before)
+		}
+	}
+}
+
+func formatDay(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format("2006-01-02")
+}
+
 func TestDirWalk(t *testing.T) {
 	start := time.Now()
 	BaseDir := "D:\\"
@@ -208,7 +494,7 @@ func TestSearchFile(t *testing.T) {
 	)
 
 	dirController := controller.NewDirController()
-	response, err := dirController.SearchItemFromInput(&controller.SearchParams{
+	response, err := dirController.SearchItemFromInput(&dto.SearchParams{
 		Query:       targetInput,
 		CurrentPath: currDirPath,
 		//ModifiedAfter:  "2025-06-21T00:00:00.000Z",
@@ -234,7 +520,7 @@ func TestLLM(t *testing.T) {
 		currDirPath = "E:\\Files"
 	)
 	dirController := controller.NewDirController()
-	if _, err := dirController.SearchItemFromLLM(&controller.SearchParams{
+	if _, err := dirController.SearchItemFromLLM(&dto.SearchParams{
 		Query:       query,
 		CurrentPath: currDirPath,
 	}); err != nil {
@@ -288,10 +574,13 @@ func TestSearchStream(t *testing.T) {
 	)
 	d := controller.NewDirController()
 	//d.setCtx(context.Background())
-	d.SearchItemFromInputInStream(&controller.SearchParams{
+	err := d.SearchItemFromInputInStream(&dto.SearchParams{
 		Query:       query,
 		CurrentPath: currDirPath,
 	})
+	if errors.Is(err, controller.ErrNoContext) {
+		t.Skip("needs a running Wails application")
+	}
 }
 
 func TestSetConfigDir(t *testing.T) {
@@ -302,3 +591,1689 @@ func TestSetConfigDir(t *testing.T) {
 func TestAbc(t *testing.T) {
 
 }
+
+func TestValidateFileName(t *testing.T) {
+	cases := []struct {
+		os, name string
+		ok       bool
+	}{
+		{utils.WINDOWS, "report.docx", true},
+		{utils.WINDOWS, "CON", false},
+		{utils.WINDOWS, "lpt1.txt", false},
+		{utils.WINDOWS, "a?b", false},
+		{utils.WINDOWS, "trailing.", false},
+		{utils.LINUX, "a:b", true},
+		{utils.LINUX, "a/b", false},
+		{utils.LINUX, "..", false},
+		{utils.LINUX, strings.Repeat("a", utils.MaxNameLength+1), false},
+	}
+	for _, c := range cases {
+		if err := utils.ValidateFileName(c.os, c.name); (err == nil) != c.ok {
+			t.Errorf("ValidateFileName(%s, %q) = %v", c.os, c.name, err)
+		}
+	}
+}
+
+func TestBatchRename(t *testing.T) {
+	service.GetSysInfoInstance()
+	dir := t.TempDir()
+	var paths []string
+	for _, name := range []string{"a.txt", "b.txt"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	// 互换名称
+	swap := &dto.BatchRenameParams{Paths: paths, Rules: []dto.RenameRule{
+		{Type: service.RenameRuleReplace, Find: "a", Replace: "x"},
+		{Type: service.RenameRuleReplace, Find: "b", Replace: "a"},
+		{Type: service.RenameRuleReplace, Find: "x", Replace: "b"},
+	}}
+	if _, err := service.BatchRename(swap); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "a.txt")); string(data) != "b.txt" {
+		t.Fatalf("a.txt contains %q after swap", data)
+	}
+
+	// 新名称重复时不做任何修改
+	dup := &dto.BatchRenameParams{Paths: paths, Rules: []dto.RenameRule{{Type: service.RenameRuleSequence, Position: "replace", Step: -1, Start: 1}, {Type: service.RenameRuleReplace, Find: "0", Replace: "1"}}}
+	previews, err := service.BatchRename(dup)
+	if !errors.Is(err, service.ErrRenameConflicts) || previews[0].Conflict == "" || previews[1].Conflict == "" {
+		t.Fatalf("expected conflicts, got %v", err)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "b.txt")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFuseResults(t *testing.T) {
+	var (
+		now    = time.Now()
+		old    = now.AddDate(-1, 0, 0)
+		after  = now.AddDate(0, -1, 0)
+		report = &service.FileSystemEntry{Path: "/data/report.pdf", Name: "report.pdf", Size: 2048, ModTime: now}
+	)
+	keywordItems := []*service.FileSystemEntry{report}
+	vectorHits := []*service.VectorHit{
+		{Entry: &service.FileSystemEntry{Path: "/data/summary.pdf", Name: "summary.pdf", Size: 4096, ModTime: now}},
+		{Entry: &service.FileSystemEntry{Path: "/data/report.pdf", Name: "report.pdf", Size: 2048, ModTime: now}},
+		{Entry: &service.FileSystemEntry{Path: "/data/notes.txt", Name: "notes.txt", Size: 4096, ModTime: now}},
+		{Entry: &service.FileSystemEntry{Path: "/data/tiny.pdf", Name: "tiny.pdf", Size: 10, ModTime: now}},
+		{Entry: &service.FileSystemEntry{Path: "/data/archive.pdf", Name: "archive.pdf", Size: 4096, ModTime: old}},
+		{Entry: &service.FileSystemEntry{Path: "/data/reports", Name: "reports.pdf", IsDir: true, ModTime: now}},
+	}
+	params := &service.SearchParams{FileType: []string{"pdf"}, MinSize: 1024, ModifiedAfter: &after}
+	res, err := service.FuseResults(params, "report", keywordItems, vectorHits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, entry := range res {
+		got = append(got, entry.Path)
+	}
+	// 两路都命中的排在最前, 类型、大小、时间不满足的向量结果被过滤
+	want := []string{"/data/report.pdf", "/data/summary.pdf"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("FuseResults = %v, want %v", got, want)
+	}
+
+	// 没有过滤条件时保留全部向量结果
+	res, err = service.FuseResults(&service.SearchParams{}, "report", keywordItems, vectorHits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res) != len(vectorHits) || res[0].Path != report.Path {
+		t.Fatalf("FuseResults without filters returned %d entries", len(res))
+	}
+}
+
+func TestCreateItem(t *testing.T) {
+	service.GetSysInfoInstance()
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "a"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	// 多级路径中新建的最上层文件夹为 a/b
+	result, err := service.CreateItem(dir, "a/b/c/note.txt", service.CreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Path != filepath.Join(dir, "a", "b", "c", "note.txt") || result.Created != filepath.Join(dir, "a", "b") {
+		t.Fatalf("CreateItem = %+v", result)
+	}
+	// 同名时自动重命名, 没有新建中间文件夹
+	result, err = service.CreateItem(dir, "a/b/c/note.txt", service.CreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(dir, "a", "b", "c", "note (2).txt"); result.Path != want || result.Created != want {
+		t.Fatalf("CreateItem = %+v", result)
+	}
+	if _, err = service.CreateItem(dir, "a/b/c/note.txt", service.CreateOptions{KeepName: true}); !errors.Is(err, os.ErrExist) {
+		t.Fatalf("expected ErrExist, got %v", err)
+	}
+}
+
+func TestJournal(t *testing.T) {
+	var (
+		dir     = t.TempDir()
+		journal = &service.Journal{}
+		source  = filepath.Join(dir, "a.txt")
+		target  = filepath.Join(dir, "sub", "b.txt")
+	)
+	if err := os.WriteFile(source, []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Dir(target), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(source, target); err != nil {
+		t.Fatal(err)
+	}
+	journal.Record(service.JournalMove, source, target, "")
+
+	if _, err := journal.Undo(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(source); err != nil {
+		t.Fatalf("undo did not move back: %v", err)
+	}
+	if _, err := journal.Undo(); !errors.Is(err, service.ErrNothingToUndo) {
+		t.Fatalf("expected ErrNothingToUndo, got %v", err)
+	}
+
+	// 返回的日志是副本, 之后的重做不会修改它
+	history := journal.History()
+	if len(history) != 1 || !history[0].Undone {
+		t.Fatalf("History = %+v", history)
+	}
+	history[0].Source = filepath.Join(dir, "other.txt")
+	if _, err := journal.Redo(); err != nil {
+		t.Fatal(err)
+	}
+	if !history[0].Undone || journal.History()[0].Source != source {
+		t.Fatal("History returned entries shared with the journal")
+	}
+	if _, err := os.Stat(target); err != nil {
+		t.Fatalf("redo did not move again: %v", err)
+	}
+
+	// 操作之后被修改过的项目不能撤销, 也不做任何修改
+	if err := os.WriteFile(target, []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := journal.Undo(); !errors.Is(err, service.ErrJournalConflict) {
+		t.Fatalf("expected ErrJournalConflict, got %v", err)
+	}
+	if _, err := os.Stat(target); err != nil {
+		t.Fatal(err)
+	}
+
+	// 原位置已被占用时不能撤销
+	journal.Record(service.JournalRename, source, target, "")
+	if err := os.WriteFile(source, []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := journal.Undo(); !errors.Is(err, service.ErrJournalConflict) {
+		t.Fatalf("expected ErrJournalConflict, got %v", err)
+	}
+}
+
+func TestJournalCrossDevice(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("named pipes are not files on windows")
+	}
+	var (
+		journal = &service.Journal{}
+		source  = filepath.Join(t.TempDir(), "docs")
+		target  = filepath.Join(otherDeviceDir(t), "docs")
+	)
+	// 文件夹已被移动到另一个设备上, 其中有无法复制的命名管道
+	if err := os.MkdirAll(filepath.Join(target, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{"a.txt": "a", "sub/b.txt": "b"} {
+		if err := os.WriteFile(filepath.Join(target, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mkfifo(t, filepath.Join(target, "sub", "pipe"))
+	journal.Record(service.JournalMove, source, target, "")
+	before := readTree(t, target)
+
+	// 撤销失败时两边都不丢失内容
+	if _, err := journal.Undo(); err == nil {
+		t.Fatal("undoing a move with a named pipe across devices should fail")
+	}
+	if after := readTree(t, target); fmt.Sprint(after) != fmt.Sprint(before) {
+		t.Fatalf("target changed: %v, want %v", after, before)
+	}
+	if _, err := os.Lstat(source); !os.IsNotExist(err) {
+		t.Fatalf("partial copy left at %s: %v", source, err)
+	}
+
+	if err := os.Remove(filepath.Join(target, "sub", "pipe")); err != nil {
+		t.Fatal(err)
+	}
+	before = readTree(t, target)
+	if _, err := journal.Undo(); err != nil {
+		t.Fatal(err)
+	}
+	if after := readTree(t, source); fmt.Sprint(after) != fmt.Sprint(before) {
+		t.Fatalf("source %v, want %v", after, before)
+	}
+	if _, err := os.Lstat(target); !os.IsNotExist(err) {
+		t.Fatalf("target still exists: %v", err)
+	}
+}
+
+// waitTransfer 等待任务满足 done, 超时时测试失败
+func waitTransfer(t *testing.T, id string, done func(job *service.TransferJob) bool) *service.TransferJob {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		for _, job := range service.GetTransferManager().Jobs() {
+			if job.ID == id && done(job) {
+				return job
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("transfer %s timed out", id)
+	return nil
+}
+
+func TestTransferConflictPolicies(t *testing.T) {
+	manager := service.GetTransferManager()
+	for _, policy := range []string{service.ConflictSkip, service.ConflictOverwrite, service.ConflictKeepBoth, service.ConflictAsk} {
+		var (
+			srcDir    = t.TempDir()
+			targetDir = t.TempDir()
+			source    = filepath.Join(srcDir, "a.txt")
+			target    = filepath.Join(targetDir, "a.txt")
+		)
+		if err := os.WriteFile(source, []byte("new"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(target, []byte("old"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		job, err := manager.Submit(service.TransferCopy, []string{source}, targetDir, policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if policy == service.ConflictAsk {
+			// 任务等待用户选择, 选择保留两者
+			job = waitTransfer(t, job.ID, func(job *service.TransferJob) bool { return job.Status == service.TransferWaiting })
+			if job.Conflict == nil || job.Conflict.Target != target {
+				t.Fatalf("conflict = %+v", job.Conflict)
+			}
+			if err = manager.ResolveConflict(job.ID, service.ConflictAsk, false); err == nil {
+				t.Fatal("ResolveConflict accepted ask")
+			}
+			if err = manager.ResolveConflict(job.ID, service.ConflictKeepBoth, false); err != nil {
+				t.Fatal(err)
+			}
+		}
+		job = waitTransfer(t, job.ID, (*service.TransferJob).Finished)
+		if job.Status != service.TransferDone {
+			t.Fatalf("%s: status %s, error %s", policy, job.Status, job.Error)
+		}
+
+		old, _ := os.ReadFile(target)
+		copied, _ := os.ReadFile(filepath.Join(targetDir, "a (2).txt"))
+		switch policy {
+		case service.ConflictSkip:
+			if string(old) != "old" || job.Skipped != 1 {
+				t.Fatalf("skip: target %q, skipped %d", old, job.Skipped)
+			}
+		case service.ConflictOverwrite:
+			if string(old) != "new" {
+				t.Fatalf("overwrite: target %q", old)
+			}
+		default:
+			if string(old) != "old" || string(copied) != "new" {
+				t.Fatalf("%s: target %q, copy %q", policy, old, copied)
+			}
+		}
+		if data, _ := os.ReadFile(source); string(data) != "new" {
+			t.Fatalf("%s: source changed to %q", policy, data)
+		}
+	}
+}
+
+func TestTransferOverwrite(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("only the freedesktop.org trash can be redirected to a temporary folder")
+	}
+	manager := service.GetTransferManager()
+	transfer := func(op, source, targetDir string) *service.TransferJob {
+		t.Helper()
+		job, err := manager.Submit(op, []string{source}, targetDir, service.ConflictOverwrite)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return waitTransfer(t, job.ID, (*service.TransferJob).Finished)
+	}
+
+	t.Run("replace folder", func(t *testing.T) {
+		// 文件替换同名文件夹, 文件夹移到回收站, 与移动一起撤销
+		var (
+			srcDir    = t.TempDir()
+			targetDir = t.TempDir()
+			source    = filepath.Join(srcDir, "docs")
+			target    = filepath.Join(targetDir, "docs")
+		)
+		if err := os.WriteFile(source, []byte("new"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.MkdirAll(target, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(target, "x.txt"), []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		before := readTree(t, targetDir)
+		if job := transfer(service.TransferMove, source, targetDir); job.Status != service.TransferDone {
+			t.Fatalf("status %s, error %s", job.Status, job.Error)
+		}
+		if data, err := os.ReadFile(target); err != nil || string(data) != "new" {
+			t.Fatalf("target %q, %v", data, err)
+		}
+		entry, err := service.GetJournal().Undo()
+		if err != nil || entry.Op != service.JournalReplace {
+			t.Fatalf("undo %+v, %v", entry, err)
+		}
+		if after := readTree(t, targetDir); fmt.Sprint(after) != fmt.Sprint(before) {
+			t.Fatalf("after undo %v, want %v", after, before)
+		}
+		if data, err := os.ReadFile(source); err != nil || string(data) != "new" {
+			t.Fatalf("source %q, %v", data, err)
+		}
+	})
+	t.Run("restore on failure", func(t *testing.T) {
+		// 复制被取消时恢复被替换的文件夹
+		defer func(size int) { service.TransferBufferSize = size }(service.TransferBufferSize)
+		service.TransferBufferSize = 1
+		var (
+			srcDir    = t.TempDir()
+			targetDir = t.TempDir()
+			source    = filepath.Join(srcDir, "big.bin")
+			target    = filepath.Join(targetDir, "big.bin")
+		)
+		if err := os.WriteFile(source, make([]byte, 4<<20), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.MkdirAll(target, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(target, "x.txt"), []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		before := readTree(t, targetDir)
+		job, err := manager.Submit(service.TransferCopy, []string{source}, targetDir, service.ConflictOverwrite)
+		if err != nil {
+			t.Fatal(err)
+		}
+		waitTransfer(t, job.ID, func(job *service.TransferJob) bool { return job.DoneBytes > 0 })
+		if err = manager.Cancel(job.ID); err != nil {
+			t.Fatal(err)
+		}
+		if job = waitTransfer(t, job.ID, (*service.TransferJob).Finished); job.Status != service.TransferCanceled {
+			t.Fatalf("status %s", job.Status)
+		}
+		if after := readTree(t, targetDir); fmt.Sprint(after) != fmt.Sprint(before) {
+			t.Fatalf("replaced folder was not restored: %v, want %v", after, before)
+		}
+	})
+}
+
+// otherDeviceDir 在另一个设备上创建临时文件夹, 可通过 GOSEARCH_TEST_OTHER_DEVICE 指定, 默认使用 /dev/shm
+func otherDeviceDir(t *testing.T) string {
+	t.Helper()
+	otherDevice := os.Getenv("GOSEARCH_TEST_OTHER_DEVICE")
+	if otherDevice == "" {
+		otherDevice = "/dev/shm"
+	}
+	if info, err := os.Stat(otherDevice); err != nil || !info.IsDir() {
+		t.Skip("no directory on another device")
+	}
+	dir, err := os.MkdirTemp(otherDevice, "gosearch-test-")
+	if err != nil {
+		t.Skip(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	return dir
+}
+
+// mkfifo 创建无法被复制的命名管道
+func mkfifo(t *testing.T, path string) {
+	t.Helper()
+	if err := exec.Command("mkfifo", path).Run(); err != nil {
+		t.Skip("mkfifo unavailable:", err)
+	}
+}
+
+// readTree 读取文件夹中所有普通文件的内容, key 为相对路径, 其他类型的文件记为其类型
+func readTree(t *testing.T, root string) map[string]string {
+	t.Helper()
+	tree := make(map[string]string)
+	err := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil || path == root {
+			return err
+		}
+		rel, _ := filepath.Rel(root, path)
+		switch info, _ := d.Info(); {
+		case d.IsDir():
+			tree[rel] = "dir"
+		case info.Mode().IsRegular():
+			data, err := os.ReadFile(path)
+			tree[rel] = string(data)
+			return err
+		default:
+			tree[rel] = info.Mode().Type().String()
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tree
+}
+
+func TestTransferCrossDevice(t *testing.T) {
+	targetDir := otherDeviceDir(t)
+	source := filepath.Join(t.TempDir(), "docs")
+	if err := os.MkdirAll(filepath.Join(source, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(source, "sub", "a.txt"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	job, err := service.GetTransferManager().Submit(service.TransferMove, []string{source}, targetDir, service.ConflictAsk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	job = waitTransfer(t, job.ID, (*service.TransferJob).Finished)
+	if job.Status != service.TransferDone {
+		t.Fatalf("status %s, error %s", job.Status, job.Error)
+	}
+	if data, err := os.ReadFile(filepath.Join(targetDir, "docs", "sub", "a.txt")); err != nil || string(data) != "a" {
+		t.Fatalf("moved file = %q, %v", data, err)
+	}
+	if _, err = os.Lstat(source); !os.IsNotExist(err) {
+		t.Fatalf("source still exists: %v", err)
+	}
+
+	// 单个项目的移动同样在跨设备时复制后删除
+	back := filepath.Join(filepath.Dir(source), "docs")
+	if err = service.MovePath(filepath.Join(targetDir, "docs"), back); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(filepath.Join(back, "sub", "a.txt")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMovePathCrossDevice(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("named pipes are not files on windows")
+	}
+	targetDir := otherDeviceDir(t)
+	source := filepath.Join(t.TempDir(), "docs")
+	if err := os.MkdirAll(filepath.Join(source, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{"a.txt": "a", "sub/b.txt": "b", "sub/c.txt": "c"} {
+		if err := os.WriteFile(filepath.Join(source, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mkfifo(t, filepath.Join(source, "sub", "pipe"))
+	before := readTree(t, source)
+
+	// 有无法复制的项目时移动失败, 源文件夹保持完整, 目标中不留下副本
+	target := filepath.Join(targetDir, "docs")
+	if err := service.MovePath(source, target); err == nil {
+		t.Fatal("moving a folder with a named pipe across devices should fail")
+	}
+	if after := readTree(t, source); fmt.Sprint(after) != fmt.Sprint(before) {
+		t.Fatalf("source changed: %v, want %v", after, before)
+	}
+	if _, err := os.Lstat(target); !os.IsNotExist(err) {
+		t.Fatalf("target left behind: %v", err)
+	}
+
+	// 全部可以复制时移动成功
+	if err := os.Remove(filepath.Join(source, "sub", "pipe")); err != nil {
+		t.Fatal(err)
+	}
+	before = readTree(t, source)
+	if err := service.MovePath(source, target); err != nil {
+		t.Fatal(err)
+	}
+	if after := readTree(t, target); fmt.Sprint(after) != fmt.Sprint(before) {
+		t.Fatalf("target %v, want %v", after, before)
+	}
+	if _, err := os.Lstat(source); !os.IsNotExist(err) {
+		t.Fatalf("source still exists: %v", err)
+	}
+}
+
+// fakeOperator 直接操作文件的 FileOperator, 删除的项目移到测试自己的回收站文件夹
+type fakeOperator struct {
+	trashDir string
+	trashed  map[string]string // key: 回收站中的标识, value: 原路径
+}
+
+func (o *fakeOperator) RenameItem(path string, newName string) error {
+	return os.Rename(path, filepath.Join(filepath.Dir(path), newName))
+}
+
+func (o *fakeOperator) MoveItem(path string, targetDir string) error {
+	return service.MovePath(path, filepath.Join(targetDir, filepath.Base(path)))
+}
+
+func (o *fakeOperator) CreateFolder(dirPath string, dirName string) error {
+	return os.Mkdir(filepath.Join(dirPath, dirName), 0755)
+}
+
+func (o *fakeOperator) DeleteItem(path string) (*service.TrashItem, error) {
+	id := fmt.Sprintf("%d", len(o.trashed))
+	if err := os.Rename(path, filepath.Join(o.trashDir, id)); err != nil {
+		return nil, err
+	}
+	o.trashed[id] = path
+	return &service.TrashItem{ID: id, Name: filepath.Base(path), OriginalPath: path}, nil
+}
+
+func (o *fakeOperator) DeletePermanently(path string, recursive bool) error {
+	if recursive {
+		return os.RemoveAll(path)
+	}
+	return os.Remove(path)
+}
+
+func (o *fakeOperator) RestoreTrashItem(id string) (string, error) {
+	path, ok := o.trashed[id]
+	if !ok {
+		return "", fmt.Errorf("trash item %s not found", id)
+	}
+	if _, err := os.Lstat(path); err == nil {
+		return "", fmt.Errorf("%s already exists", path)
+	}
+	return path, os.Rename(filepath.Join(o.trashDir, id), path)
+}
+
+func TestFileAgent(t *testing.T) {
+	base := filepath.Join(t.TempDir(), "work")
+	outside := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(base, "docs"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{"docs/a.txt": "a", "docs/b.png": "b"} {
+		if err := os.WriteFile(filepath.Join(base, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(outside, "secret.txt"), []byte("s"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(base, "link")); err != nil {
+		t.Skip("symlinks unavailable:", err)
+	}
+	before := readTree(t, base)
+
+	// 第一轮规划所有操作, 第二轮输出总结; 之后的子测试重新规划时重复这两轮
+	steps := toolCalls(
+		[2]string{"create_folder", `{"path":".","name":"images"}`},
+		[2]string{"rename_item", `{"path":"docs","new_name":"papers"}`},
+		// docs 已在计划中重命名为 papers, 其中的文件按新路径引用
+		[2]string{"move_item", `{"path":"papers/b.png","target_dir":"images"}`},
+		[2]string{"delete_item", `{"path":"papers/a.txt"}`},
+		// 符号链接指向工作目录之外, 不能操作
+		[2]string{"move_item", `{"path":"link/secret.txt","target_dir":"."}`},
+	)
+	fake := startFakeLLM(t, service.UData{}, func(call int) (int, string) {
+		if call%2 == 1 {
+			return http.StatusOK, steps
+		}
+		return http.StatusOK, "整理完成"
+	})
+	agent := service.GetFileAgent()
+	plan, err := agent.Plan(context.Background(), "把图片放进 images", base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ops []string
+	for _, step := range plan.Steps {
+		rel, _ := filepath.Rel(base, step.Source)
+		ops = append(ops, step.Op+" "+filepath.ToSlash(rel))
+	}
+	if got := strings.Join(ops, ", "); got != "create_folder ., rename docs, move papers/b.png, delete papers/a.txt" {
+		t.Fatalf("steps: %s", got)
+	}
+	if plan.Summary != "整理完成" || fake.calls() != 2 {
+		t.Fatalf("summary %q after %d calls", plan.Summary, fake.calls())
+	}
+	fake.lock.Lock()
+	toolResults := fake.requests[1]
+	fake.lock.Unlock()
+	if !strings.Contains(toolResults, "outside the working directory") {
+		t.Fatalf("the symlink escaping the working directory was not rejected: %s", toolResults)
+	}
+
+	operator := &fakeOperator{trashDir: t.TempDir(), trashed: make(map[string]string)}
+	t.Run("execute and undo", func(t *testing.T) {
+		executed, err := agent.Execute(plan.ID, operator)
+		if err != nil || executed.Status != service.PlanExecuted {
+			t.Fatalf("status %s, %v", executed.Status, err)
+		}
+		if data, err := os.ReadFile(filepath.Join(base, "images", "b.png")); err != nil || string(data) != "b" {
+			t.Fatalf("moved file %q, %v", data, err)
+		}
+		if _, err = os.Lstat(filepath.Join(base, "papers", "a.txt")); !os.IsNotExist(err) {
+			t.Fatalf("deleted file still exists: %v", err)
+		}
+		if _, err = agent.Execute(plan.ID, operator); !errors.Is(err, service.ErrPlanNotFound) {
+			t.Fatalf("executing twice: %v", err)
+		}
+
+		undone, err := agent.Undo(plan.ID, operator)
+		if err != nil || undone.Status != service.PlanUndone {
+			t.Fatalf("status %s, %v", undone.Status, err)
+		}
+		if after := readTree(t, base); fmt.Sprint(after) != fmt.Sprint(before) {
+			t.Fatalf("after undo %v, want %v", after, before)
+		}
+		if _, err = agent.Undo(plan.ID, operator); err == nil {
+			t.Fatal("undoing twice should fail")
+		}
+	})
+	t.Run("reject", func(t *testing.T) {
+		pending, err := agent.Plan(context.Background(), "把图片放进 images", base)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = agent.Reject(pending.ID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = agent.Execute(pending.ID, operator); !errors.Is(err, service.ErrPlanNotFound) {
+			t.Fatalf("executing a rejected plan: %v", err)
+		}
+	})
+	t.Run("expired", func(t *testing.T) {
+		pending, err := agent.Plan(context.Background(), "把图片放进 images", base)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func(ttl time.Duration) { service.AgentPlanTTL = ttl }(service.AgentPlanTTL)
+		service.AgentPlanTTL = 0
+		if _, err = agent.Execute(pending.ID, operator); !errors.Is(err, service.ErrPlanExpired) {
+			t.Fatalf("executing an expired plan: %v", err)
+		}
+		if after := readTree(t, base); fmt.Sprint(after) != fmt.Sprint(before) {
+			t.Fatalf("expired plan changed files: %v", after)
+		}
+	})
+}
+
+func TestTransferCancel(t *testing.T) {
+	// 每次只复制一个字节, 保证取消时文件还没有写完
+	defer func(size int) { service.TransferBufferSize = size }(service.TransferBufferSize)
+	service.TransferBufferSize = 1
+
+	var (
+		srcDir    = t.TempDir()
+		targetDir = t.TempDir()
+		source    = filepath.Join(srcDir, "big.bin")
+	)
+	if err := os.WriteFile(source, make([]byte, 4<<20), 0644); err != nil {
+		t.Fatal(err)
+	}
+	manager := service.GetTransferManager()
+	job, err := manager.Submit(service.TransferCopy, []string{source}, targetDir, service.ConflictAsk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitTransfer(t, job.ID, func(job *service.TransferJob) bool { return job.DoneBytes > 0 })
+	if err = manager.Cancel(job.ID); err != nil {
+		t.Fatal(err)
+	}
+	job = waitTransfer(t, job.ID, (*service.TransferJob).Finished)
+	if job.Status != service.TransferCanceled {
+		t.Fatalf("status %s", job.Status)
+	}
+	// 未写完的临时文件与目标文件都不应留下
+	entries, err := os.ReadDir(targetDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("target dir contains %s after cancel", entries[0].Name())
+	}
+}
+
+func TestRenameItem(t *testing.T) {
+	service.GetSysInfoInstance()
+	var (
+		root = t.TempDir()
+		dir  = filepath.Join(root, "dir")
+		path = filepath.Join(dir, "a.txt")
+	)
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// 新名称不能包含路径或指向上级目录, 防止把项目移出原文件夹
+	for _, name := range []string{"..", ".", "../evil.txt", "sub/b.txt", "/tmp/evil.txt", ""} {
+		if _, err := service.RenameItem(path, name, false); err == nil {
+			t.Errorf("RenameItem accepted %q", name)
+		}
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := os.ReadDir(root); len(entries) != 1 {
+		t.Fatalf("rename created items outside the folder: %d entries", len(entries))
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "b.txt"), []byte("b"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.RenameItem(path, "b.txt", false); !errors.Is(err, service.ErrTargetExists) {
+		t.Fatalf("expected ErrTargetExists, got %v", err)
+	}
+	result, err := service.RenameItem(path, "c.txt", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.NewPath != filepath.Join(dir, "c.txt") || result.Replaced != nil {
+		t.Fatalf("RenameItem = %+v", result)
+	}
+}
+
+func TestRenameReplaceJournal(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("uses an isolated freedesktop trash")
+	}
+	service.GetSysInfoInstance()
+	var (
+		dir     = t.TempDir()
+		path    = filepath.Join(dir, "a.txt")
+		target  = filepath.Join(dir, "b.txt")
+		journal = &service.Journal{}
+	)
+	t.Setenv("XDG_DATA_HOME", filepath.Join(dir, ".data"))
+	if err := os.WriteFile(path, []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(target, []byte("b"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	result, err := service.RenameItem(path, "b.txt", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Replaced == nil {
+		t.Fatal("replaced file was not moved to trash")
+	}
+	// 替换与重命名记录为一个操作, 一次撤销同时恢复两个文件
+	journal.RecordRename(result)
+	if history := journal.History(); len(history) != 1 || history[0].Op != service.JournalReplace {
+		t.Fatalf("History = %+v", history)
+	}
+	if _, err = journal.Undo(); err != nil {
+		t.Fatal(err)
+	}
+	a, _ := os.ReadFile(path)
+	b, _ := os.ReadFile(target)
+	if string(a) != "a" || string(b) != "b" {
+		t.Fatalf("after undo a.txt = %q, b.txt = %q", a, b)
+	}
+	if _, err = journal.Redo(); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ = os.ReadFile(target); string(b) != "a" {
+		t.Fatalf("after redo b.txt = %q", b)
+	}
+	if _, err = os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("a.txt still exists after redo: %v", err)
+	}
+}
+
+func TestThumbnail(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("uses an isolated freedesktop thumbnail cache")
+	}
+	var (
+		dir      = t.TempDir()
+		cacheDir = filepath.Join(dir, ".cache", "thumbnails", service.ThumbnailNormal)
+		source   = filepath.Join(dir, "photo.png")
+		foreign  = filepath.Join(cacheDir, strings.Repeat("0", 32)+".png")
+	)
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(dir, ".cache"))
+	defer func(size int64, every int) {
+		service.ThumbnailCacheSize, service.ThumbnailPruneEvery = size, every
+	}(service.ThumbnailCacheSize, service.ThumbnailPruneEvery)
+
+	var img bytes.Buffer
+	if err := png.Encode(&img, image.NewRGBA(image.Rect(0, 0, 600, 300))); err != nil {
+		t.Fatal(err)
+	}
+	// 其他程序生成的缩略图, 没有 Software 文本块
+	if err := os.MkdirAll(cacheDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{source, foreign} {
+		if err := os.WriteFile(path, img.Bytes(), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	thumbService := service.GetThumbnailService()
+	request := func() *service.Thumbnail {
+		t.Helper()
+		deadline := time.Now().Add(10 * time.Second)
+		for time.Now().Before(deadline) {
+			thumbs, err := thumbService.Request([]string{source}, service.ThumbnailNormal)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if thumbs[0].URL != "" || thumbs[0].Failed {
+				return thumbs[0]
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatal("thumbnail timed out")
+		return nil
+	}
+	thumb := request()
+	if thumb.Failed {
+		t.Fatal("thumbnail failed")
+	}
+	recorder := httptest.NewRecorder()
+	thumbService.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, thumb.URL, nil))
+	decoded, err := png.Decode(recorder.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bounds := decoded.Bounds(); bounds.Dx() != 128 || bounds.Dy() != 64 {
+		t.Fatalf("thumbnail size %v", bounds)
+	}
+	recorder = httptest.NewRecorder()
+	thumbService.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, service.ThumbnailURLPrefix+"normal/../photo.png", nil))
+	if recorder.Code != http.StatusNotFound {
+		t.Fatalf("ServeHTTP outside the cache returned %d", recorder.Code)
+	}
+
+	// 超出缓存上限时只删除本程序生成的缩略图
+	service.ThumbnailCacheSize, service.ThumbnailPruneEvery = 1, 1
+	if err = os.Chtimes(source, time.Now(), time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	request()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		entries, _ := os.ReadDir(cacheDir)
+		if len(entries) == 1 && entries[0].Name() == filepath.Base(foreign) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("cache contains %d entries after prune", len(entries))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRerankResults(t *testing.T) {
+	dir := t.TempDir()
+	var items []*service.FileSystemEntry
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		items = append(items, &service.FileSystemEntry{Path: path, Name: name, Size: 5, ModTime: time.Now()})
+	}
+	rerank := func(t *testing.T, conf service.UData, output string) (*service.RerankResult, string, *fakeLLM) {
+		t.Helper()
+		fake := startFakeLLM(t, conf, func(int) (int, string) { return http.StatusOK, output })
+		var streamed strings.Builder
+		result, err := service.RerankResults(context.Background(), "最新的文件", items, func(chunk string) {
+			streamed.WriteString(chunk)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result, streamed.String(), fake
+	}
+	names := func(entries []*service.FileSystemEntry) string {
+		var res []string
+		for _, entry := range entries {
+			res = append(res, entry.Name)
+		}
+		return strings.Join(res, ",")
+	}
+
+	t.Run("ranking", func(t *testing.T) {
+		// 排序部分不输出, 被省略的候选按原顺序追加
+		result, streamed, _ := rerank(t, service.UData{}, "<ranking>3,1</ranking>\nc.txt 最相关")
+		if !result.Reranked || names(result.Items) != "c.txt,a.txt,b.txt" {
+			t.Fatalf("reranked %v, items %s", result.Reranked, names(result.Items))
+		}
+		if result.Explanation != "c.txt 最相关" || strings.TrimSpace(streamed) != "c.txt 最相关" {
+			t.Fatalf("explanation %q, streamed %q", result.Explanation, streamed)
+		}
+	})
+	t.Run("missing end tag", func(t *testing.T) {
+		// 没有结束标签时保持原顺序, 缓存的内容在结束时全部输出
+		output := "<ranking>2,1 缺少结束标签"
+		result, streamed, _ := rerank(t, service.UData{}, output)
+		if result.Reranked || names(result.Items) != "a.txt,b.txt,c.txt" || streamed != output {
+			t.Fatalf("reranked %v, items %s, streamed %q", result.Reranked, names(result.Items), streamed)
+		}
+	})
+	t.Run("no ranking", func(t *testing.T) {
+		output := "无法判断哪个文件更相关"
+		result, streamed, _ := rerank(t, service.UData{}, output)
+		if result.Reranked || streamed != output {
+			t.Fatalf("reranked %v, streamed %q", result.Reranked, streamed)
+		}
+	})
+	t.Run("budget", func(t *testing.T) {
+		// 预算放不下任何候选时不请求模型
+		result, _, fake := rerank(t, service.UData{RerankTokenBudget: 1}, "<ranking>1</ranking>")
+		if result.Reranked || fake.calls() != 0 || names(result.Items) != "a.txt,b.txt,c.txt" {
+			t.Fatalf("reranked %v with %d calls", result.Reranked, fake.calls())
+		}
+	})
+}
+
+func TestLLMRetry(t *testing.T) {
+	delay := service.LLMRetryDelay
+	service.LLMRetryDelay = time.Millisecond
+	t.Cleanup(func() { service.LLMRetryDelay = delay })
+	output := `{"Query":"report"}`
+
+	t.Run("transient", func(t *testing.T) {
+		// 503 属于临时错误, 重试后成功
+		fake := startFakeLLM(t, service.UData{}, func(call int) (int, string) {
+			if call == 1 {
+				return http.StatusServiceUnavailable, "overloaded"
+			}
+			return http.StatusOK, output
+		})
+		params, err := service.ParseParamsFromLLM(context.Background(), "qzx retry transient")
+		if err != nil || params.Query != "report" || fake.calls() != 2 {
+			t.Fatalf("params %+v, err %v, calls %d", params, err, fake.calls())
+		}
+		// 相同的查询使用缓存, 不再请求模型
+		if _, err = service.ParseParamsFromLLM(context.Background(), "qzx retry transient"); err != nil || fake.calls() != 2 {
+			t.Fatalf("cached query: err %v, calls %d", err, fake.calls())
+		}
+	})
+	t.Run("client error", func(t *testing.T) {
+		fake := startFakeLLM(t, service.UData{}, func(int) (int, string) { return http.StatusBadRequest, "bad request" })
+		_, err := service.ParseParamsFromLLM(context.Background(), "qzx retry client error")
+		var statusErr *service.LLMStatusError
+		if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusBadRequest || fake.calls() != 1 {
+			t.Fatalf("err %v, calls %d", err, fake.calls())
+		}
+	})
+	t.Run("exhausted", func(t *testing.T) {
+		fake := startFakeLLM(t, service.UData{}, func(int) (int, string) { return http.StatusBadGateway, "bad gateway" })
+		if _, err := service.ParseParamsFromLLM(context.Background(), "qzx retry exhausted"); err == nil || fake.calls() != service.LLMRetryTimes {
+			t.Fatalf("err %v, calls %d", err, fake.calls())
+		}
+	})
+	t.Run("config change", func(t *testing.T) {
+		// 请求进行中修改配置, 每次请求使用各自的配置快照
+		startFakeLLM(t, service.UData{}, func(int) (int, string) { return http.StatusOK, output })
+		data, _ := service.GetUserData()
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(2)
+			go func(i int) {
+				defer wg.Done()
+				_, _ = service.ParseParamsFromLLM(context.Background(), fmt.Sprintf("qzx retry config %d", i))
+			}(i)
+			go func(i int) {
+				defer wg.Done()
+				conf := *data.Masked()
+				conf.Model = fmt.Sprintf("fake-model-%d", i%2)
+				_ = data.SetUserData(&conf)
+			}(i)
+		}
+		wg.Wait()
+	})
+}
+
+func TestSecretStore(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the keyring can only be disabled through D-Bus on linux")
+	}
+	bootConf, _, err := service.EnsureConfigInitialized()
+	if err != nil {
+		t.Fatal(err)
+	}
+	secretsPath := filepath.Join(bootConf.CustomConfigDir, utils.SecretFileName)
+	const secret = "sk-test-0123456789abcdef"
+
+	store := service.GetSecretStore()
+	if store.Name() != "encrypted file" {
+		t.Fatalf("store %s, want the encrypted file fallback", store.Name())
+	}
+	t.Run("round trip", func(t *testing.T) {
+		if err := store.Set("test_secret", secret); err != nil {
+			t.Fatal(err)
+		}
+		if value, err := store.Get("test_secret"); err != nil || value != secret {
+			t.Fatalf("get %q, %v", value, err)
+		}
+		if data, err := os.ReadFile(secretsPath); err != nil || bytes.Contains(data, []byte(secret)) {
+			t.Fatalf("secrets file must hold ciphertext only: %v", err)
+		}
+		if err := store.Delete("test_secret"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.Get("test_secret"); !errors.Is(err, service.ErrSecretNotFound) {
+			t.Fatalf("get after delete: %v", err)
+		}
+	})
+	t.Run("passphrase", func(t *testing.T) {
+		// 口令不同时无法解密
+		t.Setenv(service.PassphraseEnv, "first passphrase")
+		if err := store.Set("test_passphrase", secret); err != nil {
+			t.Fatal(err)
+		}
+		if value, err := store.Get("test_passphrase"); err != nil || value != secret {
+			t.Fatalf("get %q, %v", value, err)
+		}
+		t.Setenv(service.PassphraseEnv, "second passphrase")
+		if value, err := store.Get("test_passphrase"); err == nil {
+			t.Fatalf("decrypted %q with a wrong passphrase", value)
+		}
+		_ = store.Delete("test_passphrase")
+	})
+	t.Run("user data", func(t *testing.T) {
+		// ApiKey 不写入 data.json, 返回给前端的是脱敏后的值, 原样传回时不覆盖
+		data, err := service.GetUserData()
+		if err != nil {
+			t.Fatal(err)
+		}
+		prev := *data.Masked()
+		prev.ApiKey, _ = store.Get(service.SecretApiKey)
+		t.Cleanup(func() {
+			_ = data.SetUserData(&prev)
+			_ = data.StoreUserData()
+		})
+
+		if err = data.SetUserData(&service.UData{Model: "secret-model", ApiKey: secret}); err != nil {
+			t.Fatal(err)
+		}
+		if err = data.StoreUserData(); err != nil {
+			t.Fatal(err)
+		}
+		plain, err := os.ReadFile(filepath.Join(bootConf.CustomConfigDir, utils.UserDataFileName))
+		if err != nil || bytes.Contains(plain, []byte(secret)) {
+			t.Fatalf("data.json must not hold the api key: %v", err)
+		}
+		if value, err := store.Get(service.SecretApiKey); err != nil || value != secret {
+			t.Fatalf("stored key %q, %v", value, err)
+		}
+		masked := data.Masked()
+		if masked.ApiKey == secret || masked.ApiKey != service.MaskSecret(secret) {
+			t.Fatalf("masked key %q", masked.ApiKey)
+		}
+		if err = data.SetUserData(masked); err != nil {
+			t.Fatal(err)
+		}
+		if data.ApiKey != secret {
+			t.Fatalf("masked key overwrote the api key: %q", data.ApiKey)
+		}
+	})
+}
+
+func TestPromptLanguage(t *testing.T) {
+	_, conf, err := service.EnsureConfigInitialized()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(promptLang, lang string) { conf.PromptLanguage, conf.Language = promptLang, lang }(conf.PromptLanguage, conf.Language)
+
+	cases := []struct {
+		promptLang, lang, system string
+		want                     string
+	}{
+		{"en", "zh-CN", "zh_CN", "en"},
+		{"zh", "en", "en_US", "zh"},
+		{"", "en", "zh_CN", "en"}, // 界面语言优先于系统语言
+		{"", "zh-TW", "en_US", "zh"},
+		{"", "", "en_US", "en"},
+		{"", "", "zh_CN", "zh"},
+		{"", "", "C", "zh"},
+		{"", "fr", "en_US", "zh"}, // 设置了不支持的语言时不使用系统语言
+	}
+	for _, c := range cases {
+		if c.promptLang == "" && c.lang == "" && (runtime.GOOS == "windows" || runtime.GOOS == "darwin") {
+			// 系统语言不只取决于环境变量
+			continue
+		}
+		conf.PromptLanguage, conf.Language = c.promptLang, c.lang
+		t.Setenv("LC_ALL", c.system)
+		prompt, err := service.RenderPrompt(service.PromptSearch, service.NewPromptData(""))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(prompt.Version, "-"+c.want+"-") {
+			t.Errorf("prompt %q, language %q, system %q: version %s, want %s", c.promptLang, c.lang, c.system, prompt.Version, c.want)
+		}
+	}
+}
+
+func TestLLMUsageQuota(t *testing.T) {
+	usage := service.GetUsageTracker()
+	today := func() service.UsageTotals { return *usage.Daily(1)[0] }
+
+	t.Run("quota", func(t *testing.T) {
+		// 模拟接口每次返回 10 个输入 token 与 5 个输出 token
+		fake := startFakeLLM(t, service.UData{MonthlyTokenLimit: 30, PromptPrice: 2, CompletionPrice: 4},
+			func(int) (int, string) { return http.StatusOK, `{"Query":"report"}` })
+		data, _ := service.GetUserData()
+		before := today()
+		for i := 0; i < 2; i++ {
+			if _, err := service.ParseParamsFromLLM(context.Background(), fmt.Sprintf("qzx usage quota %d", i)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		after := today()
+		if after.Requests-before.Requests != 2 || after.TotalTokens-before.TotalTokens != 30 {
+			t.Fatalf("daily usage grew by %d requests and %d tokens", after.Requests-before.Requests, after.TotalTokens-before.TotalTokens)
+		}
+		status := usage.Quota(data)
+		if !status.Exceeded || status.UsedTokens != 30 || math.Abs(status.UsedCost-2*(10*2+5*4)/1e6) > 1e-12 {
+			t.Fatalf("quota %+v", status)
+		}
+
+		// 超出限额后不再请求模型
+		_, err := service.ParseParamsFromLLM(context.Background(), "qzx usage quota blocked")
+		if !errors.Is(err, service.ErrQuotaExceeded) || fake.calls() != 2 {
+			t.Fatalf("err %v after %d calls", err, fake.calls())
+		}
+
+		// 单独为该服务商提高限额后可以继续请求
+		conf := *data.Masked()
+		conf.ProviderQuotas = map[string]*service.ProviderQuota{service.LLMProvider(data): {MonthlyTokenLimit: 100}}
+		if err = data.SetUserData(&conf); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = service.ParseParamsFromLLM(context.Background(), "qzx usage quota raised"); err != nil || fake.calls() != 3 {
+			t.Fatalf("err %v after %d calls", err, fake.calls())
+		}
+	})
+	t.Run("failed request", func(t *testing.T) {
+		// 失败的请求只计入请求次数, 不占用限额
+		startFakeLLM(t, service.UData{MonthlyTokenLimit: 1}, func(int) (int, string) { return http.StatusBadRequest, "bad request" })
+		data, _ := service.GetUserData()
+		before := today()
+		if _, err := service.ParseParamsFromLLM(context.Background(), "qzx usage failed"); err == nil {
+			t.Fatal("the request should fail")
+		}
+		after := today()
+		if after.Requests-before.Requests != 1 || after.Failed-before.Failed != 1 || after.TotalTokens != before.TotalTokens {
+			t.Fatalf("before %+v, after %+v", before, after)
+		}
+		if status := usage.Quota(data); status.Exceeded || status.UsedTokens != 0 {
+			t.Fatalf("quota %+v", status)
+		}
+	})
+}
+
+func TestPrefetcher(t *testing.T) {
+	defer func(delay, interval time.Duration) {
+		service.PrefetchDelay, service.PrefetchInterval = delay, interval
+	}(service.PrefetchDelay, service.PrefetchInterval)
+	service.PrefetchDelay, service.PrefetchInterval = 10*time.Millisecond, time.Millisecond
+
+	// work 的上级文件夹, 打开过的 visited, 最近修改的 recent 与很久没有修改的 old
+	base := filepath.Join(t.TempDir(), "work")
+	old := time.Now().Add(-30 * 24 * time.Hour)
+	for _, name := range []string{"visited", "recent", "old"} {
+		if err := os.MkdirAll(filepath.Join(base, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if name != "recent" {
+			if err := os.Chtimes(filepath.Join(base, name), old, old); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	readDir := func(path string) *service.DirContent {
+		dirCnt := service.NewDirContent()
+		if err := dirCnt.GetDirCnt(path); err != nil {
+			t.Fatal(err)
+		}
+		return dirCnt
+	}
+	cache := service.GetPathCache()
+	waitCached := func(paths ...string) {
+		t.Helper()
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+			cached := 0
+			for _, path := range paths {
+				if cache.Contains(path) {
+					cached++
+				}
+			}
+			if cached == len(paths) {
+				return
+			}
+		}
+		t.Fatalf("%v were not prefetched", paths)
+	}
+
+	prefetcher := service.GetPrefetcher()
+	defer prefetcher.Configure(nil)
+	prefetcher.Configure(&service.AppConfig{PrefetchDirs: 2})
+	prefetcher.Visit(readDir(filepath.Join(base, "visited")))
+	waitCached(base)
+	prefetcher.Stop()
+
+	// 打开过的子文件夹与上级文件夹优先, 超出数量的 recent 与很久没有修改的 old 不预取
+	prefetcher.Visit(readDir(base))
+	waitCached(filepath.Join(base, "visited"), filepath.Dir(base))
+	time.Sleep(50 * time.Millisecond)
+	for _, name := range []string{"recent", "old"} {
+		if cache.Contains(filepath.Join(base, name)) {
+			t.Errorf("%s should not be prefetched", name)
+		}
+	}
+
+	// 离开文件夹后尚未开始的预取被取消
+	prefetcher.Configure(&service.AppConfig{PrefetchDirs: 4})
+	service.PrefetchDelay = 50 * time.Millisecond
+	prefetcher.Visit(readDir(base))
+	prefetcher.Stop()
+	time.Sleep(150 * time.Millisecond)
+	if cache.Contains(filepath.Join(base, "recent")) {
+		t.Error("a cancelled prefetch still loaded folders")
+	}
+}
+
+func TestCacheSnapshot(t *testing.T) {
+	_, appConf, err := service.EnsureConfigInitialized()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(enabled bool) { appConf.CacheSnapshot = enabled }(appConf.CacheSnapshot)
+	appConf.CacheSnapshot = true
+
+	base := t.TempDir()
+	var dirs []string
+	for _, name := range []string{"same", "changed"} {
+		dir := filepath.Join(base, name)
+		if err = os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err = os.WriteFile(filepath.Join(dir, "a.txt"), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		dirs = append(dirs, dir)
+	}
+	cache := service.GetPathCache()
+	for _, dir := range dirs {
+		dirCnt := service.NewDirContent()
+		if err = dirCnt.GetDirCnt(dir); err != nil {
+			t.Fatal(err)
+		}
+		if err = cache.Put(dirCnt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer func() {
+		for _, dir := range dirs {
+			cache.Remove(dir)
+		}
+	}()
+	// restart 模拟退出后重新启动: 保存快照, 清空这些条目后从快照恢复
+	restart := func() {
+		t.Helper()
+		if err := cache.SaveSnapshot(); err != nil {
+			t.Fatal(err)
+		}
+		for _, dir := range dirs {
+			cache.Remove(dir)
+		}
+		if err := cache.LoadSnapshot(); err != nil {
+			t.Fatal(err)
+		}
+		for _, dir := range dirs {
+			if !cache.Contains(dir) {
+				t.Fatalf("%s was not restored", dir)
+			}
+		}
+	}
+	restart()
+	// 尚未核对过的恢复条目同样写入快照
+	restart()
+
+	// 文件夹在退出期间被修改, 第一次命中时发现并重新读取
+	later := time.Now().Add(time.Hour)
+	if err = os.Chtimes(dirs[1], later, later); err != nil {
+		t.Fatal(err)
+	}
+	if dirCnt, ok := cache.Get(dirs[0]); !ok || dirCnt.Files["a.txt"] == nil {
+		t.Fatalf("unchanged folder should hit: %v", ok)
+	}
+	if _, ok := cache.Get(dirs[1]); ok {
+		t.Fatal("changed folder should miss")
+	}
+	if cache.Contains(dirs[1]) {
+		t.Fatal("changed folder should be discarded")
+	}
+}
+
+func TestTrashRestore(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("only the freedesktop.org trash can be redirected to a temporary folder")
+	}
+	base := t.TempDir()
+	file := filepath.Join(base, "a.txt")
+	folder := filepath.Join(base, "docs")
+	if err := os.MkdirAll(folder, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for path, content := range map[string]string{file: "a", filepath.Join(folder, "b.txt"): "b"} {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	before := readTree(t, base)
+
+	var items []*service.TrashItem
+	for _, path := range []string{file, folder} {
+		item, err := service.MoveToTrash(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if item.OriginalPath != path {
+			t.Fatalf("original path %s, want %s", item.OriginalPath, path)
+		}
+		if _, err = os.Lstat(path); !os.IsNotExist(err) {
+			t.Fatalf("%s still exists: %v", path, err)
+		}
+		items = append(items, item)
+	}
+	listed, err := service.ListTrash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := make(map[string]*service.TrashItem)
+	for _, item := range listed {
+		found[item.ID] = item
+	}
+	for _, item := range items {
+		if listed := found[item.ID]; listed == nil || listed.OriginalPath != item.OriginalPath || listed.IsDir != (item.OriginalPath == folder) {
+			t.Fatalf("%s not listed correctly: %+v", item.OriginalPath, listed)
+		}
+	}
+
+	// 原位置被占用时不覆盖
+	if err = os.WriteFile(file, []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = service.RestoreTrashItem(items[0].ID); !errors.Is(err, service.ErrTrashConflict) {
+		t.Fatalf("restore onto an existing file: %v", err)
+	}
+	if err = os.Remove(file); err != nil {
+		t.Fatal(err)
+	}
+	for _, item := range items {
+		if path, err := service.RestoreTrashItem(item.ID); err != nil || path != item.OriginalPath {
+			t.Fatalf("restored to %s, %v", path, err)
+		}
+	}
+	if after := readTree(t, base); fmt.Sprint(after) != fmt.Sprint(before) {
+		t.Fatalf("after restore %v, want %v", after, before)
+	}
+	if _, err = service.RestoreTrashItem(items[0].ID); err == nil {
+		t.Fatal("restoring twice should fail")
+	}
+
+	// 彻底删除后不再出现在回收站中
+	item, err := service.MoveToTrash(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = service.DeleteTrashItem(item.ID); err != nil {
+		t.Fatal(err)
+	}
+	if listed, _ = service.ListTrash(); slices.ContainsFunc(listed, func(i *service.TrashItem) bool { return i.ID == item.ID }) {
+		t.Fatal("deleted item is still listed")
+	}
+}
+
+func TestPreviewEncoding(t *testing.T) {
+	defer func(n int) { service.PreviewTextBytes = n }(service.PreviewTextBytes)
+	service.PreviewTextBytes = 64
+
+	text := "你好, GoSearch"
+	gb, err := simplifiedchinese.GB18030.NewEncoder().String("中文文本预览, 编码识别")
+	if err != nil {
+		t.Fatal(err)
+	}
+	utf16LE := func(s string, bom bool) []byte {
+		var res []byte
+		if bom {
+			res = append(res, 0xFF, 0xFE)
+		}
+		for _, unit := range utf16.Encode([]rune(s)) {
+			res = append(res, byte(unit), byte(unit>>8))
+		}
+		return res
+	}
+	utf16BE := func(s string) []byte {
+		var res []byte
+		for _, unit := range utf16.Encode([]rune(s)) {
+			res = append(res, byte(unit>>8), byte(unit))
+		}
+		return res
+	}
+	long := strings.Repeat("文", 30) // 90 字节, 截断在第 64 字节处的字符中间
+
+	cases := []struct {
+		name     string
+		data     []byte
+		kind     string
+		encoding string
+		text     string
+	}{
+		{"utf8.txt", []byte(text), service.PreviewText, "utf-8", text},
+		{"bom.txt", append([]byte{0xEF, 0xBB, 0xBF}, text...), service.PreviewText, "utf-8", text},
+		{"utf16le.txt", utf16LE(text, true), service.PreviewText, "utf-16le", text},
+		{"utf16le-nobom.txt", utf16LE("plain ascii text", false), service.PreviewText, "utf-16le", "plain ascii text"},
+		{"utf16be-nobom.txt", utf16BE("plain ascii text"), service.PreviewText, "utf-16be", "plain ascii text"},
+		{"gb18030.txt", []byte(gb), service.PreviewText, "gb18030", "中文文本预览, 编码识别"},
+		{"truncated.txt", []byte(long), service.PreviewText, "utf-8", strings.Repeat("文", 21)},
+		{"binary.bin", []byte{0x7F, 'E', 'L', 'F', 2, 1, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0}, service.PreviewHex, "", ""},
+	}
+	dir := t.TempDir()
+	for _, c := range cases {
+		path := filepath.Join(dir, c.name)
+		if err = os.WriteFile(path, c.data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		preview, err := service.GetPreview(context.Background(), path)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if preview.Kind != c.kind || preview.Encoding != c.encoding {
+			t.Errorf("%s: kind %s, encoding %s, want %s, %s", c.name, preview.Kind, preview.Encoding, c.kind, c.encoding)
+			continue
+		}
+		if c.kind != service.PreviewText {
+			continue
+		}
+		recorder := httptest.NewRecorder()
+		service.GetPreviewStore().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, preview.URL, nil))
+		if got := recorder.Body.String(); got != c.text {
+			t.Errorf("%s: text %q, want %q", c.name, got, c.text)
+		}
+		if preview.Truncated != (len(c.data) > service.PreviewTextBytes) {
+			t.Errorf("%s: truncated %v", c.name, preview.Truncated)
+		}
+	}
+}
+
+func TestProperties(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "a.txt")
+	if err := os.WriteFile(file, []byte("hello\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 3, 2))); err != nil {
+		t.Fatal(err)
+	}
+	picture := filepath.Join(dir, "b.png")
+	if err := os.WriteFile(picture, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	props, err := service.GetProperties(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if props.Name != "a.txt" || props.IsDir || props.Size != 6 || !strings.HasPrefix(props.MimeType, "text/plain") {
+		t.Fatalf("file properties %+v", props)
+	}
+	if runtime.GOOS != "windows" {
+		if err = os.Chmod(file, 0640); err != nil {
+			t.Fatal(err)
+		}
+		if props, err = service.GetProperties(file); err != nil {
+			t.Fatal(err)
+		}
+		if props.Permissions != "-rw-r-----" || props.Octal != "0640" || props.Owner == "" || props.HardLinks != 1 {
+			t.Fatalf("unix properties %+v", props)
+		}
+	}
+	if props, err = service.GetProperties(dir); err != nil || !props.IsDir || props.MimeType != "inode/directory" {
+		t.Fatalf("folder properties %+v, %v", props, err)
+	}
+	if props, err = service.GetProperties(picture); err != nil || props.Image == nil ||
+		props.Image.Width != 3 || props.Image.Height != 2 || props.Image.Format != "png" {
+		t.Fatalf("image properties %+v, %v", props, err)
+	}
+
+	// 符号链接显示目标的属性, 目标不存在时显示链接本身
+	link := filepath.Join(dir, "link")
+	if err = os.Symlink(file, link); err == nil {
+		if props, err = service.GetProperties(link); err != nil || !props.IsSymlink || props.LinkTarget != file || props.Size != 6 {
+			t.Fatalf("link properties %+v, %v", props, err)
+		}
+		dangling := filepath.Join(dir, "dangling")
+		if err = os.Symlink(filepath.Join(dir, "missing"), dangling); err != nil {
+			t.Fatal(err)
+		}
+		if props, err = service.GetProperties(dangling); err != nil || !props.IsSymlink || props.MimeType != "inode/symlink" {
+			t.Fatalf("dangling link properties %+v, %v", props, err)
+		}
+	}
+
+	hashes, err := service.ComputeHashes(context.Background(), file, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		service.HashMD5:    "b1946ac92492d2347c6235b4d2611184",
+		service.HashSHA1:   "f572d396fae9206628714fb2ce00f72e94f2258f",
+		service.HashSHA256: "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03",
+	}
+	if fmt.Sprint(hashes) != fmt.Sprint(want) {
+		t.Fatalf("hashes %v, want %v", hashes, want)
+	}
+	if _, err = service.ComputeHashes(context.Background(), file, []string{"crc32"}); err == nil {
+		t.Fatal("unsupported algorithm accepted")
+	}
+	if _, err = service.ComputeHashes(context.Background(), dir, nil); err == nil {
+		t.Fatal("hashed a folder")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = service.ComputeHashes(ctx, file, nil); !errors.Is(err, context.Canceled) {
+		t.Fatalf("canceled hash: %v", err)
+	}
+}
+
+func TestOpener(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("fake xdg-open and desktop files are only used on Linux")
+	}
+	dir := t.TempDir()
+	bin, data, config := filepath.Join(dir, "bin"), filepath.Join(dir, "data"), filepath.Join(dir, "config")
+	apps := filepath.Join(data, "applications")
+	for _, d := range []string{bin, apps, config} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files := map[string]string{
+		// xdg-open 对 missing 开头的文件按"没有可用的程序"退出, 其余记录收到的环境变量
+		filepath.Join(bin, "xdg-open"):    "#!/bin/sh\ncase \"$(basename \"$1\")\" in missing*) exit 3;; esac\nenv > \"$1.env\"\n",
+		filepath.Join(bin, "fake-editor"): "#!/bin/sh\nprintf '%s\\n' \"$PWD\" \"$@\" > \"$2.args\"\n",
+		filepath.Join(apps, "fake.desktop"): "[Desktop Entry]\nType=Application\nName=Fake Editor\n" +
+			"Exec=fake-editor --new-window %f\nMimeType=text/plain;\n",
+		filepath.Join(apps, "another.desktop"): "[Desktop Entry]\nType=Application\nName=Another\nExec=another\nMimeType=text/*;\n",
+		filepath.Join(apps, "hidden.desktop"): "[Desktop Entry]\nType=Application\nName=Hidden\nExec=hidden\n" +
+			"MimeType=text/plain;\nNoDisplay=true\n",
+		filepath.Join(config, "mimeapps.list"): "[Default Applications]\ntext/plain=missing.desktop;fake.desktop;\n",
+	}
+	for path, content := range files {
+		if err := os.WriteFile(path, []byte(content), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("XDG_DATA_HOME", data)
+	t.Setenv("XDG_DATA_DIRS", filepath.Join(dir, "none"))
+	t.Setenv("XDG_CONFIG_HOME", config)
+	t.Setenv("XDG_CONFIG_DIRS", filepath.Join(dir, "none"))
+	t.Setenv("XDG_CURRENT_DESKTOP", "")
+	t.Setenv("WEBKIT_DISABLE_COMPOSITING_MODE", "1")
+	t.Setenv("DESKTOP_STARTUP_ID", "gosearch-test")
+	t.Setenv("GOSEARCH_TEST_KEEP", "1")
+
+	docs := filepath.Join(dir, "docs")
+	if err := os.Mkdir(docs, 0755); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(docs, "a.txt")
+	if err := os.WriteFile(file, []byte("hello\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	waitFile := func(path string) string {
+		for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(20 * time.Millisecond) {
+			if content, err := os.ReadFile(path); err == nil && len(content) > 0 {
+				return string(content)
+			}
+		}
+		t.Fatalf("%s was not written", path)
+		return ""
+	}
+
+	// 默认应用在最前, 未安装的默认应用与 NoDisplay 的应用不列出
+	list, err := service.ListApplications(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, app := range list {
+		ids = append(ids, fmt.Sprintf("%s:%v", app.ID, app.Default))
+	}
+	if fmt.Sprint(ids) != "[fake.desktop:true another.desktop:false]" {
+		t.Fatalf("applications %v", ids)
+	}
+
+	// 子进程不继承 WebView 参数与启动通知标识
+	if err = service.OpenPath(file); err != nil {
+		t.Fatal(err)
+	}
+	env := waitFile(file + ".env")
+	if strings.Contains(env, "WEBKIT_") || strings.Contains(env, "DESKTOP_STARTUP_ID") || !strings.Contains(env, "GOSEARCH_TEST_KEEP=1") {
+		t.Fatalf("opener environment:\n%s", env)
+	}
+
+	// 指定应用时展开 Exec 的字段代码, 工作目录为文件所在的文件夹
+	if err = service.OpenWith(file, "fake.desktop"); err != nil {
+		t.Fatal(err)
+	}
+	if args := waitFile(file + ".args"); args != docs+"\n--new-window\n"+file+"\n" {
+		t.Fatalf("open with arguments:\n%s", args)
+	}
+	if err = service.OpenWith(file, "missing.desktop"); !errors.Is(err, service.ErrAppNotFound) {
+		t.Fatalf("open with a missing application: %v", err)
+	}
+
+	// 启动后很快失败退出的通过监听函数通知
+	failures := make(chan *service.OpenFailure, 1)
+	service.SetOpenerListener(func(failure *service.OpenFailure) { failures <- failure })
+	t.Cleanup(func() { service.SetOpenerListener(nil) })
+	if err = service.OpenPath(filepath.Join(docs, "missing.bin")); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case failure := <-failures:
+		if failure.Program != "xdg-open" || !strings.Contains(failure.Error, "could not find a program") {
+			t.Fatalf("open failure %+v", failure)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("open failure was not reported")
+	}
+}
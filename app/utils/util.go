@@ -9,6 +9,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"unicode/utf16"
 )
 
 /*
@@ -102,3 +103,48 @@ func UnmarshalJSON(response string, instance interface{}) error {
 	}
 	return nil
 }
+
+// windowsReservedNames Windows保留的设备名, 带扩展名时同样不可用(例如 con.txt)
+var windowsReservedNames = map[string]struct{}{
+	"CON": {}, "PRN": {}, "AUX": {}, "NUL": {},
+	"COM1": {}, "COM2": {}, "COM3": {}, "COM4": {}, "COM5": {}, "COM6": {}, "COM7": {}, "COM8": {}, "COM9": {},
+	"LPT1": {}, "LPT2": {}, "LPT3": {}, "LPT4": {}, "LPT5": {}, "LPT6": {}, "LPT7": {}, "LPT8": {}, "LPT9": {},
+}
+
+// ValidateFileName 按操作系统检查单个文件名(不含路径): 非法字符、保留名称与长度限制
+func ValidateFileName(os string, name string) error {
+	if name == "" || name == "." || name == ".." {
+		return fmt.Errorf("invalid name %q", name)
+	}
+	if strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("name %q must not contain path separators", name)
+	}
+	for _, r := range name {
+		if r < 0x20 {
+			return fmt.Errorf("name %q must not contain control characters", name)
+		}
+	}
+	length := len(name)
+	switch os {
+	case WINDOWS:
+		length = len(utf16.Encode([]rune(name)))
+		if strings.ContainsAny(name, `<>:"|?*`) {
+			return fmt.Errorf(`name %q must not contain any of <>:"|?*`, name)
+		}
+		if strings.HasSuffix(name, ".") || strings.HasSuffix(name, " ") {
+			return fmt.Errorf("name %q must not end with a dot or space", name)
+		}
+		base := strings.ToUpper(strings.TrimSpace(strings.SplitN(name, ".", 2)[0]))
+		if _, ok := windowsReservedNames[base]; ok {
+			return fmt.Errorf("name %q is reserved by Windows", name)
+		}
+	case MAC:
+		if strings.Contains(name, ":") {
+			return fmt.Errorf("name %q must not contain ':'", name)
+		}
+	}
+	if length > MaxNameLength {
+		return fmt.Errorf("name %q is too long (max %d)", name, MaxNameLength)
+	}
+	return nil
+}
@@ -133,6 +133,7 @@ const resources = {
             "Current path, editable": "Current path, editable",
             "Retrieve Description": "Retrieve Description",
             "Open": "Open",
+            "Failed to open: {{message}}": "Failed to open: {{message}}",
             "Copy Path": "Copy Path",
             "Rename": "Rename",
             "Delete": "Delete",
@@ -166,6 +167,7 @@ const resources = {
 
             "LLM Configuration": "LLM Configuration",
             "Enter your LLM API Key": "Enter your LLM API Key",
+            "The API key is encrypted with a key file stored on this computer. Set GOSEARCH_SECRET_PASSPHRASE or enable a system keyring to protect it.": "The API key is encrypted with a key file stored on this computer. Set GOSEARCH_SECRET_PASSPHRASE or enable a system keyring to protect it.",
             "API Key": "API Key",
             "Model Name": "Model Name",
             "e.g., gpt-3.5-turbo, claude-2": "e.g., gpt-3.5-turbo, claude-2",
@@ -301,6 +303,7 @@ const resources = {
             "Current path, editable": "当前路径",
             "Retrieve Description": "查看检索说明",
             "Open": "打开",
+            "Failed to open: {{message}}": "打开失败: {{message}}",
             "Copy Path": "复制路径",
             "Rename": "重命名",
             "Delete": "删除",
@@ -335,6 +338,7 @@ const resources = {
             "LLM Configuration": "大模型配置",
             "API Key": "API Key",
             "Enter your LLM API Key": "输入API KEY",
+            "The API key is encrypted with a key file stored on this computer. Set GOSEARCH_SECRET_PASSPHRASE or enable a system keyring to protect it.": "API Key 使用保存在本机的口令文件加密, 能读取配置目录的程序都可以解密. 请设置 GOSEARCH_SECRET_PASSPHRASE 环境变量或启用系统密钥环.",
             "Model Name": "模型名称",
             "e.g., gpt-3.5-turbo, claude-2": "例如, gpt-3.5-turbo, claude-2",
             "Base URL": "Base URL",
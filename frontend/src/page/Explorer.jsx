@@ -12,6 +12,7 @@ import { useNavigation } from '../hooks/useNavigation';
 import { useSearch } from '../hooks/useSearch';
 import FileIcon from "../components/FileIcon.jsx";
 import { OpenFile } from "../../wailsjs/go/controller/FileController"
+import { EventsOn, EventsOff } from "../../wailsjs/runtime/runtime";
 import PreviewModal from "../components/PreviewModel.jsx";
 
 const ITEM_HEIGHT = 40;
@@ -60,6 +61,15 @@ function Explorer(callback, deps) {
         loadData('');
     }, [loadData])
 
+    // 打开文件的程序启动后很快失败退出时, 后端通过 open_failed 事件通知
+    useEffect(() => {
+        const handleOpenFailed = (failure) => {
+            toast.error(t("Failed to open: {{message}}", { message: failure.error }));
+        };
+        EventsOn("open_failed", handleOpenFailed);
+        return () => EventsOff("open_failed");
+    }, [t])
+
     // --- 事件处理器 ---
     const handleDiskClick = useCallback((item) => {
         if (item.device && item.device !== currentPath) {
@@ -204,6 +204,9 @@ function SettingsPage({ currentTheme, onChangeTheme, initialAppConfig, setInitia
                             // disabled={isSavingUserData || isLoading}
                         />
                     </div>
+                    {userData?.secret_warning && (
+                        <p className="settings-note">{t(userData.secret_warning)}</p>
+                    )}
                     <div className="settings-form-group">
                         <label htmlFor="llmModel">{t('Model Name')}:</label>
                         <input